@@ -0,0 +1,13 @@
+package agents_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestAgents(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Agents Suite")
+}
@@ -0,0 +1,111 @@
+package agents
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+)
+
+// Client talks to the agent API of a Woodhouse server.
+type Client struct {
+	ServerURL         string
+	RegistrationToken string
+	HTTPClient        *http.Client
+}
+
+func NewClient(serverURL, registrationToken string) *Client {
+	return &Client{
+		ServerURL:         strings.TrimSuffix(serverURL, "/"),
+		RegistrationToken: registrationToken,
+		HTTPClient:        &http.Client{},
+	}
+}
+
+func (c *Client) Register(name string, labels []string) (Credentials, error) {
+	body, err := json.Marshal(registration{Name: name, Labels: labels})
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	var creds Credentials
+	if err := c.do(context.Background(), "POST", "/agent-api/agents", c.RegistrationToken, bytes.NewReader(body), &creds); err != nil {
+		return Credentials{}, fmt.Errorf("registering agent. Cause: %v", err)
+	}
+	return creds, nil
+}
+
+// Heartbeat tells the server that the agent is alive, and returns whether the
+// agent has been disabled.
+func (c *Client) Heartbeat(creds Credentials) (bool, error) {
+	var resp heartbeatResponse
+	err := c.do(context.Background(), "PUT", fmt.Sprintf("/agent-api/agents/%s/heartbeat", creds.AgentID), creds.Secret, nil, &resp)
+	return resp.Disabled, err
+}
+
+// Poll waits for builds to run or stop. It returns ErrUnknownAgent when the
+// server has forgotten the agent, which then needs to register again.
+func (c *Client) Poll(ctx context.Context, creds Credentials, freeSlots int) (Work, error) {
+	var work Work
+	err := c.do(ctx, "GET", fmt.Sprintf("/agent-api/agents/%s/work?slots=%d", creds.AgentID, freeSlots), creds.Secret, nil, &work)
+	return work, err
+}
+
+// SendOutput streams output to the server until output is exhausted.
+func (c *Client) SendOutput(creds Credentials, buildID string, output io.Reader) error {
+	return c.do(context.Background(), "POST", fmt.Sprintf("/agent-api/agents/%s/builds/%s/output", creds.AgentID, buildID), creds.Secret, output, nil)
+}
+
+func (c *Client) RecordRevision(creds Credentials, buildID string, revision jobs.Revision) error {
+	body, err := json.Marshal(revision)
+	if err != nil {
+		return err
+	}
+	return c.do(context.Background(), "POST", fmt.Sprintf("/agent-api/agents/%s/builds/%s/revisions", creds.AgentID, buildID), creds.Secret, bytes.NewReader(body), nil)
+}
+
+func (c *Client) Finish(creds Credentials, buildID string, exitStatus uint32) error {
+	body, err := json.Marshal(buildResult{ExitStatus: exitStatus})
+	if err != nil {
+		return err
+	}
+	return c.do(context.Background(), "PUT", fmt.Sprintf("/agent-api/agents/%s/builds/%s/status", creds.AgentID, buildID), creds.Secret, bytes.NewReader(body), nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path, token string, body io.Reader, result interface{}) error {
+	req, err := http.NewRequest(method, c.ServerURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		switch strings.TrimSpace(string(message)) {
+		case ErrUnknownAgent.Error():
+			return ErrUnknownAgent
+		case ErrUnknownBuild.Error():
+			return ErrUnknownBuild
+		case ErrUnauthorized.Error():
+			return ErrUnauthorized
+		}
+		return fmt.Errorf("%s %s returned %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,175 @@
+package agents
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+
+	"github.com/gorilla/mux"
+)
+
+// Handler serves the API that build agents use to register with the server,
+// poll for builds, and report on them. Agents register with the registration
+// token, and authenticate every other request with their own credentials.
+type Handler struct {
+	*mux.Router
+
+	// How long a poll for work is held open when there is nothing to do
+	PollTimeout time.Duration
+
+	pool *Pool
+}
+
+type registration struct {
+	Name   string
+	Labels []string
+}
+
+type heartbeatResponse struct {
+	Disabled bool
+}
+
+type buildResult struct {
+	ExitStatus uint32
+}
+
+func NewHandler(pool *Pool) *Handler {
+	h := &Handler{
+		Router:      mux.NewRouter(),
+		PollTimeout: time.Second * 30,
+		pool:        pool,
+	}
+
+	h.HandleFunc("/agent-api/agents", h.register).Methods("POST")
+	h.HandleFunc("/agent-api/agents/{agentId}/heartbeat", h.authenticated(h.heartbeat)).Methods("PUT")
+	h.HandleFunc("/agent-api/agents/{agentId}/work", h.authenticated(h.poll)).Methods("GET")
+	h.HandleFunc("/agent-api/agents/{agentId}/builds/{buildId}/output", h.authenticated(h.receiveOutput)).Methods("POST")
+	h.HandleFunc("/agent-api/agents/{agentId}/builds/{buildId}/revisions", h.authenticated(h.receiveRevision)).Methods("POST")
+	h.HandleFunc("/agent-api/agents/{agentId}/builds/{buildId}/status", h.authenticated(h.receiveStatus)).Methods("PUT")
+
+	return h
+}
+
+func (h *Handler) register(w http.ResponseWriter, r *http.Request) {
+	var reg registration
+	if err := json.NewDecoder(r.Body).Decode(&reg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	creds, err := h.pool.Register(bearerToken(r), reg.Name, reg.Labels)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, creds)
+}
+
+func (h *Handler) authenticated(handle http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		creds := Credentials{AgentID: mux.Vars(r)["agentId"], Secret: bearerToken(r)}
+		if err := h.pool.Authenticate(creds); err != nil {
+			writeError(w, err)
+			return
+		}
+		handle(w, r)
+	}
+}
+
+func (h *Handler) heartbeat(w http.ResponseWriter, r *http.Request) {
+	disabled, err := h.pool.Heartbeat(mux.Vars(r)["agentId"])
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, heartbeatResponse{Disabled: disabled})
+}
+
+func (h *Handler) poll(w http.ResponseWriter, r *http.Request) {
+	freeSlots, err := strconv.Atoi(r.URL.Query().Get("slots"))
+	if err != nil {
+		http.Error(w, "slots must be a number", http.StatusBadRequest)
+		return
+	}
+
+	work, err := h.pool.Poll(r.Context(), mux.Vars(r)["agentId"], freeSlots, h.PollTimeout)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, work)
+}
+
+func (h *Handler) receiveOutput(w http.ResponseWriter, r *http.Request) {
+	output, err := h.pool.Output(mux.Vars(r)["agentId"], mux.Vars(r)["buildId"])
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if _, err := io.Copy(output, r.Body); err != nil {
+		log.Printf("error receiving output of build %s: %v\n", mux.Vars(r)["buildId"], err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) receiveRevision(w http.ResponseWriter, r *http.Request) {
+	var revision jobs.Revision
+	if err := json.NewDecoder(r.Body).Decode(&revision); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.pool.RecordRevision(mux.Vars(r)["agentId"], mux.Vars(r)["buildId"], revision); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) receiveStatus(w http.ResponseWriter, r *http.Request) {
+	var result buildResult
+	if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.pool.Finish(mux.Vars(r)["agentId"], mux.Vars(r)["buildId"], result.ExitStatus); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func bearerToken(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrUnknownAgent, ErrUnknownBuild:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case ErrUnauthorized:
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	default:
+		log.Printf("agent API error: %v\n", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("error writing response: %v\n", err)
+	}
+}
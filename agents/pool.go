@@ -0,0 +1,447 @@
+package agents
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+
+	"github.com/pborman/uuid"
+)
+
+var ErrUnknownAgent = errors.New("unknown agent")
+var ErrUnknownBuild = errors.New("unknown build")
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Agent is a snapshot of a registered build agent.
+type Agent struct {
+	ID       string
+	Name     string
+	Labels   []string
+	LastSeen time.Time
+	Builds   []string
+
+	// Disabled agents finish their running builds but are given no new ones
+	Disabled bool
+}
+
+// Credentials are issued to each agent when it registers.
+type Credentials struct {
+	AgentID string
+	Secret  string
+}
+
+// Work is handed to an agent when it polls.
+type Work struct {
+	// Builds the agent should start
+	Assignments []Assignment
+
+	// Builds assigned to the agent earlier that it should stop
+	Cancelled []string
+}
+
+type Assignment struct {
+	BuildID string
+	Job     jobs.Job
+}
+
+type agent struct {
+	id         string
+	name       string
+	secretHash string
+	labels     []string
+	lastSeen   time.Time
+	builds     map[string]*build
+}
+
+type build struct {
+	id        string
+	job       jobs.Job
+	output    io.WriteCloser
+	status    chan<- uint32
+	agent     *agent
+	cancelled bool
+	notified  bool
+	finished  bool
+}
+
+// Pool is a jobs.Runner that queues builds until an agent with the labels
+// required by the job polls for work.
+type Pool struct {
+	// Agents that have not sent a heartbeat for this long are considered
+	// lost, and their builds are failed.
+	AgentTimeout time.Duration
+
+	RegistrationToken RegistrationToken
+
+	mutex   sync.Mutex
+	agents  map[string]*agent
+	queue   []*build
+	builds  map[string]*build
+	changed chan struct{}
+
+	// By agent name, so that it survives an agent registering again
+	disabled map[string]bool
+}
+
+func NewPool(agentTimeout time.Duration, registrationToken RegistrationToken) *Pool {
+	p := &Pool{
+		AgentTimeout:      agentTimeout,
+		RegistrationToken: registrationToken,
+		agents:            make(map[string]*agent),
+		builds:            make(map[string]*build),
+		changed:           make(chan struct{}),
+		disabled:          make(map[string]bool),
+	}
+
+	go func() {
+		for range time.Tick(agentTimeout / 2) {
+			p.RemoveLostAgents()
+		}
+	}()
+	return p
+}
+
+func (p *Pool) Run(ctx context.Context, job jobs.Job, outputDest io.WriteCloser, status chan<- uint32) error {
+	if job.Command == "" {
+		return fmt.Errorf("No arguments could be parsed from command: %s", job.Command)
+	}
+
+	// Agents cannot reach the artifacts kept on the server
+	upstreamBuilds := job.UpstreamBuilds
+	job.UpstreamBuilds = nil
+	for _, upstream := range upstreamBuilds {
+		upstream.ArtifactsDir = ""
+		job.UpstreamBuilds = append(job.UpstreamBuilds, upstream)
+	}
+
+	// Agents run the job with their own runners
+	if job.DockerImage != "" || job.Dockerfile != "" {
+		job.RunnerType = jobs.RunnerContainer
+	} else {
+		job.RunnerType = jobs.RunnerLocal
+	}
+
+	b := &build{id: uuid.New(), job: job, output: outputDest, status: status}
+	fmt.Fprintf(outputDest, "Waiting for an agent with labels %v\n", job.AgentLabels)
+
+	p.mutex.Lock()
+	p.queue = append(p.queue, b)
+	p.builds[b.id] = b
+	p.notifyPollers()
+	p.mutex.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		p.cancel(b)
+	}()
+	return nil
+}
+
+func (p *Pool) Register(registrationToken, name string, labels []string) (Credentials, error) {
+	if err := p.RegistrationToken.Check(registrationToken); err != nil {
+		return Credentials{}, err
+	}
+
+	secret, err := randomSecret()
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	a := &agent{
+		id:         uuid.New(),
+		name:       name,
+		secretHash: hashSecret(secret),
+		labels:     labels,
+		lastSeen:   time.Now(),
+		builds:     make(map[string]*build),
+	}
+	p.agents[a.id] = a
+	log.Printf("agent %s (%s) registered with labels %v\n", a.id, name, labels)
+	return Credentials{AgentID: a.id, Secret: secret}, nil
+}
+
+func (p *Pool) Authenticate(creds Credentials) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	a, ok := p.agents[creds.AgentID]
+	if !ok {
+		return ErrUnknownAgent
+	}
+	if !secretsEqual(a.secretHash, hashSecret(creds.Secret)) {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// Heartbeat records that an agent is alive, and returns whether it is
+// disabled.
+func (p *Pool) Heartbeat(agentID string) (bool, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	a, ok := p.agents[agentID]
+	if !ok {
+		return false, ErrUnknownAgent
+	}
+	a.lastSeen = time.Now()
+	return p.disabled[a.name], nil
+}
+
+func (p *Pool) SetDisabled(agentID string, disabled bool) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	a, ok := p.agents[agentID]
+	if !ok {
+		return ErrUnknownAgent
+	}
+	if disabled {
+		p.disabled[a.name] = true
+	} else {
+		delete(p.disabled, a.name)
+	}
+	p.notifyPollers()
+	return nil
+}
+
+func (p *Pool) RotateRegistrationToken() error {
+	return p.RegistrationToken.Rotate()
+}
+
+// Poll waits up to timeout for work for an agent with the given number of
+// free build slots.
+func (p *Pool) Poll(ctx context.Context, agentID string, freeSlots int, timeout time.Duration) (Work, error) {
+	deadline := time.After(timeout)
+	for {
+		p.mutex.Lock()
+		a, ok := p.agents[agentID]
+		if !ok {
+			p.mutex.Unlock()
+			return Work{}, ErrUnknownAgent
+		}
+
+		work := p.collectWork(a, freeSlots)
+		changed := p.changed
+		p.mutex.Unlock()
+
+		if len(work.Assignments) > 0 || len(work.Cancelled) > 0 {
+			return work, nil
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return work, nil
+		case <-ctx.Done():
+			return work, nil
+		}
+	}
+}
+
+func (p *Pool) collectWork(a *agent, freeSlots int) Work {
+	work := Work{Assignments: []Assignment{}, Cancelled: []string{}}
+
+	for _, b := range a.builds {
+		if b.cancelled && !b.notified {
+			b.notified = true
+			work.Cancelled = append(work.Cancelled, b.id)
+		}
+	}
+
+	if p.disabled[a.name] {
+		freeSlots = 0
+	}
+
+	remaining := []*build{}
+	for _, b := range p.queue {
+		if len(work.Assignments) < freeSlots && hasLabels(a.labels, b.job.AgentLabels) {
+			b.agent = a
+			a.builds[b.id] = b
+			work.Assignments = append(work.Assignments, Assignment{BuildID: b.id, Job: b.job})
+			fmt.Fprintf(b.output, "Running on agent %s\n", a.id)
+		} else {
+			remaining = append(remaining, b)
+		}
+	}
+	p.queue = remaining
+	return work
+}
+
+// Output returns the destination for output of a build assigned to an agent.
+func (p *Pool) Output(agentID, buildID string) (io.Writer, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	b, err := p.assignedBuild(agentID, buildID)
+	if err != nil {
+		return nil, err
+	}
+	return b.output, nil
+}
+
+// RecordRevision keeps the revision of an input fetched by the agent.
+func (p *Pool) RecordRevision(agentID, buildID string, revision jobs.Revision) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	b, err := p.assignedBuild(agentID, buildID)
+	if err != nil {
+		return err
+	}
+	return jobs.RecordRevision(b.output, revision)
+}
+
+func (p *Pool) Finish(agentID, buildID string, exitStatus uint32) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	b, err := p.assignedBuild(agentID, buildID)
+	if err != nil {
+		return err
+	}
+	p.finish(b, exitStatus)
+	return nil
+}
+
+func (p *Pool) Agents() []Agent {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	list := []Agent{}
+	for _, a := range p.agents {
+		builds := []string{}
+		for id := range a.builds {
+			builds = append(builds, id)
+		}
+		sort.Strings(builds)
+		list = append(list, Agent{
+			ID:       a.id,
+			Name:     a.name,
+			Labels:   a.labels,
+			LastSeen: a.lastSeen,
+			Builds:   builds,
+			Disabled: p.disabled[a.name],
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// RemoveLostAgents forgets agents that have not sent a heartbeat within
+// AgentTimeout, failing any builds they were running.
+func (p *Pool) RemoveLostAgents() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for id, a := range p.agents {
+		if time.Since(a.lastSeen) < p.AgentTimeout {
+			continue
+		}
+
+		log.Printf("agent %s (%s) has not been seen since %s. Failing its builds\n", id, a.name, a.lastSeen)
+		for _, b := range a.builds {
+			fmt.Fprintf(b.output, "\nAgent %s stopped responding\n", id)
+			p.finish(b, jobs.StatusAgentLost)
+		}
+		delete(p.agents, id)
+	}
+}
+
+func (p *Pool) assignedBuild(agentID, buildID string) (*build, error) {
+	a, ok := p.agents[agentID]
+	if !ok {
+		return nil, ErrUnknownAgent
+	}
+
+	b, ok := a.builds[buildID]
+	if !ok {
+		return nil, ErrUnknownBuild
+	}
+	return b, nil
+}
+
+func (p *Pool) cancel(b *build) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if b.finished {
+		return
+	}
+
+	if b.agent == nil {
+		for i, queued := range p.queue {
+			if queued == b {
+				p.queue = append(p.queue[:i], p.queue[i+1:]...)
+				break
+			}
+		}
+		p.finish(b, jobs.StatusAborted)
+		return
+	}
+
+	b.cancelled = true
+	p.notifyPollers()
+}
+
+// Must be called with the mutex held
+func (p *Pool) finish(b *build, exitStatus uint32) {
+	if b.finished {
+		return
+	}
+	b.finished = true
+
+	delete(p.builds, b.id)
+	if b.agent != nil {
+		delete(b.agent.builds, b.id)
+	}
+
+	if err := b.output.Close(); err != nil {
+		log.Printf("error closing output of build %s: %v\n", b.id, err)
+	}
+	b.status <- exitStatus
+}
+
+// Wakes up every agent waiting in Poll. Must be called with the mutex held.
+func (p *Pool) notifyPollers() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+func hasLabels(agentLabels, required []string) bool {
+	for _, label := range required {
+		found := false
+		for _, agentLabel := range agentLabels {
+			if agentLabel == label {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
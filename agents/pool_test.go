@@ -0,0 +1,230 @@
+package agents_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/craigfurman/woodhouse-ci/agents"
+	"github.com/craigfurman/woodhouse-ci/jobs"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Pool", func() {
+	var (
+		pool     *agents.Pool
+		tokenDir string
+		token    agents.RegistrationToken
+
+		job        jobs.Job
+		ctx        context.Context
+		cancel     context.CancelFunc
+		output     *gbytes.Buffer
+		exitStatus chan uint32
+	)
+
+	poll := func(agentID string, freeSlots int) agents.Work {
+		work, err := pool.Poll(context.Background(), agentID, freeSlots, time.Millisecond*50)
+		Expect(err).NotTo(HaveOccurred())
+		return work
+	}
+
+	register := func(labels ...string) string {
+		secret, err := ioutil.ReadFile(token.Path)
+		Expect(err).NotTo(HaveOccurred())
+		creds, err := pool.Register(strings.TrimSpace(string(secret)), "some-agent", labels)
+		Expect(err).NotTo(HaveOccurred())
+		return creds.AgentID
+	}
+
+	BeforeEach(func() {
+		var err error
+		tokenDir, err = ioutil.TempDir("", "agent-pool-unit-tests")
+		Expect(err).NotTo(HaveOccurred())
+		token = agents.RegistrationToken{Path: filepath.Join(tokenDir, "token")}
+		Expect(token.Ensure()).To(Succeed())
+
+		pool = agents.NewPool(time.Minute, token)
+		job = jobs.Job{ID: "some-id", Command: "make", DockerImage: "busybox", RunnerType: jobs.RunnerAgent, AgentLabels: []string{"linux"}}
+		ctx, cancel = context.WithCancel(context.Background())
+		output = gbytes.NewBuffer()
+		exitStatus = make(chan uint32, 1)
+	})
+
+	AfterEach(func() {
+		cancel()
+		Expect(os.RemoveAll(tokenDir)).To(Succeed())
+	})
+
+	JustBeforeEach(func() {
+		Expect(pool.Run(ctx, job, output, exitStatus)).To(Succeed())
+	})
+
+	It("assigns the build to an agent with the required labels", func() {
+		agentID := register("linux", "arm64")
+		work := poll(agentID, 1)
+		Expect(work.Assignments).To(HaveLen(1))
+		Expect(work.Assignments[0].Job.ID).To(Equal("some-id"))
+		Expect(output).To(gbytes.Say("Running on agent %s", agentID))
+	})
+
+	It("tells the agent which of its runners to use", func() {
+		work := poll(register("linux"), 1)
+		Expect(work.Assignments[0].Job.RunnerType).To(Equal(jobs.RunnerContainer))
+	})
+
+	Context("when the job's image is built from a Dockerfile", func() {
+		BeforeEach(func() {
+			job.DockerImage = ""
+			job.Dockerfile = "Dockerfile"
+		})
+
+		It("tells the agent to run it in a container", func() {
+			work := poll(register("linux"), 1)
+			Expect(work.Assignments[0].Job.RunnerType).To(Equal(jobs.RunnerContainer))
+		})
+	})
+
+	It("does not assign the build to agents without the required labels", func() {
+		Expect(poll(register("windows"), 1).Assignments).To(BeEmpty())
+		Expect(poll(register("linux"), 1).Assignments).To(HaveLen(1))
+	})
+
+	It("does not assign the build to agents without free slots", func() {
+		agentID := register("linux")
+		Expect(poll(agentID, 0).Assignments).To(BeEmpty())
+		Expect(poll(agentID, 1).Assignments).To(HaveLen(1))
+	})
+
+	It("wakes up agents waiting for work", func() {
+		agentID := register("linux")
+		Expect(poll(agentID, 1).Assignments).To(HaveLen(1))
+
+		works := make(chan agents.Work)
+		go func() {
+			work, _ := pool.Poll(context.Background(), agentID, 1, time.Minute)
+			works <- work
+		}()
+		Expect(pool.Run(context.Background(), job, gbytes.NewBuffer(), make(chan uint32, 1))).To(Succeed())
+		Eventually(works).Should(Receive(WithTransform(func(w agents.Work) int { return len(w.Assignments) }, Equal(1))))
+	})
+
+	It("records the output and status reported by the agent", func() {
+		agentID := register("linux")
+		buildID := poll(agentID, 1).Assignments[0].BuildID
+
+		buildOutput, err := pool.Output(agentID, buildID)
+		Expect(err).NotTo(HaveOccurred())
+		buildOutput.Write([]byte("hello from the agent"))
+		Expect(pool.Finish(agentID, buildID, 3)).To(Succeed())
+
+		Expect(output).To(gbytes.Say("hello from the agent"))
+		Expect(output.Closed()).To(BeTrue())
+		Expect(exitStatus).To(Receive(Equal(uint32(3))))
+	})
+
+	It("rejects reports for builds assigned to other agents", func() {
+		agentID := register("linux")
+		buildID := poll(agentID, 1).Assignments[0].BuildID
+
+		otherAgentID := register("linux")
+		Expect(pool.Finish(otherAgentID, buildID, 0)).To(MatchError(agents.ErrUnknownBuild))
+		Expect(pool.Finish("not-an-agent", buildID, 0)).To(MatchError(agents.ErrUnknownAgent))
+	})
+
+	Context("when the build is cancelled before an agent picks it up", func() {
+		It("records it as aborted", func() {
+			cancel()
+			Eventually(exitStatus).Should(Receive(Equal(jobs.StatusAborted)))
+			Expect(poll(register("linux"), 1).Assignments).To(BeEmpty())
+		})
+	})
+
+	Context("when a running build is cancelled", func() {
+		It("tells the agent running it to stop", func() {
+			agentID := register("linux")
+			buildID := poll(agentID, 1).Assignments[0].BuildID
+
+			cancel()
+			Eventually(func() []string { return poll(agentID, 0).Cancelled }).Should(ConsistOf(buildID))
+			Expect(poll(agentID, 0).Cancelled).To(BeEmpty())
+		})
+	})
+
+	Context("when an agent is disabled", func() {
+		It("finishes its running builds but is given no new ones", func() {
+			agentID := register("linux")
+			buildID := poll(agentID, 1).Assignments[0].BuildID
+
+			Expect(pool.SetDisabled(agentID, true)).To(Succeed())
+			Expect(pool.Run(context.Background(), job, gbytes.NewBuffer(), make(chan uint32, 1))).To(Succeed())
+			Expect(poll(agentID, 1).Assignments).To(BeEmpty())
+			Expect(pool.Finish(agentID, buildID, 0)).To(Succeed())
+
+			Expect(pool.SetDisabled(agentID, false)).To(Succeed())
+			Expect(poll(agentID, 1).Assignments).To(HaveLen(1))
+		})
+
+		It("reports that it is disabled in heartbeats", func() {
+			agentID := register("linux")
+			Expect(pool.SetDisabled(agentID, true)).To(Succeed())
+			Expect(pool.Heartbeat(agentID)).To(BeTrue())
+			Expect(pool.Agents()[0].Disabled).To(BeTrue())
+		})
+	})
+
+	Describe("authentication", func() {
+		It("rejects registrations without the registration token", func() {
+			_, err := pool.Register("guess", "some-agent", nil)
+			Expect(err).To(MatchError(agents.ErrUnauthorized))
+		})
+
+		It("issues each agent its own credentials", func() {
+			secret, err := ioutil.ReadFile(token.Path)
+			Expect(err).NotTo(HaveOccurred())
+			creds, err := pool.Register(strings.TrimSpace(string(secret)), "some-agent", nil)
+			Expect(err).NotTo(HaveOccurred())
+			otherCreds, err := pool.Register(strings.TrimSpace(string(secret)), "other-agent", nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(pool.Authenticate(creds)).To(Succeed())
+			Expect(pool.Authenticate(agents.Credentials{AgentID: creds.AgentID, Secret: otherCreds.Secret})).To(MatchError(agents.ErrUnauthorized))
+			Expect(pool.Authenticate(agents.Credentials{AgentID: "not-an-agent", Secret: creds.Secret})).To(MatchError(agents.ErrUnknownAgent))
+		})
+
+		It("keeps registered agents when the registration token is rotated", func() {
+			agentID := register("linux")
+			oldToken, err := ioutil.ReadFile(token.Path)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(pool.RotateRegistrationToken()).To(Succeed())
+			_, err = pool.Register(strings.TrimSpace(string(oldToken)), "some-agent", nil)
+			Expect(err).To(MatchError(agents.ErrUnauthorized))
+			Expect(pool.Heartbeat(agentID)).To(BeFalse())
+		})
+	})
+
+	Context("when an agent stops sending heartbeats", func() {
+		It("fails its builds and forgets it", func() {
+			pool = agents.NewPool(time.Millisecond*100, token)
+			lostOutput := gbytes.NewBuffer()
+			lostStatus := make(chan uint32, 1)
+			Expect(pool.Run(ctx, job, lostOutput, lostStatus)).To(Succeed())
+			agentID := register("linux")
+			Expect(poll(agentID, 1).Assignments).To(HaveLen(1))
+
+			Eventually(lostStatus).Should(Receive(Equal(jobs.StatusAgentLost)))
+			Expect(lostOutput).To(gbytes.Say("Agent %s stopped responding", agentID))
+			Expect(pool.Agents()).To(BeEmpty())
+
+			_, err := pool.Poll(context.Background(), agentID, 1, 0)
+			Expect(err).To(MatchError(agents.ErrUnknownAgent))
+		})
+	})
+})
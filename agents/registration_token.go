@@ -0,0 +1,65 @@
+package agents
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// RegistrationToken is the shared secret agents present to register with the
+// server. It is kept in a file that only the Woodhouse user can read, and is
+// read on every registration so that replacing the file takes effect without
+// a restart.
+type RegistrationToken struct {
+	Path string
+}
+
+// Ensure creates a token unless one exists already.
+func (t RegistrationToken) Ensure() error {
+	if _, err := os.Stat(t.Path); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("checking for registration token: %s. Cause: %v", t.Path, err)
+	}
+	return t.Rotate()
+}
+
+// Rotate replaces the token. Agents that have already registered keep their
+// own credentials, so only new registrations need the new token.
+func (t RegistrationToken) Rotate() error {
+	token, err := randomSecret()
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(t.Path, []byte(token+"\n"), 0600); err != nil {
+		return fmt.Errorf("writing registration token: %s. Cause: %v", t.Path, err)
+	}
+	return nil
+}
+
+func (t RegistrationToken) Check(token string) error {
+	expected, err := ioutil.ReadFile(t.Path)
+	if err != nil {
+		return fmt.Errorf("reading registration token: %s. Cause: %v", t.Path, err)
+	}
+	if token == "" || !secretsEqual(strings.TrimSpace(string(expected)), token) {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+func randomSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("generating secret. Cause: %v", err)
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+func secretsEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
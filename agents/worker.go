@@ -0,0 +1,212 @@
+package agents
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+)
+
+// Worker is the agent side: it registers with a server and runs the builds
+// it is given.
+type Worker struct {
+	Client *Client
+	Runner jobs.Runner
+	Name   string
+	Labels []string
+
+	// Maximum number of builds to run at once
+	Slots int
+
+	// How often to tell the server that the agent is alive. Must be well
+	// under the server's agent timeout.
+	HeartbeatInterval time.Duration
+
+	// How long to wait before retrying after failing to reach the server
+	RetryInterval time.Duration
+
+	mutex   sync.Mutex
+	creds   Credentials
+	running map[string]context.CancelFunc
+	builds  sync.WaitGroup
+}
+
+// Work runs builds until ctx is cancelled. Running builds are then stopped,
+// and their status reported, before it returns.
+func (w *Worker) Work(ctx context.Context) {
+	w.running = make(map[string]context.CancelFunc)
+
+	heartbeatsStopped := make(chan struct{})
+	go func() {
+		w.sendHeartbeats(ctx)
+		close(heartbeatsStopped)
+	}()
+
+	for ctx.Err() == nil {
+		creds := w.credentials()
+		if creds.AgentID == "" {
+			var err error
+			creds, err = w.Client.Register(w.Name, w.Labels)
+			if err != nil {
+				log.Printf("%v. Retrying in %s\n", err, w.RetryInterval)
+				w.wait(ctx, w.RetryInterval)
+				continue
+			}
+			log.Printf("registered as agent %s with labels %v\n", creds.AgentID, w.Labels)
+			w.setCredentials(creds)
+		}
+
+		work, err := w.Client.Poll(ctx, creds, w.freeSlots())
+		if err == ErrUnknownAgent || err == ErrUnauthorized {
+			log.Println("server no longer knows this agent. Stopping running builds and registering again")
+			w.cancelAll()
+			w.setCredentials(Credentials{})
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("error polling for work: %v. Retrying in %s\n", err, w.RetryInterval)
+				w.wait(ctx, w.RetryInterval)
+			}
+			continue
+		}
+
+		w.mutex.Lock()
+		for _, buildID := range work.Cancelled {
+			if cancel, ok := w.running[buildID]; ok {
+				cancel()
+			}
+		}
+		w.mutex.Unlock()
+
+		for _, assignment := range work.Assignments {
+			w.start(creds, assignment)
+		}
+	}
+
+	w.cancelAll()
+	w.builds.Wait()
+	<-heartbeatsStopped
+}
+
+func (w *Worker) sendHeartbeats(ctx context.Context) {
+	for {
+		w.wait(ctx, w.HeartbeatInterval)
+		if ctx.Err() != nil {
+			return
+		}
+
+		creds := w.credentials()
+		if creds.AgentID == "" {
+			continue
+		}
+
+		// Failures are dealt with by polling, which registers again if the
+		// server has forgotten the agent. Disabled agents need do nothing, as
+		// the server gives them no new builds.
+		if _, err := w.Client.Heartbeat(creds); err != nil {
+			log.Printf("error sending heartbeat: %v\n", err)
+		}
+	}
+}
+
+func (w *Worker) start(creds Credentials, assignment Assignment) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w.mutex.Lock()
+	w.running[assignment.BuildID] = cancel
+	w.mutex.Unlock()
+	w.builds.Add(1)
+
+	go func() {
+		defer w.builds.Done()
+		defer func() {
+			w.mutex.Lock()
+			delete(w.running, assignment.BuildID)
+			w.mutex.Unlock()
+			cancel()
+		}()
+
+		log.Printf("running build %s of job %s\n", assignment.BuildID, assignment.Job.Name)
+		exitStatus := w.run(ctx, creds, assignment)
+		if err := w.Client.Finish(creds, assignment.BuildID, exitStatus); err != nil {
+			log.Printf("error reporting status of build %s: %v\n", assignment.BuildID, err)
+		}
+	}()
+}
+
+func (w *Worker) run(ctx context.Context, creds Credentials, assignment Assignment) uint32 {
+	outputReader, outputWriter := io.Pipe()
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		err := w.Client.SendOutput(creds, assignment.BuildID, outputReader)
+		if err != nil {
+			log.Printf("error sending output of build %s: %v\n", assignment.BuildID, err)
+		}
+		// Unblock the runner if the server stopped reading
+		outputReader.CloseWithError(fmt.Errorf("sending output: %v", err))
+	}()
+
+	output := &buildOutput{PipeWriter: outputWriter, client: w.Client, creds: creds, buildID: assignment.BuildID}
+	status := make(chan uint32, 1)
+	if err := w.Runner.Run(ctx, assignment.Job, output, status); err != nil {
+		fmt.Fprintf(outputWriter, "Error starting job: %v\n", err)
+		outputWriter.Close()
+		<-sent
+		return uint32(1)
+	}
+
+	exitStatus := <-status
+	<-sent
+	return exitStatus
+}
+
+// buildOutput sends the revisions the runner fetched to the server, as well as
+// the output.
+type buildOutput struct {
+	*io.PipeWriter
+	client  *Client
+	creds   Credentials
+	buildID string
+}
+
+func (o *buildOutput) RecordRevision(revision jobs.Revision) error {
+	return o.client.RecordRevision(o.creds, o.buildID, revision)
+}
+
+func (w *Worker) credentials() Credentials {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.creds
+}
+
+func (w *Worker) setCredentials(creds Credentials) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.creds = creds
+}
+
+func (w *Worker) freeSlots() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.Slots - len(w.running)
+}
+
+func (w *Worker) cancelAll() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for _, cancel := range w.running {
+		cancel()
+	}
+}
+
+func (w *Worker) wait(ctx context.Context, d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+	}
+}
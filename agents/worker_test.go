@@ -0,0 +1,194 @@
+package agents_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/craigfurman/woodhouse-ci/agents"
+	"github.com/craigfurman/woodhouse-ci/jobs"
+	"github.com/craigfurman/woodhouse-ci/jobs/fake_job_runner"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Worker", func() {
+	var (
+		tokenDir string
+		pool     *agents.Pool
+		server   *httptest.Server
+		runner   *fake_job_runner.FakeRunner
+		worker   *agents.Worker
+		stopWork context.CancelFunc
+		stopped  chan struct{}
+
+		job        jobs.Job
+		output     *gbytes.Buffer
+		exitStatus chan uint32
+	)
+
+	BeforeEach(func() {
+		var err error
+		tokenDir, err = ioutil.TempDir("", "agent-worker-unit-tests")
+		Expect(err).NotTo(HaveOccurred())
+		token := agents.RegistrationToken{Path: filepath.Join(tokenDir, "token")}
+		Expect(token.Ensure()).To(Succeed())
+		secret, err := ioutil.ReadFile(token.Path)
+		Expect(err).NotTo(HaveOccurred())
+
+		pool = agents.NewPool(time.Millisecond*500, token)
+		handler := agents.NewHandler(pool)
+		handler.PollTimeout = time.Millisecond * 100
+		server = httptest.NewServer(handler)
+
+		runner = new(fake_job_runner.FakeRunner)
+		runner.RunStub = func(ctx context.Context, job jobs.Job, outputDest io.WriteCloser, status chan<- uint32) error {
+			go func() {
+				fmt.Fprintf(outputDest, "running %s\n", job.Command)
+				status <- 0
+				outputDest.Close()
+			}()
+			return nil
+		}
+
+		worker = &agents.Worker{
+			Client:            agents.NewClient(server.URL+"/", strings.TrimSpace(string(secret))),
+			Runner:            runner,
+			Name:              "some-agent",
+			Labels:            []string{"linux"},
+			Slots:             1,
+			HeartbeatInterval: time.Millisecond * 50,
+			RetryInterval:     time.Millisecond * 10,
+		}
+
+		job = jobs.Job{ID: "some-id", Name: "gob", Command: "make test", RunnerType: jobs.RunnerAgent, AgentLabels: []string{"linux"}}
+		output = gbytes.NewBuffer()
+		exitStatus = make(chan uint32, 1)
+	})
+
+	JustBeforeEach(func() {
+		var ctx context.Context
+		ctx, stopWork = context.WithCancel(context.Background())
+		stopped = make(chan struct{})
+		go func() {
+			worker.Work(ctx)
+			close(stopped)
+		}()
+	})
+
+	AfterEach(func() {
+		stopWork()
+		Eventually(stopped).Should(BeClosed())
+		server.Close()
+		Expect(os.RemoveAll(tokenDir)).To(Succeed())
+	})
+
+	It("registers with its name and labels", func() {
+		Eventually(pool.Agents).Should(HaveLen(1))
+		Expect(pool.Agents()[0].Name).To(Equal("some-agent"))
+		Expect(pool.Agents()[0].Labels).To(Equal([]string{"linux"}))
+	})
+
+	It("stays registered by sending heartbeats", func() {
+		Eventually(pool.Agents).Should(HaveLen(1))
+		agentID := pool.Agents()[0].ID
+		Consistently(func() string {
+			list := pool.Agents()
+			if len(list) == 0 {
+				return ""
+			}
+			return list[0].ID
+		}, "1s").Should(Equal(agentID))
+	})
+
+	Context("when the registration token is wrong", func() {
+		BeforeEach(func() {
+			worker.Client.RegistrationToken = "guess"
+		})
+
+		It("is not registered", func() {
+			Consistently(pool.Agents, "200ms").Should(BeEmpty())
+		})
+	})
+
+	It("runs builds and reports their output and status to the server", func() {
+		Expect(pool.Run(context.Background(), job, output, exitStatus)).To(Succeed())
+
+		Eventually(exitStatus).Should(Receive(Equal(uint32(0))))
+		Expect(output).To(gbytes.Say("running make test"))
+		Expect(output.Closed()).To(BeTrue())
+
+		_, ranJob, _, _ := runner.RunArgsForCall(0)
+		Expect(ranJob.RunnerType).To(Equal(jobs.RunnerLocal))
+	})
+
+	It("reports the revisions the runner fetched to the server", func() {
+		runner.RunStub = func(ctx context.Context, job jobs.Job, outputDest io.WriteCloser, status chan<- uint32) error {
+			go func() {
+				jobs.RecordRevision(outputDest, jobs.Revision{Input: "lib", Revision: "abc123"})
+				status <- 0
+				outputDest.Close()
+			}()
+			return nil
+		}
+		recorder := &revisionRecorder{Buffer: output}
+		Expect(pool.Run(context.Background(), job, recorder, exitStatus)).To(Succeed())
+
+		Eventually(exitStatus).Should(Receive(Equal(uint32(0))))
+		Expect(recorder.revisions).To(Equal([]jobs.Revision{{Input: "lib", Revision: "abc123"}}))
+	})
+
+	Context("when the build is cancelled on the server", func() {
+		BeforeEach(func() {
+			runner.RunStub = func(ctx context.Context, job jobs.Job, outputDest io.WriteCloser, status chan<- uint32) error {
+				go func() {
+					fmt.Fprintln(outputDest, "started")
+					<-ctx.Done()
+					status <- 143
+					outputDest.Close()
+				}()
+				return nil
+			}
+		})
+
+		It("stops the build", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			Expect(pool.Run(ctx, job, output, exitStatus)).To(Succeed())
+			Eventually(output).Should(gbytes.Say("started"))
+
+			cancel()
+			Eventually(exitStatus).Should(Receive(Equal(uint32(143))))
+		})
+	})
+
+	Context("when the runner fails to start the job", func() {
+		BeforeEach(func() {
+			runner.RunStub = nil
+			runner.RunReturns(fmt.Errorf("no runner for job"))
+		})
+
+		It("reports the build as failed", func() {
+			Expect(pool.Run(context.Background(), job, output, exitStatus)).To(Succeed())
+			Eventually(exitStatus).Should(Receive(Equal(uint32(1))))
+			Expect(output).To(gbytes.Say("Error starting job: no runner for job"))
+		})
+	})
+})
+
+type revisionRecorder struct {
+	*gbytes.Buffer
+	revisions []jobs.Revision
+}
+
+func (r *revisionRecorder) RecordRevision(revision jobs.Revision) error {
+	r.revisions = append(r.revisions, revision)
+	return nil
+}
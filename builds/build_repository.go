@@ -1,6 +1,8 @@
 package builds
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -10,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/craigfurman/woodhouse-ci/jobs"
 )
@@ -26,7 +29,7 @@ func NewRepository(buildsDir string) *Repository {
 	}
 }
 
-func (r *Repository) Create(jobId string) (int, io.WriteCloser, chan uint32, error) {
+func (r *Repository) Create(jobId string, variant string) (int, io.WriteCloser, chan uint32, error) {
 	r.Lock()
 	defer r.Unlock()
 
@@ -45,6 +48,12 @@ func (r *Repository) Create(jobId string) (int, io.WriteCloser, chan uint32, err
 		return errs(fmt.Errorf("getting highest build: %v", err))
 	}
 
+	if variant != "" {
+		if err := ioutil.WriteFile(r.variantFile(jobId, buildNumber), []byte(variant), 0644); err != nil {
+			return errs(fmt.Errorf("creating variant file: %v", err))
+		}
+	}
+
 	f, err := os.Create(filepath.Join(r.BuildsDir, jobId, fmt.Sprintf("%d-output.txt", buildNumber)))
 	if err != nil {
 		return errs(fmt.Errorf("creating output file: %v", err))
@@ -53,7 +62,371 @@ func (r *Repository) Create(jobId string) (int, io.WriteCloser, chan uint32, err
 	status := make(chan uint32, 1)
 	go r.recordStatus(jobId, buildNumber, status)
 
-	return buildNumber, f, status, nil
+	output := &buildOutput{
+		File:          f,
+		revisionsFile: r.revisionsFile(jobId, buildNumber),
+		inputsFile:    r.inputsFile(jobId, buildNumber),
+		awaitingFile:  r.awaitingApprovalFile(jobId, buildNumber),
+		approvalFile:  r.approvalFile(jobId, buildNumber),
+		artifactsDir:  r.artifactsDir(jobId, buildNumber),
+		cachesDir:     r.cachesDir(jobId),
+		servicesDir:   r.serviceLogsDir(jobId, buildNumber),
+		mutex:         new(sync.Mutex),
+	}
+	return buildNumber, output, status, nil
+}
+
+// buildOutput keeps the revisions of the inputs fetched for a build, what
+// else it was built with and the artifacts it kept alongside its output, as
+// well as the logs of its service containers. The caches it uses are those of
+// its job.
+type buildOutput struct {
+	*os.File
+	revisionsFile string
+	inputsFile    string
+	awaitingFile  string
+	approvalFile  string
+	artifactsDir  string
+	cachesDir     string
+	servicesDir   string
+
+	mutex     *sync.Mutex
+	revisions []jobs.Revision
+}
+
+func (o *buildOutput) RecordRevision(revision jobs.Revision) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.revisions = append(o.revisions, revision)
+	contents, err := json.Marshal(o.revisions)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(o.revisionsFile, contents, 0644); err != nil {
+		return fmt.Errorf("writing revisions file: %v", err)
+	}
+	return nil
+}
+
+func (o *buildOutput) RecordInputs(inputs jobs.BuildInputs) error {
+	contents, err := json.Marshal(inputs)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(o.inputsFile, contents, 0644); err != nil {
+		return fmt.Errorf("writing inputs file: %v", err)
+	}
+	return nil
+}
+
+// How often a build awaiting approval checks whether it has been decided
+var approvalPollInterval = time.Millisecond * 500
+
+// AwaitApproval marks the build as awaiting approval until a decision about
+// it is kept, which may have been made already, e.g. for an earlier attempt.
+func (o *buildOutput) AwaitApproval(ctx context.Context) (jobs.Approval, error) {
+	if err := ioutil.WriteFile(o.awaitingFile, nil, 0644); err != nil {
+		return jobs.Approval{}, fmt.Errorf("creating awaiting approval file: %v", err)
+	}
+	defer os.Remove(o.awaitingFile)
+
+	for {
+		approval, err := readApproval(o.approvalFile)
+		if err != nil {
+			return jobs.Approval{}, err
+		}
+		if approval != nil {
+			return *approval, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return jobs.Approval{}, ctx.Err()
+		case <-time.After(approvalPollInterval):
+		}
+	}
+}
+
+func (r *Repository) Decide(jobId string, buildNumber int, approval jobs.Approval) error {
+	r.Lock()
+	defer r.Unlock()
+
+	if _, err := os.Stat(r.awaitingApprovalFile(jobId, buildNumber)); os.IsNotExist(err) {
+		return fmt.Errorf("build %d of job %s is not awaiting approval", buildNumber, jobId)
+	}
+	existing, err := readApproval(r.approvalFile(jobId, buildNumber))
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("build %d of job %s was already decided: %s", buildNumber, jobId, existing)
+	}
+
+	contents, err := json.Marshal(approval)
+	if err != nil {
+		return err
+	}
+	// Written elsewhere first so that the build never reads half a decision
+	tmpFile := r.approvalFile(jobId, buildNumber) + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, contents, 0644); err != nil {
+		return fmt.Errorf("writing approval file: %v", err)
+	}
+	return os.Rename(tmpFile, r.approvalFile(jobId, buildNumber))
+}
+
+// readApproval returns nil if no decision was made.
+func readApproval(approvalFile string) (*jobs.Approval, error) {
+	contents, err := ioutil.ReadFile(approvalFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading approval file: %v", err)
+	}
+
+	var approval jobs.Approval
+	if err := json.Unmarshal(contents, &approval); err != nil {
+		return nil, fmt.Errorf("parsing approval file: %v", err)
+	}
+	return &approval, nil
+}
+
+func (r *Repository) awaitingApprovalFile(jobId string, buildNumber int) string {
+	return filepath.Join(r.BuildsDir, jobId, fmt.Sprintf("%d-awaiting-approval", buildNumber))
+}
+
+func (r *Repository) approvalFile(jobId string, buildNumber int) string {
+	return filepath.Join(r.BuildsDir, jobId, fmt.Sprintf("%d-approval.json", buildNumber))
+}
+
+// Cells of a matrix build are kept as builds of their own, numbered in order,
+// in a directory next to the build's output. Each cell's name is kept as its
+// variant.
+func (r *Repository) cells(jobId string, buildNumber int) *Repository {
+	return &Repository{
+		Mutex:     r.Mutex,
+		BuildsDir: filepath.Join(r.BuildsDir, jobId, fmt.Sprintf("%d-cells", buildNumber)),
+	}
+}
+
+func (r *Repository) CreateCell(jobId string, buildNumber int, cell jobs.Cell) (int, io.WriteCloser, chan uint32, error) {
+	cells := r.cells(jobId, buildNumber)
+	cellNumber, output, status, err := cells.Create("", cell.Name)
+	if err != nil {
+		return cellNumber, output, status, fmt.Errorf("creating cell of build %d of job %s. Cause: %v", buildNumber, jobId, err)
+	}
+
+	// Cells share the caches of their job
+	output.(*buildOutput).cachesDir = r.cachesDir(jobId)
+
+	if cell.AllowFailure {
+		if err := ioutil.WriteFile(cells.allowFailureFile(cellNumber), nil, 0644); err != nil {
+			output.Close()
+			return -1, nil, nil, fmt.Errorf("creating allow failure file: %v", err)
+		}
+	}
+	return cellNumber, output, status, nil
+}
+
+func (r *Repository) FindCell(jobId string, buildNumber, cellNumber int) (jobs.Build, error) {
+	cells := r.cells(jobId, buildNumber)
+	cell, err := cells.Find("", cellNumber)
+	if err != nil {
+		return jobs.Build{}, err
+	}
+
+	if _, err := os.Stat(cells.allowFailureFile(cellNumber)); err == nil {
+		cell.AllowFailure = true
+	}
+	return cell, nil
+}
+
+// findCells returns the cells of a build without their output.
+func (r *Repository) findCells(jobId string, buildNumber int) ([]jobs.Build, error) {
+	cells := r.cells(jobId, buildNumber)
+	if _, err := os.Stat(cells.BuildsDir); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	highestCell, err := cells.HighestBuild("")
+	if err != nil {
+		return nil, err
+	}
+
+	found := []jobs.Build{}
+	for cellNumber := 1; cellNumber <= highestCell; cellNumber++ {
+		cell, err := r.FindCell(jobId, buildNumber, cellNumber)
+		if err != nil {
+			return nil, err
+		}
+		cell.Output = nil
+		found = append(found, cell)
+	}
+	return found, nil
+}
+
+// Attempts at a build that is retried are kept like cells, in a directory
+// next to the build's output.
+func (r *Repository) attempts(jobId string, buildNumber int) *Repository {
+	return &Repository{
+		Mutex:     r.Mutex,
+		BuildsDir: filepath.Join(r.BuildsDir, jobId, fmt.Sprintf("%d-attempts", buildNumber)),
+	}
+}
+
+func (r *Repository) CreateAttempt(jobId string, buildNumber int) (int, io.WriteCloser, chan uint32, error) {
+	attemptNumber, output, status, err := r.attempts(jobId, buildNumber).Create("", "")
+	if err != nil {
+		return attemptNumber, output, status, fmt.Errorf("creating attempt at build %d of job %s. Cause: %v", buildNumber, jobId, err)
+	}
+	return attemptNumber, output, status, nil
+}
+
+func (r *Repository) FindAttempt(jobId string, buildNumber, attemptNumber int) (jobs.Build, error) {
+	return r.attempts(jobId, buildNumber).Find("", attemptNumber)
+}
+
+// findAttempts returns the attempts at a build without their output.
+func (r *Repository) findAttempts(jobId string, buildNumber int) ([]jobs.Build, error) {
+	attempts := r.attempts(jobId, buildNumber)
+	if _, err := os.Stat(attempts.BuildsDir); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	highestAttempt, err := attempts.HighestBuild("")
+	if err != nil {
+		return nil, err
+	}
+
+	found := []jobs.Build{}
+	for attemptNumber := 1; attemptNumber <= highestAttempt; attemptNumber++ {
+		attempt, err := attempts.Find("", attemptNumber)
+		if err != nil {
+			return nil, err
+		}
+		attempt.Output = nil
+		found = append(found, attempt)
+	}
+	return found, nil
+}
+
+func (r *Repository) allowFailureFile(buildNumber int) string {
+	return filepath.Join(r.BuildsDir, fmt.Sprintf("%d-allow-failure", buildNumber))
+}
+
+func (o *buildOutput) ArtifactsDir() (string, error) {
+	if err := os.MkdirAll(o.artifactsDir, 0755); err != nil {
+		return "", fmt.Errorf("creating artifacts directory: %v", err)
+	}
+	return o.artifactsDir, nil
+}
+
+func (r *Repository) artifactsDir(jobId string, buildNumber int) string {
+	return filepath.Join(r.BuildsDir, jobId, fmt.Sprintf("%d-artifacts", buildNumber))
+}
+
+// findArtifacts lists the files kept by a build, relative to its artifacts
+// directory.
+func (r *Repository) findArtifacts(jobId string, buildNumber int) (string, []string, error) {
+	dir := r.artifactsDir(jobId, buildNumber)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return "", nil, nil
+	}
+
+	var artifacts []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		artifacts = append(artifacts, filepath.ToSlash(rel))
+		return err
+	})
+	return dir, artifacts, err
+}
+
+// Service logs are kept as a file named after each service
+func (r *Repository) serviceLogsDir(jobId string, buildNumber int) string {
+	return filepath.Join(r.BuildsDir, jobId, fmt.Sprintf("%d-services", buildNumber))
+}
+
+func (o *buildOutput) ServiceLog(name string) (io.WriteCloser, error) {
+	if err := os.MkdirAll(o.servicesDir, 0755); err != nil {
+		return nil, fmt.Errorf("creating service logs directory: %v", err)
+	}
+	f, err := os.Create(filepath.Join(o.servicesDir, name+".log"))
+	if err != nil {
+		return nil, fmt.Errorf("creating service log: %v", err)
+	}
+	return f, nil
+}
+
+func (r *Repository) findServiceLogs(jobId string, buildNumber int) ([]jobs.ServiceLog, error) {
+	files, err := ioutil.ReadDir(r.serviceLogsDir(jobId, buildNumber))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []jobs.ServiceLog
+	for _, f := range files {
+		output, err := ioutil.ReadFile(filepath.Join(r.serviceLogsDir(jobId, buildNumber), f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, jobs.ServiceLog{Name: strings.TrimSuffix(f.Name(), ".log"), Output: output})
+	}
+	return logs, nil
+}
+
+// Caches are kept by name, with a directory for each key
+func (r *Repository) cachesDir(jobId string) string {
+	return filepath.Join(r.BuildsDir, jobId, "caches")
+}
+
+func (o *buildOutput) CacheDir(cache jobs.Cache, key string) (string, error) {
+	if key == "" {
+		key = "default"
+	}
+	dir := filepath.Join(o.cachesDir, cache.Name, key)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("creating cache directory: %v", err)
+	}
+	return dir, nil
+}
+
+// ClearCaches moves the caches out of the way before removing them, so that
+// builds starting meanwhile get new ones. Builds using them keep what they
+// have mounted.
+func (r *Repository) ClearCaches(jobId string) error {
+	dir := r.cachesDir(jobId)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+
+	cleared := fmt.Sprintf("%s-cleared-%d", dir, time.Now().UnixNano())
+	if err := os.Rename(dir, cleared); err != nil {
+		return fmt.Errorf("moving caches directory: %v", err)
+	}
+	if err := os.RemoveAll(cleared); err != nil {
+		return fmt.Errorf("removing caches directory: %v", err)
+	}
+	return nil
+}
+
+func (r *Repository) variantFile(jobId string, buildNumber int) string {
+	return filepath.Join(r.BuildsDir, jobId, fmt.Sprintf("%d-variant.txt", buildNumber))
+}
+
+func (r *Repository) revisionsFile(jobId string, buildNumber int) string {
+	return filepath.Join(r.BuildsDir, jobId, fmt.Sprintf("%d-revisions.json", buildNumber))
+}
+
+func (r *Repository) inputsFile(jobId string, buildNumber int) string {
+	return filepath.Join(r.BuildsDir, jobId, fmt.Sprintf("%d-inputs.json", buildNumber))
 }
 
 func (r *Repository) HighestBuild(jobId string) (int, error) {
@@ -108,13 +481,99 @@ func (r *Repository) Find(jobId string, buildNumber int) (jobs.Build, error) {
 		return jobs.Build{}, err
 	}
 
+	revisions, err := r.getRevisions(jobId, buildNumber)
+	if err != nil {
+		return jobs.Build{}, err
+	}
+
+	inputs, err := r.getInputs(jobId, buildNumber)
+	if err != nil {
+		return jobs.Build{}, err
+	}
+
+	variant, err := ioutil.ReadFile(r.variantFile(jobId, buildNumber))
+	if err != nil && !os.IsNotExist(err) {
+		return jobs.Build{}, fmt.Errorf("reading variant file for job %s. Cause: %v", jobId, err)
+	}
+
+	cells, err := r.findCells(jobId, buildNumber)
+	if err != nil {
+		return jobs.Build{}, fmt.Errorf("finding cells of build %d of job %s. Cause: %v", buildNumber, jobId, err)
+	}
+
+	_, err = os.Stat(r.awaitingApprovalFile(jobId, buildNumber))
+	awaitingApproval := err == nil && !finished
+	approval, err := readApproval(r.approvalFile(jobId, buildNumber))
+	if err != nil {
+		return jobs.Build{}, fmt.Errorf("finding approval of build %d of job %s. Cause: %v", buildNumber, jobId, err)
+	}
+
+	attempts, err := r.findAttempts(jobId, buildNumber)
+	if err != nil {
+		return jobs.Build{}, fmt.Errorf("finding attempts at build %d of job %s. Cause: %v", buildNumber, jobId, err)
+	}
+
+	artifactsDir, artifacts, err := r.findArtifacts(jobId, buildNumber)
+	if err != nil {
+		return jobs.Build{}, fmt.Errorf("listing artifacts of build %d of job %s. Cause: %v", buildNumber, jobId, err)
+	}
+
+	serviceLogs, err := r.findServiceLogs(jobId, buildNumber)
+	if err != nil {
+		return jobs.Build{}, fmt.Errorf("reading service logs of build %d of job %s. Cause: %v", buildNumber, jobId, err)
+	}
+
 	return jobs.Build{
-		Output:     out,
-		ExitStatus: exitStatus,
-		Finished:   finished,
+		Output:           out,
+		ExitStatus:       exitStatus,
+		Finished:         finished,
+		Revisions:        revisions,
+		ParameterValues:  inputs.Parameters,
+		Image:            inputs.DockerImage,
+		RebuildOf:        inputs.RebuildOf,
+		Variant:          string(variant),
+		Cells:            cells,
+		Attempts:         attempts,
+		AwaitingApproval: awaitingApproval,
+		Approval:         approval,
+		ArtifactsDir:     artifactsDir,
+		Artifacts:        artifacts,
+		ServiceLogs:      serviceLogs,
 	}, nil
 }
 
+func (r *Repository) getRevisions(jobId string, buildNumber int) ([]jobs.Revision, error) {
+	contents, err := ioutil.ReadFile(r.revisionsFile(jobId, buildNumber))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading revisions file for job %s. Cause: %v", jobId, err)
+	}
+
+	var revisions []jobs.Revision
+	if err := json.Unmarshal(contents, &revisions); err != nil {
+		return nil, fmt.Errorf("parsing revisions file for job %s. Cause: %v", jobId, err)
+	}
+	return revisions, nil
+}
+
+func (r *Repository) getInputs(jobId string, buildNumber int) (jobs.BuildInputs, error) {
+	var inputs jobs.BuildInputs
+	contents, err := ioutil.ReadFile(r.inputsFile(jobId, buildNumber))
+	if os.IsNotExist(err) {
+		return inputs, nil
+	}
+	if err != nil {
+		return inputs, fmt.Errorf("reading inputs file for job %s. Cause: %v", jobId, err)
+	}
+
+	if err := json.Unmarshal(contents, &inputs); err != nil {
+		return inputs, fmt.Errorf("parsing inputs file for job %s. Cause: %v", jobId, err)
+	}
+	return inputs, nil
+}
+
 func (r *Repository) getBuildExitStatus(jobId string, buildNumber int) (bool, uint32, error) {
 	statusFile := filepath.Join(r.BuildsDir, jobId, fmt.Sprintf("%d-status.txt", buildNumber))
 	if _, err := os.Stat(statusFile); os.IsNotExist(err) {
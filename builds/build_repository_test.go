@@ -1,6 +1,7 @@
 package builds_test
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -33,7 +34,7 @@ var _ = Describe("BuildRepository", func() {
 		)
 
 		JustBeforeEach(func() {
-			buildNumber, outputDest, exitStatusChan, createErr = repo.Create(jobId)
+			buildNumber, outputDest, exitStatusChan, createErr = repo.Create(jobId, "")
 		})
 
 		Context("when the builds directory already exists", func() {
@@ -56,9 +57,244 @@ var _ = Describe("BuildRepository", func() {
 				Expect(buildNumber).To(Equal(1))
 			})
 
+			Context("when a build of a variant of the job is created", func() {
+				It("records the variant", func() {
+					n, o, _, err := repo.Create(jobId, "pull request #12")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(o.Close()).To(Succeed())
+
+					b, err := repo.Find(jobId, n)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b.Variant).To(Equal("pull request #12"))
+				})
+			})
+
+			Context("when the build keeps artifacts", func() {
+				It("lists them", func() {
+					dir, err := jobs.ArtifactsDir(outputDest)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(os.MkdirAll(filepath.Join(dir, "dist"), 0755)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(dir, "dist", "app"), []byte("binary"), 0644)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(dir, "app.tar"), []byte("tarball"), 0644)).To(Succeed())
+
+					b, err := repo.Find(jobId, buildNumber)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b.ArtifactsDir).To(Equal(dir))
+					Expect(b.Artifacts).To(Equal([]string{"app.tar", "dist/app"}))
+
+					highest, err := repo.HighestBuild(jobId)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(highest).To(Equal(buildNumber))
+				})
+			})
+
+			Context("when the build has service containers", func() {
+				It("keeps the log of each of them", func() {
+					for _, service := range []string{"redis", "postgres"} {
+						log, err := jobs.ServiceLogWriter(outputDest, service)
+						Expect(err).NotTo(HaveOccurred())
+						_, err = log.Write([]byte(service + " is up\n"))
+						Expect(err).NotTo(HaveOccurred())
+						Expect(log.Close()).To(Succeed())
+					}
+
+					b, err := repo.Find(jobId, buildNumber)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b.ServiceLogs).To(Equal([]jobs.ServiceLog{
+						{Name: "postgres", Output: []byte("postgres is up\n")},
+						{Name: "redis", Output: []byte("redis is up\n")},
+					}))
+					Expect(b.Output).To(BeEmpty())
+
+					highest, err := repo.HighestBuild(jobId)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(highest).To(Equal(buildNumber))
+				})
+			})
+
+			Context("when the build uses caches", func() {
+				var cache jobs.Cache
+
+				BeforeEach(func() {
+					cache = jobs.Cache{Name: "go-modules", Path: "/go/pkg/mod"}
+				})
+
+				It("keeps them for later builds of the job", func() {
+					dir, err := jobs.CacheDir(outputDest, cache, "")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(ioutil.WriteFile(filepath.Join(dir, "module.zip"), []byte("module"), 0644)).To(Succeed())
+					Expect(outputDest.Close()).To(Succeed())
+
+					_, nextOutput, _, err := repo.Create(jobId, "")
+					Expect(err).NotTo(HaveOccurred())
+					defer nextOutput.Close()
+					Expect(jobs.CacheDir(nextOutput, cache, "")).To(Equal(dir))
+					Expect(ioutil.ReadFile(filepath.Join(dir, "module.zip"))).To(Equal([]byte("module")))
+
+					highest, err := repo.HighestBuild(jobId)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(highest).To(Equal(buildNumber + 1))
+				})
+
+				It("keeps a cache for each key", func() {
+					first, err := jobs.CacheDir(outputDest, cache, "abc")
+					Expect(err).NotTo(HaveOccurred())
+					second, err := jobs.CacheDir(outputDest, cache, "def")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(first).NotTo(Equal(second))
+				})
+
+				It("shares them with cells of a matrix", func() {
+					dir, err := jobs.CacheDir(outputDest, cache, "")
+					Expect(err).NotTo(HaveOccurred())
+					_, cellOutput, _, err := repo.CreateCell(jobId, buildNumber, jobs.Cell{Name: "golang:1.22"})
+					Expect(err).NotTo(HaveOccurred())
+					defer cellOutput.Close()
+					Expect(jobs.CacheDir(cellOutput, cache, "")).To(Equal(dir))
+				})
+
+				It("clears them", func() {
+					dir, err := jobs.CacheDir(outputDest, cache, "")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(ioutil.WriteFile(filepath.Join(dir, "module.zip"), []byte("module"), 0644)).To(Succeed())
+
+					Expect(repo.ClearCaches(jobId)).To(Succeed())
+					Expect(filepath.Join(dir, "module.zip")).NotTo(BeAnExistingFile())
+					files, err := ioutil.ReadDir(filepath.Join(buildsDir, jobId))
+					Expect(err).NotTo(HaveOccurred())
+					for _, file := range files {
+						Expect(file.Name()).NotTo(HavePrefix("caches"))
+					}
+				})
+
+				It("clears nothing when the job has no caches", func() {
+					Expect(repo.ClearCaches("other-id")).To(Succeed())
+				})
+			})
+
+			Context("when the build is of a matrix", func() {
+				It("keeps a build of each cell", func() {
+					first, firstOutput, firstStatus, err := repo.CreateCell(jobId, buildNumber, jobs.Cell{Name: "golang:1.21"})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(first).To(Equal(1))
+					second, secondOutput, _, err := repo.CreateCell(jobId, buildNumber, jobs.Cell{Name: "golang:1.22", AllowFailure: true})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(second).To(Equal(2))
+
+					_, err = firstOutput.Write([]byte("cell output"))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(firstOutput.Close()).To(Succeed())
+					Expect(secondOutput.Close()).To(Succeed())
+					firstStatus <- 3
+					Eventually(func() bool {
+						cell, err := repo.FindCell(jobId, buildNumber, first)
+						Expect(err).NotTo(HaveOccurred())
+						return cell.Finished
+					}).Should(BeTrue())
+
+					cell, err := repo.FindCell(jobId, buildNumber, first)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(cell.Output).To(Equal([]byte("cell output")))
+					Expect(cell.ExitStatus).To(Equal(uint32(3)))
+
+					b, err := repo.Find(jobId, buildNumber)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b.Cells).To(Equal([]jobs.Build{
+						{Variant: "golang:1.21", Finished: true, ExitStatus: 3},
+						{Variant: "golang:1.22", AllowFailure: true},
+					}))
+
+					highest, err := repo.HighestBuild(jobId)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(highest).To(Equal(buildNumber))
+				})
+			})
+
+			Context("when the build awaits approval", func() {
+				var decided chan jobs.Approval
+
+				JustBeforeEach(func() {
+					decided = make(chan jobs.Approval, 1)
+					go func() {
+						defer GinkgoRecover()
+						approval, err := outputDest.(jobs.ApprovalWaiter).AwaitApproval(context.Background())
+						Expect(err).NotTo(HaveOccurred())
+						decided <- approval
+					}()
+
+					Eventually(func() bool {
+						b, err := repo.Find(jobId, buildNumber)
+						Expect(err).NotTo(HaveOccurred())
+						return b.AwaitingApproval
+					}).Should(BeTrue())
+				})
+
+				It("resumes the build once it is decided", func() {
+					approval := jobs.Approval{Approved: true, Approver: "alice", At: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)}
+					Consistently(decided).ShouldNot(Receive())
+					Expect(repo.Decide(jobId, buildNumber, approval)).To(Succeed())
+					Eventually(decided, "2s").Should(Receive(Equal(approval)))
+
+					b, err := repo.Find(jobId, buildNumber)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b.AwaitingApproval).To(BeFalse())
+					Expect(b.Approval).To(Equal(&approval))
+				})
+
+				It("can only be decided once", func() {
+					Expect(repo.Decide(jobId, buildNumber, jobs.Approval{Approver: "alice"})).To(Succeed())
+					Expect(repo.Decide(jobId, buildNumber, jobs.Approval{Approved: true, Approver: "bob"})).To(MatchError(ContainSubstring("was already decided: Rejected by alice")))
+					Eventually(decided, "2s").Should(Receive())
+				})
+			})
+
+			Context("when the build is not awaiting approval", func() {
+				It("cannot be decided", func() {
+					Expect(repo.Decide(jobId, buildNumber, jobs.Approval{Approver: "alice"})).To(MatchError(fmt.Sprintf("build %d of job %s is not awaiting approval", buildNumber, jobId)))
+				})
+			})
+
+			Context("when the build is retried", func() {
+				It("keeps each attempt separately", func() {
+					first, firstOutput, firstStatus, err := repo.CreateAttempt(jobId, buildNumber)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(first).To(Equal(1))
+					_, err = firstOutput.Write([]byte("flaked"))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(firstOutput.Close()).To(Succeed())
+					firstStatus <- 1
+
+					second, secondOutput, _, err := repo.CreateAttempt(jobId, buildNumber)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(second).To(Equal(2))
+					Expect(secondOutput.Close()).To(Succeed())
+
+					Eventually(func() bool {
+						attempt, err := repo.FindAttempt(jobId, buildNumber, first)
+						Expect(err).NotTo(HaveOccurred())
+						return attempt.Finished
+					}).Should(BeTrue())
+
+					attempt, err := repo.FindAttempt(jobId, buildNumber, first)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(attempt.Output).To(Equal([]byte("flaked")))
+
+					b, err := repo.Find(jobId, buildNumber)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(b.Attempts).To(Equal([]jobs.Build{
+						{Finished: true, ExitStatus: 1},
+						{},
+					}))
+
+					highest, err := repo.HighestBuild(jobId)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(highest).To(Equal(buildNumber))
+				})
+			})
+
 			Context("when another build for the same job is created", func() {
 				It("is the second build for this job", func() {
-					n, o, c, err := repo.Create(jobId)
+					n, o, c, err := repo.Create(jobId, "")
 					defer o.Close()
 
 					Expect(err).NotTo(HaveOccurred())
@@ -102,6 +338,42 @@ var _ = Describe("BuildRepository", func() {
 						Expect(b.Output).To(Equal([]byte("output from build")))
 						Expect(b.ExitStatus).To(Equal(uint32(42)))
 						Expect(b.Finished).To(BeTrue())
+						Expect(b.Revisions).To(BeEmpty())
+					})
+
+					It("is not a variant of the job", func() {
+						Expect(b.Variant).To(BeEmpty())
+					})
+
+					Context("when the revisions of the build's inputs were recorded", func() {
+						It("returns them", func() {
+							Expect(jobs.RecordRevision(outputDest, jobs.Revision{Revision: "abc123"})).To(Succeed())
+							Expect(jobs.RecordRevision(outputDest, jobs.Revision{Input: "lib", Revision: "def456"})).To(Succeed())
+
+							b, err := repo.Find(jobId, buildNumber)
+							Expect(err).NotTo(HaveOccurred())
+							Expect(b.Revisions).To(Equal([]jobs.Revision{
+								{Revision: "abc123"},
+								{Input: "lib", Revision: "def456"},
+							}))
+						})
+					})
+
+					Context("when the build's inputs were recorded", func() {
+						It("returns them", func() {
+							values := []jobs.ParameterValue{{Name: "TARGET", Value: "staging"}, {Name: "DRY_RUN", Value: "true"}}
+							Expect(jobs.RecordInputs(outputDest, jobs.BuildInputs{
+								DockerImage: "golang:1.22",
+								Parameters:  values,
+								RebuildOf:   3,
+							})).To(Succeed())
+
+							b, err := repo.Find(jobId, buildNumber)
+							Expect(err).NotTo(HaveOccurred())
+							Expect(b.ParameterValues).To(Equal(values))
+							Expect(b.Image).To(Equal("golang:1.22"))
+							Expect(b.RebuildOf).To(Equal(3))
+						})
 					})
 
 					Context("when no builds exist for the given Job", func() {
@@ -114,7 +386,7 @@ var _ = Describe("BuildRepository", func() {
 
 				Context("when another build is created", func() {
 					JustBeforeEach(func() {
-						_, _, _, err := repo.Create("some-other-id")
+						_, _, _, err := repo.Create("some-other-id", "")
 						Expect(err).NotTo(HaveOccurred())
 					})
 
@@ -29,3 +29,7 @@ func (r *Repository) Stream(jobId string, buildNumber int, startAtByte int64) (*
 		Buffer:      make([]byte, 4096),
 	}, nil
 }
+
+func (r *Repository) StreamCell(jobId string, buildNumber, cellNumber int, startAtByte int64) (*chunkedio.ChunkedReader, error) {
+	return r.cells(jobId, buildNumber).Stream("", cellNumber, startAtByte)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/craigfurman/woodhouse-ci/agents"
+	"github.com/craigfurman/woodhouse-ci/jobs"
+	"github.com/craigfurman/woodhouse-ci/runner"
+	"github.com/craigfurman/woodhouse-ci/vcs"
+)
+
+func main() {
+	serverURL := flag.String("server", "http://localhost:8080", "URL of the Woodhouse server")
+	tokenFile := flag.String("registrationTokenFile", "", "file containing the server's agent registration token")
+	name := flag.String("name", "", "name shown on the server's agents page. Defaults to the hostname")
+	labels := flag.String("labels", "", "comma separated labels advertised to the server, e.g. linux,arm64")
+	slots := flag.Int("slots", 1, "maximum number of builds to run at once")
+	containerRuntime := flag.String("containerRuntime", jobs.RunnerDocker, `container runtime for jobs with a docker image: "docker" or "podman"`)
+	dockerHost := flag.String("dockerHost", "unix:///var/run/docker.sock", "address of the Docker Engine API")
+	gitMirrorDir := flag.String("gitMirrorDir", "", "directory for mirrors of git repositories, to speed up checkouts. Empty disables mirroring")
+	localTimeout := flag.Duration("localTimeout", time.Hour, "maximum duration of jobs without a docker image. 0 means no limit")
+	flag.Parse()
+
+	if *tokenFile == "" {
+		log.Fatal("-registrationTokenFile is required")
+	}
+	token, err := ioutil.ReadFile(*tokenFile)
+	must(err)
+
+	if *name == "" {
+		*name, err = os.Hostname()
+		must(err)
+	}
+
+	dockerClient, err := runner.NewDockerClient(*dockerHost)
+	must(err)
+	sources := vcs.Registry{
+		jobs.SourceGit:       vcs.GitCloner{MirrorDir: *gitMirrorDir},
+		jobs.SourceMercurial: vcs.MercurialCloner{},
+		jobs.SourceArchive:   vcs.ArchiveFetcher{},
+	}
+	dockerRunner := runner.NewDockerAPIRunner(dockerClient, sources)
+
+	jobRunner := runner.Dispatcher{
+		jobs.RunnerLocal: runner.NewLocalRunner(sources, *localTimeout),
+	}
+	switch *containerRuntime {
+	case jobs.RunnerDocker:
+		if err := dockerRunner.RemoveContainers(context.Background()); err != nil {
+			log.Printf("error removing containers left over from previous run: %v\n", err)
+		}
+		jobRunner[jobs.RunnerContainer] = dockerRunner
+	case jobs.RunnerPodman:
+		jobRunner[jobs.RunnerContainer] = runner.NewPodmanRunner(sources)
+	default:
+		log.Fatalf("unsupported container runtime: %s\n", *containerRuntime)
+	}
+
+	var agentLabels []string
+	for _, label := range strings.Split(*labels, ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			agentLabels = append(agentLabels, label)
+		}
+	}
+
+	worker := &agents.Worker{
+		Client:            agents.NewClient(*serverURL, strings.TrimSpace(string(token))),
+		Runner:            jobRunner,
+		Name:              *name,
+		Labels:            agentLabels,
+		Slots:             *slots,
+		HeartbeatInterval: time.Second * 10,
+		RetryInterval:     time.Second * 5,
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	exitChan := make(chan os.Signal, 1)
+	signal.Notify(exitChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		log.Printf("Caught signal %s. Stopping running builds\n", <-exitChan)
+		stop()
+	}()
+
+	log.Printf("woodhouse-agent connecting to %s\n", *serverURL)
+	worker.Work(ctx)
+
+	if err := vcs.RemoveTempDirs(); err != nil {
+		log.Printf("error removing temporary checkouts: %v\n", err)
+	}
+	log.Println("Goodbye!")
+}
+
+func must(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
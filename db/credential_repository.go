@@ -0,0 +1,93 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+	"github.com/craigfurman/woodhouse-ci/secrets"
+)
+
+// CredentialRepository stores git credentials with their secrets encrypted.
+type CredentialRepository struct {
+	db  *sql.DB
+	key secrets.Key
+}
+
+func NewCredentialRepository(dbPath string, key secrets.Key) (*CredentialRepository, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CredentialRepository{
+		db:  db,
+		key: key,
+	}, nil
+}
+
+// List returns every credential without its secret.
+func (repo *CredentialRepository) List() ([]jobs.GitCredential, error) {
+	rows, err := repo.db.Query("SELECT name, type, username, knownhosts FROM gitcredentials ORDER BY name")
+	if err != nil {
+		return []jobs.GitCredential{}, err
+	}
+	defer rows.Close()
+
+	list := []jobs.GitCredential{}
+	for rows.Next() {
+		var credential jobs.GitCredential
+		if err := rows.Scan(&credential.Name, &credential.Type, &credential.Username, &credential.KnownHosts); err != nil {
+			return list, err
+		}
+		list = append(list, credential)
+	}
+	return list, rows.Err()
+}
+
+// Save creates a credential, or replaces the one with the same name.
+func (repo *CredentialRepository) Save(credential *jobs.GitCredential) error {
+	if err := credential.Validate(); err != nil {
+		return err
+	}
+
+	secret, err := repo.key.Encrypt([]byte(credential.Secret))
+	if err != nil {
+		return fmt.Errorf("saving credential: %s. Cause: %v", credential.Name, err)
+	}
+	_, err = repo.db.Exec(
+		"INSERT OR REPLACE INTO gitcredentials(name, type, username, knownhosts, secret) VALUES(?, ?, ?, ?, ?)",
+		credential.Name,
+		credential.Type,
+		credential.Username,
+		credential.KnownHosts,
+		secret,
+	)
+	return err
+}
+
+func (repo *CredentialRepository) Find(name string) (jobs.GitCredential, error) {
+	credential := jobs.GitCredential{Name: name}
+	var secret []byte
+	err := repo.db.QueryRow("SELECT type, username, knownhosts, secret FROM gitcredentials WHERE name=?", name).
+		Scan(&credential.Type, &credential.Username, &credential.KnownHosts, &secret)
+	if err != nil {
+		return jobs.GitCredential{}, fmt.Errorf("no credential found with name: %s. Cause: %v", name, err)
+	}
+
+	plaintext, err := repo.key.Decrypt(secret)
+	if err != nil {
+		return jobs.GitCredential{}, fmt.Errorf("reading credential: %s. Cause: %v", name, err)
+	}
+	credential.Secret = string(plaintext)
+	return credential, nil
+}
+
+func (repo *CredentialRepository) Delete(name string) error {
+	_, err := repo.db.Exec("DELETE FROM gitcredentials WHERE name=?", name)
+	return err
+}
+
+func (repo *CredentialRepository) Close() error {
+	return repo.db.Close()
+}
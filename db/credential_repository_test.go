@@ -0,0 +1,98 @@
+package db_test
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/craigfurman/woodhouse-ci/db"
+	"github.com/craigfurman/woodhouse-ci/jobs"
+	"github.com/craigfurman/woodhouse-ci/secrets"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CredentialRepository", func() {
+	var (
+		repo       *db.CredentialRepository
+		dbPath     string
+		keyDir     string
+		key        secrets.Key
+		credential jobs.GitCredential
+	)
+
+	BeforeEach(func() {
+		cwd, err := os.Getwd()
+		Expect(err).NotTo(HaveOccurred())
+		dbPath = filepath.Join(cwd, "sqlite", "store.db")
+		os.Remove(dbPath)
+		migrateCmd := exec.Command("goose", "up")
+		migrateCmd.Dir = filepath.Join(cwd, "..")
+		migrateCmd.Stdout = GinkgoWriter
+		migrateCmd.Stderr = GinkgoWriter
+		Expect(migrateCmd.Run()).To(Succeed())
+
+		keyDir, err = ioutil.TempDir("", "credential-repository-tests")
+		Expect(err).NotTo(HaveOccurred())
+		key = secrets.Key{Path: filepath.Join(keyDir, "key")}
+		Expect(key.Ensure()).To(Succeed())
+
+		repo, err = db.NewCredentialRepository(dbPath, key)
+		Expect(err).NotTo(HaveOccurred())
+
+		credential = jobs.GitCredential{
+			Name:       "deploy-key",
+			Type:       jobs.CredentialSSH,
+			Secret:     "private key",
+			KnownHosts: "github.com ssh-ed25519 AAAA",
+		}
+		Expect(repo.Save(&credential)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(repo.Close()).To(Succeed())
+		Expect(os.RemoveAll(keyDir)).To(Succeed())
+	})
+
+	It("finds credentials with their secrets", func() {
+		Expect(repo.Find("deploy-key")).To(Equal(credential))
+	})
+
+	It("lists credentials without their secrets", func() {
+		credential.Secret = ""
+		Expect(repo.List()).To(ConsistOf(credential))
+	})
+
+	It("encrypts secrets", func() {
+		conn, err := sql.Open("sqlite3", dbPath)
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+
+		var secret []byte
+		Expect(conn.QueryRow("SELECT secret FROM gitcredentials").Scan(&secret)).To(Succeed())
+		Expect(string(secret)).NotTo(ContainSubstring("private key"))
+	})
+
+	It("replaces credentials with the same name", func() {
+		credential.Secret = "rotated key"
+		Expect(repo.Save(&credential)).To(Succeed())
+		Expect(repo.Find("deploy-key")).To(Equal(credential))
+	})
+
+	It("deletes credentials", func() {
+		Expect(repo.Delete("deploy-key")).To(Succeed())
+		_, err := repo.Find("deploy-key")
+		Expect(err).To(MatchError(ContainSubstring("no credential found with name: deploy-key")))
+	})
+
+	Context("when the credential is invalid", func() {
+		It("does not save it", func() {
+			err := repo.Save(&jobs.GitCredential{Name: "no-hosts", Type: jobs.CredentialSSH, Secret: "key"})
+			Expect(err).To(MatchError(ContainSubstring("needs known_hosts entries")))
+			Expect(repo.List()).To(HaveLen(1))
+		})
+	})
+})
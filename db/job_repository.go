@@ -2,7 +2,9 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/craigfurman/woodhouse-ci/jobs"
 
@@ -10,6 +12,8 @@ import (
 	"github.com/pborman/uuid"
 )
 
+const jobColumns = "id, name, command, dockerimage, gitrepository, runnertype, agentlabels, checkoutdepth, singlebranch, submodules, sparsepaths, gitcredential, sourcetype, checkoutref, inputs, includepaths, excludepaths, matrix, upstream, artifacts, parameters, retry, approval, concurrency, locks, caches, services, dockerfile, container"
+
 type JobRepository struct {
 	db *sql.DB
 }
@@ -26,15 +30,15 @@ func NewJobRepository(dbPath string) (*JobRepository, error) {
 }
 
 func (repo *JobRepository) List() ([]jobs.Job, error) {
-	jobRows, err := repo.db.Query("SELECT * FROM jobs")
+	jobRows, err := repo.db.Query("SELECT " + jobColumns + " FROM jobs")
 	if err != nil {
 		return []jobs.Job{}, err
 	}
 
 	list := []jobs.Job{}
 	for jobRows.Next() {
-		var job jobs.Job
-		if err := jobRows.Scan(&job.ID, &job.Name, &job.Command, &job.DockerImage, &job.GitRepository); err != nil {
+		job, err := scanJob(jobRows)
+		if err != nil {
 			return list, err
 		}
 		list = append(list, job)
@@ -44,21 +48,98 @@ func (repo *JobRepository) List() ([]jobs.Job, error) {
 
 func (repo *JobRepository) Save(job *jobs.Job) error {
 	job.ID = uuid.New()
-	_, err := repo.db.Exec(
-		"INSERT INTO jobs(id, name, command, dockerimage, gitrepository) VALUES(?, ?, ?, ?, ?)",
+	if job.RunnerType == "" {
+		job.RunnerType = jobs.RunnerContainer
+	}
+	if job.SourceType == "" {
+		job.SourceType = jobs.SourceGit
+	}
+	if job.Checkout.Submodules == "" {
+		job.Checkout.Submodules = jobs.SubmodulesRecursive
+	}
+	for i := range job.Inputs {
+		if job.Inputs[i].SourceType == "" {
+			job.Inputs[i].SourceType = jobs.SourceGit
+		}
+		if job.Inputs[i].Checkout.Submodules == "" {
+			job.Inputs[i].Checkout.Submodules = jobs.SubmodulesRecursive
+		}
+	}
+	inputs, err := encodeInputs(job.Inputs)
+	if err != nil {
+		return err
+	}
+	matrix, err := encodeMatrix(job.Matrix)
+	if err != nil {
+		return err
+	}
+	parameters, err := encodeParameters(job.Parameters)
+	if err != nil {
+		return err
+	}
+	retry, err := encodeRetryPolicy(job.Retry)
+	if err != nil {
+		return err
+	}
+	approval, err := encodeApprovalGate(job.Approval)
+	if err != nil {
+		return err
+	}
+	locks, err := encodeLocks(job.Locks)
+	if err != nil {
+		return err
+	}
+	caches, err := encodeCaches(job.Caches)
+	if err != nil {
+		return err
+	}
+	services, err := encodeServices(job.Services)
+	if err != nil {
+		return err
+	}
+	container, err := encodeContainerOptions(job.Container)
+	if err != nil {
+		return err
+	}
+
+	_, err = repo.db.Exec(
+		"INSERT INTO jobs("+jobColumns+") VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
 		job.ID,
 		job.Name,
 		job.Command,
 		job.DockerImage,
-		job.GitRepository,
+		job.Repository,
+		job.RunnerType,
+		strings.Join(job.AgentLabels, ","),
+		job.Checkout.Depth,
+		job.Checkout.SingleBranch,
+		job.Checkout.Submodules,
+		strings.Join(job.Checkout.SparsePaths, "\n"),
+		job.Checkout.CredentialName,
+		job.SourceType,
+		job.Checkout.Ref,
+		inputs,
+		strings.Join(job.Paths.Include, "\n"),
+		strings.Join(job.Paths.Exclude, "\n"),
+		matrix,
+		strings.Join(job.Upstream, ","),
+		strings.Join(job.Artifacts, "\n"),
+		parameters,
+		retry,
+		approval,
+		job.Concurrency,
+		locks,
+		caches,
+		services,
+		job.Dockerfile,
+		container,
 	)
 	return err
 }
 
 func (repo *JobRepository) FindById(id string) (jobs.Job, error) {
-	job := jobs.Job{ID: id}
-	if err := repo.db.QueryRow("SELECT name, command, dockerimage, gitrepository FROM jobs WHERE id=?", id).
-		Scan(&job.Name, &job.Command, &job.DockerImage, &job.GitRepository); err != nil {
+	job, err := scanJob(repo.db.QueryRow("SELECT "+jobColumns+" FROM jobs WHERE id=?", id))
+	if err != nil {
 		return jobs.Job{}, fmt.Errorf("no job found with ID: %s. Cause: %v", id, err)
 	}
 	return job, nil
@@ -67,3 +148,185 @@ func (repo *JobRepository) FindById(id string) (jobs.Job, error) {
 func (repo *JobRepository) Close() error {
 	return repo.db.Close()
 }
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanJob(row scanner) (jobs.Job, error) {
+	var job jobs.Job
+	var agentLabels, sparsePaths, inputs, includePaths, excludePaths, matrix, upstream, artifacts, parameters, retry, approval, locks, caches, services, container string
+	err := row.Scan(
+		&job.ID,
+		&job.Name,
+		&job.Command,
+		&job.DockerImage,
+		&job.Repository,
+		&job.RunnerType,
+		&agentLabels,
+		&job.Checkout.Depth,
+		&job.Checkout.SingleBranch,
+		&job.Checkout.Submodules,
+		&sparsePaths,
+		&job.Checkout.CredentialName,
+		&job.SourceType,
+		&job.Checkout.Ref,
+		&inputs,
+		&includePaths,
+		&excludePaths,
+		&matrix,
+		&upstream,
+		&artifacts,
+		&parameters,
+		&retry,
+		&approval,
+		&job.Concurrency,
+		&locks,
+		&caches,
+		&services,
+		&job.Dockerfile,
+		&container,
+	)
+	if err != nil {
+		return job, err
+	}
+	job.AgentLabels = splitList(agentLabels, ",")
+	job.Checkout.SparsePaths = splitList(sparsePaths, "\n")
+	job.Paths = jobs.PathFilter{Include: splitList(includePaths, "\n"), Exclude: splitList(excludePaths, "\n")}
+	job.Upstream = splitList(upstream, ",")
+	job.Artifacts = splitList(artifacts, "\n")
+	if inputs != "" {
+		if err := json.Unmarshal([]byte(inputs), &job.Inputs); err != nil {
+			return job, fmt.Errorf("parsing inputs of job %s. Cause: %v", job.ID, err)
+		}
+	}
+	if matrix != "" {
+		if err := json.Unmarshal([]byte(matrix), &job.Matrix); err != nil {
+			return job, fmt.Errorf("parsing matrix of job %s. Cause: %v", job.ID, err)
+		}
+	}
+	if parameters != "" {
+		if err := json.Unmarshal([]byte(parameters), &job.Parameters); err != nil {
+			return job, fmt.Errorf("parsing parameters of job %s. Cause: %v", job.ID, err)
+		}
+	}
+	if retry != "" {
+		if err := json.Unmarshal([]byte(retry), &job.Retry); err != nil {
+			return job, fmt.Errorf("parsing retry policy of job %s. Cause: %v", job.ID, err)
+		}
+	}
+	if approval != "" {
+		if err := json.Unmarshal([]byte(approval), &job.Approval); err != nil {
+			return job, fmt.Errorf("parsing approval gate of job %s. Cause: %v", job.ID, err)
+		}
+	}
+	if locks != "" {
+		if err := json.Unmarshal([]byte(locks), &job.Locks); err != nil {
+			return job, fmt.Errorf("parsing locks of job %s. Cause: %v", job.ID, err)
+		}
+	}
+	if caches != "" {
+		if err := json.Unmarshal([]byte(caches), &job.Caches); err != nil {
+			return job, fmt.Errorf("parsing caches of job %s. Cause: %v", job.ID, err)
+		}
+	}
+	if services != "" {
+		if err := json.Unmarshal([]byte(services), &job.Services); err != nil {
+			return job, fmt.Errorf("parsing services of job %s. Cause: %v", job.ID, err)
+		}
+	}
+	if container != "" {
+		if err := json.Unmarshal([]byte(container), &job.Container); err != nil {
+			return job, fmt.Errorf("parsing container options of job %s. Cause: %v", job.ID, err)
+		}
+	}
+	return job, nil
+}
+
+// Inputs are stored as JSON, without their credentials
+func encodeInputs(inputs []jobs.Input) (string, error) {
+	if len(inputs) == 0 {
+		return "", nil
+	}
+
+	stored := make([]jobs.Input, len(inputs))
+	for i, input := range inputs {
+		input.Checkout.Credential = nil
+		stored[i] = input
+	}
+	encoded, err := json.Marshal(stored)
+	return string(encoded), err
+}
+
+func encodeMatrix(matrix jobs.Matrix) (string, error) {
+	if matrix.Empty() {
+		return "", nil
+	}
+	encoded, err := json.Marshal(matrix)
+	return string(encoded), err
+}
+
+func encodeParameters(parameters []jobs.Parameter) (string, error) {
+	if len(parameters) == 0 {
+		return "", nil
+	}
+	encoded, err := json.Marshal(parameters)
+	return string(encoded), err
+}
+
+func encodeRetryPolicy(policy jobs.RetryPolicy) (string, error) {
+	if !policy.Enabled() {
+		return "", nil
+	}
+	encoded, err := json.Marshal(policy)
+	return string(encoded), err
+}
+
+func encodeApprovalGate(gate jobs.ApprovalGate) (string, error) {
+	if !gate.Required {
+		return "", nil
+	}
+	encoded, err := json.Marshal(gate)
+	return string(encoded), err
+}
+
+func encodeLocks(locks []jobs.Lock) (string, error) {
+	if len(locks) == 0 {
+		return "", nil
+	}
+	encoded, err := json.Marshal(locks)
+	return string(encoded), err
+}
+
+func encodeCaches(caches []jobs.Cache) (string, error) {
+	if len(caches) == 0 {
+		return "", nil
+	}
+	encoded, err := json.Marshal(caches)
+	return string(encoded), err
+}
+
+func encodeServices(services []jobs.ServiceContainer) (string, error) {
+	if len(services) == 0 {
+		return "", nil
+	}
+	encoded, err := json.Marshal(services)
+	return string(encoded), err
+}
+
+func encodeContainerOptions(options jobs.ContainerOptions) (string, error) {
+	encoded, err := json.Marshal(options)
+	if err != nil || string(encoded) == "{}" {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// Agent labels and upstream job IDs are stored comma separated, and paths one
+// per line
+func splitList(list, separator string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, separator)
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"time"
 
 	"github.com/craigfurman/woodhouse-ci/db"
 	"github.com/craigfurman/woodhouse-ci/jobs"
@@ -43,10 +44,17 @@ var _ = Describe("JobRepository", func() {
 
 		BeforeEach(func() {
 			savedJob = &jobs.Job{
-				Name:          "myFancyJob",
-				Command:       "my CI script",
-				DockerImage:   "someUser/someName:someTag",
-				GitRepository: "sweet potato",
+				Name:        "myFancyJob",
+				Command:     "my CI script",
+				DockerImage: "someUser/someName:someTag",
+				Repository:  "sweet potato",
+				SourceType:  jobs.SourceArchive,
+				RunnerType:  jobs.RunnerLocal,
+				Checkout: jobs.CheckoutOptions{
+					Depth:       1,
+					Submodules:  jobs.SubmodulesTopLevel,
+					SparsePaths: []string{"src", "docs"},
+				},
 			}
 			saveJobErr = repo.Save(savedJob)
 		})
@@ -64,11 +72,18 @@ var _ = Describe("JobRepository", func() {
 				list, err := repo.List()
 				Expect(err).NotTo(HaveOccurred())
 				Expect(list).To(ConsistOf(jobs.Job{
-					ID:            savedJob.ID,
-					Name:          "myFancyJob",
-					Command:       "my CI script",
-					DockerImage:   "someUser/someName:someTag",
-					GitRepository: "sweet potato",
+					ID:          savedJob.ID,
+					Name:        "myFancyJob",
+					Command:     "my CI script",
+					DockerImage: "someUser/someName:someTag",
+					Repository:  "sweet potato",
+					SourceType:  jobs.SourceArchive,
+					RunnerType:  jobs.RunnerLocal,
+					Checkout: jobs.CheckoutOptions{
+						Depth:       1,
+						Submodules:  jobs.SubmodulesTopLevel,
+						SparsePaths: []string{"src", "docs"},
+					},
 				}))
 			})
 
@@ -76,16 +91,233 @@ var _ = Describe("JobRepository", func() {
 			PContext("when listing jobs fails", func() {})
 		})
 
+		Context("when the job does not specify a runner, source type or checkout options", func() {
+			It("defaults to running in a container", func() {
+				job := &jobs.Job{Name: "defaulted", Command: "ls"}
+				Expect(repo.Save(job)).To(Succeed())
+				found, err := repo.FindById(job.ID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(found.RunnerType).To(Equal(jobs.RunnerContainer))
+			})
+
+			It("defaults to checking out submodules recursively", func() {
+				job := &jobs.Job{Name: "defaulted", Command: "ls"}
+				Expect(repo.Save(job)).To(Succeed())
+				found, err := repo.FindById(job.ID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(found.Checkout).To(Equal(jobs.CheckoutOptions{Submodules: jobs.SubmodulesRecursive}))
+			})
+
+			It("defaults to fetching the source with git", func() {
+				job := &jobs.Job{Name: "defaulted", Command: "ls"}
+				Expect(repo.Save(job)).To(Succeed())
+				found, err := repo.FindById(job.ID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(found.SourceType).To(Equal(jobs.SourceGit))
+			})
+		})
+
+		Context("when the job requires agent labels", func() {
+			It("saves the labels", func() {
+				job := &jobs.Job{Name: "arm", Command: "make", RunnerType: jobs.RunnerAgent, AgentLabels: []string{"linux", "arm64"}}
+				Expect(repo.Save(job)).To(Succeed())
+				found, err := repo.FindById(job.ID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(found.AgentLabels).To(Equal([]string{"linux", "arm64"}))
+			})
+		})
+
+		Context("when the job fetches with a git credential", func() {
+			It("saves the credential name", func() {
+				job := &jobs.Job{Name: "private", Command: "make", Checkout: jobs.CheckoutOptions{CredentialName: "deploy-key"}}
+				Expect(repo.Save(job)).To(Succeed())
+				found, err := repo.FindById(job.ID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(found.Checkout.CredentialName).To(Equal("deploy-key"))
+			})
+		})
+
+		Context("when the job has a ref and other inputs", func() {
+			It("saves them", func() {
+				job := &jobs.Job{
+					Name:       "integration",
+					Command:    "make",
+					Repository: "https://example.com/app.git",
+					Checkout:   jobs.CheckoutOptions{Ref: "release"},
+					Inputs: []jobs.Input{
+						{Name: "lib", Repository: "https://example.com/lib.git", Checkout: jobs.CheckoutOptions{Ref: "v1.2", CredentialName: "deploy-key"}},
+						{Name: "assets", SourceType: jobs.SourceArchive, Repository: "https://example.com/assets.tar.gz"},
+					},
+				}
+				Expect(repo.Save(job)).To(Succeed())
+				found, err := repo.FindById(job.ID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(found.Checkout.Ref).To(Equal("release"))
+				Expect(found.Inputs).To(Equal([]jobs.Input{
+					{Name: "lib", SourceType: jobs.SourceGit, Repository: "https://example.com/lib.git", Checkout: jobs.CheckoutOptions{Ref: "v1.2", Submodules: jobs.SubmodulesRecursive, CredentialName: "deploy-key"}},
+					{Name: "assets", SourceType: jobs.SourceArchive, Repository: "https://example.com/assets.tar.gz", Checkout: jobs.CheckoutOptions{Submodules: jobs.SubmodulesRecursive}},
+				}))
+			})
+		})
+
+		Context("when the job has path filters", func() {
+			It("saves them", func() {
+				job := &jobs.Job{Name: "api", Command: "make", Paths: jobs.PathFilter{Include: []string{"services/api/", "libs/"}, Exclude: []string{"*.md"}}}
+				Expect(repo.Save(job)).To(Succeed())
+				found, err := repo.FindById(job.ID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(found.Paths).To(Equal(job.Paths))
+			})
+		})
+
+		Context("when the job is part of a pipeline", func() {
+			It("saves its upstream jobs and artifacts", func() {
+				job := &jobs.Job{Name: "deploy", Command: "make deploy", Upstream: []string{"build-id", "test-id"}, Artifacts: []string{"dist/", "*.tar.gz"}}
+				Expect(repo.Save(job)).To(Succeed())
+				found, err := repo.FindById(job.ID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(found.Upstream).To(Equal(job.Upstream))
+				Expect(found.Artifacts).To(Equal(job.Artifacts))
+			})
+		})
+
+		Context("when the job has a matrix", func() {
+			It("saves it", func() {
+				matrix := jobs.Matrix{
+					DockerImages:    []string{"golang:1.21", "golang:1.22"},
+					Env:             []string{"GOARCH=amd64", "GOARCH=386 CGO_ENABLED=0"},
+					AllowedFailures: []string{"GOARCH=386"},
+				}
+				job := &jobs.Job{Name: "lib", Command: "go test ./...", Matrix: matrix}
+				Expect(repo.Save(job)).To(Succeed())
+				found, err := repo.FindById(job.ID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(found.Matrix).To(Equal(matrix))
+			})
+		})
+
+		Context("when the job has parameters", func() {
+			It("saves them", func() {
+				parameters := []jobs.Parameter{
+					{Name: "VERSION", Type: jobs.ParameterString, Default: "latest"},
+					{Name: "TARGET", Type: jobs.ParameterChoice, Choices: []string{"staging", "production"}},
+					{Name: "DRY_RUN", Type: jobs.ParameterBoolean, Default: "true"},
+				}
+				job := &jobs.Job{Name: "deploy", Command: "make deploy", Parameters: parameters}
+				Expect(repo.Save(job)).To(Succeed())
+				found, err := repo.FindById(job.ID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(found.Parameters).To(Equal(parameters))
+			})
+		})
+
+		Context("when the job retries failed builds", func() {
+			It("saves its retry policy", func() {
+				policy := jobs.RetryPolicy{MaxAttempts: 3, ExitStatuses: []uint32{1, 2}, InfrastructureErrors: true}
+				job := &jobs.Job{Name: "flaky", Command: "make test", Retry: policy}
+				Expect(repo.Save(job)).To(Succeed())
+				found, err := repo.FindById(job.ID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(found.Retry).To(Equal(policy))
+			})
+		})
+
+		Context("when the job requires approval", func() {
+			It("saves its approval gate", func() {
+				gate := jobs.ApprovalGate{Required: true, Timeout: time.Hour}
+				job := &jobs.Job{Name: "deploy", Command: "make deploy", Approval: gate}
+				Expect(repo.Save(job)).To(Succeed())
+				found, err := repo.FindById(job.ID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(found.Approval).To(Equal(gate))
+			})
+		})
+
+		Context("when the job runs one build at a time", func() {
+			It("saves its concurrency policy", func() {
+				job := &jobs.Job{Name: "deploy", Command: "make deploy", Concurrency: jobs.ConcurrencySupersede}
+				Expect(repo.Save(job)).To(Succeed())
+				found, err := repo.FindById(job.ID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(found.Concurrency).To(Equal(jobs.ConcurrencySupersede))
+			})
+		})
+
+		Context("when the job holds locks", func() {
+			It("saves its locks", func() {
+				locks := []jobs.Lock{{Name: "staging"}, {Name: "devices", Slots: 3}}
+				job := &jobs.Job{Name: "deploy", Command: "make deploy", Locks: locks}
+				Expect(repo.Save(job)).To(Succeed())
+				found, err := repo.FindById(job.ID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(found.Locks).To(Equal(locks))
+			})
+		})
+
+		Context("when the job keeps caches", func() {
+			It("saves its caches", func() {
+				caches := []jobs.Cache{{Name: "go-modules", Path: "/go/pkg/mod", KeyFiles: []string{"go.sum"}}}
+				job := &jobs.Job{Name: "build", Command: "make", Caches: caches}
+				Expect(repo.Save(job)).To(Succeed())
+				found, err := repo.FindById(job.ID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(found.Caches).To(Equal(caches))
+			})
+
+			It("saves the options of its container", func() {
+				options := jobs.ContainerOptions{
+					CPUs:                   0.5,
+					Memory:                 1 << 30,
+					NetworkMode:            jobs.NetworkNone,
+					ReadOnlyRootFilesystem: true,
+					User:                   "nobody",
+					Volumes:                []string{"/opt/tools:/tools:ro"},
+				}
+				job := &jobs.Job{Name: "build", Command: "make", Container: options}
+				Expect(repo.Save(job)).To(Succeed())
+				found, err := repo.FindById(job.ID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(found.Container).To(Equal(options))
+			})
+
+			It("saves the path of its Dockerfile", func() {
+				job := &jobs.Job{Name: "build", Command: "make", Repository: "app.git", Dockerfile: "ci/Dockerfile"}
+				Expect(repo.Save(job)).To(Succeed())
+				found, err := repo.FindById(job.ID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(found.Dockerfile).To(Equal("ci/Dockerfile"))
+			})
+
+			It("saves its service containers", func() {
+				services := []jobs.ServiceContainer{
+					{Name: "postgres", Image: "postgres:13", Env: []string{"POSTGRES_PASSWORD=woodhouse"}, HealthCheck: "pg_isready"},
+					{Name: "redis", Image: "redis"},
+				}
+				job := &jobs.Job{Name: "build", Command: "make", Services: services}
+				Expect(repo.Save(job)).To(Succeed())
+				found, err := repo.FindById(job.ID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(found.Services).To(Equal(services))
+			})
+		})
+
 		Describe("retrieving the job", func() {
 			It("retrieves the job", func() {
 				job, err := repo.FindById(savedJob.ID)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(job).To(Equal(jobs.Job{
-					ID:            savedJob.ID,
-					Name:          "myFancyJob",
-					Command:       "my CI script",
-					DockerImage:   "someUser/someName:someTag",
-					GitRepository: "sweet potato",
+					ID:          savedJob.ID,
+					Name:        "myFancyJob",
+					Command:     "my CI script",
+					DockerImage: "someUser/someName:someTag",
+					Repository:  "sweet potato",
+					SourceType:  jobs.SourceArchive,
+					RunnerType:  jobs.RunnerLocal,
+					Checkout: jobs.CheckoutOptions{
+						Depth:       1,
+						Submodules:  jobs.SubmodulesTopLevel,
+						SparsePaths: []string{"src", "docs"},
+					},
 				}))
 			})
 
@@ -0,0 +1,7 @@
+
+-- +goose Up
+UPDATE jobs SET runnertype = 'container' WHERE runnertype = 'docker';
+
+
+-- +goose Down
+UPDATE jobs SET runnertype = 'docker' WHERE runnertype = 'container';
@@ -0,0 +1,16 @@
+-- +goose Up
+ALTER TABLE jobs ADD COLUMN agentlabels TEXT NOT NULL DEFAULT '';
+
+
+-- +goose Down
+CREATE TABLE jobs_backup(
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	command TEXT NOT NULL,
+	dockerimage TEXT NOT NULL,
+	gitrepository TEXT NOT NULL,
+	runnertype TEXT NOT NULL DEFAULT 'container'
+);
+INSERT INTO jobs_backup SELECT id, name, command, dockerimage, gitrepository, runnertype FROM jobs;
+DROP TABLE jobs;
+ALTER TABLE jobs_backup RENAME TO jobs;
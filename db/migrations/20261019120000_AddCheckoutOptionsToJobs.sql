@@ -0,0 +1,20 @@
+-- +goose Up
+ALTER TABLE jobs ADD COLUMN checkoutdepth INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE jobs ADD COLUMN singlebranch BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE jobs ADD COLUMN submodules TEXT NOT NULL DEFAULT 'recursive';
+ALTER TABLE jobs ADD COLUMN sparsepaths TEXT NOT NULL DEFAULT '';
+
+
+-- +goose Down
+CREATE TABLE jobs_backup(
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	command TEXT NOT NULL,
+	dockerimage TEXT NOT NULL,
+	gitrepository TEXT NOT NULL,
+	runnertype TEXT NOT NULL DEFAULT 'container',
+	agentlabels TEXT NOT NULL DEFAULT ''
+);
+INSERT INTO jobs_backup SELECT id, name, command, dockerimage, gitrepository, runnertype, agentlabels FROM jobs;
+DROP TABLE jobs;
+ALTER TABLE jobs_backup RENAME TO jobs;
@@ -0,0 +1,29 @@
+-- +goose Up
+CREATE TABLE gitcredentials(
+	name TEXT PRIMARY KEY,
+	type TEXT NOT NULL,
+	username TEXT NOT NULL DEFAULT '',
+	knownhosts TEXT NOT NULL DEFAULT '',
+	secret BLOB NOT NULL
+);
+ALTER TABLE jobs ADD COLUMN gitcredential TEXT NOT NULL DEFAULT '';
+
+
+-- +goose Down
+DROP TABLE gitcredentials;
+CREATE TABLE jobs_backup(
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	command TEXT NOT NULL,
+	dockerimage TEXT NOT NULL,
+	gitrepository TEXT NOT NULL,
+	runnertype TEXT NOT NULL DEFAULT 'container',
+	agentlabels TEXT NOT NULL DEFAULT '',
+	checkoutdepth INTEGER NOT NULL DEFAULT 0,
+	singlebranch BOOLEAN NOT NULL DEFAULT 0,
+	submodules TEXT NOT NULL DEFAULT 'recursive',
+	sparsepaths TEXT NOT NULL DEFAULT ''
+);
+INSERT INTO jobs_backup SELECT id, name, command, dockerimage, gitrepository, runnertype, agentlabels, checkoutdepth, singlebranch, submodules, sparsepaths FROM jobs;
+DROP TABLE jobs;
+ALTER TABLE jobs_backup RENAME TO jobs;
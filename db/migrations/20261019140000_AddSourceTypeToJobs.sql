@@ -0,0 +1,22 @@
+-- +goose Up
+ALTER TABLE jobs ADD COLUMN sourcetype TEXT NOT NULL DEFAULT 'git';
+
+
+-- +goose Down
+CREATE TABLE jobs_backup(
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	command TEXT NOT NULL,
+	dockerimage TEXT NOT NULL,
+	gitrepository TEXT NOT NULL,
+	runnertype TEXT NOT NULL DEFAULT 'container',
+	agentlabels TEXT NOT NULL DEFAULT '',
+	checkoutdepth INTEGER NOT NULL DEFAULT 0,
+	singlebranch BOOLEAN NOT NULL DEFAULT 0,
+	submodules TEXT NOT NULL DEFAULT 'recursive',
+	sparsepaths TEXT NOT NULL DEFAULT '',
+	gitcredential TEXT NOT NULL DEFAULT ''
+);
+INSERT INTO jobs_backup SELECT id, name, command, dockerimage, gitrepository, runnertype, agentlabels, checkoutdepth, singlebranch, submodules, sparsepaths, gitcredential FROM jobs;
+DROP TABLE jobs;
+ALTER TABLE jobs_backup RENAME TO jobs;
@@ -0,0 +1,29 @@
+-- +goose Up
+ALTER TABLE jobs ADD COLUMN upstream TEXT NOT NULL DEFAULT '';
+ALTER TABLE jobs ADD COLUMN artifacts TEXT NOT NULL DEFAULT '';
+
+
+-- +goose Down
+CREATE TABLE jobs_backup(
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	command TEXT NOT NULL,
+	dockerimage TEXT NOT NULL,
+	gitrepository TEXT NOT NULL,
+	runnertype TEXT NOT NULL DEFAULT 'container',
+	agentlabels TEXT NOT NULL DEFAULT '',
+	checkoutdepth INTEGER NOT NULL DEFAULT 0,
+	singlebranch BOOLEAN NOT NULL DEFAULT 0,
+	submodules TEXT NOT NULL DEFAULT 'recursive',
+	sparsepaths TEXT NOT NULL DEFAULT '',
+	gitcredential TEXT NOT NULL DEFAULT '',
+	sourcetype TEXT NOT NULL DEFAULT 'git',
+	checkoutref TEXT NOT NULL DEFAULT '',
+	inputs TEXT NOT NULL DEFAULT '',
+	includepaths TEXT NOT NULL DEFAULT '',
+	excludepaths TEXT NOT NULL DEFAULT '',
+	matrix TEXT NOT NULL DEFAULT ''
+);
+INSERT INTO jobs_backup SELECT id, name, command, dockerimage, gitrepository, runnertype, agentlabels, checkoutdepth, singlebranch, submodules, sparsepaths, gitcredential, sourcetype, checkoutref, inputs, includepaths, excludepaths, matrix FROM jobs;
+DROP TABLE jobs;
+ALTER TABLE jobs_backup RENAME TO jobs;
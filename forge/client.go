@@ -0,0 +1,70 @@
+package forge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// CommitStatus is shown by the forge next to a commit, e.g. on a pull request.
+type CommitStatus struct {
+	State       string `json:"state"`
+	TargetURL   string `json:"target_url,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	// Distinguishes statuses from different jobs for the same commit
+	Context string `json:"context"`
+}
+
+//go:generate counterfeiter -o fake_client/fake_client.go . Client
+type Client interface {
+	SetStatus(repository, commit string, status CommitStatus) error
+}
+
+// GitHubClient sets commit statuses with the GitHub API, or any forge that
+// implements the same statuses endpoint.
+type GitHubClient struct {
+	APIURL     string
+	Token      string
+	HTTPClient *http.Client
+}
+
+func NewGitHubClient(apiURL, token string) *GitHubClient {
+	return &GitHubClient{
+		APIURL:     strings.TrimSuffix(apiURL, "/"),
+		Token:      token,
+		HTTPClient: &http.Client{},
+	}
+}
+
+func (c *GitHubClient) SetStatus(repository, commit string, status CommitStatus) error {
+	body, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/repos/%s/statuses/%s", c.APIURL, repository, commit), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("setting status of %s in %s. Cause: %v", commit, repository, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("setting status of %s in %s. Cause: %s: %s", commit, repository, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
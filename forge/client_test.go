@@ -0,0 +1,58 @@
+package forge_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/craigfurman/woodhouse-ci/forge"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GitHubClient", func() {
+	var (
+		server   *httptest.Server
+		client   *forge.GitHubClient
+		request  *http.Request
+		received forge.CommitStatus
+		status   int
+	)
+
+	BeforeEach(func() {
+		status = http.StatusCreated
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			request = r
+			Expect(json.NewDecoder(r.Body).Decode(&received)).To(Succeed())
+			w.WriteHeader(status)
+			w.Write([]byte(`{"message": "some message"}`))
+		}))
+		client = forge.NewGitHubClient(server.URL+"/", "some-token")
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("sets the status of the commit", func() {
+		status := forge.CommitStatus{State: "pending", TargetURL: "http://woodhouse/jobs/1/builds/2", Description: "The build is running", Context: "woodhouse-ci/app"}
+		Expect(client.SetStatus("octocat/app", "abc123", status)).To(Succeed())
+
+		Expect(request.Method).To(Equal("POST"))
+		Expect(request.URL.Path).To(Equal("/repos/octocat/app/statuses/abc123"))
+		Expect(request.Header.Get("Authorization")).To(Equal("Bearer some-token"))
+		Expect(received).To(Equal(status))
+	})
+
+	Context("when the forge rejects the status", func() {
+		BeforeEach(func() {
+			status = http.StatusUnprocessableEntity
+		})
+
+		It("errors", func() {
+			err := client.SetStatus("octocat/app", "abc123", forge.CommitStatus{State: "bogus"})
+			Expect(err).To(MatchError(`setting status of abc123 in octocat/app. Cause: 422 Unprocessable Entity: {"message": "some message"}`))
+		})
+	})
+})
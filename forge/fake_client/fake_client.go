@@ -0,0 +1,57 @@
+// This file was generated by counterfeiter
+package fake_client
+
+import (
+	"sync"
+
+	"github.com/craigfurman/woodhouse-ci/forge"
+)
+
+type FakeClient struct {
+	SetStatusStub        func(repository string, commit string, status forge.CommitStatus) error
+	setStatusMutex       sync.RWMutex
+	setStatusArgsForCall []struct {
+		repository string
+		commit     string
+		status     forge.CommitStatus
+	}
+	setStatusReturns struct {
+		result1 error
+	}
+}
+
+func (fake *FakeClient) SetStatus(repository string, commit string, status forge.CommitStatus) error {
+	fake.setStatusMutex.Lock()
+	fake.setStatusArgsForCall = append(fake.setStatusArgsForCall, struct {
+		repository string
+		commit     string
+		status     forge.CommitStatus
+	}{repository, commit, status})
+	fake.setStatusMutex.Unlock()
+	if fake.SetStatusStub != nil {
+		return fake.SetStatusStub(repository, commit, status)
+	} else {
+		return fake.setStatusReturns.result1
+	}
+}
+
+func (fake *FakeClient) SetStatusCallCount() int {
+	fake.setStatusMutex.RLock()
+	defer fake.setStatusMutex.RUnlock()
+	return len(fake.setStatusArgsForCall)
+}
+
+func (fake *FakeClient) SetStatusArgsForCall(i int) (string, string, forge.CommitStatus) {
+	fake.setStatusMutex.RLock()
+	defer fake.setStatusMutex.RUnlock()
+	return fake.setStatusArgsForCall[i].repository, fake.setStatusArgsForCall[i].commit, fake.setStatusArgsForCall[i].status
+}
+
+func (fake *FakeClient) SetStatusReturns(result1 error) {
+	fake.SetStatusStub = nil
+	fake.setStatusReturns = struct {
+		result1 error
+	}{result1}
+}
+
+var _ forge.Client = new(FakeClient)
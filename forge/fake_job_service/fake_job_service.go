@@ -0,0 +1,100 @@
+// This file was generated by counterfeiter
+package fake_job_service
+
+import (
+	"sync"
+
+	"github.com/craigfurman/woodhouse-ci/forge"
+	"github.com/craigfurman/woodhouse-ci/jobs"
+)
+
+type FakeJobService struct {
+	TriggerJobStub        func(id string) (int, error)
+	triggerJobMutex       sync.RWMutex
+	triggerJobArgsForCall []struct {
+		id string
+	}
+	triggerJobReturns struct {
+		result1 int
+		result2 error
+	}
+	RunPullRequestStub        func(id string, pr jobs.PullRequest) (int, error)
+	runPullRequestMutex       sync.RWMutex
+	runPullRequestArgsForCall []struct {
+		id string
+		pr jobs.PullRequest
+	}
+	runPullRequestReturns struct {
+		result1 int
+		result2 error
+	}
+}
+
+func (fake *FakeJobService) TriggerJob(id string) (int, error) {
+	fake.triggerJobMutex.Lock()
+	fake.triggerJobArgsForCall = append(fake.triggerJobArgsForCall, struct {
+		id string
+	}{id})
+	fake.triggerJobMutex.Unlock()
+	if fake.TriggerJobStub != nil {
+		return fake.TriggerJobStub(id)
+	} else {
+		return fake.triggerJobReturns.result1, fake.triggerJobReturns.result2
+	}
+}
+
+func (fake *FakeJobService) TriggerJobCallCount() int {
+	fake.triggerJobMutex.RLock()
+	defer fake.triggerJobMutex.RUnlock()
+	return len(fake.triggerJobArgsForCall)
+}
+
+func (fake *FakeJobService) TriggerJobArgsForCall(i int) string {
+	fake.triggerJobMutex.RLock()
+	defer fake.triggerJobMutex.RUnlock()
+	return fake.triggerJobArgsForCall[i].id
+}
+
+func (fake *FakeJobService) TriggerJobReturns(result1 int, result2 error) {
+	fake.TriggerJobStub = nil
+	fake.triggerJobReturns = struct {
+		result1 int
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeJobService) RunPullRequest(id string, pr jobs.PullRequest) (int, error) {
+	fake.runPullRequestMutex.Lock()
+	fake.runPullRequestArgsForCall = append(fake.runPullRequestArgsForCall, struct {
+		id string
+		pr jobs.PullRequest
+	}{id, pr})
+	fake.runPullRequestMutex.Unlock()
+	if fake.RunPullRequestStub != nil {
+		return fake.RunPullRequestStub(id, pr)
+	} else {
+		return fake.runPullRequestReturns.result1, fake.runPullRequestReturns.result2
+	}
+}
+
+func (fake *FakeJobService) RunPullRequestCallCount() int {
+	fake.runPullRequestMutex.RLock()
+	defer fake.runPullRequestMutex.RUnlock()
+	return len(fake.runPullRequestArgsForCall)
+}
+
+func (fake *FakeJobService) RunPullRequestArgsForCall(i int) (string, jobs.PullRequest) {
+	fake.runPullRequestMutex.RLock()
+	defer fake.runPullRequestMutex.RUnlock()
+	return fake.runPullRequestArgsForCall[i].id, fake.runPullRequestArgsForCall[i].pr
+}
+
+func (fake *FakeJobService) RunPullRequestReturns(result1 int, result2 error) {
+	fake.RunPullRequestStub = nil
+	fake.runPullRequestReturns = struct {
+		result1 int
+		result2 error
+	}{result1, result2}
+}
+
+var _ forge.JobService = new(FakeJobService)
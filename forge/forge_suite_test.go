@@ -0,0 +1,13 @@
+package forge_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestForge(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Forge Suite")
+}
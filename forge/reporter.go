@@ -0,0 +1,27 @@
+package forge
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+)
+
+// Reporter is a jobs.StatusReporter that sets the status of the head commit of
+// pull requests, linking to the build.
+type Reporter struct {
+	Client Client
+
+	// Where Woodhouse is served from, as seen by users of the forge
+	ExternalURL string
+}
+
+func (r Reporter) ReportStatus(status jobs.BuildStatus) error {
+	commitStatus := CommitStatus{
+		State:       status.State,
+		TargetURL:   fmt.Sprintf("%s/jobs/%s/builds/%d", strings.TrimSuffix(r.ExternalURL, "/"), status.Job.ID, status.BuildNumber),
+		Description: status.Description,
+		Context:     "woodhouse-ci/" + status.Job.Name,
+	}
+	return r.Client.SetStatus(status.PullRequest.Repository, status.PullRequest.HeadCommit, commitStatus)
+}
@@ -0,0 +1,35 @@
+package forge_test
+
+import (
+	"github.com/craigfurman/woodhouse-ci/forge"
+	"github.com/craigfurman/woodhouse-ci/forge/fake_client"
+	"github.com/craigfurman/woodhouse-ci/jobs"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reporter", func() {
+	It("sets the status of the pull request's head commit, linking to the build", func() {
+		client := new(fake_client.FakeClient)
+		reporter := forge.Reporter{Client: client, ExternalURL: "https://ci.example.com/"}
+
+		Expect(reporter.ReportStatus(jobs.BuildStatus{
+			Job:         jobs.Job{ID: "some-id", Name: "app"},
+			BuildNumber: 3,
+			PullRequest: jobs.PullRequest{Number: 12, Repository: "octocat/app", HeadCommit: "abc123"},
+			State:       jobs.StateSuccess,
+			Description: "The build passed",
+		})).To(Succeed())
+
+		repository, commit, status := client.SetStatusArgsForCall(0)
+		Expect(repository).To(Equal("octocat/app"))
+		Expect(commit).To(Equal("abc123"))
+		Expect(status).To(Equal(forge.CommitStatus{
+			State:       "success",
+			TargetURL:   "https://ci.example.com/jobs/some-id/builds/3",
+			Description: "The build passed",
+			Context:     "woodhouse-ci/app",
+		}))
+	})
+})
@@ -0,0 +1,185 @@
+package forge
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+
+	"github.com/gorilla/mux"
+)
+
+var ErrBadSignature = errors.New("bad signature")
+
+// WebhookSecret signs the webhooks that the forge sends, so that nobody else
+// can start builds. It is kept in a file that only the Woodhouse user can
+// read, and is read for every webhook.
+type WebhookSecret struct {
+	Path string
+}
+
+// Ensure creates a secret unless one exists already.
+func (s WebhookSecret) Ensure() error {
+	if _, err := os.Stat(s.Path); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("checking for webhook secret: %s. Cause: %v", s.Path, err)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return fmt.Errorf("generating webhook secret. Cause: %v", err)
+	}
+	if err := ioutil.WriteFile(s.Path, []byte(hex.EncodeToString(secret)+"\n"), 0600); err != nil {
+		return fmt.Errorf("writing webhook secret: %s. Cause: %v", s.Path, err)
+	}
+	return nil
+}
+
+// Check verifies a signature of the form "sha256=<hex HMAC of payload>".
+func (s WebhookSecret) Check(payload []byte, signature string) error {
+	secret, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		return fmt.Errorf("reading webhook secret: %s. Cause: %v", s.Path, err)
+	}
+
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil || !strings.HasPrefix(signature, "sha256=") {
+		return ErrBadSignature
+	}
+	mac := hmac.New(sha256.New, []byte(strings.TrimSpace(string(secret))))
+	mac.Write(payload)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+//go:generate counterfeiter -o fake_job_service/fake_job_service.go . JobService
+type JobService interface {
+	TriggerJob(id string) (int, error)
+	RunPullRequest(id string, pr jobs.PullRequest) (int, error)
+}
+
+// Handler receives webhooks from the forge. Pushes trigger the job, and pull
+// requests being opened or updated build them.
+type Handler struct {
+	*mux.Router
+
+	jobService JobService
+	secret     WebhookSecret
+}
+
+type pullRequestEvent struct {
+	Action      string
+	Number      int
+	PullRequest struct {
+		Head struct {
+			SHA string
+		}
+	} `json:"pull_request"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	}
+}
+
+func NewHandler(jobService JobService, secret WebhookSecret) *Handler {
+	h := &Handler{
+		Router:     mux.NewRouter(),
+		jobService: jobService,
+		secret:     secret,
+	}
+
+	h.HandleFunc("/hooks/github/jobs/{jobId}", h.receive).Methods("POST")
+	return h
+}
+
+func (h *Handler) receive(w http.ResponseWriter, r *http.Request) {
+	payload, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.secret.Check(payload, r.Header.Get("X-Hub-Signature-256")); err == ErrBadSignature {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		log.Printf("webhook error: %v\n", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	jobID := mux.Vars(r)["jobId"]
+	var buildNumber int
+	switch event := r.Header.Get("X-GitHub-Event"); event {
+	case "ping":
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case "push":
+		buildNumber, err = h.jobService.TriggerJob(jobID)
+	case "pull_request":
+		var pr jobs.PullRequest
+		var build bool
+		if pr, build, err = pullRequest(payload, r.URL.Query().Get("build")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !build {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		buildNumber, err = h.jobService.RunPullRequest(jobID, pr)
+	default:
+		http.Error(w, fmt.Sprintf("unsupported event: %s", event), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("error building job %s for webhook: %v\n", jobID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/jobs/%s/builds/%d", jobID, buildNumber))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// pullRequest parses a pull_request event, returning whether the pull request
+// should be built. Builds are of the head of the pull request, or of the
+// result of merging it when ref is "merge".
+func pullRequest(payload []byte, ref string) (jobs.PullRequest, bool, error) {
+	var event pullRequestEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return jobs.PullRequest{}, false, err
+	}
+
+	switch event.Action {
+	case "opened", "synchronize", "reopened":
+	default:
+		return jobs.PullRequest{}, false, nil
+	}
+
+	switch ref {
+	case "", "head":
+		ref = "head"
+	case "merge":
+	default:
+		return jobs.PullRequest{}, false, fmt.Errorf("unknown pull request ref: %s", ref)
+	}
+
+	return jobs.PullRequest{
+		Number:     event.Number,
+		Repository: event.Repository.FullName,
+		Ref:        fmt.Sprintf("refs/pull/%d/%s", event.Number, ref),
+		HeadCommit: event.PullRequest.Head.SHA,
+	}, true, nil
+}
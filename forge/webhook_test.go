@@ -0,0 +1,130 @@
+package forge_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/craigfurman/woodhouse-ci/forge"
+	"github.com/craigfurman/woodhouse-ci/forge/fake_job_service"
+	"github.com/craigfurman/woodhouse-ci/jobs"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("webhooks", func() {
+	var (
+		tmpDir     string
+		secret     forge.WebhookSecret
+		jobService *fake_job_service.FakeJobService
+		handler    *forge.Handler
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "woodhouse-forge-tests")
+		Expect(err).NotTo(HaveOccurred())
+		secret = forge.WebhookSecret{Path: filepath.Join(tmpDir, "webhook-secret")}
+		Expect(secret.Ensure()).To(Succeed())
+
+		jobService = new(fake_job_service.FakeJobService)
+		jobService.TriggerJobReturns(4, nil)
+		jobService.RunPullRequestReturns(5, nil)
+		handler = forge.NewHandler(jobService, secret)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	sign := func(payload string) string {
+		key, err := ioutil.ReadFile(secret.Path)
+		Expect(err).NotTo(HaveOccurred())
+		mac := hmac.New(sha256.New, []byte(strings.TrimSpace(string(key))))
+		mac.Write([]byte(payload))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	deliver := func(path, event, payload, signature string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", path, strings.NewReader(payload))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("X-GitHub-Event", event)
+		req.Header.Set("X-Hub-Signature-256", signature)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	Describe("WebhookSecret", func() {
+		It("does not replace an existing secret", func() {
+			before, err := ioutil.ReadFile(secret.Path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secret.Ensure()).To(Succeed())
+			Expect(ioutil.ReadFile(secret.Path)).To(Equal(before))
+		})
+
+		It("checks payload signatures", func() {
+			Expect(secret.Check([]byte("payload"), sign("payload"))).To(Succeed())
+			Expect(secret.Check([]byte("payload"), sign("other"))).To(Equal(forge.ErrBadSignature))
+			Expect(secret.Check([]byte("payload"), "")).To(Equal(forge.ErrBadSignature))
+		})
+	})
+
+	It("rejects webhooks that are not signed with the secret", func() {
+		resp := deliver("/hooks/github/jobs/some-id", "push", "{}", sign("something else"))
+		Expect(resp.Code).To(Equal(http.StatusUnauthorized))
+		Expect(jobService.TriggerJobCallCount()).To(Equal(0))
+	})
+
+	It("acknowledges pings", func() {
+		resp := deliver("/hooks/github/jobs/some-id", "ping", "{}", sign("{}"))
+		Expect(resp.Code).To(Equal(http.StatusNoContent))
+	})
+
+	It("triggers the job on pushes", func() {
+		resp := deliver("/hooks/github/jobs/some-id", "push", "{}", sign("{}"))
+		Expect(resp.Code).To(Equal(http.StatusCreated))
+		Expect(resp.Header().Get("Location")).To(Equal("/jobs/some-id/builds/4"))
+		Expect(jobService.TriggerJobArgsForCall(0)).To(Equal("some-id"))
+	})
+
+	Describe("pull request events", func() {
+		payload := func(action string) string {
+			return `{"action": "` + action + `", "number": 12, "pull_request": {"head": {"sha": "abc123"}}, "repository": {"full_name": "octocat/app"}}`
+		}
+
+		It("builds the head of pull requests that are opened or updated", func() {
+			for _, action := range []string{"opened", "synchronize", "reopened"} {
+				resp := deliver("/hooks/github/jobs/some-id", "pull_request", payload(action), sign(payload(action)))
+				Expect(resp.Code).To(Equal(http.StatusCreated))
+				Expect(resp.Header().Get("Location")).To(Equal("/jobs/some-id/builds/5"))
+			}
+
+			Expect(jobService.RunPullRequestCallCount()).To(Equal(3))
+			jobID, pr := jobService.RunPullRequestArgsForCall(0)
+			Expect(jobID).To(Equal("some-id"))
+			Expect(pr).To(Equal(jobs.PullRequest{Number: 12, Repository: "octocat/app", Ref: "refs/pull/12/head", HeadCommit: "abc123"}))
+		})
+
+		It("can build the result of merging the pull request", func() {
+			resp := deliver("/hooks/github/jobs/some-id?build=merge", "pull_request", payload("opened"), sign(payload("opened")))
+			Expect(resp.Code).To(Equal(http.StatusCreated))
+			_, pr := jobService.RunPullRequestArgsForCall(0)
+			Expect(pr.Ref).To(Equal("refs/pull/12/merge"))
+			Expect(pr.HeadCommit).To(Equal("abc123"))
+		})
+
+		It("ignores other actions", func() {
+			resp := deliver("/hooks/github/jobs/some-id", "pull_request", payload("closed"), sign(payload("closed")))
+			Expect(resp.Code).To(Equal(http.StatusNoContent))
+			Expect(jobService.RunPullRequestCallCount()).To(Equal(0))
+		})
+	})
+})
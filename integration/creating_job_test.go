@@ -28,8 +28,22 @@ var _ = Describe("Creating a job", func() {
 		Expect(page.Destroy()).To(Succeed())
 	})
 
-	PContext("when there is no docker image specified", func() {
-		It("runs the job on the host OS", func() {})
+	Context("when the job is run on the Woodhouse host", func() {
+		It("runs the job on the host OS", func() {
+			By("creating the new job without a docker image", func() {
+				pageobjects.NewListJobsPage(page).Visit().
+					GoToCreateNewJob().
+					CreateLocalJob("Local", `sh -c "echo $WOODHOUSE_JOB_NAME"`, "")
+			})
+
+			By("streaming the output from the job", func() {
+				Eventually(page.Find("#jobOutput")).Should(HaveText("Local"))
+			})
+
+			By("indicating that the job ran successfully", func() {
+				Eventually(page.Find("#jobResult")).Should(HaveText("Success"))
+			})
+		})
 	})
 
 	It("creates and runs the new job", func() {
@@ -0,0 +1,120 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"time"
+)
+
+// ApprovalGate pauses builds before they run, until someone approves or
+// rejects them, e.g. before deploying to production.
+type ApprovalGate struct {
+	Required bool
+
+	// Builds not approved in time are rejected. Zero waits for as long as it
+	// takes.
+	Timeout time.Duration `json:",omitempty"`
+}
+
+// Approval is the decision made about a build awaiting approval.
+type Approval struct {
+	Approved bool
+	Approver string
+	At       time.Time
+}
+
+func (a Approval) String() string {
+	decision := "Rejected"
+	if a.Approved {
+		decision = "Approved"
+	}
+	return fmt.Sprintf("%s by %s at %s", decision, a.Approver, a.At.Format(time.RFC1123))
+}
+
+// ApprovalWaiter is implemented by build outputs that can pause a build until
+// a decision about it is made.
+type ApprovalWaiter interface {
+	AwaitApproval(ctx context.Context) (Approval, error)
+}
+
+// AwaitApproval pauses a build of a job that requires approval until it is
+// decided, returning the status the build must stop with unless it was
+// approved. Builds whose output cannot wait for a decision are not approved.
+func AwaitApproval(ctx context.Context, job Job, outputDest io.Writer) uint32 {
+	if !job.Approval.Required {
+		return 0
+	}
+	waiter, ok := outputDest.(ApprovalWaiter)
+	if !ok {
+		fmt.Fprintln(outputDest, "Error: this build requires approval, which it cannot wait for")
+		return StatusNotApproved
+	}
+
+	waitCtx := ctx
+	if job.Approval.Timeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, job.Approval.Timeout)
+		defer cancel()
+		fmt.Fprintf(outputDest, "Awaiting approval for up to %s\n", job.Approval.Timeout)
+	} else {
+		fmt.Fprintln(outputDest, "Awaiting approval")
+	}
+
+	approval, err := waiter.AwaitApproval(waitCtx)
+	switch {
+	case ctx.Err() != nil:
+		return StatusAborted
+	case waitCtx.Err() != nil:
+		fmt.Fprintf(outputDest, "Not approved within %s\n", job.Approval.Timeout)
+		return StatusNotApproved
+	case err != nil:
+		fmt.Fprintf(outputDest, "Error awaiting approval: %v\n", err)
+		return StatusNotApproved
+	}
+
+	fmt.Fprintln(outputDest, approval)
+	if !approval.Approved {
+		return StatusNotApproved
+	}
+	return 0
+}
+
+// startOnceApproved waits for a build to be approved, then joins its lane and
+// starts it, unless it must wait for its turn. It returns the status the build
+// finished with if it never started.
+func startOnceApproved(ctx context.Context, job Job, joinLane func() bool, start func() error, outputDest io.WriteCloser) uint32 {
+	exitStatus := AwaitApproval(ctx, job, outputDest)
+	if exitStatus == 0 {
+		if !joinLane() {
+			return 0
+		}
+		err := start()
+		if err == nil {
+			return 0
+		}
+		fmt.Fprintf(outputDest, "Error starting build: %v\n", err)
+		exitStatus = StatusContainerFailed
+	}
+
+	if err := outputDest.Close(); err != nil {
+		log.Printf("error closing output of a build that never ran: %v\n", err)
+	}
+	return exitStatus
+}
+
+// Approve records a decision about a build that is awaiting approval, which
+// resumes it.
+func (s *Service) Approve(jobId string, buildNumber int, approval Approval) error {
+	if approval.Approver == "" {
+		return fmt.Errorf("deciding build %d of job %s. Cause: no approver given", buildNumber, jobId)
+	}
+	if approval.At.IsZero() {
+		approval.At = time.Now()
+	}
+	if err := s.BuildRepository.Decide(jobId, buildNumber, approval); err != nil {
+		return fmt.Errorf("deciding build %d of job %s. Cause: %v", buildNumber, jobId, err)
+	}
+	return nil
+}
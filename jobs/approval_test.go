@@ -0,0 +1,223 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+	"github.com/craigfurman/woodhouse-ci/jobs/fake_build_repository"
+	"github.com/craigfurman/woodhouse-ci/jobs/fake_job_repository"
+	"github.com/craigfurman/woodhouse-ci/jobs/fake_job_runner"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Approvals", func() {
+	var (
+		job       jobs.Job
+		output    *approvalOutput
+		decisions chan jobs.Approval
+	)
+
+	BeforeEach(func() {
+		job = jobs.Job{ID: "deploy", Approval: jobs.ApprovalGate{Required: true}}
+		decisions = make(chan jobs.Approval, 1)
+		output = &approvalOutput{Buffer: gbytes.NewBuffer(), decisions: decisions}
+	})
+
+	It("resumes builds that are approved", func() {
+		decisions <- jobs.Approval{Approved: true, Approver: "alice", At: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)}
+		Expect(jobs.AwaitApproval(context.Background(), job, output)).To(Equal(uint32(0)))
+		Expect(output.Buffer).To(gbytes.Say("Awaiting approval"))
+		Expect(output.Buffer).To(gbytes.Say("Approved by alice at Mon, 19 Oct 2026 12:00:00 UTC"))
+	})
+
+	It("stops builds that are rejected", func() {
+		decisions <- jobs.Approval{Approver: "bob"}
+		Expect(jobs.AwaitApproval(context.Background(), job, output)).To(Equal(jobs.StatusNotApproved))
+		Expect(output.Buffer).To(gbytes.Say("Rejected by bob"))
+	})
+
+	It("stops builds that are not approved in time", func() {
+		job.Approval.Timeout = time.Millisecond * 10
+		Expect(jobs.AwaitApproval(context.Background(), job, output)).To(Equal(jobs.StatusNotApproved))
+		Expect(output.Buffer).To(gbytes.Say("Awaiting approval for up to 10ms"))
+		Expect(output.Buffer).To(gbytes.Say("Not approved within 10ms"))
+	})
+
+	It("aborts builds that are stopped while waiting", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		Expect(jobs.AwaitApproval(ctx, job, output)).To(Equal(jobs.StatusAborted))
+	})
+
+	It("does not wait for jobs that do not require approval", func() {
+		job.Approval = jobs.ApprovalGate{}
+		Expect(jobs.AwaitApproval(context.Background(), job, gbytes.NewBuffer())).To(Equal(uint32(0)))
+	})
+
+	It("does not approve builds whose output cannot wait", func() {
+		buffer := gbytes.NewBuffer()
+		Expect(jobs.AwaitApproval(context.Background(), job, buffer)).To(Equal(jobs.StatusNotApproved))
+		Expect(buffer).To(gbytes.Say("requires approval, which it cannot wait for"))
+	})
+
+	Describe("running builds of jobs that require approval", func() {
+		var (
+			service  *jobs.Service
+			runner   *fake_job_runner.FakeRunner
+			outputs  map[string]*approvalOutput
+			statuses map[string]chan uint32
+			finish   map[string]chan uint32
+			numbers  map[string]int
+			mutex    sync.Mutex
+		)
+
+		BeforeEach(func() {
+			jobRepo := new(fake_job_repository.FakeJobRepository)
+			jobRepo.FindByIdStub = func(id string) (jobs.Job, error) {
+				if id == "deploy-prod" {
+					return jobs.Job{
+						ID:          id,
+						Locks:       []jobs.Lock{{Name: "staging"}},
+						Concurrency: jobs.ConcurrencySerial,
+						Approval:    jobs.ApprovalGate{Required: true},
+					}, nil
+				}
+				return jobs.Job{ID: id, Locks: []jobs.Lock{{Name: "staging"}}}, nil
+			}
+
+			outputs = map[string]*approvalOutput{}
+			statuses = map[string]chan uint32{}
+			finish = map[string]chan uint32{}
+			numbers = map[string]int{}
+			buildRepo := new(fake_build_repository.FakeBuildRepository)
+			buildRepo.CreateStub = func(jobID, variant string) (int, io.WriteCloser, chan uint32, error) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				numbers[jobID]++
+				key := fmt.Sprintf("%s/%d", jobID, numbers[jobID])
+				outputs[key] = &approvalOutput{Buffer: gbytes.NewBuffer(), decisions: make(chan jobs.Approval, 1)}
+				statuses[key] = make(chan uint32, 1)
+				finish[key] = make(chan uint32, 1)
+				return numbers[jobID], outputs[key], statuses[key], nil
+			}
+
+			runner = new(fake_job_runner.FakeRunner)
+			runner.RunStub = func(ctx context.Context, job jobs.Job, outputDest io.WriteCloser, status chan<- uint32) error {
+				mutex.Lock()
+				buildFinished := finish[fmt.Sprintf("%s/%d", job.ID, numbers[job.ID])]
+				mutex.Unlock()
+				go func() {
+					status <- <-buildFinished
+					outputDest.Close()
+				}()
+				return nil
+			}
+
+			service = &jobs.Service{JobRepository: jobRepo, BuildRepository: buildRepo, Runner: runner}
+		})
+
+		start := func(id string) {
+			_, err := service.RunJob(id)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		ranJobs := func() []string {
+			var ids []string
+			for i := 0; i < runner.RunCallCount(); i++ {
+				_, job, _, _ := runner.RunArgsForCall(i)
+				ids = append(ids, job.ID)
+			}
+			return ids
+		}
+
+		It("does not hold locks while waiting for approval", func() {
+			start("deploy-prod")
+			Eventually(outputs["deploy-prod/1"].Buffer).Should(gbytes.Say("Awaiting approval"))
+			Expect(service.Locks()).To(BeEmpty())
+
+			start("deploy-api")
+			Eventually(ranJobs).Should(Equal([]string{"deploy-api"}))
+
+			outputs["deploy-prod/1"].decisions <- jobs.Approval{Approved: true, Approver: "alice"}
+			Eventually(outputs["deploy-prod/1"].Buffer).Should(gbytes.Say("Waiting for lock staging"))
+			Consistently(ranJobs).Should(Equal([]string{"deploy-api"}))
+
+			finish["deploy-api/1"] <- 0
+			Eventually(ranJobs).Should(Equal([]string{"deploy-api", "deploy-prod"}))
+			_, job, _, _ := runner.RunArgsForCall(1)
+			Expect(job.Approval.Required).To(BeFalse())
+		})
+
+		It("does not hold up later builds of the job while waiting for approval", func() {
+			start("deploy-prod")
+			start("deploy-prod")
+			Eventually(outputs["deploy-prod/2"].Buffer).Should(gbytes.Say("Awaiting approval"))
+
+			outputs["deploy-prod/2"].decisions <- jobs.Approval{Approved: true, Approver: "alice"}
+			Eventually(ranJobs).Should(Equal([]string{"deploy-prod"}))
+			Expect(outputs["deploy-prod/2"].Buffer).NotTo(gbytes.Say("Waiting for build"))
+		})
+
+		It("never runs builds that are rejected", func() {
+			start("deploy-prod")
+			outputs["deploy-prod/1"].decisions <- jobs.Approval{Approver: "bob"}
+			Eventually(statuses["deploy-prod/1"]).Should(Receive(Equal(jobs.StatusNotApproved)))
+			Expect(outputs["deploy-prod/1"].Closed()).To(BeTrue())
+			Expect(ranJobs()).To(BeEmpty())
+		})
+	})
+
+	Describe("deciding", func() {
+		var (
+			service   *jobs.Service
+			buildRepo *fake_build_repository.FakeBuildRepository
+		)
+
+		BeforeEach(func() {
+			buildRepo = new(fake_build_repository.FakeBuildRepository)
+			service = &jobs.Service{BuildRepository: buildRepo}
+		})
+
+		It("records who decided and when", func() {
+			Expect(service.Approve("deploy", 3, jobs.Approval{Approved: true, Approver: "alice"})).To(Succeed())
+			jobID, buildNumber, approval := buildRepo.DecideArgsForCall(0)
+			Expect(jobID).To(Equal("deploy"))
+			Expect(buildNumber).To(Equal(3))
+			Expect(approval.Approver).To(Equal("alice"))
+			Expect(approval.Approved).To(BeTrue())
+			Expect(approval.At).To(BeTemporally("~", time.Now(), time.Second))
+		})
+
+		It("requires an approver", func() {
+			Expect(service.Approve("deploy", 3, jobs.Approval{Approved: true})).To(MatchError(ContainSubstring("no approver given")))
+			Expect(buildRepo.DecideCallCount()).To(Equal(0))
+		})
+
+		It("returns errors deciding", func() {
+			buildRepo.DecideReturns(errors.New("not awaiting approval"))
+			Expect(service.Approve("deploy", 3, jobs.Approval{Approver: "alice"})).To(MatchError(ContainSubstring("not awaiting approval")))
+		})
+	})
+})
+
+type approvalOutput struct {
+	*gbytes.Buffer
+	decisions chan jobs.Approval
+}
+
+func (o *approvalOutput) AwaitApproval(ctx context.Context) (jobs.Approval, error) {
+	select {
+	case approval := <-o.decisions:
+		return approval, nil
+	case <-ctx.Done():
+		return jobs.Approval{}, ctx.Err()
+	}
+}
@@ -0,0 +1,82 @@
+package jobs
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// Cache is a directory kept between builds of a job, e.g. of downloaded
+// dependencies, and mounted into the container at Path.
+type Cache struct {
+	Name string
+
+	// Where the cache is mounted in the container. Relative paths are in the
+	// workspace. They cannot contain "..".
+	Path string
+
+	// Files of the job's repository whose contents key the cache, e.g. go.sum,
+	// so that only builds of the same contents share it. They are relative to
+	// the workspace.
+	KeyFiles []string `json:",omitempty"`
+}
+
+var cacheName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// ValidateCaches checks that caches can be told apart, and that their key files
+// are in the workspace.
+func ValidateCaches(caches []Cache) error {
+	names := map[string]bool{}
+	paths := map[string]bool{}
+	for _, cache := range caches {
+		if !cacheName.MatchString(cache.Name) {
+			return fmt.Errorf("cache names may only contain letters, numbers, '.', '_' and '-', not: %s", cache.Name)
+		}
+		if names[cache.Name] {
+			return fmt.Errorf("more than one cache is named %s", cache.Name)
+		}
+		names[cache.Name] = true
+
+		if cache.Path == "" {
+			return fmt.Errorf("cache %s has no path", cache.Name)
+		}
+		if hasParent(cache.Path) {
+			return fmt.Errorf("the path of cache %s cannot contain '..', not: %s", cache.Name, cache.Path)
+		}
+		if paths[cache.Path] {
+			return fmt.Errorf("more than one cache is mounted at %s", cache.Path)
+		}
+		paths[cache.Path] = true
+
+		for _, file := range cache.KeyFiles {
+			if isAbsolute(file) || hasParent(file) {
+				return fmt.Errorf("key files of cache %s must be in the workspace, not: %s", cache.Name, file)
+			}
+		}
+	}
+	return nil
+}
+
+// CacheKeeper is implemented by build outputs that keep the caches of a job
+// between its builds.
+type CacheKeeper interface {
+	CacheDir(cache Cache, key string) (string, error)
+}
+
+// CacheDir is where the cache with the given key is kept, or empty if the
+// build output cannot keep caches.
+func CacheDir(outputDest io.Writer, cache Cache, key string) (string, error) {
+	if keeper, ok := outputDest.(CacheKeeper); ok {
+		return keeper.CacheDir(cache, key)
+	}
+	return "", nil
+}
+
+// ClearCaches removes every cache of the job, so that its next build starts
+// without them.
+func (s *Service) ClearCaches(jobId string) error {
+	if err := s.BuildRepository.ClearCaches(jobId); err != nil {
+		return fmt.Errorf("clearing caches of job %s. Cause: %v", jobId, err)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package jobs_test
+
+import (
+	"errors"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+	"github.com/craigfurman/woodhouse-ci/jobs/fake_build_repository"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Caches", func() {
+	It("validates the caches of a job", func() {
+		Expect(jobs.ValidateCaches([]jobs.Cache{
+			{Name: "go-modules", Path: "/go/pkg/mod", KeyFiles: []string{"go.sum"}},
+			{Name: "npm", Path: "node_modules"},
+		})).To(Succeed())
+		Expect(jobs.ValidateCaches([]jobs.Cache{{Name: "go modules", Path: "/go"}})).To(MatchError(ContainSubstring("not: go modules")))
+		Expect(jobs.ValidateCaches([]jobs.Cache{{Name: "go", Path: "/go"}, {Name: "go", Path: "/root/go"}})).To(MatchError("more than one cache is named go"))
+		Expect(jobs.ValidateCaches([]jobs.Cache{{Name: "go", Path: "/go"}, {Name: "gopath", Path: "/go"}})).To(MatchError("more than one cache is mounted at /go"))
+	})
+
+	It("does not allow caches to reach outside the workspace", func() {
+		for _, file := range []string{"/etc/shadow", "../../etc/shadow", "vendor/../../go.sum", `..\go.sum`} {
+			Expect(jobs.ValidateCaches([]jobs.Cache{{Name: "go", Path: "/go", KeyFiles: []string{"go.sum", file}}})).To(MatchError("key files of cache go must be in the workspace, not: " + file))
+		}
+		Expect(jobs.ValidateCaches([]jobs.Cache{{Name: "go", Path: "../../go"}})).To(MatchError("the path of cache go cannot contain '..', not: ../../go"))
+		Expect(jobs.ValidateCaches([]jobs.Cache{{Name: "go", Path: "/go/../etc"}})).To(MatchError(ContainSubstring("not: /go/../etc")))
+	})
+
+	It("clears the caches of a job", func() {
+		buildRepo := new(fake_build_repository.FakeBuildRepository)
+		service := &jobs.Service{BuildRepository: buildRepo}
+		Expect(service.ClearCaches("some-id")).To(Succeed())
+		Expect(buildRepo.ClearCachesArgsForCall(0)).To(Equal("some-id"))
+
+		buildRepo.ClearCachesReturns(errors.New("disk on fire"))
+		Expect(service.ClearCaches("some-id")).To(MatchError("clearing caches of job some-id. Cause: disk on fire"))
+	})
+})
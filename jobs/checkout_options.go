@@ -0,0 +1,90 @@
+package jobs
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// CheckoutOptions control how much of the git repository is fetched.
+type CheckoutOptions struct {
+	// Branch, tag or commit to check out. Empty means the default branch.
+	Ref string
+
+	// Number of commits of history to fetch. Zero means all of it.
+	Depth int
+
+	// Only fetch the default branch
+	SingleBranch bool
+
+	// One of the Submodules* constants. Empty means SubmodulesRecursive.
+	Submodules string
+
+	// Directories to check out. Empty means the whole repository.
+	SparsePaths []string
+
+	// Name of the GitCredential to fetch the repository with, if any
+	CredentialName string
+
+	// Looked up from CredentialName when a build starts. It is never saved
+	// with the job.
+	Credential *GitCredential `json:",omitempty"`
+}
+
+// Values of CheckoutOptions.Submodules
+const (
+	SubmodulesNone      = "none"
+	SubmodulesTopLevel  = "top-level"
+	SubmodulesRecursive = "recursive"
+)
+
+func (o CheckoutOptions) String() string {
+	depth := "full history"
+	if o.Depth > 0 {
+		depth = fmt.Sprintf("depth %d", o.Depth)
+	}
+
+	branches := "all branches"
+	if o.SingleBranch {
+		branches = "single branch"
+	}
+
+	submodules := o.Submodules
+	if submodules == "" {
+		submodules = SubmodulesRecursive
+	}
+
+	paths := "all paths"
+	if len(o.SparsePaths) > 0 {
+		paths = "sparse paths " + strings.Join(o.SparsePaths, ", ")
+	}
+
+	description := fmt.Sprintf("%s, %s, submodules: %s, %s", depth, branches, submodules, paths)
+	if o.Ref != "" {
+		description = "ref " + o.Ref + ", " + description
+	}
+	if o.CredentialName != "" {
+		description += ", credentials: " + o.CredentialName
+	}
+	return description
+}
+
+// ValidateRef checks that a git ref is a well formed branch, tag or commit
+// name, which cannot be mistaken for an option to git.
+func ValidateRef(ref string) error {
+	if ref == "" {
+		return nil
+	}
+	if strings.HasPrefix(ref, "-") {
+		return fmt.Errorf("refs cannot start with '-', not: %s", ref)
+	}
+
+	err := exec.Command("git", "check-ref-format", "--allow-onelevel", ref).Run()
+	if _, ok := err.(*exec.ExitError); ok {
+		return fmt.Errorf("not a valid git ref: %s", ref)
+	}
+	if err != nil {
+		return fmt.Errorf("checking git ref %s. Cause: %v", ref, err)
+	}
+	return nil
+}
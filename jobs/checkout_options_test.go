@@ -0,0 +1,26 @@
+package jobs_test
+
+import (
+	"github.com/craigfurman/woodhouse-ci/jobs"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Checkout options", func() {
+	It("accepts branches, tags and commits", func() {
+		for _, ref := range []string{"", "master", "release/1.2", "v1.2.0", "refs/pull/12/head", "17b38552487f2314a58f93e8517ca700e6abbed7"} {
+			Expect(jobs.ValidateRef(ref)).To(Succeed())
+		}
+	})
+
+	It("rejects refs that git could mistake for options", func() {
+		Expect(jobs.ValidateRef("--upload-pack=touch /tmp/pwned")).To(MatchError("refs cannot start with '-', not: --upload-pack=touch /tmp/pwned"))
+	})
+
+	It("rejects malformed refs", func() {
+		for _, ref := range []string{"a..b", "feature branch", "topic.lock", "HEAD@{1}"} {
+			Expect(jobs.ValidateRef(ref)).To(MatchError("not a valid git ref: " + ref))
+		}
+	})
+})
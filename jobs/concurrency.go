@@ -0,0 +1,152 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+)
+
+// Values of Job.Concurrency, which decides what happens to a build started
+// while another build of the job is running
+const (
+	// Builds run alongside each other. The default.
+	ConcurrencyParallel = "parallel"
+
+	// Builds wait for those started before them to finish
+	ConcurrencySerial = "serial"
+
+	// A new build stops the running build and drops any still waiting to run,
+	// e.g. so that only the latest push is deployed
+	ConcurrencySupersede = "supersede"
+)
+
+func ValidateConcurrency(concurrency string) error {
+	switch concurrency {
+	case "", ConcurrencyParallel, ConcurrencySerial, ConcurrencySupersede:
+		return nil
+	}
+	return fmt.Errorf("unknown concurrency policy: %s", concurrency)
+}
+
+func (j Job) serialized() bool {
+	return j.Concurrency == ConcurrencySerial || j.Concurrency == ConcurrencySupersede
+}
+
+// lane holds the builds of a job that must not run at the same time. Each pull
+// request has its own lane, so that its builds neither wait for nor stop those
+// of other pull requests or of the job itself.
+type lane struct {
+	running *laneBuild
+	waiting []*laneBuild
+}
+
+type laneBuild struct {
+	number   int
+	progress *inProgressBuild
+
+	// Receives 0 when it is the build's turn to run, or the number of the
+	// build that superseded it
+	turn chan int
+}
+
+func laneKey(jobID string, request buildRequest) string {
+	if request.pullRequest != nil {
+		return jobID + "/" + request.pullRequest.String()
+	}
+	return jobID
+}
+
+// join adds a build to its lane. It returns the number of the build it must
+// wait for and a channel that receives once it is its turn, or nil if it can
+// run straight away.
+func (s *Service) join(key, concurrency string, buildNumber int, progress *inProgressBuild) (int, <-chan int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.lanes == nil {
+		s.lanes = make(map[string]*lane)
+	}
+
+	build := &laneBuild{number: buildNumber, progress: progress, turn: make(chan int, 1)}
+	l, ok := s.lanes[key]
+	if !ok {
+		s.lanes[key] = &lane{running: build}
+		return 0, nil
+	}
+
+	if concurrency == ConcurrencySupersede {
+		for _, waiting := range l.waiting {
+			waiting.turn <- buildNumber
+		}
+		l.waiting = nil
+		l.running.progress.supersededBy = buildNumber
+		l.running.progress.cancel()
+	}
+	l.waiting = append(l.waiting, build)
+	return l.running.number, build.turn
+}
+
+// leave removes a build from its lane, handing the lane to the next build
+// waiting in it if the build was running.
+func (s *Service) leave(key string, buildNumber int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	l, ok := s.lanes[key]
+	if !ok {
+		return
+	}
+
+	if l.running.number != buildNumber {
+		for i, waiting := range l.waiting {
+			if waiting.number == buildNumber {
+				l.waiting = append(l.waiting[:i], l.waiting[i+1:]...)
+				break
+			}
+		}
+		return
+	}
+
+	if len(l.waiting) == 0 {
+		delete(s.lanes, key)
+		return
+	}
+	l.running, l.waiting = l.waiting[0], l.waiting[1:]
+	l.running.turn <- 0
+}
+
+// startInTurn waits for a build's turn to run and starts it, returning the
+// status it finished with if it never started.
+func startInTurn(ctx context.Context, turn <-chan int, start func() error, outputDest io.WriteCloser) uint32 {
+	var exitStatus uint32
+	select {
+	case supersededBy := <-turn:
+		if supersededBy == 0 {
+			err := start()
+			if err == nil {
+				return 0
+			}
+			fmt.Fprintf(outputDest, "Error starting build: %v\n", err)
+			exitStatus = StatusContainerFailed
+		} else {
+			fmt.Fprintf(outputDest, "Superseded by build %d\n", supersededBy)
+			exitStatus = StatusSuperseded
+		}
+	case <-ctx.Done():
+		exitStatus = StatusAborted
+	}
+
+	if err := outputDest.Close(); err != nil {
+		log.Printf("error closing output of a build that never ran: %v\n", err)
+	}
+	return exitStatus
+}
+
+// stoppedStatus is the status of a build that was stopped before it finished.
+func (s *Service) stoppedStatus(progress *inProgressBuild) uint32 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if progress.supersededBy != 0 {
+		return StatusSuperseded
+	}
+	return StatusAborted
+}
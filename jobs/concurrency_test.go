@@ -0,0 +1,167 @@
+package jobs_test
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+	"github.com/craigfurman/woodhouse-ci/jobs/fake_build_repository"
+	"github.com/craigfurman/woodhouse-ci/jobs/fake_job_repository"
+	"github.com/craigfurman/woodhouse-ci/jobs/fake_job_runner"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Concurrency", func() {
+	It("accepts known policies", func() {
+		for _, policy := range []string{"", jobs.ConcurrencyParallel, jobs.ConcurrencySerial, jobs.ConcurrencySupersede} {
+			Expect(jobs.ValidateConcurrency(policy)).To(Succeed())
+		}
+		Expect(jobs.ValidateConcurrency("sometimes")).To(MatchError("unknown concurrency policy: sometimes"))
+	})
+
+	Describe("running builds of a job", func() {
+		var (
+			service  *jobs.Service
+			jobRepo  *fake_job_repository.FakeJobRepository
+			runner   *fake_job_runner.FakeRunner
+			outputs  []*gbytes.Buffer
+			statuses []chan uint32
+			finish   []chan uint32
+			mutex    sync.Mutex
+		)
+
+		BeforeEach(func() {
+			jobRepo = new(fake_job_repository.FakeJobRepository)
+			outputs, statuses, finish = nil, nil, nil
+
+			buildRepo := new(fake_build_repository.FakeBuildRepository)
+			buildRepo.CreateStub = func(jobID, variant string) (int, io.WriteCloser, chan uint32, error) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				outputs = append(outputs, gbytes.NewBuffer())
+				statuses = append(statuses, make(chan uint32, 1))
+				finish = append(finish, make(chan uint32, 1))
+				return len(outputs), outputs[len(outputs)-1], statuses[len(statuses)-1], nil
+			}
+
+			runner = new(fake_job_runner.FakeRunner)
+			runner.RunStub = func(ctx context.Context, job jobs.Job, outputDest io.WriteCloser, status chan<- uint32) error {
+				mutex.Lock()
+				buildFinished := finish[len(finish)-1]
+				for i, output := range outputs {
+					if output == outputDest {
+						buildFinished = finish[i]
+					}
+				}
+				mutex.Unlock()
+
+				// Builds only stop once the test finishes them, even when
+				// they are cancelled
+				go func() {
+					status <- <-buildFinished
+					outputDest.Close()
+				}()
+				return nil
+			}
+
+			service = &jobs.Service{JobRepository: jobRepo, BuildRepository: buildRepo, Runner: runner}
+		})
+
+		start := func() int {
+			buildNumber, err := service.RunJob("some-id")
+			Expect(err).NotTo(HaveOccurred())
+			return buildNumber
+		}
+
+		Context("when the job runs builds in parallel", func() {
+			BeforeEach(func() {
+				jobRepo.FindByIdReturns(jobs.Job{ID: "some-id", Concurrency: jobs.ConcurrencyParallel}, nil)
+			})
+
+			It("starts every build straight away", func() {
+				start()
+				start()
+				Expect(runner.RunCallCount()).To(Equal(2))
+			})
+		})
+
+		Context("when the job runs builds one at a time", func() {
+			BeforeEach(func() {
+				jobRepo.FindByIdReturns(jobs.Job{ID: "some-id", Concurrency: jobs.ConcurrencySerial}, nil)
+			})
+
+			It("queues builds behind the running build", func() {
+				start()
+				start()
+				start()
+				Expect(runner.RunCallCount()).To(Equal(1))
+				Expect(outputs[1]).To(gbytes.Say("Waiting for build 1 to finish"))
+				Expect(outputs[2]).To(gbytes.Say("Waiting for build 1 to finish"))
+
+				finish[0] <- 0
+				Eventually(statuses[0]).Should(Receive(Equal(uint32(0))))
+				Eventually(runner.RunCallCount).Should(Equal(2))
+				Consistently(runner.RunCallCount).Should(Equal(2))
+
+				finish[1] <- 1
+				Eventually(statuses[1]).Should(Receive(Equal(uint32(1))))
+				Eventually(runner.RunCallCount).Should(Equal(3))
+
+				finish[2] <- 0
+				Eventually(statuses[2]).Should(Receive(Equal(uint32(0))))
+			})
+
+			It("does not queue pull request builds behind builds of the job", func() {
+				start()
+				_, err := service.RunPullRequest("some-id", jobs.PullRequest{Number: 12, Ref: "refs/pull/12/head"})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(runner.RunCallCount()).To(Equal(2))
+			})
+
+			It("aborts queued builds when shutting down", func() {
+				start()
+				start()
+				go service.Shutdown(0)
+				Eventually(statuses[1]).Should(Receive(Equal(jobs.StatusAborted)))
+				Expect(outputs[1].Closed()).To(BeTrue())
+
+				finish[0] <- 0
+				Eventually(statuses[0]).Should(Receive(Equal(jobs.StatusAborted)))
+				Expect(runner.RunCallCount()).To(Equal(1))
+			})
+		})
+
+		Context("when newer builds supersede older ones", func() {
+			BeforeEach(func() {
+				jobRepo.FindByIdReturns(jobs.Job{ID: "some-id", Concurrency: jobs.ConcurrencySupersede}, nil)
+			})
+
+			It("stops the running build and drops stale queued builds", func() {
+				start()
+				start()
+				Expect(runner.RunCallCount()).To(Equal(1))
+				Expect(outputs[1]).To(gbytes.Say("Waiting for build 1 to finish"))
+
+				finish[0] <- 1
+				Eventually(statuses[0]).Should(Receive(Equal(jobs.StatusSuperseded)))
+				Eventually(runner.RunCallCount).Should(Equal(2))
+
+				start()
+				start()
+				Eventually(statuses[2]).Should(Receive(Equal(jobs.StatusSuperseded)))
+				Expect(outputs[2]).To(gbytes.Say("Superseded by build 4"))
+				Expect(outputs[2].Closed()).To(BeTrue())
+
+				finish[1] <- 1
+				Eventually(statuses[1]).Should(Receive(Equal(jobs.StatusSuperseded)))
+				Eventually(runner.RunCallCount).Should(Equal(3))
+				finish[3] <- 0
+				Eventually(statuses[3]).Should(Receive(Equal(uint32(0))))
+			})
+		})
+	})
+})
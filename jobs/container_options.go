@@ -0,0 +1,151 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ContainerOptions limit what a job's container may use, and how much it is
+// isolated from the host. The zero value runs containers with the defaults of
+// the container runtime.
+type ContainerOptions struct {
+	// Number of CPUs, which may be fractional
+	CPUs float64 `json:",omitempty"`
+
+	// Limits in bytes, and of the number of processes
+	Memory    int64 `json:",omitempty"`
+	PidsLimit int64 `json:",omitempty"`
+
+	// One of the Network values. Empty uses the runtime's default network.
+	NetworkMode string `json:",omitempty"`
+
+	ReadOnlyRootFilesystem bool `json:",omitempty"`
+
+	// User, and optionally group, to run the command as, e.g. "1000:1000"
+	User string `json:",omitempty"`
+
+	// Only allowed by the server's ContainerPolicy
+	Privileged bool `json:",omitempty"`
+
+	// Directories of the host to mount, as "host path:container path" and
+	// optionally ":ro". Only allowed by the server's ContainerPolicy.
+	Volumes []string `json:",omitempty"`
+}
+
+// Values of ContainerOptions.NetworkMode
+const (
+	NetworkBridge = "bridge"
+	NetworkNone   = "none"
+)
+
+var containerUser = regexp.MustCompile(`^[A-Za-z0-9_.-]+(:[A-Za-z0-9_.-]+)?$`)
+
+func ValidateContainerOptions(job Job) error {
+	options := job.Container
+	if options.CPUs < 0 || options.Memory < 0 || options.PidsLimit < 0 {
+		return errors.New("container limits cannot be negative")
+	}
+
+	switch options.NetworkMode {
+	case "", NetworkBridge:
+	case NetworkNone:
+		if len(job.Services) > 0 {
+			return errors.New("jobs with services cannot have no network")
+		}
+	default:
+		return fmt.Errorf("unknown network mode: %s", options.NetworkMode)
+	}
+
+	if options.User != "" && !containerUser.MatchString(options.User) {
+		return fmt.Errorf("containers must be run as a user like name or uid:gid, not: %s", options.User)
+	}
+
+	for _, volume := range options.Volumes {
+		if _, _, err := ParseVolume(volume); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseVolume splits a volume into its absolute host and container paths.
+func ParseVolume(volume string) (string, string, error) {
+	parts := strings.Split(volume, ":")
+	if len(parts) == 3 && (parts[2] == "ro" || parts[2] == "rw") {
+		parts = parts[:2]
+	}
+	if len(parts) != 2 || !path.IsAbs(parts[0]) || !path.IsAbs(parts[1]) {
+		return "", "", fmt.Errorf("volumes must be given as absolute host path:container path, optionally followed by :ro, not: %s", volume)
+	}
+	return path.Clean(parts[0]), path.Clean(parts[1]), nil
+}
+
+// ContainerPolicy is what an administrator allows jobs to do that would let
+// them reach the host. Nothing is allowed by default.
+type ContainerPolicy struct {
+	// Images whose containers may be privileged, e.g. "docker:dind"
+	PrivilegedImages []string
+
+	// Directories of the host that may be mounted, along with anything in
+	// them
+	VolumeDirs []string
+
+	// Whether jobs may run directly on the Woodhouse host, without a container
+	AllowLocalRunner bool
+}
+
+// Check returns an error if the job's container options are not allowed.
+func (p ContainerPolicy) Check(job Job) error {
+	if err := ValidateContainerOptions(job); err != nil {
+		return err
+	}
+
+	if job.RunnerType == RunnerLocal && !p.AllowLocalRunner {
+		return errors.New("jobs are not allowed to run on the Woodhouse host")
+	}
+
+	if job.Container.Privileged {
+		images := job.Matrix.DockerImages
+		if len(images) == 0 {
+			images = []string{job.DockerImage}
+		}
+		for _, image := range images {
+			if image == "" {
+				return errors.New("containers of images built from a Dockerfile are not allowed to be privileged")
+			}
+			if !contains(p.PrivilegedImages, image) {
+				return fmt.Errorf("containers of image %s are not allowed to be privileged", image)
+			}
+		}
+	}
+
+	for _, volume := range job.Container.Volumes {
+		hostPath, _, _ := ParseVolume(volume)
+		if !p.allowsVolume(hostPath) {
+			return fmt.Errorf("mounting %s is not allowed", hostPath)
+		}
+	}
+	return nil
+}
+
+func (p ContainerPolicy) allowsVolume(hostPath string) bool {
+	for _, dir := range p.VolumeDirs {
+		dir = path.Clean(dir)
+		if hostPath == dir || strings.HasPrefix(hostPath, strings.TrimSuffix(dir, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
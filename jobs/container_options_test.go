@@ -0,0 +1,68 @@
+package jobs_test
+
+import (
+	"github.com/craigfurman/woodhouse-ci/jobs"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Container options", func() {
+	It("validates the options of a job's container", func() {
+		Expect(jobs.ValidateContainerOptions(jobs.Job{Container: jobs.ContainerOptions{
+			CPUs:                   1.5,
+			Memory:                 512 * 1024 * 1024,
+			PidsLimit:              100,
+			NetworkMode:            jobs.NetworkNone,
+			ReadOnlyRootFilesystem: true,
+			User:                   "1000:1000",
+			Volumes:                []string{"/opt/tools:/tools:ro"},
+		}})).To(Succeed())
+
+		Expect(jobs.ValidateContainerOptions(jobs.Job{Container: jobs.ContainerOptions{Memory: -1}})).To(MatchError("container limits cannot be negative"))
+		Expect(jobs.ValidateContainerOptions(jobs.Job{Container: jobs.ContainerOptions{NetworkMode: "host"}})).To(MatchError("unknown network mode: host"))
+		Expect(jobs.ValidateContainerOptions(jobs.Job{
+			Container: jobs.ContainerOptions{NetworkMode: jobs.NetworkNone},
+			Services:  []jobs.ServiceContainer{{Name: "postgres", Image: "postgres"}},
+		})).To(MatchError("jobs with services cannot have no network"))
+		Expect(jobs.ValidateContainerOptions(jobs.Job{Container: jobs.ContainerOptions{User: "root; rm -rf /"}})).To(MatchError(ContainSubstring("not: root; rm -rf /")))
+		Expect(jobs.ValidateContainerOptions(jobs.Job{Container: jobs.ContainerOptions{Volumes: []string{"tools:/tools"}}})).To(MatchError(ContainSubstring("not: tools:/tools")))
+	})
+
+	Describe("the policy of what jobs may do", func() {
+		policy := jobs.ContainerPolicy{
+			PrivilegedImages: []string{"docker:dind"},
+			VolumeDirs:       []string{"/var/cache/woodhouse/"},
+		}
+
+		It("allows jobs that cannot reach the host", func() {
+			Expect(policy.Check(jobs.Job{DockerImage: "golang", Container: jobs.ContainerOptions{User: "nobody"}})).To(Succeed())
+		})
+
+		It("only allows privileged containers of allowed images", func() {
+			Expect(policy.Check(jobs.Job{DockerImage: "docker:dind", Container: jobs.ContainerOptions{Privileged: true}})).To(Succeed())
+			Expect(policy.Check(jobs.Job{DockerImage: "golang", Container: jobs.ContainerOptions{Privileged: true}})).To(MatchError("containers of image golang are not allowed to be privileged"))
+			Expect(policy.Check(jobs.Job{
+				DockerImage: "docker:dind",
+				Matrix:      jobs.Matrix{DockerImages: []string{"docker:dind", "docker:latest"}},
+				Container:   jobs.ContainerOptions{Privileged: true},
+			})).To(MatchError("containers of image docker:latest are not allowed to be privileged"))
+			Expect(policy.Check(jobs.Job{Dockerfile: "Dockerfile", Container: jobs.ContainerOptions{Privileged: true}})).To(MatchError("containers of images built from a Dockerfile are not allowed to be privileged"))
+		})
+
+		It("only allows mounting allowed directories", func() {
+			Expect(policy.Check(jobs.Job{Container: jobs.ContainerOptions{Volumes: []string{"/var/cache/woodhouse/apt:/var/cache/apt"}}})).To(Succeed())
+			Expect(policy.Check(jobs.Job{Container: jobs.ContainerOptions{Volumes: []string{"/var/cache/woodhouse-other:/cache"}}})).To(MatchError("mounting /var/cache/woodhouse-other is not allowed"))
+			Expect(policy.Check(jobs.Job{Container: jobs.ContainerOptions{Volumes: []string{"/var/cache/woodhouse/../../run/docker.sock:/docker.sock"}}})).To(MatchError("mounting /var/run/docker.sock is not allowed"))
+		})
+
+		It("only allows jobs to run on the Woodhouse host when the local runner is allowed", func() {
+			job := jobs.Job{RunnerType: jobs.RunnerLocal}
+			Expect(policy.Check(job)).To(MatchError("jobs are not allowed to run on the Woodhouse host"))
+
+			allowed := policy
+			allowed.AllowLocalRunner = true
+			Expect(allowed.Check(job)).To(Succeed())
+		})
+	})
+})
@@ -0,0 +1,31 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ValidateDockerfile checks that a job built from a Dockerfile has nothing else
+// to run in, and that the Dockerfile is in the checkout of its repository.
+func ValidateDockerfile(job Job) error {
+	if job.Dockerfile == "" {
+		return nil
+	}
+	if job.DockerImage != "" {
+		return errors.New("jobs cannot have both a docker image and a Dockerfile")
+	}
+	if len(job.Matrix.DockerImages) > 0 {
+		return errors.New("jobs with a Dockerfile cannot have a matrix of docker images")
+	}
+	if job.Repository == "" {
+		return errors.New("jobs with a Dockerfile need a repository to build it from")
+	}
+
+	clean := path.Clean(job.Dockerfile)
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("the Dockerfile must be a path in the job's repository, not: %s", job.Dockerfile)
+	}
+	return nil
+}
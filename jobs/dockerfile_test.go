@@ -0,0 +1,30 @@
+package jobs_test
+
+import (
+	"github.com/craigfurman/woodhouse-ci/jobs"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dockerfiles", func() {
+	It("accepts jobs built from a Dockerfile in their repository", func() {
+		Expect(jobs.ValidateDockerfile(jobs.Job{Repository: "app.git", Dockerfile: "ci/Dockerfile"})).To(Succeed())
+		Expect(jobs.ValidateDockerfile(jobs.Job{DockerImage: "golang"})).To(Succeed())
+	})
+
+	It("rejects jobs with something else to run in", func() {
+		Expect(jobs.ValidateDockerfile(jobs.Job{Repository: "app.git", Dockerfile: "Dockerfile", DockerImage: "golang"})).To(MatchError("jobs cannot have both a docker image and a Dockerfile"))
+		Expect(jobs.ValidateDockerfile(jobs.Job{
+			Repository: "app.git",
+			Dockerfile: "Dockerfile",
+			Matrix:     jobs.Matrix{DockerImages: []string{"golang:1.15", "golang:1.16"}},
+		})).To(MatchError("jobs with a Dockerfile cannot have a matrix of docker images"))
+	})
+
+	It("rejects Dockerfiles outside the job's repository", func() {
+		Expect(jobs.ValidateDockerfile(jobs.Job{Dockerfile: "Dockerfile"})).To(MatchError("jobs with a Dockerfile need a repository to build it from"))
+		Expect(jobs.ValidateDockerfile(jobs.Job{Repository: "app.git", Dockerfile: "/etc/Dockerfile"})).To(MatchError(ContainSubstring("not: /etc/Dockerfile")))
+		Expect(jobs.ValidateDockerfile(jobs.Job{Repository: "app.git", Dockerfile: "ci/../../Dockerfile"})).To(MatchError(ContainSubstring("not: ci/../../Dockerfile")))
+	})
+})
@@ -10,10 +10,11 @@ import (
 )
 
 type FakeBuildRepository struct {
-	CreateStub        func(jobId string) (int, io.WriteCloser, chan uint32, error)
+	CreateStub        func(jobId string, variant string) (int, io.WriteCloser, chan uint32, error)
 	createMutex       sync.RWMutex
 	createArgsForCall []struct {
-		jobId string
+		jobId   string
+		variant string
 	}
 	createReturns struct {
 		result1 int
@@ -51,16 +52,94 @@ type FakeBuildRepository struct {
 		result1 *chunkedio.ChunkedReader
 		result2 error
 	}
+	CreateCellStub        func(jobId string, buildNumber int, cell jobs.Cell) (int, io.WriteCloser, chan uint32, error)
+	createCellMutex       sync.RWMutex
+	createCellArgsForCall []struct {
+		jobId       string
+		buildNumber int
+		cell        jobs.Cell
+	}
+	createCellReturns struct {
+		result1 int
+		result2 io.WriteCloser
+		result3 chan uint32
+		result4 error
+	}
+	FindCellStub        func(jobId string, buildNumber int, cellNumber int) (jobs.Build, error)
+	findCellMutex       sync.RWMutex
+	findCellArgsForCall []struct {
+		jobId       string
+		buildNumber int
+		cellNumber  int
+	}
+	findCellReturns struct {
+		result1 jobs.Build
+		result2 error
+	}
+	StreamCellStub        func(jobId string, buildNumber int, cellNumber int, startAtByte int64) (*chunkedio.ChunkedReader, error)
+	streamCellMutex       sync.RWMutex
+	streamCellArgsForCall []struct {
+		jobId       string
+		buildNumber int
+		cellNumber  int
+		startAtByte int64
+	}
+	streamCellReturns struct {
+		result1 *chunkedio.ChunkedReader
+		result2 error
+	}
+	CreateAttemptStub        func(jobId string, buildNumber int) (int, io.WriteCloser, chan uint32, error)
+	createAttemptMutex       sync.RWMutex
+	createAttemptArgsForCall []struct {
+		jobId       string
+		buildNumber int
+	}
+	createAttemptReturns struct {
+		result1 int
+		result2 io.WriteCloser
+		result3 chan uint32
+		result4 error
+	}
+	FindAttemptStub        func(jobId string, buildNumber int, attemptNumber int) (jobs.Build, error)
+	findAttemptMutex       sync.RWMutex
+	findAttemptArgsForCall []struct {
+		jobId         string
+		buildNumber   int
+		attemptNumber int
+	}
+	findAttemptReturns struct {
+		result1 jobs.Build
+		result2 error
+	}
+	DecideStub        func(jobId string, buildNumber int, approval jobs.Approval) error
+	decideMutex       sync.RWMutex
+	decideArgsForCall []struct {
+		jobId       string
+		buildNumber int
+		approval    jobs.Approval
+	}
+	decideReturns struct {
+		result1 error
+	}
+	ClearCachesStub        func(jobId string) error
+	clearCachesMutex       sync.RWMutex
+	clearCachesArgsForCall []struct {
+		jobId string
+	}
+	clearCachesReturns struct {
+		result1 error
+	}
 }
 
-func (fake *FakeBuildRepository) Create(jobId string) (int, io.WriteCloser, chan uint32, error) {
+func (fake *FakeBuildRepository) Create(jobId string, variant string) (int, io.WriteCloser, chan uint32, error) {
 	fake.createMutex.Lock()
 	fake.createArgsForCall = append(fake.createArgsForCall, struct {
-		jobId string
-	}{jobId})
+		jobId   string
+		variant string
+	}{jobId, variant})
 	fake.createMutex.Unlock()
 	if fake.CreateStub != nil {
-		return fake.CreateStub(jobId)
+		return fake.CreateStub(jobId, variant)
 	} else {
 		return fake.createReturns.result1, fake.createReturns.result2, fake.createReturns.result3, fake.createReturns.result4
 	}
@@ -72,10 +151,10 @@ func (fake *FakeBuildRepository) CreateCallCount() int {
 	return len(fake.createArgsForCall)
 }
 
-func (fake *FakeBuildRepository) CreateArgsForCall(i int) string {
+func (fake *FakeBuildRepository) CreateArgsForCall(i int) (string, string) {
 	fake.createMutex.RLock()
 	defer fake.createMutex.RUnlock()
-	return fake.createArgsForCall[i].jobId
+	return fake.createArgsForCall[i].jobId, fake.createArgsForCall[i].variant
 }
 
 func (fake *FakeBuildRepository) CreateReturns(result1 int, result2 io.WriteCloser, result3 chan uint32, result4 error) {
@@ -190,4 +269,249 @@ func (fake *FakeBuildRepository) StreamReturns(result1 *chunkedio.ChunkedReader,
 	}{result1, result2}
 }
 
+func (fake *FakeBuildRepository) CreateCell(jobId string, buildNumber int, cell jobs.Cell) (int, io.WriteCloser, chan uint32, error) {
+	fake.createCellMutex.Lock()
+	fake.createCellArgsForCall = append(fake.createCellArgsForCall, struct {
+		jobId       string
+		buildNumber int
+		cell        jobs.Cell
+	}{jobId, buildNumber, cell})
+	fake.createCellMutex.Unlock()
+	if fake.CreateCellStub != nil {
+		return fake.CreateCellStub(jobId, buildNumber, cell)
+	} else {
+		return fake.createCellReturns.result1, fake.createCellReturns.result2, fake.createCellReturns.result3, fake.createCellReturns.result4
+	}
+}
+
+func (fake *FakeBuildRepository) CreateCellCallCount() int {
+	fake.createCellMutex.RLock()
+	defer fake.createCellMutex.RUnlock()
+	return len(fake.createCellArgsForCall)
+}
+
+func (fake *FakeBuildRepository) CreateCellArgsForCall(i int) (string, int, jobs.Cell) {
+	fake.createCellMutex.RLock()
+	defer fake.createCellMutex.RUnlock()
+	return fake.createCellArgsForCall[i].jobId, fake.createCellArgsForCall[i].buildNumber, fake.createCellArgsForCall[i].cell
+}
+
+func (fake *FakeBuildRepository) CreateCellReturns(result1 int, result2 io.WriteCloser, result3 chan uint32, result4 error) {
+	fake.CreateCellStub = nil
+	fake.createCellReturns = struct {
+		result1 int
+		result2 io.WriteCloser
+		result3 chan uint32
+		result4 error
+	}{result1, result2, result3, result4}
+}
+
+func (fake *FakeBuildRepository) FindCell(jobId string, buildNumber int, cellNumber int) (jobs.Build, error) {
+	fake.findCellMutex.Lock()
+	fake.findCellArgsForCall = append(fake.findCellArgsForCall, struct {
+		jobId       string
+		buildNumber int
+		cellNumber  int
+	}{jobId, buildNumber, cellNumber})
+	fake.findCellMutex.Unlock()
+	if fake.FindCellStub != nil {
+		return fake.FindCellStub(jobId, buildNumber, cellNumber)
+	} else {
+		return fake.findCellReturns.result1, fake.findCellReturns.result2
+	}
+}
+
+func (fake *FakeBuildRepository) FindCellCallCount() int {
+	fake.findCellMutex.RLock()
+	defer fake.findCellMutex.RUnlock()
+	return len(fake.findCellArgsForCall)
+}
+
+func (fake *FakeBuildRepository) FindCellArgsForCall(i int) (string, int, int) {
+	fake.findCellMutex.RLock()
+	defer fake.findCellMutex.RUnlock()
+	return fake.findCellArgsForCall[i].jobId, fake.findCellArgsForCall[i].buildNumber, fake.findCellArgsForCall[i].cellNumber
+}
+
+func (fake *FakeBuildRepository) FindCellReturns(result1 jobs.Build, result2 error) {
+	fake.FindCellStub = nil
+	fake.findCellReturns = struct {
+		result1 jobs.Build
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeBuildRepository) StreamCell(jobId string, buildNumber int, cellNumber int, startAtByte int64) (*chunkedio.ChunkedReader, error) {
+	fake.streamCellMutex.Lock()
+	fake.streamCellArgsForCall = append(fake.streamCellArgsForCall, struct {
+		jobId       string
+		buildNumber int
+		cellNumber  int
+		startAtByte int64
+	}{jobId, buildNumber, cellNumber, startAtByte})
+	fake.streamCellMutex.Unlock()
+	if fake.StreamCellStub != nil {
+		return fake.StreamCellStub(jobId, buildNumber, cellNumber, startAtByte)
+	} else {
+		return fake.streamCellReturns.result1, fake.streamCellReturns.result2
+	}
+}
+
+func (fake *FakeBuildRepository) StreamCellCallCount() int {
+	fake.streamCellMutex.RLock()
+	defer fake.streamCellMutex.RUnlock()
+	return len(fake.streamCellArgsForCall)
+}
+
+func (fake *FakeBuildRepository) StreamCellArgsForCall(i int) (string, int, int, int64) {
+	fake.streamCellMutex.RLock()
+	defer fake.streamCellMutex.RUnlock()
+	return fake.streamCellArgsForCall[i].jobId, fake.streamCellArgsForCall[i].buildNumber, fake.streamCellArgsForCall[i].cellNumber, fake.streamCellArgsForCall[i].startAtByte
+}
+
+func (fake *FakeBuildRepository) StreamCellReturns(result1 *chunkedio.ChunkedReader, result2 error) {
+	fake.StreamCellStub = nil
+	fake.streamCellReturns = struct {
+		result1 *chunkedio.ChunkedReader
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeBuildRepository) CreateAttempt(jobId string, buildNumber int) (int, io.WriteCloser, chan uint32, error) {
+	fake.createAttemptMutex.Lock()
+	fake.createAttemptArgsForCall = append(fake.createAttemptArgsForCall, struct {
+		jobId       string
+		buildNumber int
+	}{jobId, buildNumber})
+	fake.createAttemptMutex.Unlock()
+	if fake.CreateAttemptStub != nil {
+		return fake.CreateAttemptStub(jobId, buildNumber)
+	} else {
+		return fake.createAttemptReturns.result1, fake.createAttemptReturns.result2, fake.createAttemptReturns.result3, fake.createAttemptReturns.result4
+	}
+}
+
+func (fake *FakeBuildRepository) CreateAttemptCallCount() int {
+	fake.createAttemptMutex.RLock()
+	defer fake.createAttemptMutex.RUnlock()
+	return len(fake.createAttemptArgsForCall)
+}
+
+func (fake *FakeBuildRepository) CreateAttemptArgsForCall(i int) (string, int) {
+	fake.createAttemptMutex.RLock()
+	defer fake.createAttemptMutex.RUnlock()
+	return fake.createAttemptArgsForCall[i].jobId, fake.createAttemptArgsForCall[i].buildNumber
+}
+
+func (fake *FakeBuildRepository) CreateAttemptReturns(result1 int, result2 io.WriteCloser, result3 chan uint32, result4 error) {
+	fake.CreateAttemptStub = nil
+	fake.createAttemptReturns = struct {
+		result1 int
+		result2 io.WriteCloser
+		result3 chan uint32
+		result4 error
+	}{result1, result2, result3, result4}
+}
+
+func (fake *FakeBuildRepository) FindAttempt(jobId string, buildNumber int, attemptNumber int) (jobs.Build, error) {
+	fake.findAttemptMutex.Lock()
+	fake.findAttemptArgsForCall = append(fake.findAttemptArgsForCall, struct {
+		jobId         string
+		buildNumber   int
+		attemptNumber int
+	}{jobId, buildNumber, attemptNumber})
+	fake.findAttemptMutex.Unlock()
+	if fake.FindAttemptStub != nil {
+		return fake.FindAttemptStub(jobId, buildNumber, attemptNumber)
+	} else {
+		return fake.findAttemptReturns.result1, fake.findAttemptReturns.result2
+	}
+}
+
+func (fake *FakeBuildRepository) FindAttemptCallCount() int {
+	fake.findAttemptMutex.RLock()
+	defer fake.findAttemptMutex.RUnlock()
+	return len(fake.findAttemptArgsForCall)
+}
+
+func (fake *FakeBuildRepository) FindAttemptArgsForCall(i int) (string, int, int) {
+	fake.findAttemptMutex.RLock()
+	defer fake.findAttemptMutex.RUnlock()
+	return fake.findAttemptArgsForCall[i].jobId, fake.findAttemptArgsForCall[i].buildNumber, fake.findAttemptArgsForCall[i].attemptNumber
+}
+
+func (fake *FakeBuildRepository) FindAttemptReturns(result1 jobs.Build, result2 error) {
+	fake.FindAttemptStub = nil
+	fake.findAttemptReturns = struct {
+		result1 jobs.Build
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeBuildRepository) Decide(jobId string, buildNumber int, approval jobs.Approval) error {
+	fake.decideMutex.Lock()
+	fake.decideArgsForCall = append(fake.decideArgsForCall, struct {
+		jobId       string
+		buildNumber int
+		approval    jobs.Approval
+	}{jobId, buildNumber, approval})
+	fake.decideMutex.Unlock()
+	if fake.DecideStub != nil {
+		return fake.DecideStub(jobId, buildNumber, approval)
+	} else {
+		return fake.decideReturns.result1
+	}
+}
+
+func (fake *FakeBuildRepository) DecideCallCount() int {
+	fake.decideMutex.RLock()
+	defer fake.decideMutex.RUnlock()
+	return len(fake.decideArgsForCall)
+}
+
+func (fake *FakeBuildRepository) DecideArgsForCall(i int) (string, int, jobs.Approval) {
+	fake.decideMutex.RLock()
+	defer fake.decideMutex.RUnlock()
+	return fake.decideArgsForCall[i].jobId, fake.decideArgsForCall[i].buildNumber, fake.decideArgsForCall[i].approval
+}
+
+func (fake *FakeBuildRepository) DecideReturns(result1 error) {
+	fake.DecideStub = nil
+	fake.decideReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeBuildRepository) ClearCaches(jobId string) error {
+	fake.clearCachesMutex.Lock()
+	fake.clearCachesArgsForCall = append(fake.clearCachesArgsForCall, struct {
+		jobId string
+	}{jobId})
+	fake.clearCachesMutex.Unlock()
+	if fake.ClearCachesStub != nil {
+		return fake.ClearCachesStub(jobId)
+	} else {
+		return fake.clearCachesReturns.result1
+	}
+}
+
+func (fake *FakeBuildRepository) ClearCachesCallCount() int {
+	fake.clearCachesMutex.RLock()
+	defer fake.clearCachesMutex.RUnlock()
+	return len(fake.clearCachesArgsForCall)
+}
+
+func (fake *FakeBuildRepository) ClearCachesArgsForCall(i int) string {
+	fake.clearCachesMutex.RLock()
+	defer fake.clearCachesMutex.RUnlock()
+	return fake.clearCachesArgsForCall[i].jobId
+}
+
+func (fake *FakeBuildRepository) ClearCachesReturns(result1 error) {
+	fake.ClearCachesStub = nil
+	fake.clearCachesReturns = struct {
+		result1 error
+	}{result1}
+}
+
 var _ jobs.BuildRepository = new(FakeBuildRepository)
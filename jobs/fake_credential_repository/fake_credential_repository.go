@@ -0,0 +1,55 @@
+// This file was generated by counterfeiter
+package fake_credential_repository
+
+import (
+	"sync"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+)
+
+type FakeCredentialRepository struct {
+	FindStub        func(name string) (jobs.GitCredential, error)
+	findMutex       sync.RWMutex
+	findArgsForCall []struct {
+		name string
+	}
+	findReturns struct {
+		result1 jobs.GitCredential
+		result2 error
+	}
+}
+
+func (fake *FakeCredentialRepository) Find(name string) (jobs.GitCredential, error) {
+	fake.findMutex.Lock()
+	fake.findArgsForCall = append(fake.findArgsForCall, struct {
+		name string
+	}{name})
+	fake.findMutex.Unlock()
+	if fake.FindStub != nil {
+		return fake.FindStub(name)
+	} else {
+		return fake.findReturns.result1, fake.findReturns.result2
+	}
+}
+
+func (fake *FakeCredentialRepository) FindCallCount() int {
+	fake.findMutex.RLock()
+	defer fake.findMutex.RUnlock()
+	return len(fake.findArgsForCall)
+}
+
+func (fake *FakeCredentialRepository) FindArgsForCall(i int) string {
+	fake.findMutex.RLock()
+	defer fake.findMutex.RUnlock()
+	return fake.findArgsForCall[i].name
+}
+
+func (fake *FakeCredentialRepository) FindReturns(result1 jobs.GitCredential, result2 error) {
+	fake.FindStub = nil
+	fake.findReturns = struct {
+		result1 jobs.GitCredential
+		result2 error
+	}{result1, result2}
+}
+
+var _ jobs.CredentialRepository = new(FakeCredentialRepository)
@@ -2,6 +2,7 @@
 package fake_job_runner
 
 import (
+	"context"
 	"io"
 	"sync"
 
@@ -9,9 +10,10 @@ import (
 )
 
 type FakeRunner struct {
-	RunStub        func(job jobs.Job, outputDest io.WriteCloser, status chan<- uint32) error
+	RunStub        func(ctx context.Context, job jobs.Job, outputDest io.WriteCloser, status chan<- uint32) error
 	runMutex       sync.RWMutex
 	runArgsForCall []struct {
+		ctx        context.Context
 		job        jobs.Job
 		outputDest io.WriteCloser
 		status     chan<- uint32
@@ -21,16 +23,17 @@ type FakeRunner struct {
 	}
 }
 
-func (fake *FakeRunner) Run(job jobs.Job, outputDest io.WriteCloser, status chan<- uint32) error {
+func (fake *FakeRunner) Run(ctx context.Context, job jobs.Job, outputDest io.WriteCloser, status chan<- uint32) error {
 	fake.runMutex.Lock()
 	fake.runArgsForCall = append(fake.runArgsForCall, struct {
+		ctx        context.Context
 		job        jobs.Job
 		outputDest io.WriteCloser
 		status     chan<- uint32
-	}{job, outputDest, status})
+	}{ctx, job, outputDest, status})
 	fake.runMutex.Unlock()
 	if fake.RunStub != nil {
-		return fake.RunStub(job, outputDest, status)
+		return fake.RunStub(ctx, job, outputDest, status)
 	} else {
 		return fake.runReturns.result1
 	}
@@ -42,10 +45,10 @@ func (fake *FakeRunner) RunCallCount() int {
 	return len(fake.runArgsForCall)
 }
 
-func (fake *FakeRunner) RunArgsForCall(i int) (jobs.Job, io.WriteCloser, chan<- uint32) {
+func (fake *FakeRunner) RunArgsForCall(i int) (context.Context, jobs.Job, io.WriteCloser, chan<- uint32) {
 	fake.runMutex.RLock()
 	defer fake.runMutex.RUnlock()
-	return fake.runArgsForCall[i].job, fake.runArgsForCall[i].outputDest, fake.runArgsForCall[i].status
+	return fake.runArgsForCall[i].ctx, fake.runArgsForCall[i].job, fake.runArgsForCall[i].outputDest, fake.runArgsForCall[i].status
 }
 
 func (fake *FakeRunner) RunReturns(result1 error) {
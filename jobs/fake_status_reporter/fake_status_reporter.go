@@ -0,0 +1,53 @@
+// This file was generated by counterfeiter
+package fake_status_reporter
+
+import (
+	"sync"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+)
+
+type FakeStatusReporter struct {
+	ReportStatusStub        func(status jobs.BuildStatus) error
+	reportStatusMutex       sync.RWMutex
+	reportStatusArgsForCall []struct {
+		status jobs.BuildStatus
+	}
+	reportStatusReturns struct {
+		result1 error
+	}
+}
+
+func (fake *FakeStatusReporter) ReportStatus(status jobs.BuildStatus) error {
+	fake.reportStatusMutex.Lock()
+	fake.reportStatusArgsForCall = append(fake.reportStatusArgsForCall, struct {
+		status jobs.BuildStatus
+	}{status})
+	fake.reportStatusMutex.Unlock()
+	if fake.ReportStatusStub != nil {
+		return fake.ReportStatusStub(status)
+	} else {
+		return fake.reportStatusReturns.result1
+	}
+}
+
+func (fake *FakeStatusReporter) ReportStatusCallCount() int {
+	fake.reportStatusMutex.RLock()
+	defer fake.reportStatusMutex.RUnlock()
+	return len(fake.reportStatusArgsForCall)
+}
+
+func (fake *FakeStatusReporter) ReportStatusArgsForCall(i int) jobs.BuildStatus {
+	fake.reportStatusMutex.RLock()
+	defer fake.reportStatusMutex.RUnlock()
+	return fake.reportStatusArgsForCall[i].status
+}
+
+func (fake *FakeStatusReporter) ReportStatusReturns(result1 error) {
+	fake.ReportStatusStub = nil
+	fake.reportStatusReturns = struct {
+		result1 error
+	}{result1}
+}
+
+var _ jobs.StatusReporter = new(FakeStatusReporter)
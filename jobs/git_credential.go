@@ -0,0 +1,58 @@
+package jobs
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Names of credentials and inputs appear in URLs and paths, so are kept simple
+var simpleName = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+// GitCredential authenticates fetches of private repositories. Credentials
+// are named, so that several jobs can share one.
+type GitCredential struct {
+	Name string
+	Type string
+
+	// Only used by HTTPS credentials
+	Username string
+
+	// The private key of an SSH credential, or the password or token of an
+	// HTTPS one
+	Secret string
+
+	// known_hosts lines that the SSH server's host key must match
+	KnownHosts string
+}
+
+// Values of GitCredential.Type
+const (
+	CredentialSSH   = "ssh"
+	CredentialHTTPS = "https"
+)
+
+func (c GitCredential) Validate() error {
+	if !simpleName.MatchString(c.Name) {
+		return fmt.Errorf("credential names may only contain letters, numbers, '.', '_' and '-', not: %s", c.Name)
+	}
+	if c.Secret == "" {
+		return fmt.Errorf("credential %s has no secret", c.Name)
+	}
+
+	switch c.Type {
+	case CredentialSSH:
+		// Without pinned host keys, ssh would have to trust whichever host
+		// answers
+		if strings.TrimSpace(c.KnownHosts) == "" {
+			return fmt.Errorf("SSH credential %s needs known_hosts entries for the git server", c.Name)
+		}
+	case CredentialHTTPS:
+		if c.Username == "" {
+			return fmt.Errorf("HTTPS credential %s needs a username", c.Name)
+		}
+	default:
+		return fmt.Errorf("unknown credential type: %s", c.Type)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package jobs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Input is a source that a build fetches. The job's own repository is the
+// input with an empty name.
+type Input struct {
+	Name       string
+	SourceType string
+	Repository string
+	Checkout   CheckoutOptions
+}
+
+// Sources are the inputs a build fetches: the job's repository, if it has one,
+// followed by its other inputs.
+func (j Job) Sources() []Input {
+	sources := []Input{}
+	if j.Repository != "" {
+		sources = append(sources, Input{SourceType: j.SourceType, Repository: j.Repository, Checkout: j.Checkout})
+	}
+	return append(sources, j.Inputs...)
+}
+
+// ValidateInputs checks that every input can be given a directory of its own.
+func ValidateInputs(inputs []Input) error {
+	names := map[string]bool{}
+	for _, input := range inputs {
+		if !simpleName.MatchString(input.Name) || input.Name == "." || input.Name == ".." {
+			return fmt.Errorf("input names may only contain letters, numbers, '.', '_' and '-', not: %s", input.Name)
+		}
+		if names[input.Name] {
+			return fmt.Errorf("more than one input is named %s", input.Name)
+		}
+		names[input.Name] = true
+
+		if input.Repository == "" {
+			return fmt.Errorf("input %s has no repository", input.Name)
+		}
+	}
+	return nil
+}
+
+// ValidateRepositories checks that the repository of each source cannot be
+// mistaken for an option by the tools that fetch it.
+func ValidateRepositories(sources []Input) error {
+	for _, source := range sources {
+		if strings.HasPrefix(source.Repository, "-") {
+			return fmt.Errorf("repositories cannot start with '-', not: %s", source.Repository)
+		}
+	}
+	return nil
+}
+
+// validateRefs checks the ref of each source, which must be a git ref unless
+// the source is a mercurial repository.
+func validateRefs(sources []Input) error {
+	for _, source := range sources {
+		// Mercurial revisions are not git refs, but still cannot look like options
+		if source.SourceType == SourceMercurial {
+			if strings.HasPrefix(source.Checkout.Ref, "-") {
+				return fmt.Errorf("refs cannot start with '-', not: %s", source.Checkout.Ref)
+			}
+		} else if err := ValidateRef(source.Checkout.Ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
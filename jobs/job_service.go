@@ -1,25 +1,256 @@
 package jobs
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"sync"
+	"time"
 
 	"github.com/craigfurman/woodhouse-ci/chunkedio"
 )
 
 type Job struct {
-	ID            string
-	Name          string
-	GitRepository string
-	DockerImage   string
-	Command       string
+	ID          string
+	Name        string
+	DockerImage string
+	Command     string
+	RunnerType  string
+
+	// Path of a Dockerfile in the job's repository to build the image the job
+	// runs in from, instead of using DockerImage
+	Dockerfile string
+
+	// Where to fetch the source from, e.g. a repository or archive URL
+	// depending on SourceType. Empty means the job has no source.
+	Repository string
+	SourceType string
+
+	// Only agents advertising all of these labels run the job
+	AgentLabels []string
+
+	Checkout CheckoutOptions
+
+	// Other sources the job needs, fetched into directories of the workspace
+	// named after them
+	Inputs []Input
+
+	// Triggered builds are skipped when none of the files of the job's
+	// repository that changed since the last build match
+	Paths PathFilter
+
+	// Builds of a job with a matrix are made of a build of each of its cells
+	Matrix Matrix
+
+	// Environment variables, like "NAME=value", set for the job's command by
+	// the cell of a matrix it is built for. They are never saved with the job.
+	Env []string `json:",omitempty"`
+
+	// IDs of jobs that must pass for a revision before the job is built
+	Upstream []string
+
+	// Paths in the workspace, which may be glob patterns, kept after a build
+	// passes for downstream jobs to use
+	Artifacts []string
+
+	// Failed builds are tried again when the policy allows
+	Retry RetryPolicy
+
+	// Whether builds wait for someone to approve them before running
+	Approval ApprovalGate
+
+	// Shared resources that builds hold while they run
+	Locks []Lock
+
+	// Directories kept between builds and mounted into their containers
+	Caches []Cache
+
+	// Containers started for each build on a network of its own, e.g.
+	// databases that its tests use
+	Services []ServiceContainer
+
+	// Limits and security options of the container the job runs in
+	Container ContainerOptions
+
+	// What happens to a build started while another is running, one of the
+	// Concurrency values. Empty runs them in parallel.
+	Concurrency string
+
+	// Chosen when a build is started by hand, and set as environment variables
+	Parameters []Parameter
+
+	// Set when a build is triggered by upstream jobs passing. Never saved.
+	UpstreamBuilds []UpstreamBuild `json:",omitempty"`
+
+	// Set when a build is triggered rather than started by hand, to the
+	// revision of the job's repository that the last build used. It is never
+	// saved with the job.
+	ChangedSince string `json:",omitempty"`
+}
+
+// Revision records which revision of an input a build used.
+type Revision struct {
+	Input    string
+	Revision string
 }
 
+// RevisionRecorder is implemented by build outputs that keep the revisions of
+// the inputs a build used.
+type RevisionRecorder interface {
+	RecordRevision(revision Revision) error
+}
+
+// RecordRevision keeps the revision if the build output is able to.
+func RecordRevision(outputDest io.Writer, revision Revision) error {
+	if recorder, ok := outputDest.(RevisionRecorder); ok {
+		return recorder.RecordRevision(revision)
+	}
+	return nil
+}
+
+// Values of Job.RunnerType
+const (
+	// Run in a container using whichever runtime the server is configured with
+	RunnerContainer = "container"
+	RunnerDocker    = "docker"
+	RunnerPodman    = "podman"
+	RunnerLocal     = "local"
+
+	// Run on a remote build agent
+	RunnerAgent = "agent"
+)
+
+// Values of Job.SourceType
+const (
+	// The default
+	SourceGit       = "git"
+	SourceMercurial = "hg"
+	// A tarball or zip file downloaded over HTTP(S)
+	SourceArchive = "archive"
+)
+
+func validateTypes(job Job) error {
+	switch job.RunnerType {
+	case "", RunnerContainer, RunnerDocker, RunnerPodman, RunnerLocal, RunnerAgent:
+	default:
+		return fmt.Errorf("unknown runner type: %s", job.RunnerType)
+	}
+
+	for _, source := range append([]Input{{SourceType: job.SourceType}}, job.Inputs...) {
+		switch source.SourceType {
+		case "", SourceGit, SourceMercurial, SourceArchive:
+		default:
+			return fmt.Errorf("unknown source type: %s", source.SourceType)
+		}
+	}
+	return nil
+}
+
+// validate checks everything about a job that does not depend on other jobs or
+// on the service's policies.
+func validate(job Job) error {
+	for _, err := range []error{
+		validateTypes(job),
+		ValidateRepositories(job.Sources()),
+		validateRefs(job.Sources()),
+		ValidateInputs(job.Inputs),
+		job.Paths.Validate(),
+		job.Matrix.Validate(),
+		ValidateParameters(job.Parameters),
+		job.Retry.Validate(),
+		ValidateConcurrency(job.Concurrency),
+		ValidateLocks(job.Locks),
+		ValidateCaches(job.Caches),
+		ValidateServices(job.Services),
+		ValidateDockerfile(job),
+		ValidateArtifacts(job.Artifacts),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+
+	if job.Retry.Enabled() && !job.Matrix.Empty() {
+		return errors.New("jobs with a matrix cannot retry failed builds")
+	}
+	if job.Approval.Required && !job.Matrix.Empty() {
+		return errors.New("jobs with a matrix cannot require approval")
+	}
+	return nil
+}
+
+// Exit statuses recorded when a build fails because of Woodhouse or its
+// infrastructure, rather than because of the job's command. They are
+// deliberately outside the range of process exit codes so that they cannot be
+// confused with one.
+const (
+	// The build was stopped by Woodhouse, e.g. when shutting down
+	StatusAborted uint32 = 256 + iota
+	StatusFetchFailed
+	StatusImagePullFailed
+	StatusContainerFailed
+	StatusTimedOut
+	// The agent running the build stopped responding
+	StatusAgentLost
+	// Nothing the job's path filters match changed since the last build
+	StatusSkipped
+	// The build was rejected, or not approved in time
+	StatusNotApproved
+	// A newer build of the job stopped the build, or dropped it before it ran
+	StatusSuperseded
+	// The image could not be built from the job's Dockerfile
+	StatusImageBuildFailed
+)
+
 type Build struct {
 	Job
 	Finished   bool
 	Output     []byte
 	ExitStatus uint32
+	Revisions  []Revision
+
+	// The value of each of the job's parameters that the build used
+	ParameterValues []ParameterValue
+
+	// The docker image the build ran in, which is that of the job unless it
+	// has been changed since
+	Image string
+
+	// Number of the earlier build this one was a rebuild of
+	RebuildOf int
+
+	// Describes what else the build was of, e.g. a pull request, when it was
+	// not of the job as it is. Cells of a matrix are variants named after
+	// their image and environment variables.
+	Variant string
+
+	// Builds of each cell of the job's matrix, without their output
+	Cells []Build
+
+	// Each attempt at the build when the job retries failed builds, without
+	// their output
+	Attempts []Build
+
+	// Set while the build is paused until it is approved, and once it is
+	// decided
+	AwaitingApproval bool
+	Approval         *Approval
+
+	// Name of the lock the build is waiting for before it runs
+	WaitingForLock string
+
+	// Set for cells of a matrix that may fail without failing the build
+	AllowFailure bool
+
+	// Where the artifacts kept by the build are, if it kept any, and their
+	// paths relative to it
+	ArtifactsDir string
+	Artifacts    []string
+
+	// Logs of each of the build's service containers
+	ServiceLogs []ServiceLog
 }
 
 //go:generate counterfeiter -o fake_job_repository/fake_job_repository.go . JobRepository
@@ -31,21 +262,56 @@ type JobRepository interface {
 
 //go:generate counterfeiter -o fake_build_repository/fake_build_repository.go . BuildRepository
 type BuildRepository interface {
-	Create(jobId string) (int, io.WriteCloser, chan uint32, error)
+	Create(jobId string, variant string) (int, io.WriteCloser, chan uint32, error)
 	Find(jobId string, buildNumber int) (Build, error)
 	HighestBuild(jobId string) (int, error)
 	Stream(jobId string, buildNumber int, startAtByte int64) (*chunkedio.ChunkedReader, error)
+	CreateCell(jobId string, buildNumber int, cell Cell) (int, io.WriteCloser, chan uint32, error)
+	FindCell(jobId string, buildNumber, cellNumber int) (Build, error)
+	StreamCell(jobId string, buildNumber, cellNumber int, startAtByte int64) (*chunkedio.ChunkedReader, error)
+	CreateAttempt(jobId string, buildNumber int) (int, io.WriteCloser, chan uint32, error)
+	FindAttempt(jobId string, buildNumber, attemptNumber int) (Build, error)
+	Decide(jobId string, buildNumber int, approval Approval) error
+	ClearCaches(jobId string) error
+}
+
+//go:generate counterfeiter -o fake_credential_repository/fake_credential_repository.go . CredentialRepository
+type CredentialRepository interface {
+	Find(name string) (GitCredential, error)
 }
 
 //go:generate counterfeiter -o fake_job_runner/fake_job_runner.go . Runner
 type Runner interface {
-	Run(job Job, outputDest io.WriteCloser, status chan<- uint32) error
+	Run(ctx context.Context, job Job, outputDest io.WriteCloser, status chan<- uint32) error
 }
 
+// Time to wait for builds to report their status after being asked to stop
+var stopTimeout = time.Second * 30
+
 type Service struct {
 	JobRepository   JobRepository
 	Runner          Runner
 	BuildRepository BuildRepository
+	Credentials     CredentialRepository
+
+	// Reports the status of pull request builds, if set
+	Reporter StatusReporter
+
+	// What jobs are allowed to do that would let them reach the host
+	ContainerPolicy ContainerPolicy
+
+	mutex         sync.Mutex
+	shuttingDown  bool
+	runningBuilds sync.WaitGroup
+	inProgress    map[string]*inProgressBuild
+	lanes         map[string]*lane
+	locks         lockTable
+}
+
+type inProgressBuild struct {
+	cancel       context.CancelFunc
+	abandon      chan struct{}
+	supersededBy int
 }
 
 func (s *Service) AllLatestBuilds() ([]Build, error) {
@@ -60,12 +326,7 @@ func (s *Service) AllLatestBuilds() ([]Build, error) {
 
 	builds := []Build{}
 	for _, job := range jobList {
-		highestBuildForJob, err := s.HighestBuild(job.ID)
-		if err != nil {
-			return errs(err)
-		}
-
-		build, err := s.findBuild(job, highestBuildForJob)
+		build, err := s.latestBuild(job)
 		if err != nil {
 			return errs(err)
 		}
@@ -75,28 +336,417 @@ func (s *Service) AllLatestBuilds() ([]Build, error) {
 	return builds, nil
 }
 
+// latestBuild ignores builds of variants, e.g. pull requests, as they do not
+// reflect the state of the job's repository.
+func (s *Service) latestBuild(job Job) (Build, error) {
+	highestBuildForJob, err := s.HighestBuild(job.ID)
+	if err != nil {
+		return Build{}, err
+	}
+
+	latest, err := s.findBuild(job, highestBuildForJob)
+	for buildNumber := highestBuildForJob - 1; err == nil && latest.Variant != "" && buildNumber > 0; buildNumber-- {
+		latest, err = s.findBuild(job, buildNumber)
+	}
+	return latest, err
+}
+
 func (s *Service) Save(job *Job) error {
+	if job == nil {
+		return errors.New("saving job. Cause: no job given")
+	}
+	if err := validate(*job); err != nil {
+		return fmt.Errorf("saving job %s. Cause: %v", job.Name, err)
+	}
+	if err := s.ContainerPolicy.Check(*job); err != nil {
+		return fmt.Errorf("saving job %s. Cause: %v", job.Name, err)
+	}
+	if len(job.Locks) > 0 {
+		others, err := s.JobRepository.List()
+		if err != nil {
+			return fmt.Errorf("saving job %s. Cause: %v", job.Name, err)
+		}
+		if err := checkLockSlots(*job, others); err != nil {
+			return fmt.Errorf("saving job %s. Cause: %v", job.Name, err)
+		}
+	}
 	return s.JobRepository.Save(job)
 }
 
 func (s *Service) RunJob(id string) (int, error) {
+	return s.startBuild(id, buildRequest{})
+}
+
+// RunJobWithParameters starts a build using the given values of the job's
+// parameters, and the defaults of any others.
+func (s *Service) RunJobWithParameters(id string, parameters map[string]string) (int, error) {
+	return s.startBuild(id, buildRequest{parameters: parameters})
+}
+
+// TriggerJob starts a build because of a change to the job's repository,
+// rather than by hand. The build is skipped if none of the files that changed
+// since the last build match the job's path filters.
+func (s *Service) TriggerJob(id string) (int, error) {
+	return s.startBuild(id, buildRequest{triggered: true})
+}
+
+// RunPullRequest builds a pull request as a variant of the job, reporting the
+// status of the build for the pull request's head commit.
+func (s *Service) RunPullRequest(id string, pr PullRequest) (int, error) {
+	return s.startBuild(id, buildRequest{pullRequest: &pr})
+}
+
+type buildRequest struct {
+	triggered   bool
+	pullRequest *PullRequest
+	upstream    []UpstreamBuild
+	parameters  map[string]string
+	rebuild     *rebuild
+}
+
+func (s *Service) startBuild(id string, request buildRequest) (int, error) {
+	s.mutex.Lock()
+	if s.shuttingDown {
+		s.mutex.Unlock()
+		return 0, fmt.Errorf("running job with ID: %s. Cause: not accepting new builds while shutting down", id)
+	}
+	s.runningBuilds.Add(1)
+	s.mutex.Unlock()
+
+	buildNumber, err := s.runJob(id, request)
+	if err != nil {
+		s.runningBuilds.Done()
+	}
+	return buildNumber, err
+}
+
+func (s *Service) runJob(id string, request buildRequest) (int, error) {
 	job, err := s.JobRepository.FindById(id)
 	if err != nil {
 		return 0, fmt.Errorf("running job with ID: %s. Cause: %v", id, err)
 	}
 
-	buildNumber, outputDest, exitStatusChan, err := s.BuildRepository.Create(id)
+	var variant string
+	if request.pullRequest != nil {
+		variant = request.pullRequest.String()
+		job.Checkout.Ref = request.pullRequest.Ref
+	}
+	if request.rebuild != nil {
+		variant = request.rebuild.String()
+		request.rebuild.pin(&job)
+	}
+
+	if request.triggered && !job.Paths.Empty() {
+		if job.ChangedSince, err = s.lastBuiltRevision(id); err != nil {
+			log.Printf("error finding the last revision of job %s that was built, so building it anyway: %v\n", id, err)
+		}
+	}
+
+	if err := s.findCredential(&job.Checkout); err != nil {
+		return 0, fmt.Errorf("running job with ID: %s. Cause: %v", id, err)
+	}
+	for i := range job.Inputs {
+		if err := s.findCredential(&job.Inputs[i].Checkout); err != nil {
+			return 0, fmt.Errorf("running job with ID: %s. Cause: %v", id, err)
+		}
+	}
+
+	parameterValues, err := ResolveParameters(job.Parameters, request.parameters)
+	if err != nil {
+		return 0, fmt.Errorf("running job with ID: %s. Cause: %v", id, err)
+	}
+
+	// The policy may have changed since the job was saved
+	if err := s.ContainerPolicy.Check(job); err != nil {
+		return 0, fmt.Errorf("running job with ID: %s. Cause: %v", id, err)
+	}
+	for _, value := range parameterValues {
+		job.Env = append(job.Env, value.Name+"="+value.Value)
+	}
+
+	buildNumber, outputDest, exitStatusChan, err := s.BuildRepository.Create(id, variant)
 	if err != nil {
 		return 0, fmt.Errorf("creating build data for job with ID: %s. Cause: %v", id, err)
 	}
+	inputs := BuildInputs{DockerImage: job.DockerImage, Parameters: parameterValues}
+	if request.rebuild != nil {
+		inputs.RebuildOf = request.rebuild.buildNumber
+		fmt.Fprintf(outputDest, "Rebuilding build %d\n", request.rebuild.buildNumber)
+	}
+	if err := RecordInputs(outputDest, inputs); err != nil {
+		log.Printf("error recording inputs of build %d of job %s: %v\n", buildNumber, id, err)
+	}
+
+	report := func(state, description string) {
+		if request.pullRequest == nil || s.Reporter == nil {
+			return
+		}
+		status := BuildStatus{Job: job, BuildNumber: buildNumber, PullRequest: *request.pullRequest, State: state, Description: description}
+		if err := s.Reporter.ReportStatus(status); err != nil {
+			log.Printf("error reporting status of build %d of job %s: %v\n", buildNumber, id, err)
+		}
+	}
+	report(StatePending, "The build is running")
+	if request.upstream != nil {
+		buildUpstream(&job, request.upstream, outputDest)
+	}
 
-	if err := s.Runner.Run(job, outputDest, exitStatusChan); err != nil {
-		return 0, fmt.Errorf("starting job with ID: %s. Cause: %v", id, err)
+	buildKey := fmt.Sprintf("%s/%d", id, buildNumber)
+	ctx, cancel := context.WithCancel(context.Background())
+	build := &inProgressBuild{cancel: cancel, abandon: make(chan struct{})}
+	s.mutex.Lock()
+	if s.inProgress == nil {
+		s.inProgress = make(map[string]*inProgressBuild)
 	}
+	s.inProgress[buildKey] = build
+	s.mutex.Unlock()
+
+	run := s.Runner.Run
+	if !job.Matrix.Empty() {
+		run = s.matrixRunner(buildNumber).Run
+	}
+	if job.Retry.Enabled() {
+		run = s.retryRunner(buildNumber, run).Run
+	}
+	if len(job.Locks) > 0 {
+		run = s.lockRunner(buildNumber, run).Run
+	}
+
+	// Builds are approved before they wait for their turn or take any locks,
+	// so that a build awaiting approval holds up nothing else
+	gatedJob := job
+	job.Approval = ApprovalGate{}
+
+	var turn <-chan int
+	lane := laneKey(id, request)
+	joinLane := func() bool {
+		if !job.serialized() {
+			return true
+		}
+		var runningBuild int
+		if runningBuild, turn = s.join(lane, job.Concurrency, buildNumber, build); turn != nil {
+			fmt.Fprintf(outputDest, "Waiting for build %d to finish\n", runningBuild)
+		}
+		return turn == nil
+	}
+
+	runnerStatus := make(chan uint32, 1)
+	start := func() error { return run(ctx, job, outputDest, runnerStatus) }
+	if !gatedJob.Approval.Required {
+		if joinLane() {
+			if err := start(); err != nil {
+				s.leave(lane, buildNumber)
+				s.forget(buildKey)
+				report(StateError, "The build could not start")
+				return 0, fmt.Errorf("starting job with ID: %s. Cause: %v", id, err)
+			}
+		}
+	}
+
+	go func() {
+		defer s.runningBuilds.Done()
+		var exitStatus uint32
+		if gatedJob.Approval.Required {
+			exitStatus = startOnceApproved(ctx, gatedJob, joinLane, start, outputDest)
+		}
+		if exitStatus == 0 && turn != nil {
+			exitStatus = startInTurn(ctx, turn, start, outputDest)
+		}
+		if exitStatus == 0 {
+			select {
+			case exitStatus = <-runnerStatus:
+			case <-build.abandon:
+			}
+		}
+		if ctx.Err() != nil {
+			exitStatus = s.stoppedStatus(build)
+		}
+		s.leave(lane, buildNumber)
+		s.forget(buildKey)
+		exitStatusChan <- exitStatus
+		report(finishedStatus(exitStatus))
+
+		if exitStatus == 0 && variant == "" {
+			s.triggerDownstream(id, buildNumber)
+		}
+	}()
 
 	return buildNumber, nil
 }
 
+// matrixRunner runs a build of each cell of a job's matrix, writing a summary
+// of their results to the output of the matrix build.
+type matrixRunner struct {
+	service     *Service
+	buildNumber int
+}
+
+func (s *Service) matrixRunner(buildNumber int) matrixRunner {
+	return matrixRunner{service: s, buildNumber: buildNumber}
+}
+
+func (m matrixRunner) Run(ctx context.Context, job Job, outputDest io.WriteCloser, status chan<- uint32) error {
+	if err := job.Matrix.Validate(); err != nil {
+		return err
+	}
+
+	cells := job.Matrix.Cells(job)
+	exitStatuses := make([]uint32, len(cells))
+	var finished sync.WaitGroup
+	var outputMutex sync.Mutex
+	say := func(format string, args ...interface{}) {
+		outputMutex.Lock()
+		defer outputMutex.Unlock()
+		fmt.Fprintf(outputDest, format, args...)
+	}
+
+	for i, cell := range cells {
+		cellNumber, cellOutput, cellStatus, err := m.service.BuildRepository.CreateCell(job.ID, m.buildNumber, cell)
+		if err != nil {
+			say("Error creating build data for cell %s: %v\n", cell.Name, err)
+			exitStatuses[i] = StatusContainerFailed
+			continue
+		}
+		say("Started cell %d: %s\n", cellNumber, cell.Name)
+
+		runnerStatus := make(chan uint32, 1)
+		if err := m.service.Runner.Run(ctx, cell.Job, cellOutput, runnerStatus); err != nil {
+			fmt.Fprintf(cellOutput, "Error starting cell: %v\n", err)
+			cellOutput.Close()
+			runnerStatus <- StatusContainerFailed
+		}
+
+		finished.Add(1)
+		go func(i int, cell Cell) {
+			defer finished.Done()
+			exitStatuses[i] = <-runnerStatus
+			cellStatus <- exitStatuses[i]
+
+			allowed := ""
+			if cell.AllowFailure && exitStatuses[i] != 0 {
+				allowed = " (allowed to fail)"
+			}
+			say("Cell %s finished with exit status %d%s\n", cell.Name, exitStatuses[i], allowed)
+		}(i, cell)
+	}
+
+	go func() {
+		finished.Wait()
+		if err := outputDest.Close(); err != nil {
+			log.Printf("error closing matrix output: %v\n", err)
+		}
+		status <- MatrixStatus(cells, exitStatuses)
+	}()
+	return nil
+}
+
+// lastBuiltRevision is the revision of the job's repository that the last build
+// that was not skipped used, or empty if there was none. Builds of variants,
+// e.g. pull requests, are not of the job's repository as it is.
+func (s *Service) lastBuiltRevision(jobID string) (string, error) {
+	highestBuild, err := s.BuildRepository.HighestBuild(jobID)
+	if err != nil {
+		return "", err
+	}
+
+	for buildNumber := highestBuild; buildNumber > 0; buildNumber-- {
+		build, err := s.BuildRepository.Find(jobID, buildNumber)
+		if err != nil {
+			return "", err
+		}
+		if build.Variant != "" || (build.Finished && build.ExitStatus == StatusSkipped) {
+			continue
+		}
+		if revision := primaryRevision(build); revision != "" {
+			return revision, nil
+		}
+	}
+	return "", nil
+}
+
+// primaryRevision is the revision of the job's own repository that a build
+// used, if it recorded one.
+func primaryRevision(build Build) string {
+	for _, revision := range builtRevisions(build) {
+		if revision.Input == "" {
+			return revision.Revision
+		}
+	}
+	return ""
+}
+
+func builtRevisions(build Build) []Revision {
+	if len(build.Cells) > 0 {
+		// Every cell of a matrix builds the same revisions
+		return build.Cells[0].Revisions
+	}
+	return build.Revisions
+}
+
+func (s *Service) findCredential(options *CheckoutOptions) error {
+	if options.CredentialName == "" {
+		return nil
+	}
+
+	credential, err := s.Credentials.Find(options.CredentialName)
+	if err != nil {
+		return fmt.Errorf("finding git credential %s. Cause: %v", options.CredentialName, err)
+	}
+	options.Credential = &credential
+	return nil
+}
+
+func (s *Service) forget(buildKey string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if build, ok := s.inProgress[buildKey]; ok {
+		build.cancel()
+		delete(s.inProgress, buildKey)
+	}
+}
+
+// Shutdown stops new builds from being started and waits for running builds
+// to finish. Builds still running after gracePeriod are stopped and recorded
+// as aborted.
+func (s *Service) Shutdown(gracePeriod time.Duration) {
+	s.mutex.Lock()
+	s.shuttingDown = true
+	s.mutex.Unlock()
+
+	allFinished := make(chan struct{})
+	go func() {
+		s.runningBuilds.Wait()
+		close(allFinished)
+	}()
+
+	select {
+	case <-allFinished:
+		return
+	case <-time.After(gracePeriod):
+	}
+
+	s.mutex.Lock()
+	log.Printf("%d build(s) still running after %s. Stopping them\n", len(s.inProgress), gracePeriod)
+	for _, build := range s.inProgress {
+		build.cancel()
+	}
+	s.mutex.Unlock()
+
+	select {
+	case <-allFinished:
+		return
+	case <-time.After(stopTimeout):
+	}
+
+	s.mutex.Lock()
+	log.Printf("%d build(s) did not stop after %s. Recording them as aborted\n", len(s.inProgress), stopTimeout)
+	for _, build := range s.inProgress {
+		close(build.abandon)
+	}
+	s.mutex.Unlock()
+	<-allFinished
+}
+
 func (s *Service) FindBuild(jobId string, buildNumber int) (Build, error) {
 	job, err := s.JobRepository.FindById(jobId)
 	if err != nil {
@@ -111,9 +761,40 @@ func (s *Service) findBuild(job Job, buildNumber int) (Build, error) {
 		return Build{}, err
 	}
 	build.Job = job
+	if !build.Finished {
+		build.WaitingForLock = s.locks.waitingFor(job.ID, buildNumber)
+	}
 	return build, nil
 }
 
+func (s *Service) FindCell(jobId string, buildNumber, cellNumber int) (Build, error) {
+	job, err := s.JobRepository.FindById(jobId)
+	if err != nil {
+		return Build{}, err
+	}
+
+	cell, err := s.BuildRepository.FindCell(jobId, buildNumber, cellNumber)
+	if err != nil {
+		return Build{}, err
+	}
+	cell.Job = job
+	return cell, nil
+}
+
+func (s *Service) FindAttempt(jobId string, buildNumber, attemptNumber int) (Build, error) {
+	job, err := s.JobRepository.FindById(jobId)
+	if err != nil {
+		return Build{}, err
+	}
+
+	attempt, err := s.BuildRepository.FindAttempt(jobId, buildNumber, attemptNumber)
+	if err != nil {
+		return Build{}, err
+	}
+	attempt.Job = job
+	return attempt, nil
+}
+
 func (s *Service) HighestBuild(jobId string) (int, error) {
 	return s.BuildRepository.HighestBuild(jobId)
 }
@@ -121,3 +802,7 @@ func (s *Service) HighestBuild(jobId string) (int, error) {
 func (s *Service) Stream(jobId string, buildNumber int, streamOffset int64) (*chunkedio.ChunkedReader, error) {
 	return s.BuildRepository.Stream(jobId, buildNumber, streamOffset)
 }
+
+func (s *Service) StreamCell(jobId string, buildNumber, cellNumber int, streamOffset int64) (*chunkedio.ChunkedReader, error) {
+	return s.BuildRepository.StreamCell(jobId, buildNumber, cellNumber, streamOffset)
+}
@@ -1,17 +1,23 @@
 package jobs_test
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"time"
 
 	"github.com/craigfurman/woodhouse-ci/jobs"
 	"github.com/craigfurman/woodhouse-ci/jobs/fake_build_repository"
+	"github.com/craigfurman/woodhouse-ci/jobs/fake_credential_repository"
 	"github.com/craigfurman/woodhouse-ci/jobs/fake_job_repository"
 	"github.com/craigfurman/woodhouse-ci/jobs/fake_job_runner"
+	"github.com/craigfurman/woodhouse-ci/jobs/fake_status_reporter"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 )
 
 var _ = Describe("Service", func() {
@@ -20,16 +26,19 @@ var _ = Describe("Service", func() {
 		jobRepo   *fake_job_repository.FakeJobRepository
 		buildRepo *fake_build_repository.FakeBuildRepository
 		runner    *fake_job_runner.FakeRunner
+		creds     *fake_credential_repository.FakeCredentialRepository
 	)
 
 	BeforeEach(func() {
 		jobRepo = new(fake_job_repository.FakeJobRepository)
 		buildRepo = new(fake_build_repository.FakeBuildRepository)
 		runner = new(fake_job_runner.FakeRunner)
+		creds = new(fake_credential_repository.FakeCredentialRepository)
 		service = &jobs.Service{
 			JobRepository:   jobRepo,
 			Runner:          runner,
 			BuildRepository: buildRepo,
+			Credentials:     creds,
 		}
 	})
 
@@ -55,6 +64,23 @@ var _ = Describe("Service", func() {
 		})
 	})
 
+	Describe("listing the latest builds when the latest is of a pull request", func() {
+		It("returns the latest build of the job itself", func() {
+			jobRepo.ListReturns([]jobs.Job{{ID: "some-id"}}, nil)
+			buildRepo.HighestBuildReturns(3, nil)
+			buildRepo.FindStub = func(jobID string, buildNumber int) (jobs.Build, error) {
+				if buildNumber == 3 {
+					return jobs.Build{Variant: "pull request #1", ExitStatus: 1}, nil
+				}
+				return jobs.Build{Output: []byte(fmt.Sprintf("build %d", buildNumber))}, nil
+			}
+
+			builds, err := service.AllLatestBuilds()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(builds[0].Output).To(Equal([]byte("build 2")))
+		})
+	})
+
 	Describe("saving a job", func() {
 		It("saves the job using the jobRepository", func() {
 			Expect(service.Save(&jobs.Job{Name: "freddo", Command: "whoami"})).To(Succeed())
@@ -69,7 +95,90 @@ var _ = Describe("Service", func() {
 			})
 
 			It("returns the error from the jobRepository", func() {
-				Expect(service.Save(nil)).To(MatchError("something went wrong"))
+				Expect(service.Save(&jobs.Job{Name: "freddo"})).To(MatchError("something went wrong"))
+			})
+		})
+
+		Context("when there is no job", func() {
+			It("returns an error", func() {
+				Expect(service.Save(nil)).To(MatchError("saving job. Cause: no job given"))
+				Expect(jobRepo.SaveCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the job has an unknown runner type", func() {
+			It("does not save the job", func() {
+				Expect(service.Save(&jobs.Job{Name: "remote", RunnerType: "ssh"})).To(MatchError("saving job remote. Cause: unknown runner type: ssh"))
+				Expect(jobRepo.SaveCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the job has an unknown source type", func() {
+			It("does not save the job", func() {
+				Expect(service.Save(&jobs.Job{Name: "svn", SourceType: "svn", Repository: "svn://example.com/app"})).To(MatchError("saving job svn. Cause: unknown source type: svn"))
+				Expect(service.Save(&jobs.Job{Name: "lib", Inputs: []jobs.Input{{Name: "lib", SourceType: "cvs", Repository: "lib"}}})).To(MatchError("saving job lib. Cause: unknown source type: cvs"))
+				Expect(jobRepo.SaveCallCount()).To(Equal(0))
+			})
+		})
+
+		It("saves jobs of every known runner and source type", func() {
+			for _, runnerType := range []string{"", jobs.RunnerContainer, jobs.RunnerDocker, jobs.RunnerPodman, jobs.RunnerAgent} {
+				for _, sourceType := range []string{"", jobs.SourceGit, jobs.SourceMercurial, jobs.SourceArchive} {
+					Expect(service.Save(&jobs.Job{Name: "app", RunnerType: runnerType, SourceType: sourceType})).To(Succeed())
+				}
+			}
+			Expect(jobRepo.SaveCallCount()).To(Equal(20))
+		})
+
+		Context("when a repository could be mistaken for an option", func() {
+			It("does not save the job", func() {
+				Expect(service.Save(&jobs.Job{Name: "app", Repository: "--upload-pack=touch pwned"})).To(MatchError("saving job app. Cause: repositories cannot start with '-', not: --upload-pack=touch pwned"))
+				Expect(service.Save(&jobs.Job{Name: "app", Repository: "app.git", Inputs: []jobs.Input{{Name: "lib", SourceType: jobs.SourceMercurial, Repository: "--config=hooks.pre-clone=touch pwned"}}})).To(MatchError(ContainSubstring("repositories cannot start with '-'")))
+				Expect(jobRepo.SaveCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when an artifact pattern leaves the workspace", func() {
+			It("does not save the job", func() {
+				for _, pattern := range []string{"../../etc/*", "build/../../secrets", "/etc/passwd"} {
+					job := &jobs.Job{Name: "leaky", Artifacts: []string{"*.tar", pattern}}
+					Expect(service.Save(job)).To(MatchError(ContainSubstring("saving job leaky. Cause: artifact patterns")))
+				}
+				Expect(jobRepo.SaveCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the job is not valid", func() {
+			It("does not save the job", func() {
+				for job, cause := range map[*jobs.Job]string{
+					{Name: "app", Repository: "app.git", Checkout: jobs.CheckoutOptions{Ref: "a..b"}}:                                                     "not a valid git ref: a..b",
+					{Name: "app", Inputs: []jobs.Input{{Name: "lib", Repository: "lib.git", Checkout: jobs.CheckoutOptions{Ref: "--upload-pack=touch"}}}}: "refs cannot start with '-', not: --upload-pack=touch",
+					{Name: "app", Inputs: []jobs.Input{{Name: "lib", Repository: "lib.git"}, {Name: "lib", Repository: "other.git"}}}:                     "more than one input is named lib",
+					{Name: "app", Parameters: []jobs.Parameter{{Name: "TARGET", Type: jobs.ParameterChoice}}}:                                             "choice parameter TARGET has no choices",
+					{Name: "app", Concurrency: "sometimes"}:                                                                           "unknown concurrency policy: sometimes",
+					{Name: "app", Caches: []jobs.Cache{{Name: "go modules", Path: "/go"}}}:                                            "cache names may only contain letters, numbers, '.', '_' and '-', not: go modules",
+					{Name: "app", Repository: "app.git", Dockerfile: "Dockerfile", DockerImage: "golang"}:                             "jobs cannot have both a docker image and a Dockerfile",
+					{Name: "app", Retry: jobs.RetryPolicy{MaxAttempts: 2}, Matrix: jobs.Matrix{DockerImages: []string{"golang"}}}:     "jobs with a matrix cannot retry failed builds",
+					{Name: "app", Approval: jobs.ApprovalGate{Required: true}, Matrix: jobs.Matrix{DockerImages: []string{"golang"}}}: "jobs with a matrix cannot require approval",
+				} {
+					Expect(service.Save(job)).To(MatchError("saving job app. Cause: " + cause))
+				}
+				Expect(jobRepo.SaveCallCount()).To(Equal(0))
+			})
+
+			It("allows mercurial revisions that are not git refs", func() {
+				Expect(service.Save(&jobs.Job{Name: "app", SourceType: jobs.SourceMercurial, Repository: "https://example.com/app", Checkout: jobs.CheckoutOptions{Ref: "a..b"}})).To(Succeed())
+			})
+		})
+
+		Context("when the job's container options are not allowed", func() {
+			It("does not save the job", func() {
+				job := &jobs.Job{Name: "dind", DockerImage: "docker:dind", Container: jobs.ContainerOptions{Privileged: true}}
+				Expect(service.Save(job)).To(MatchError("saving job dind. Cause: containers of image docker:dind are not allowed to be privileged"))
+				Expect(jobRepo.SaveCallCount()).To(Equal(0))
+
+				service.ContainerPolicy.PrivilegedImages = []string{"docker:dind"}
+				Expect(service.Save(job)).To(Succeed())
 			})
 		})
 	})
@@ -79,7 +188,7 @@ var _ = Describe("Service", func() {
 			BeforeEach(func() {
 				job := jobs.Job{ID: "some-id", Name: "jerb", Command: "doStuff"}
 				jobRepo.FindByIdReturns(job, nil)
-				runner.RunStub = func(j jobs.Job, oDest io.WriteCloser, status chan<- uint32) error {
+				runner.RunStub = func(ctx context.Context, j jobs.Job, oDest io.WriteCloser, status chan<- uint32) error {
 					Expect(j).To(Equal(job))
 					_, err := oDest.Write([]byte("build output!"))
 					Expect(err).NotTo(HaveOccurred())
@@ -122,6 +231,60 @@ var _ = Describe("Service", func() {
 			})
 		})
 
+		Context("when the job mounts a directory that is no longer allowed", func() {
+			BeforeEach(func() {
+				jobRepo.FindByIdReturns(jobs.Job{ID: "some-id", Container: jobs.ContainerOptions{Volumes: []string{"/var/run/docker.sock:/var/run/docker.sock"}}}, nil)
+			})
+
+			It("does not run the job", func() {
+				_, err := service.RunJob("some-id")
+				Expect(err).To(MatchError("running job with ID: some-id. Cause: mounting /var/run/docker.sock is not allowed"))
+				Expect(buildRepo.CreateCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the job fetches with a git credential", func() {
+			BeforeEach(func() {
+				jobRepo.FindByIdReturns(jobs.Job{ID: "some-id", Checkout: jobs.CheckoutOptions{CredentialName: "deploy-key"}}, nil)
+				buildRepo.CreateReturns(1, nopWriteCloser{}, make(chan uint32, 1), nil)
+			})
+
+			It("gives the runner the credential", func() {
+				credential := jobs.GitCredential{Name: "deploy-key", Type: jobs.CredentialSSH, Secret: "private key"}
+				creds.FindReturns(credential, nil)
+
+				_, err := service.RunJob("some-id")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(creds.FindArgsForCall(0)).To(Equal("deploy-key"))
+				_, job, _, _ := runner.RunArgsForCall(0)
+				Expect(job.Checkout.Credential).To(Equal(&credential))
+			})
+
+			It("gives the runner the credentials of other inputs", func() {
+				jobRepo.FindByIdReturns(jobs.Job{ID: "some-id", Inputs: []jobs.Input{
+					{Name: "lib", Repository: "git@example.com:lib.git", Checkout: jobs.CheckoutOptions{CredentialName: "lib-key"}},
+				}}, nil)
+				credential := jobs.GitCredential{Name: "lib-key", Type: jobs.CredentialSSH, Secret: "private key"}
+				creds.FindReturns(credential, nil)
+
+				_, err := service.RunJob("some-id")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(creds.FindArgsForCall(0)).To(Equal("lib-key"))
+				_, job, _, _ := runner.RunArgsForCall(0)
+				Expect(job.Inputs[0].Checkout.Credential).To(Equal(&credential))
+			})
+
+			Context("when the credential cannot be found", func() {
+				It("returns error without starting a build", func() {
+					creds.FindReturns(jobs.GitCredential{}, errors.New("deleted"))
+
+					_, err := service.RunJob("some-id")
+					Expect(err).To(MatchError(ContainSubstring("finding git credential deploy-key")))
+					Expect(buildRepo.CreateCallCount()).To(Equal(0))
+				})
+			})
+		})
+
 		Context("when job cannot be started", func() {
 			BeforeEach(func() {
 				runner.RunReturns(errors.New("couldn't start job!"))
@@ -134,6 +297,404 @@ var _ = Describe("Service", func() {
 		})
 	})
 
+	Describe("triggering a job", func() {
+		var job jobs.Job
+
+		BeforeEach(func() {
+			job = jobs.Job{ID: "some-id", Command: "make", Repository: "monorepo.git", Paths: jobs.PathFilter{Include: []string{"services/api/"}}}
+			jobRepo.FindByIdStub = func(string) (jobs.Job, error) {
+				return job, nil
+			}
+			buildRepo.CreateReturns(4, nopWriteCloser{}, make(chan uint32, 1), nil)
+			buildRepo.HighestBuildReturns(3, nil)
+			builds := map[int]jobs.Build{
+				1: {Finished: true, Revisions: []jobs.Revision{{Revision: "first"}}},
+				2: {Finished: true, ExitStatus: 1, Revisions: []jobs.Revision{{Input: "lib", Revision: "lib-revision"}, {Revision: "second"}}},
+				3: {Finished: true, ExitStatus: jobs.StatusSkipped, Revisions: []jobs.Revision{{Revision: "third"}}},
+			}
+			buildRepo.FindStub = func(jobID string, buildNumber int) (jobs.Build, error) {
+				return builds[buildNumber], nil
+			}
+		})
+
+		It("gives the runner the revision of the last build that was not skipped", func() {
+			buildNumber, err := service.TriggerJob("some-id")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buildNumber).To(Equal(4))
+			_, ranJob, _, _ := runner.RunArgsForCall(0)
+			Expect(ranJob.ChangedSince).To(Equal("second"))
+		})
+
+		Context("when the job has no path filters", func() {
+			BeforeEach(func() {
+				job.Paths = jobs.PathFilter{}
+			})
+
+			It("always builds", func() {
+				_, err := service.TriggerJob("some-id")
+				Expect(err).NotTo(HaveOccurred())
+				_, ranJob, _, _ := runner.RunArgsForCall(0)
+				Expect(ranJob.ChangedSince).To(BeEmpty())
+				Expect(buildRepo.FindCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the last build cannot be found", func() {
+			BeforeEach(func() {
+				buildRepo.HighestBuildReturns(0, errors.New("no builds"))
+			})
+
+			It("builds anyway", func() {
+				_, err := service.TriggerJob("some-id")
+				Expect(err).NotTo(HaveOccurred())
+				_, ranJob, _, _ := runner.RunArgsForCall(0)
+				Expect(ranJob.ChangedSince).To(BeEmpty())
+			})
+		})
+
+		It("is not filtered when run by hand", func() {
+			_, err := service.RunJob("some-id")
+			Expect(err).NotTo(HaveOccurred())
+			_, ranJob, _, _ := runner.RunArgsForCall(0)
+			Expect(ranJob.ChangedSince).To(BeEmpty())
+		})
+	})
+
+	Describe("running a job with parameters", func() {
+		BeforeEach(func() {
+			jobRepo.FindByIdReturns(jobs.Job{ID: "some-id", Command: "deploy", Parameters: []jobs.Parameter{
+				{Name: "TARGET", Type: jobs.ParameterChoice, Choices: []string{"staging", "production"}},
+				{Name: "DRY_RUN", Type: jobs.ParameterBoolean, Default: "true"},
+			}}, nil)
+			buildRepo.CreateReturns(2, nopWriteCloser{}, make(chan uint32, 1), nil)
+		})
+
+		It("sets the values as environment variables", func() {
+			_, err := service.RunJobWithParameters("some-id", map[string]string{"TARGET": "production"})
+			Expect(err).NotTo(HaveOccurred())
+			_, ranJob, _, _ := runner.RunArgsForCall(0)
+			Expect(ranJob.Env).To(Equal([]string{"TARGET=production", "DRY_RUN=true"}))
+		})
+
+		It("uses the defaults for builds started without values", func() {
+			_, err := service.TriggerJob("some-id")
+			Expect(err).NotTo(HaveOccurred())
+			_, ranJob, _, _ := runner.RunArgsForCall(0)
+			Expect(ranJob.Env).To(Equal([]string{"TARGET=staging", "DRY_RUN=true"}))
+		})
+
+		It("does not start builds with invalid values", func() {
+			_, err := service.RunJobWithParameters("some-id", map[string]string{"DRY_RUN": "maybe"})
+			Expect(err).To(MatchError(ContainSubstring("parameter DRY_RUN must be true or false")))
+			Expect(buildRepo.CreateCallCount()).To(Equal(0))
+			Expect(runner.RunCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("rebuilding a build", func() {
+		var (
+			output *recordingOutput
+			status chan uint32
+		)
+
+		BeforeEach(func() {
+			jobRepo.FindByIdReturns(jobs.Job{
+				ID:          "some-id",
+				Command:     "make",
+				DockerImage: "golang:1.22",
+				Repository:  "app.git",
+				Inputs:      []jobs.Input{{Name: "lib", Repository: "lib.git"}, {Name: "data", SourceType: jobs.SourceArchive, Repository: "https://example.com/data.tgz"}},
+				Parameters:  []jobs.Parameter{{Name: "TARGET", Type: jobs.ParameterChoice, Choices: []string{"staging", "production"}}},
+			}, nil)
+			buildRepo.FindReturns(jobs.Build{
+				Finished:        true,
+				ExitStatus:      1,
+				Image:           "golang:1.21",
+				ParameterValues: []jobs.ParameterValue{{Name: "TARGET", Value: "production"}},
+				Revisions: []jobs.Revision{
+					{Revision: "abc123"},
+					{Input: "lib", Revision: "def456"},
+					{Input: "data", Revision: "sha256-of-archive"},
+				},
+			}, nil)
+			output = &recordingOutput{Buffer: gbytes.NewBuffer()}
+			status = make(chan uint32, 1)
+			buildRepo.CreateReturns(43, output, status, nil)
+		})
+
+		It("builds the revisions, image and parameters the build used", func() {
+			buildNumber, err := service.Rebuild("some-id", 42)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buildNumber).To(Equal(43))
+
+			jobID, buildNumber := buildRepo.FindArgsForCall(0)
+			Expect(jobID).To(Equal("some-id"))
+			Expect(buildNumber).To(Equal(42))
+
+			_, ranJob, _, _ := runner.RunArgsForCall(0)
+			Expect(ranJob.DockerImage).To(Equal("golang:1.21"))
+			Expect(ranJob.Checkout.Ref).To(Equal("abc123"))
+			Expect(ranJob.Inputs[0].Checkout.Ref).To(Equal("def456"))
+			Expect(ranJob.Inputs[1].Checkout.Ref).To(BeEmpty())
+			Expect(ranJob.Env).To(Equal([]string{"TARGET=production"}))
+		})
+
+		It("records which build it was a rebuild of", func() {
+			_, err := service.Rebuild("some-id", 42)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, variant := buildRepo.CreateArgsForCall(0)
+			Expect(variant).To(Equal("rebuild of #42"))
+			Expect(output.inputs).To(Equal([]jobs.BuildInputs{{
+				DockerImage: "golang:1.21",
+				Parameters:  []jobs.ParameterValue{{Name: "TARGET", Value: "production"}},
+				RebuildOf:   42,
+			}}))
+			Expect(output.Buffer).To(gbytes.Say("Rebuilding build 42"))
+		})
+
+		It("does not trigger downstream jobs", func() {
+			runner.RunStub = func(ctx context.Context, j jobs.Job, oDest io.WriteCloser, runnerStatus chan<- uint32) error {
+				runnerStatus <- 0
+				return nil
+			}
+			_, err := service.Rebuild("some-id", 42)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(status).Should(Receive(Equal(uint32(0))))
+			Expect(jobRepo.ListCallCount()).To(Equal(0))
+		})
+
+		Context("when the build cannot be found", func() {
+			It("returns an error", func() {
+				buildRepo.FindReturns(jobs.Build{}, errors.New("no such build"))
+				_, err := service.Rebuild("some-id", 42)
+				Expect(err).To(MatchError(ContainSubstring("no such build")))
+				Expect(runner.RunCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("running a job with a matrix", func() {
+		var (
+			matrixOutput *gbytes.Buffer
+			matrixStatus chan uint32
+			cellOutputs  []*gbytes.Buffer
+			cellStatuses []chan uint32
+			results      chan uint32
+		)
+
+		BeforeEach(func() {
+			jobRepo.FindByIdReturns(jobs.Job{
+				ID:      "some-id",
+				Command: "make",
+				Matrix: jobs.Matrix{
+					DockerImages:    []string{"golang:1.21", "golang:1.22"},
+					AllowedFailures: []string{"golang:1.22"},
+				},
+			}, nil)
+			matrixOutput = gbytes.NewBuffer()
+			matrixStatus = make(chan uint32, 1)
+			buildRepo.CreateReturns(3, matrixOutput, matrixStatus, nil)
+
+			cellOutputs, cellStatuses = nil, nil
+			buildRepo.CreateCellStub = func(jobID string, buildNumber int, cell jobs.Cell) (int, io.WriteCloser, chan uint32, error) {
+				cellOutputs = append(cellOutputs, gbytes.NewBuffer())
+				cellStatuses = append(cellStatuses, make(chan uint32, 1))
+				return len(cellOutputs), cellOutputs[len(cellOutputs)-1], cellStatuses[len(cellStatuses)-1], nil
+			}
+
+			results = make(chan uint32, 2)
+			cellResults := results
+			runner.RunStub = func(ctx context.Context, job jobs.Job, outputDest io.WriteCloser, status chan<- uint32) error {
+				go func() {
+					status <- <-cellResults
+					outputDest.Close()
+				}()
+				return nil
+			}
+		})
+
+		It("runs a build of each cell", func() {
+			_, err := service.RunJob("some-id")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(buildRepo.CreateCellCallCount()).To(Equal(2))
+			jobID, buildNumber, cell := buildRepo.CreateCellArgsForCall(1)
+			Expect(jobID).To(Equal("some-id"))
+			Expect(buildNumber).To(Equal(3))
+			Expect(cell.Name).To(Equal("golang:1.22"))
+			Expect(cell.AllowFailure).To(BeTrue())
+
+			Expect(runner.RunCallCount()).To(Equal(2))
+			_, job, outputDest, _ := runner.RunArgsForCall(0)
+			Expect(job.DockerImage).To(Equal("golang:1.21"))
+			Expect(outputDest).To(Equal(cellOutputs[0]))
+			Expect(matrixOutput).To(gbytes.Say("Started cell 1: golang:1.21"))
+		})
+
+		It("records the status of each cell, and of the build", func() {
+			_, err := service.RunJob("some-id")
+			Expect(err).NotTo(HaveOccurred())
+
+			results <- 0
+			results <- 1
+			Eventually(matrixStatus).Should(Receive(Equal(uint32(0))))
+			Expect(matrixOutput.Closed()).To(BeTrue())
+			Expect(matrixOutput).To(gbytes.Say("finished with exit status 1 \\(allowed to fail\\)"))
+
+			statuses := []uint32{<-cellStatuses[0], <-cellStatuses[1]}
+			Expect(statuses).To(ConsistOf(uint32(0), uint32(1)))
+		})
+
+		It("fails when a cell that is not allowed to fail does", func() {
+			jobRepo.FindByIdReturns(jobs.Job{ID: "some-id", Command: "make", Matrix: jobs.Matrix{Env: []string{"A=1", "A=2"}}}, nil)
+			_, err := service.RunJob("some-id")
+			Expect(err).NotTo(HaveOccurred())
+
+			results <- 0
+			results <- 2
+			Eventually(matrixStatus).Should(Receive(Equal(uint32(2))))
+		})
+
+		Context("when a cell cannot be started", func() {
+			It("records it as failed", func() {
+				runner.RunReturns(errors.New("no command"))
+				runner.RunStub = nil
+				_, err := service.RunJob("some-id")
+				Expect(err).NotTo(HaveOccurred())
+
+				Eventually(matrixStatus).Should(Receive(Equal(jobs.StatusContainerFailed)))
+				Expect(cellOutputs[0]).To(gbytes.Say("Error starting cell: no command"))
+			})
+		})
+	})
+
+	Describe("building a pull request", func() {
+		var (
+			reporter   *fake_status_reporter.FakeStatusReporter
+			exitStatus chan uint32
+			pr         jobs.PullRequest
+		)
+
+		BeforeEach(func() {
+			reporter = new(fake_status_reporter.FakeStatusReporter)
+			service.Reporter = reporter
+			jobRepo.FindByIdReturns(jobs.Job{ID: "some-id", Command: "make", Repository: "app.git", Checkout: jobs.CheckoutOptions{Depth: 1}}, nil)
+			buildRepo.CreateReturns(5, nopWriteCloser{}, make(chan uint32, 1), nil)
+			exitStatus = make(chan uint32, 1)
+			result := exitStatus
+			runner.RunStub = func(ctx context.Context, job jobs.Job, outputDest io.WriteCloser, status chan<- uint32) error {
+				go func() {
+					status <- <-result
+				}()
+				return nil
+			}
+			pr = jobs.PullRequest{Number: 12, Repository: "octocat/app", Ref: "refs/pull/12/head", HeadCommit: "abc123"}
+		})
+
+		It("builds the pull request's ref as a variant of the job", func() {
+			buildNumber, err := service.RunPullRequest("some-id", pr)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buildNumber).To(Equal(5))
+
+			jobID, variant := buildRepo.CreateArgsForCall(0)
+			Expect(jobID).To(Equal("some-id"))
+			Expect(variant).To(Equal("pull request #12"))
+			_, job, _, _ := runner.RunArgsForCall(0)
+			Expect(job.Checkout).To(Equal(jobs.CheckoutOptions{Ref: "refs/pull/12/head", Depth: 1}))
+		})
+
+		It("reports that the build is pending, then its result", func() {
+			_, err := service.RunPullRequest("some-id", pr)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reporter.ReportStatusCallCount()).To(Equal(1))
+			pending := reporter.ReportStatusArgsForCall(0)
+			Expect(pending.State).To(Equal(jobs.StatePending))
+			Expect(pending.BuildNumber).To(Equal(5))
+			Expect(pending.PullRequest).To(Equal(pr))
+			Expect(pending.Job.ID).To(Equal("some-id"))
+
+			exitStatus <- 2
+			Eventually(reporter.ReportStatusCallCount).Should(Equal(2))
+			finished := reporter.ReportStatusArgsForCall(1)
+			Expect(finished.State).To(Equal(jobs.StateFailure))
+			Expect(finished.Description).To(Equal("The build failed with exit status 2"))
+		})
+
+		It("reports builds that could not run the command as errors", func() {
+			_, err := service.RunPullRequest("some-id", pr)
+			Expect(err).NotTo(HaveOccurred())
+			exitStatus <- jobs.StatusFetchFailed
+			Eventually(reporter.ReportStatusCallCount).Should(Equal(2))
+			Expect(reporter.ReportStatusArgsForCall(1).State).To(Equal(jobs.StateError))
+		})
+
+		It("does not report the status of other builds", func() {
+			_, err := service.RunJob("some-id")
+			Expect(err).NotTo(HaveOccurred())
+			exitStatus <- 0
+			Consistently(reporter.ReportStatusCallCount).Should(Equal(0))
+			_, variant := buildRepo.CreateArgsForCall(0)
+			Expect(variant).To(BeEmpty())
+		})
+	})
+
+	Describe("shutting down", func() {
+		var (
+			exitCode      chan uint32
+			runnerStatus  chan<- uint32
+			runnerContext context.Context
+		)
+
+		BeforeEach(func() {
+			exitCode = make(chan uint32, 1)
+			buildRepo.CreateReturns(1, nopWriteCloser{}, exitCode, nil)
+			runner.RunStub = func(ctx context.Context, j jobs.Job, oDest io.WriteCloser, status chan<- uint32) error {
+				runnerContext = ctx
+				runnerStatus = status
+				return nil
+			}
+
+			_, err := service.RunJob("some-id")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("refuses to start new builds", func() {
+			runnerStatus <- 0
+			service.Shutdown(time.Second)
+			_, err := service.RunJob("some-id")
+			Expect(err).To(MatchError(ContainSubstring("not accepting new builds while shutting down")))
+			Expect(runner.RunCallCount()).To(Equal(1))
+		})
+
+		Context("when running builds finish within the grace period", func() {
+			It("waits for them to finish", func() {
+				shutdown := make(chan bool)
+				go func() {
+					service.Shutdown(time.Second * 5)
+					close(shutdown)
+				}()
+
+				Consistently(shutdown).ShouldNot(BeClosed())
+				runnerStatus <- 3
+				Eventually(shutdown).Should(BeClosed())
+				Expect(<-exitCode).To(Equal(uint32(3)))
+			})
+		})
+
+		Context("when running builds do not finish within the grace period", func() {
+			It("stops them and records them as aborted", func() {
+				go func() {
+					<-runnerContext.Done()
+					runnerStatus <- 137
+				}()
+
+				service.Shutdown(time.Millisecond * 100)
+				Expect(<-exitCode).To(Equal(jobs.StatusAborted))
+			})
+		})
+	})
+
 	Describe("finding a build", func() {
 		It("gets the build with complete output from the repository", func() {
 			job := jobs.Job{ID: "some-id", Name: "my fancy job"}
@@ -179,3 +740,18 @@ var _ = Describe("Service", func() {
 		})
 	})
 })
+
+type nopWriteCloser struct{}
+
+func (nopWriteCloser) Write(p []byte) (int, error) { return len(p), nil }
+func (nopWriteCloser) Close() error                { return nil }
+
+type recordingOutput struct {
+	*gbytes.Buffer
+	inputs []jobs.BuildInputs
+}
+
+func (o *recordingOutput) RecordInputs(inputs jobs.BuildInputs) error {
+	o.inputs = append(o.inputs, inputs)
+	return nil
+}
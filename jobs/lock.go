@@ -0,0 +1,296 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Lock is a resource shared by jobs, e.g. an environment they deploy to, that
+// a build must hold before it runs. It has one slot unless it is a pool of
+// several, which as many builds may hold at once.
+type Lock struct {
+	Name  string
+	Slots int `json:",omitempty"`
+}
+
+func (l Lock) slots() int {
+	if l.Slots < 1 {
+		return 1
+	}
+	return l.Slots
+}
+
+var lockName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+func ValidateLocks(locks []Lock) error {
+	names := map[string]bool{}
+	for _, lock := range locks {
+		if !lockName.MatchString(lock.Name) {
+			return fmt.Errorf("lock names may only contain letters, numbers, '.', '_' and '-', not: %s", lock.Name)
+		}
+		if names[lock.Name] {
+			return fmt.Errorf("lock %s is given more than once", lock.Name)
+		}
+		names[lock.Name] = true
+		if lock.Slots < 0 {
+			return fmt.Errorf("lock %s must have at least 1 slot, not: %d", lock.Name, lock.Slots)
+		}
+	}
+	return nil
+}
+
+// checkLockSlots returns an error if another job declares one of the job's
+// locks with a different number of slots.
+func checkLockSlots(job Job, others []Job) error {
+	for _, lock := range job.Locks {
+		for _, other := range others {
+			if other.ID == job.ID {
+				continue
+			}
+			for _, otherLock := range other.Locks {
+				if otherLock.Name == lock.Name && otherLock.slots() != lock.slots() {
+					return fmt.Errorf("lock %s has %d slots in job %s, not %d", lock.Name, otherLock.slots(), other.Name, lock.slots())
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// LockHolder is a build holding, or waiting for, a lock.
+type LockHolder struct {
+	JobID       string
+	BuildNumber int
+	Since       time.Time
+}
+
+// LockStatus is who holds a lock and who is waiting for it, in the order they
+// will get it.
+type LockStatus struct {
+	Name    string
+	Slots   int
+	Holders []LockHolder
+	Waiting []LockHolder
+}
+
+// lockTable keeps the locks held by running builds in memory, so that a crash
+// of Woodhouse releases all of them.
+type lockTable struct {
+	mutex   sync.Mutex
+	locks   map[string]*LockStatus
+	changed chan struct{}
+}
+
+// errLockSlots is returned when a build declares a lock with a different
+// number of slots than the builds already holding or waiting for it.
+type errLockSlots struct {
+	name          string
+	slots, wanted int
+}
+
+func (e errLockSlots) Error() string {
+	return fmt.Sprintf("lock %s has %d slots, but the job declares %d", e.name, e.slots, e.wanted)
+}
+
+// acquire waits until the build is first in line for a free slot of the lock,
+// or ctx is done. The lock keeps the number of slots it was first declared
+// with until nothing holds or waits for it.
+func (t *lockTable) acquire(ctx context.Context, holder LockHolder, lock Lock, outputDest io.Writer) error {
+	t.mutex.Lock()
+	if t.locks == nil {
+		t.locks = make(map[string]*LockStatus)
+	}
+	status, ok := t.locks[lock.Name]
+	if !ok {
+		status = &LockStatus{Name: lock.Name, Slots: lock.slots()}
+		t.locks[lock.Name] = status
+	}
+	if status.Slots != lock.slots() {
+		t.mutex.Unlock()
+		return errLockSlots{name: lock.Name, slots: status.Slots, wanted: lock.slots()}
+	}
+	holder.Since = time.Now()
+	status.Waiting = append(status.Waiting, holder)
+
+	announced := false
+	for {
+		position := indexOf(status.Waiting, holder)
+		if position < status.Slots-len(status.Holders) {
+			status.Waiting = append(status.Waiting[:position], status.Waiting[position+1:]...)
+			holder.Since = time.Now()
+			status.Holders = append(status.Holders, holder)
+			t.mutex.Unlock()
+			return nil
+		}
+
+		if t.changed == nil {
+			t.changed = make(chan struct{})
+		}
+		changed := t.changed
+		t.mutex.Unlock()
+
+		if !announced {
+			fmt.Fprintf(outputDest, "Waiting for lock %s\n", lock.Name)
+			announced = true
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			t.mutex.Lock()
+			position := indexOf(status.Waiting, holder)
+			status.Waiting = append(status.Waiting[:position], status.Waiting[position+1:]...)
+			t.released(status)
+			t.mutex.Unlock()
+			return ctx.Err()
+		}
+		t.mutex.Lock()
+	}
+}
+
+// release frees the slot of the lock the build holds, returning whether it
+// held one.
+func (t *lockTable) release(name string, holder LockHolder) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	status, ok := t.locks[name]
+	if !ok {
+		return false
+	}
+	position := indexOf(status.Holders, holder)
+	if position < 0 {
+		return false
+	}
+	status.Holders = append(status.Holders[:position], status.Holders[position+1:]...)
+	t.released(status)
+	return true
+}
+
+// released forgets a lock once nothing holds or waits for it, and wakes up
+// builds waiting for locks to check whether it is their turn.
+func (t *lockTable) released(status *LockStatus) {
+	if len(status.Holders) == 0 && len(status.Waiting) == 0 {
+		delete(t.locks, status.Name)
+	}
+	if t.changed != nil {
+		close(t.changed)
+		t.changed = nil
+	}
+}
+
+func (t *lockTable) waitingFor(jobID string, buildNumber int) string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for name, status := range t.locks {
+		if indexOf(status.Waiting, LockHolder{JobID: jobID, BuildNumber: buildNumber}) >= 0 {
+			return name
+		}
+	}
+	return ""
+}
+
+func (t *lockTable) list() []LockStatus {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	statuses := []LockStatus{}
+	for _, status := range t.locks {
+		statuses = append(statuses, LockStatus{
+			Name:    status.Name,
+			Slots:   status.Slots,
+			Holders: append([]LockHolder{}, status.Holders...),
+			Waiting: append([]LockHolder{}, status.Waiting...),
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+func indexOf(holders []LockHolder, holder LockHolder) int {
+	for i, h := range holders {
+		if h.JobID == holder.JobID && h.BuildNumber == holder.BuildNumber {
+			return i
+		}
+	}
+	return -1
+}
+
+// Locks lists the locks that builds hold or are waiting for.
+func (s *Service) Locks() []LockStatus {
+	return s.locks.list()
+}
+
+// ReleaseLock frees a slot of a lock held by a build, e.g. one that is stuck,
+// without stopping the build.
+func (s *Service) ReleaseLock(name, jobId string, buildNumber int) error {
+	if !s.locks.release(name, LockHolder{JobID: jobId, BuildNumber: buildNumber}) {
+		return fmt.Errorf("releasing lock %s. Cause: build %d of job %s does not hold it", name, buildNumber, jobId)
+	}
+	log.Printf("lock %s held by build %d of job %s was released by hand\n", name, buildNumber, jobId)
+	return nil
+}
+
+// lockRunner acquires each of a job's locks before the build runs, and
+// releases them once it finishes or is stopped. Locks are acquired in order of
+// their names, so that builds needing several cannot each hold one that
+// another is waiting for.
+type lockRunner struct {
+	service     *Service
+	buildNumber int
+	run         runFunc
+}
+
+func (s *Service) lockRunner(buildNumber int, run runFunc) lockRunner {
+	return lockRunner{service: s, buildNumber: buildNumber, run: run}
+}
+
+func (r lockRunner) Run(ctx context.Context, job Job, outputDest io.WriteCloser, status chan<- uint32) error {
+	locks := append([]Lock{}, job.Locks...)
+	sort.Slice(locks, func(i, j int) bool { return locks[i].Name < locks[j].Name })
+	holder := LockHolder{JobID: job.ID, BuildNumber: r.buildNumber}
+
+	go func() {
+		var held []Lock
+		release := func() {
+			for _, lock := range held {
+				r.service.locks.release(lock.Name, holder)
+			}
+		}
+		stop := func(exitStatus uint32) {
+			release()
+			if err := outputDest.Close(); err != nil {
+				log.Printf("error closing output of build %d of job %s: %v\n", r.buildNumber, job.ID, err)
+			}
+			status <- exitStatus
+		}
+
+		for _, lock := range locks {
+			if err := r.service.locks.acquire(ctx, holder, lock, outputDest); err != nil {
+				if _, ok := err.(errLockSlots); ok {
+					fmt.Fprintf(outputDest, "Error acquiring lock: %v\n", err)
+					stop(StatusContainerFailed)
+					return
+				}
+				stop(StatusAborted)
+				return
+			}
+			fmt.Fprintf(outputDest, "Acquired lock %s\n", lock.Name)
+			held = append(held, lock)
+		}
+
+		runnerStatus := make(chan uint32, 1)
+		if err := r.run(ctx, job, outputDest, runnerStatus); err != nil {
+			fmt.Fprintf(outputDest, "Error starting build: %v\n", err)
+			stop(StatusContainerFailed)
+			return
+		}
+		exitStatus := <-runnerStatus
+		release()
+		status <- exitStatus
+	}()
+	return nil
+}
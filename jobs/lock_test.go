@@ -0,0 +1,204 @@
+package jobs_test
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+	"github.com/craigfurman/woodhouse-ci/jobs/fake_build_repository"
+	"github.com/craigfurman/woodhouse-ci/jobs/fake_job_repository"
+	"github.com/craigfurman/woodhouse-ci/jobs/fake_job_runner"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Locks", func() {
+	It("validates the locks of a job", func() {
+		Expect(jobs.ValidateLocks([]jobs.Lock{{Name: "staging"}, {Name: "devices", Slots: 3}})).To(Succeed())
+		Expect(jobs.ValidateLocks([]jobs.Lock{{Name: "staging env"}})).To(MatchError(ContainSubstring("not: staging env")))
+		Expect(jobs.ValidateLocks([]jobs.Lock{{Name: "staging"}, {Name: "staging"}})).To(MatchError("lock staging is given more than once"))
+	})
+
+	It("does not save jobs that declare a lock with a different number of slots to other jobs", func() {
+		jobRepo := new(fake_job_repository.FakeJobRepository)
+		jobRepo.ListReturns([]jobs.Job{{ID: "test-android", Name: "test-android", Locks: []jobs.Lock{{Name: "devices", Slots: 2}}}}, nil)
+		service := &jobs.Service{JobRepository: jobRepo}
+
+		Expect(service.Save(&jobs.Job{Name: "test-ios", Locks: []jobs.Lock{{Name: "devices", Slots: 2}}})).To(Succeed())
+		Expect(service.Save(&jobs.Job{Name: "test-windows", Locks: []jobs.Lock{{Name: "devices"}}})).To(MatchError("saving job test-windows. Cause: lock devices has 2 slots in job test-android, not 1"))
+		Expect(jobRepo.SaveCallCount()).To(Equal(1))
+	})
+
+	Describe("running builds of jobs that share locks", func() {
+		var (
+			service  *jobs.Service
+			runner   *fake_job_runner.FakeRunner
+			outputs  map[string]*gbytes.Buffer
+			statuses map[string]chan uint32
+			finish   map[string]chan uint32
+			mutex    sync.Mutex
+		)
+
+		BeforeEach(func() {
+			jobRepo := new(fake_job_repository.FakeJobRepository)
+			jobRepo.FindByIdStub = func(id string) (jobs.Job, error) {
+				switch id {
+				case "deploy-api", "deploy-web":
+					return jobs.Job{ID: id, Locks: []jobs.Lock{{Name: "staging"}}}, nil
+				case "test-more-devices":
+					return jobs.Job{ID: id, Locks: []jobs.Lock{{Name: "devices", Slots: 5}}}, nil
+				case "deploy-everything":
+					return jobs.Job{ID: id, Locks: []jobs.Lock{{Name: "staging"}, {Name: "production"}}}, nil
+				}
+				return jobs.Job{ID: id, Locks: []jobs.Lock{{Name: "devices", Slots: 2}}}, nil
+			}
+
+			outputs = map[string]*gbytes.Buffer{}
+			statuses = map[string]chan uint32{}
+			finish = map[string]chan uint32{}
+			buildRepo := new(fake_build_repository.FakeBuildRepository)
+			buildRepo.CreateStub = func(jobID, variant string) (int, io.WriteCloser, chan uint32, error) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				outputs[jobID] = gbytes.NewBuffer()
+				statuses[jobID] = make(chan uint32, 1)
+				finish[jobID] = make(chan uint32, 1)
+				return 1, outputs[jobID], statuses[jobID], nil
+			}
+
+			runner = new(fake_job_runner.FakeRunner)
+			runner.RunStub = func(ctx context.Context, job jobs.Job, outputDest io.WriteCloser, status chan<- uint32) error {
+				mutex.Lock()
+				buildFinished := finish[job.ID]
+				mutex.Unlock()
+				go func() {
+					status <- <-buildFinished
+					outputDest.Close()
+				}()
+				return nil
+			}
+
+			service = &jobs.Service{JobRepository: jobRepo, BuildRepository: buildRepo, Runner: runner}
+		})
+
+		start := func(id string) {
+			_, err := service.RunJob(id)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		ranJobs := func() []string {
+			var ids []string
+			for i := 0; i < runner.RunCallCount(); i++ {
+				_, job, _, _ := runner.RunArgsForCall(i)
+				ids = append(ids, job.ID)
+			}
+			return ids
+		}
+
+		lockNames := func() []string {
+			var names []string
+			for _, lock := range service.Locks() {
+				names = append(names, lock.Name)
+			}
+			return names
+		}
+
+		It("runs one build holding a lock at a time", func() {
+			start("deploy-api")
+			Eventually(ranJobs).Should(Equal([]string{"deploy-api"}))
+			Expect(outputs["deploy-api"]).To(gbytes.Say("Acquired lock staging"))
+
+			start("deploy-web")
+			Eventually(outputs["deploy-web"]).Should(gbytes.Say("Waiting for lock staging"))
+			Consistently(ranJobs).Should(Equal([]string{"deploy-api"}))
+
+			finish["deploy-api"] <- 0
+			Eventually(statuses["deploy-api"]).Should(Receive(Equal(uint32(0))))
+			Eventually(ranJobs).Should(Equal([]string{"deploy-api", "deploy-web"}))
+			Expect(outputs["deploy-web"]).To(gbytes.Say("Acquired lock staging"))
+		})
+
+		It("shows which lock builds are waiting for", func() {
+			start("deploy-api")
+			start("deploy-web")
+			Eventually(outputs["deploy-web"]).Should(gbytes.Say("Waiting for lock staging"))
+
+			build, err := service.FindBuild("deploy-web", 1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(build.WaitingForLock).To(Equal("staging"))
+
+			locks := service.Locks()
+			Expect(locks).To(HaveLen(1))
+			Expect(locks[0].Name).To(Equal("staging"))
+			Expect(locks[0].Slots).To(Equal(1))
+			Expect(locks[0].Holders).To(HaveLen(1))
+			Expect(locks[0].Holders[0].JobID).To(Equal("deploy-api"))
+			Expect(locks[0].Holders[0].BuildNumber).To(Equal(1))
+			Expect(locks[0].Waiting).To(HaveLen(1))
+			Expect(locks[0].Waiting[0].JobID).To(Equal("deploy-web"))
+		})
+
+		It("runs as many builds as a pool of locks has slots", func() {
+			start("test-android")
+			start("test-ios")
+			start("test-windows")
+			Eventually(ranJobs).Should(ConsistOf("test-android", "test-ios"))
+			Eventually(outputs["test-windows"]).Should(gbytes.Say("Waiting for lock devices"))
+
+			finish["test-ios"] <- 1
+			Eventually(ranJobs).Should(ConsistOf("test-android", "test-ios", "test-windows"))
+		})
+
+		It("does not let a build change the number of slots of a lock", func() {
+			start("test-android")
+			Eventually(ranJobs).Should(Equal([]string{"test-android"}))
+
+			start("test-more-devices")
+			Eventually(statuses["test-more-devices"]).Should(Receive(Equal(jobs.StatusContainerFailed)))
+			Expect(outputs["test-more-devices"]).To(gbytes.Say("Error acquiring lock: lock devices has 2 slots, but the job declares 5"))
+			Expect(service.Locks()[0].Slots).To(Equal(2))
+			Expect(ranJobs()).To(Equal([]string{"test-android"}))
+		})
+
+		It("holds every lock of a job while it runs", func() {
+			start("deploy-everything")
+			Eventually(ranJobs).Should(Equal([]string{"deploy-everything"}))
+			Expect(outputs["deploy-everything"]).To(gbytes.Say("Acquired lock production"))
+			Expect(outputs["deploy-everything"]).To(gbytes.Say("Acquired lock staging"))
+
+			start("deploy-api")
+			Eventually(outputs["deploy-api"]).Should(gbytes.Say("Waiting for lock staging"))
+			finish["deploy-everything"] <- 0
+			Eventually(ranJobs).Should(ContainElement("deploy-api"))
+			Eventually(lockNames).Should(Equal([]string{"staging"}))
+		})
+
+		It("lets locks be released by hand", func() {
+			start("deploy-api")
+			start("deploy-web")
+			Eventually(outputs["deploy-web"]).Should(gbytes.Say("Waiting for lock staging"))
+
+			Expect(service.ReleaseLock("staging", "deploy-web", 1)).To(MatchError("releasing lock staging. Cause: build 1 of job deploy-web does not hold it"))
+			Expect(service.ReleaseLock("staging", "deploy-api", 1)).To(Succeed())
+			Eventually(ranJobs).Should(Equal([]string{"deploy-api", "deploy-web"}))
+		})
+
+		It("stops waiting for locks when the build is stopped", func() {
+			start("deploy-api")
+			start("deploy-web")
+			Eventually(outputs["deploy-web"]).Should(gbytes.Say("Waiting for lock staging"))
+
+			go service.Shutdown(0)
+			Eventually(statuses["deploy-web"]).Should(Receive(Equal(jobs.StatusAborted)))
+			Expect(outputs["deploy-web"].Closed()).To(BeTrue())
+
+			finish["deploy-api"] <- 0
+			Eventually(statuses["deploy-api"]).Should(Receive())
+			Eventually(service.Locks).Should(BeEmpty())
+			Expect(ranJobs()).To(Equal([]string{"deploy-api"}))
+		})
+	})
+})
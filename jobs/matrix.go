@@ -0,0 +1,108 @@
+package jobs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Matrix fans a build out into one cell per combination of docker image and
+// set of environment variables, e.g. to test against several language
+// versions. The build fails if any cell that is not allowed to fail does.
+type Matrix struct {
+	// Empty means every cell uses the job's image
+	DockerImages []string
+
+	// Each set is space separated, e.g. "GOOS=linux GOARCH=386". Empty means
+	// no variables are set.
+	Env []string
+
+	// A cell may fail if every word of one of these appears in its name, e.g.
+	// "node:21" allows every cell using that image to fail
+	AllowedFailures []string
+}
+
+// Cell is one build of a matrix.
+type Cell struct {
+	// The image and environment variables, e.g. "golang:1.21 GOARCH=386"
+	Name         string
+	Job          Job
+	AllowFailure bool
+}
+
+func (m Matrix) Empty() bool {
+	return len(m.DockerImages) == 0 && len(m.Env) == 0
+}
+
+func (m Matrix) Validate() error {
+	for _, set := range m.Env {
+		for _, variable := range strings.Fields(set) {
+			if strings.Index(variable, "=") < 1 {
+				return fmt.Errorf("invalid environment variable: %s", variable)
+			}
+		}
+	}
+	return nil
+}
+
+// Cells returns a job for each cell of the matrix, in order of image and then
+// environment variables.
+func (m Matrix) Cells(job Job) []Cell {
+	images := m.DockerImages
+	if len(images) == 0 {
+		images = []string{job.DockerImage}
+	}
+	envSets := m.Env
+	if len(envSets) == 0 {
+		envSets = []string{""}
+	}
+
+	cells := []Cell{}
+	for _, image := range images {
+		for _, envSet := range envSets {
+			cellJob := job
+			cellJob.Matrix = Matrix{}
+			cellJob.DockerImage = image
+			cellJob.Env = append(append([]string{}, job.Env...), strings.Fields(envSet)...)
+
+			name := strings.TrimSpace(strings.Join(append([]string{image}, strings.Fields(envSet)...), " "))
+			cells = append(cells, Cell{Name: name, Job: cellJob, AllowFailure: m.allowsFailure(name)})
+		}
+	}
+	return cells
+}
+
+func (m Matrix) allowsFailure(cellName string) bool {
+	words := make(map[string]bool)
+	for _, word := range strings.Fields(cellName) {
+		words[word] = true
+	}
+
+	for _, allowed := range m.AllowedFailures {
+		matches := len(strings.Fields(allowed)) > 0
+		for _, word := range strings.Fields(allowed) {
+			matches = matches && words[word]
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+// MatrixStatus is the exit status of a matrix build: that of the first cell
+// that failed without being allowed to, or skipped if every cell was.
+func MatrixStatus(cells []Cell, exitStatuses []uint32) uint32 {
+	allSkipped := true
+	for i, exitStatus := range exitStatuses {
+		if exitStatus != StatusSkipped {
+			allSkipped = false
+		}
+		if exitStatus != 0 && exitStatus != StatusSkipped && !cells[i].AllowFailure {
+			return exitStatus
+		}
+	}
+	if allSkipped && len(exitStatuses) > 0 {
+		return StatusSkipped
+	}
+	return 0
+}
@@ -0,0 +1,80 @@
+package jobs_test
+
+import (
+	"github.com/craigfurman/woodhouse-ci/jobs"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Matrix", func() {
+	job := jobs.Job{ID: "some-id", DockerImage: "golang:1.20", Command: "go test ./..."}
+
+	It("has a cell for every image and set of environment variables", func() {
+		matrix := jobs.Matrix{
+			DockerImages: []string{"golang:1.21", "golang:1.22"},
+			Env:          []string{"GOARCH=amd64", "GOARCH=386 CGO_ENABLED=0"},
+		}
+
+		cells := matrix.Cells(job)
+		names := []string{}
+		for _, cell := range cells {
+			names = append(names, cell.Name)
+		}
+		Expect(names).To(Equal([]string{
+			"golang:1.21 GOARCH=amd64",
+			"golang:1.21 GOARCH=386 CGO_ENABLED=0",
+			"golang:1.22 GOARCH=amd64",
+			"golang:1.22 GOARCH=386 CGO_ENABLED=0",
+		}))
+		Expect(cells[1].Job.DockerImage).To(Equal("golang:1.21"))
+		Expect(cells[1].Job.Env).To(Equal([]string{"GOARCH=386", "CGO_ENABLED=0"}))
+		Expect(cells[1].Job.Command).To(Equal("go test ./..."))
+		Expect(cells[1].Job.Matrix.Empty()).To(BeTrue())
+	})
+
+	It("uses the job's image when none are given", func() {
+		cells := jobs.Matrix{Env: []string{"A=1", "A=2"}}.Cells(job)
+		Expect(cells).To(HaveLen(2))
+		Expect(cells[0].Name).To(Equal("golang:1.20 A=1"))
+		Expect(cells[1].Job.DockerImage).To(Equal("golang:1.20"))
+	})
+
+	It("allows cells to fail when all the words of an allowed failure are in their name", func() {
+		matrix := jobs.Matrix{
+			DockerImages:    []string{"node:20", "node:21"},
+			Env:             []string{"A=1", "A=2"},
+			AllowedFailures: []string{"node:21 A=2", "A=3"},
+		}
+
+		allowed := []bool{}
+		for _, cell := range matrix.Cells(job) {
+			allowed = append(allowed, cell.AllowFailure)
+		}
+		Expect(allowed).To(Equal([]bool{false, false, false, true}))
+	})
+
+	It("rejects environment variables without a name", func() {
+		Expect(jobs.Matrix{Env: []string{"A=1 =2"}}.Validate()).To(MatchError("invalid environment variable: =2"))
+		Expect(jobs.Matrix{Env: []string{"A"}}.Validate()).To(MatchError("invalid environment variable: A"))
+	})
+
+	Describe("the status of the build", func() {
+		cells := []jobs.Cell{{Name: "a"}, {Name: "b", AllowFailure: true}}
+
+		It("passes when every cell passes, or is allowed to fail", func() {
+			Expect(jobs.MatrixStatus(cells, []uint32{0, 0})).To(Equal(uint32(0)))
+			Expect(jobs.MatrixStatus(cells, []uint32{0, 2})).To(Equal(uint32(0)))
+		})
+
+		It("fails with the exit status of a cell that is not allowed to fail", func() {
+			Expect(jobs.MatrixStatus(cells, []uint32{3, 2})).To(Equal(uint32(3)))
+			Expect(jobs.MatrixStatus(cells, []uint32{jobs.StatusImagePullFailed, 0})).To(Equal(jobs.StatusImagePullFailed))
+		})
+
+		It("is skipped when every cell was", func() {
+			Expect(jobs.MatrixStatus(cells, []uint32{jobs.StatusSkipped, jobs.StatusSkipped})).To(Equal(jobs.StatusSkipped))
+			Expect(jobs.MatrixStatus(cells, []uint32{jobs.StatusSkipped, 0})).To(Equal(uint32(0)))
+		})
+	})
+})
@@ -0,0 +1,120 @@
+package jobs
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Parameter is an input chosen when a build is started, which the job's
+// command sees as an environment variable of the same name.
+type Parameter struct {
+	Name string
+	Type string
+
+	// Used when no value is given, e.g. for triggered builds. Choice
+	// parameters default to their first choice.
+	Default string
+
+	// The values a choice parameter may take
+	Choices []string `json:",omitempty"`
+}
+
+// Values of Parameter.Type
+const (
+	ParameterString  = "string"
+	ParameterChoice  = "choice"
+	ParameterBoolean = "boolean"
+)
+
+// ParameterValue is the value a build used for one of its job's parameters.
+type ParameterValue struct {
+	Name  string
+	Value string
+}
+
+var parameterName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func ValidateParameters(parameters []Parameter) error {
+	names := map[string]bool{}
+	for _, parameter := range parameters {
+		if !parameterName.MatchString(parameter.Name) {
+			return fmt.Errorf("parameter names may only contain letters, numbers and '_', and not start with a number, not: %s", parameter.Name)
+		}
+		if names[parameter.Name] {
+			return fmt.Errorf("more than one parameter is named %s", parameter.Name)
+		}
+		names[parameter.Name] = true
+
+		switch parameter.Type {
+		case ParameterString:
+		case ParameterChoice:
+			if len(parameter.Choices) == 0 {
+				return fmt.Errorf("choice parameter %s has no choices", parameter.Name)
+			}
+		case ParameterBoolean:
+		default:
+			return fmt.Errorf("unknown type of parameter %s: %s", parameter.Name, parameter.Type)
+		}
+
+		if parameter.Default != "" {
+			if err := parameter.validate(parameter.Default); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p Parameter) defaultValue() string {
+	switch {
+	case p.Default != "":
+		return p.Default
+	case p.Type == ParameterChoice && len(p.Choices) > 0:
+		return p.Choices[0]
+	case p.Type == ParameterBoolean:
+		return "false"
+	}
+	return ""
+}
+
+func (p Parameter) validate(value string) error {
+	switch p.Type {
+	case ParameterChoice:
+		for _, choice := range p.Choices {
+			if value == choice {
+				return nil
+			}
+		}
+		return fmt.Errorf("parameter %s must be one of %v, not: %s", p.Name, p.Choices, value)
+	case ParameterBoolean:
+		if value != "true" && value != "false" {
+			return fmt.Errorf("parameter %s must be true or false, not: %s", p.Name, value)
+		}
+	}
+	return nil
+}
+
+// ResolveParameters returns the value of each of the parameters, in order,
+// using their defaults for those without one in values.
+func ResolveParameters(parameters []Parameter, values map[string]string) ([]ParameterValue, error) {
+	known := map[string]bool{}
+	resolved := []ParameterValue{}
+	for _, parameter := range parameters {
+		known[parameter.Name] = true
+		value, ok := values[parameter.Name]
+		if !ok {
+			value = parameter.defaultValue()
+		}
+		if err := parameter.validate(value); err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, ParameterValue{Name: parameter.Name, Value: value})
+	}
+
+	for name := range values {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown parameter: %s", name)
+		}
+	}
+	return resolved, nil
+}
@@ -0,0 +1,83 @@
+package jobs_test
+
+import (
+	"github.com/craigfurman/woodhouse-ci/jobs"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Parameters", func() {
+	parameters := []jobs.Parameter{
+		{Name: "VERSION", Type: jobs.ParameterString, Default: "latest"},
+		{Name: "TARGET", Type: jobs.ParameterChoice, Choices: []string{"staging", "production"}},
+		{Name: "DRY_RUN", Type: jobs.ParameterBoolean},
+	}
+
+	It("accepts parameters of every type", func() {
+		Expect(jobs.ValidateParameters(parameters)).To(Succeed())
+	})
+
+	It("rejects names that are not environment variable names", func() {
+		Expect(jobs.ValidateParameters([]jobs.Parameter{{Name: "1ST", Type: jobs.ParameterString}})).To(MatchError(ContainSubstring("not: 1ST")))
+		Expect(jobs.ValidateParameters([]jobs.Parameter{{Name: "A-B", Type: jobs.ParameterString}})).To(MatchError(ContainSubstring("not: A-B")))
+	})
+
+	It("rejects parameters with the same name", func() {
+		Expect(jobs.ValidateParameters([]jobs.Parameter{
+			{Name: "A", Type: jobs.ParameterString},
+			{Name: "A", Type: jobs.ParameterBoolean},
+		})).To(MatchError("more than one parameter is named A"))
+	})
+
+	It("rejects unknown types", func() {
+		Expect(jobs.ValidateParameters([]jobs.Parameter{{Name: "A", Type: "number"}})).To(MatchError("unknown type of parameter A: number"))
+	})
+
+	It("rejects choice parameters without choices", func() {
+		Expect(jobs.ValidateParameters([]jobs.Parameter{{Name: "A", Type: jobs.ParameterChoice}})).To(MatchError("choice parameter A has no choices"))
+	})
+
+	It("rejects defaults the parameter could not take", func() {
+		Expect(jobs.ValidateParameters([]jobs.Parameter{
+			{Name: "A", Type: jobs.ParameterChoice, Choices: []string{"x", "y"}, Default: "z"},
+		})).To(MatchError(ContainSubstring("not: z")))
+		Expect(jobs.ValidateParameters([]jobs.Parameter{
+			{Name: "B", Type: jobs.ParameterBoolean, Default: "yes"},
+		})).To(MatchError("parameter B must be true or false, not: yes"))
+	})
+
+	Describe("resolving values", func() {
+		It("uses the defaults of parameters without a value", func() {
+			values, err := jobs.ResolveParameters(parameters, map[string]string{"DRY_RUN": "true"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(values).To(Equal([]jobs.ParameterValue{
+				{Name: "VERSION", Value: "latest"},
+				{Name: "TARGET", Value: "staging"},
+				{Name: "DRY_RUN", Value: "true"},
+			}))
+		})
+
+		It("defaults booleans to false", func() {
+			values, err := jobs.ResolveParameters(parameters, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(values[2]).To(Equal(jobs.ParameterValue{Name: "DRY_RUN", Value: "false"}))
+		})
+
+		It("allows any string", func() {
+			values, err := jobs.ResolveParameters(parameters, map[string]string{"VERSION": "v1.2 rc"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(values[0].Value).To(Equal("v1.2 rc"))
+		})
+
+		It("rejects values that are not one of the choices", func() {
+			_, err := jobs.ResolveParameters(parameters, map[string]string{"TARGET": "test"})
+			Expect(err).To(MatchError(ContainSubstring("parameter TARGET must be one of")))
+		})
+
+		It("rejects values of parameters the job does not have", func() {
+			_, err := jobs.ResolveParameters(parameters, map[string]string{"OTHER": "x"})
+			Expect(err).To(MatchError("unknown parameter: OTHER"))
+		})
+	})
+})
@@ -0,0 +1,92 @@
+package jobs
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// PathFilter decides whether a change to a job's repository needs a build.
+// Patterns are matched against paths relative to the repository root, like
+// path.Match, except that "**" matches any number of directories, a trailing
+// "/" matches everything in a directory, and patterns with no other "/" match
+// in any directory.
+type PathFilter struct {
+	// Changes to these paths need a build. Empty means every path does.
+	Include []string
+
+	// Changes to these paths never need a build, even if they are included
+	Exclude []string
+}
+
+func (f PathFilter) Empty() bool {
+	return len(f.Include) == 0 && len(f.Exclude) == 0
+}
+
+func (f PathFilter) Validate() error {
+	for _, pattern := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid path pattern: %s", pattern)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether a change to any of the files needs a build.
+func (f PathFilter) Matches(files []string) bool {
+	for _, file := range files {
+		if f.matches(file) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f PathFilter) matches(file string) bool {
+	for _, pattern := range f.Exclude {
+		if matchPath(pattern, file) {
+			return false
+		}
+	}
+
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, pattern := range f.Include {
+		if matchPath(pattern, file) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPath(pattern, file string) bool {
+	if !strings.Contains(strings.TrimSuffix(pattern, "/"), "/") {
+		pattern = "**/" + pattern
+	}
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(file, "/"))
+}
+
+func matchSegments(pattern, file []string) bool {
+	if len(pattern) == 0 {
+		return len(file) == 0
+	}
+
+	if pattern[0] == "**" {
+		for skip := 0; skip <= len(file); skip++ {
+			if matchSegments(pattern[1:], file[skip:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(file) == 0 {
+		return false
+	}
+	matched, err := path.Match(pattern[0], file[0])
+	return err == nil && matched && matchSegments(pattern[1:], file[1:])
+}
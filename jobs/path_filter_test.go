@@ -0,0 +1,43 @@
+package jobs_test
+
+import (
+	"github.com/craigfurman/woodhouse-ci/jobs"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PathFilter", func() {
+	It("matches everything when empty", func() {
+		Expect(jobs.PathFilter{}.Matches([]string{"README.md"})).To(BeTrue())
+	})
+
+	It("matches nothing when there are no changes", func() {
+		Expect(jobs.PathFilter{Include: []string{"**"}}.Matches(nil)).To(BeFalse())
+	})
+
+	It("matches included directories", func() {
+		filter := jobs.PathFilter{Include: []string{"services/api/", "libs/**/*.go"}}
+		Expect(filter.Matches([]string{"docs/index.md", "services/api/cmd/main.go"})).To(BeTrue())
+		Expect(filter.Matches([]string{"libs/db/sql/query.go"})).To(BeTrue())
+		Expect(filter.Matches([]string{"libs/db/README.md", "services/web/main.go"})).To(BeFalse())
+	})
+
+	It("matches patterns without a slash in any directory", func() {
+		filter := jobs.PathFilter{Include: []string{"*.go", "vendor/"}}
+		Expect(filter.Matches([]string{"services/api/main.go"})).To(BeTrue())
+		Expect(filter.Matches([]string{"services/api/vendor/lib/lib.c"})).To(BeTrue())
+		Expect(filter.Matches([]string{"services/api/main.c"})).To(BeFalse())
+	})
+
+	It("does not match excluded paths, even if they are included", func() {
+		filter := jobs.PathFilter{Include: []string{"services/"}, Exclude: []string{"*.md", "docs/"}}
+		Expect(filter.Matches([]string{"services/api/README.md", "docs/services/api.txt"})).To(BeFalse())
+		Expect(filter.Matches([]string{"services/api/README.md", "services/api/main.go"})).To(BeTrue())
+	})
+
+	It("rejects invalid patterns", func() {
+		Expect(jobs.PathFilter{Exclude: []string{"docs/["}}.Validate()).To(MatchError("invalid path pattern: docs/["))
+		Expect(jobs.PathFilter{Include: []string{"docs/", "**/*.go"}}.Validate()).To(Succeed())
+	})
+})
@@ -0,0 +1,224 @@
+package jobs
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// UpstreamBuild is a passing build of a job that a downstream build was
+// triggered by.
+type UpstreamBuild struct {
+	JobID       string
+	JobName     string
+	BuildNumber int
+	Repository  string
+	Revision    string
+
+	// Where the artifacts the build kept are on the Woodhouse host, if it
+	// kept any
+	ArtifactsDir string `json:",omitempty"`
+}
+
+// ArtifactsDirName is where the artifacts of upstream builds are put in the
+// workspace, in a directory named after each upstream job.
+const ArtifactsDirName = "woodhouse-upstream"
+
+// DirName is the name of the directory of the workspace that the build's
+// artifacts are put in.
+func (u UpstreamBuild) DirName() string {
+	return strings.Replace(u.JobName, "/", "-", -1)
+}
+
+// ValidateArtifacts checks that artifact patterns can only match files in the
+// workspace.
+func ValidateArtifacts(patterns []string) error {
+	for _, pattern := range patterns {
+		if isAbsolute(pattern) {
+			return fmt.Errorf("artifact patterns must be relative to the workspace, not: %s", pattern)
+		}
+		if hasParent(pattern) {
+			return fmt.Errorf("artifact patterns cannot leave the workspace, not: %s", pattern)
+		}
+	}
+	return nil
+}
+
+// isAbsolute is true of paths that are absolute on any platform a build may
+// run on.
+func isAbsolute(p string) bool {
+	return path.IsAbs(p) || filepath.IsAbs(p) || strings.HasPrefix(p, `\`)
+}
+
+// hasParent is true of paths with a ".." element, using either separator.
+func hasParent(p string) bool {
+	for _, element := range strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if element == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// ArtifactKeeper is implemented by build outputs that keep files from the
+// workspace of a build that passed.
+type ArtifactKeeper interface {
+	ArtifactsDir() (string, error)
+}
+
+// ArtifactsDir is where a build's artifacts should be copied to, or empty if
+// the build output cannot keep them.
+func ArtifactsDir(outputDest io.Writer) (string, error) {
+	if keeper, ok := outputDest.(ArtifactKeeper); ok {
+		return keeper.ArtifactsDir()
+	}
+	return "", nil
+}
+
+// PipelineStages groups jobs by how many upstream jobs come before them, so
+// that every job is in a later stage than those it waits for. Upstream jobs
+// that do not exist are ignored.
+func PipelineStages(jobList []Job) [][]Job {
+	byID := make(map[string]Job)
+	for _, job := range jobList {
+		byID[job.ID] = job
+	}
+
+	depths := make(map[string]int)
+	var depth func(job Job, seen map[string]bool) int
+	depth = func(job Job, seen map[string]bool) int {
+		if d, ok := depths[job.ID]; ok {
+			return d
+		}
+		seen[job.ID] = true
+		d := 0
+		for _, id := range job.Upstream {
+			upstream, ok := byID[id]
+			if !ok || seen[id] {
+				continue
+			}
+			if upstreamDepth := depth(upstream, seen) + 1; upstreamDepth > d {
+				d = upstreamDepth
+			}
+		}
+		delete(seen, job.ID)
+		depths[job.ID] = d
+		return d
+	}
+
+	stages := [][]Job{}
+	for _, job := range jobList {
+		d := depth(job, make(map[string]bool))
+		for len(stages) <= d {
+			stages = append(stages, []Job{})
+		}
+		stages[d] = append(stages[d], job)
+	}
+	return stages
+}
+
+// triggerDownstream starts a build of every job downstream of one that
+// passed, once every job it waits for has passed for the same revision.
+func (s *Service) triggerDownstream(jobID string, buildNumber int) {
+	build, err := s.BuildRepository.Find(jobID, buildNumber)
+	if err != nil {
+		log.Printf("error finding build %d of job %s to trigger downstream jobs: %v\n", buildNumber, jobID, err)
+		return
+	}
+	revision := primaryRevision(build)
+
+	jobList, err := s.JobRepository.List()
+	if err != nil {
+		log.Printf("error listing jobs downstream of %s: %v\n", jobID, err)
+		return
+	}
+
+	for _, downstream := range jobList {
+		if !downstream.HasUpstream(jobID) {
+			continue
+		}
+
+		upstreamBuilds, err := s.passedUpstreamBuilds(downstream, revision)
+		if err != nil {
+			log.Printf("error finding builds upstream of job %s: %v\n", downstream.ID, err)
+			continue
+		}
+		if upstreamBuilds == nil {
+			log.Printf("not triggering job %s until all its upstream jobs pass for revision %s\n", downstream.ID, revision)
+			continue
+		}
+
+		if _, err := s.startBuild(downstream.ID, buildRequest{upstream: upstreamBuilds}); err != nil {
+			log.Printf("error triggering job %s after job %s passed: %v\n", downstream.ID, jobID, err)
+		}
+	}
+}
+
+// passedUpstreamBuilds finds the latest passing build of each of a job's
+// upstream jobs that used the revision, or nil unless they all have one.
+func (s *Service) passedUpstreamBuilds(job Job, revision string) ([]UpstreamBuild, error) {
+	upstreamBuilds := []UpstreamBuild{}
+	for _, upstreamID := range job.Upstream {
+		upstream, err := s.JobRepository.FindById(upstreamID)
+		if err != nil {
+			return nil, err
+		}
+
+		highestBuild, err := s.BuildRepository.HighestBuild(upstreamID)
+		if err != nil {
+			return nil, err
+		}
+
+		found := false
+		for buildNumber := highestBuild; buildNumber > 0 && !found; buildNumber-- {
+			build, err := s.BuildRepository.Find(upstreamID, buildNumber)
+			if err != nil {
+				return nil, err
+			}
+			if build.Variant != "" || !build.Finished || build.ExitStatus != 0 || primaryRevision(build) != revision {
+				continue
+			}
+
+			found = true
+			upstreamBuilds = append(upstreamBuilds, UpstreamBuild{
+				JobID:        upstreamID,
+				JobName:      upstream.Name,
+				BuildNumber:  buildNumber,
+				Repository:   upstream.Repository,
+				Revision:     revision,
+				ArtifactsDir: build.ArtifactsDir,
+			})
+		}
+		if !found {
+			return nil, nil
+		}
+	}
+	return upstreamBuilds, nil
+}
+
+func (j Job) HasUpstream(jobID string) bool {
+	for _, id := range j.Upstream {
+		if id == jobID {
+			return true
+		}
+	}
+	return false
+}
+
+// buildUpstream checks out the revision the upstream builds used when the job
+// builds the same repository, and tells the job about them.
+func buildUpstream(job *Job, upstreamBuilds []UpstreamBuild, outputDest io.Writer) {
+	job.UpstreamBuilds = upstreamBuilds
+	for _, upstream := range upstreamBuilds {
+		fmt.Fprintf(outputDest, "Triggered by build %d of %s (revision %s)\n", upstream.BuildNumber, upstream.JobName, upstream.Revision)
+		if upstream.Repository != "" && upstream.Repository == job.Repository && upstream.Revision != "" {
+			job.Checkout.Ref = upstream.Revision
+		}
+	}
+	if len(upstreamBuilds) > 0 && upstreamBuilds[0].Revision != "" {
+		job.Env = append(job.Env, "WOODHOUSE_UPSTREAM_REVISION="+upstreamBuilds[0].Revision)
+	}
+}
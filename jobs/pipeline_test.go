@@ -0,0 +1,137 @@
+package jobs_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+	"github.com/craigfurman/woodhouse-ci/jobs/fake_build_repository"
+	"github.com/craigfurman/woodhouse-ci/jobs/fake_credential_repository"
+	"github.com/craigfurman/woodhouse-ci/jobs/fake_job_repository"
+	"github.com/craigfurman/woodhouse-ci/jobs/fake_job_runner"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pipelines", func() {
+	Describe("stages", func() {
+		It("puts every job after the jobs it waits for", func() {
+			build := jobs.Job{ID: "build"}
+			lint := jobs.Job{ID: "lint"}
+			test := jobs.Job{ID: "test", Upstream: []string{"build"}}
+			deploy := jobs.Job{ID: "deploy", Upstream: []string{"test", "lint", "deleted"}}
+
+			Expect(jobs.PipelineStages([]jobs.Job{deploy, test, build, lint})).To(Equal([][]jobs.Job{
+				{build, lint},
+				{test},
+				{deploy},
+			}))
+		})
+	})
+
+	Describe("triggering downstream jobs", func() {
+		var (
+			service   *jobs.Service
+			jobRepo   *fake_job_repository.FakeJobRepository
+			buildRepo *fake_build_repository.FakeBuildRepository
+			runner    *fake_job_runner.FakeRunner
+			builds    map[string][]jobs.Build
+			started   chan jobs.Job
+		)
+
+		BeforeEach(func() {
+			jobList := []jobs.Job{
+				{ID: "build", Name: "build", Repository: "app.git", Command: "make"},
+				{ID: "test", Name: "test", Repository: "app.git", Command: "make test"},
+				{ID: "deploy", Name: "deploy", Repository: "app.git", Command: "make deploy", Upstream: []string{"build", "test"}},
+			}
+			jobRepo = new(fake_job_repository.FakeJobRepository)
+			jobRepo.ListReturns(jobList, nil)
+			jobRepo.FindByIdStub = func(id string) (jobs.Job, error) {
+				for _, job := range jobList {
+					if job.ID == id {
+						return job, nil
+					}
+				}
+				return jobs.Job{}, fmt.Errorf("no job %s", id)
+			}
+
+			builds = map[string][]jobs.Build{
+				"build":  {{Finished: true, Revisions: []jobs.Revision{{Revision: "abc123"}}, ArtifactsDir: "/builds/build/1-artifacts"}},
+				"test":   {},
+				"deploy": {},
+			}
+			buildRepo = new(fake_build_repository.FakeBuildRepository)
+			buildRepo.HighestBuildStub = func(jobID string) (int, error) {
+				return len(builds[jobID]), nil
+			}
+			buildRepo.FindStub = func(jobID string, buildNumber int) (jobs.Build, error) {
+				return builds[jobID][buildNumber-1], nil
+			}
+			buildRepo.CreateStub = func(jobID string, variant string) (int, io.WriteCloser, chan uint32, error) {
+				builds[jobID] = append(builds[jobID], jobs.Build{})
+				return len(builds[jobID]), nopWriteCloser{}, make(chan uint32, 1), nil
+			}
+
+			started = make(chan jobs.Job, 3)
+			runner = new(fake_job_runner.FakeRunner)
+			runner.RunStub = func(ctx context.Context, job jobs.Job, outputDest io.WriteCloser, status chan<- uint32) error {
+				if job.ID == "test" {
+					// The test build passes for the same revision as the build job
+					builds["test"][0] = jobs.Build{Finished: true, Revisions: []jobs.Revision{{Revision: "abc123"}}}
+				}
+				started <- job
+				status <- 0
+				return nil
+			}
+
+			service = &jobs.Service{
+				JobRepository:   jobRepo,
+				Runner:          runner,
+				BuildRepository: buildRepo,
+				Credentials:     new(fake_credential_repository.FakeCredentialRepository),
+			}
+		})
+
+		It("builds a job once every job it waits for has passed for the same revision", func() {
+			_, err := service.RunJob("test")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect((<-started).ID).To(Equal("test"))
+			var deploy jobs.Job
+			Eventually(started).Should(Receive(&deploy))
+			Expect(deploy.ID).To(Equal("deploy"))
+			Expect(deploy.Checkout.Ref).To(Equal("abc123"))
+			Expect(deploy.Env).To(ContainElement("WOODHOUSE_UPSTREAM_REVISION=abc123"))
+			Expect(deploy.UpstreamBuilds).To(Equal([]jobs.UpstreamBuild{
+				{JobID: "build", JobName: "build", BuildNumber: 1, Repository: "app.git", Revision: "abc123", ArtifactsDir: "/builds/build/1-artifacts"},
+				{JobID: "test", JobName: "test", BuildNumber: 1, Repository: "app.git", Revision: "abc123"},
+			}))
+		})
+
+		It("waits for every job to pass for the revision", func() {
+			builds["build"][0].Revisions = []jobs.Revision{{Revision: "def456"}}
+			_, err := service.RunJob("test")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect((<-started).ID).To(Equal("test"))
+			Consistently(started).ShouldNot(Receive())
+		})
+
+		It("does not trigger downstream jobs when the build fails", func() {
+			runner.RunStub = func(ctx context.Context, job jobs.Job, outputDest io.WriteCloser, status chan<- uint32) error {
+				builds["test"][0] = jobs.Build{Finished: true, ExitStatus: 1, Revisions: []jobs.Revision{{Revision: "abc123"}}}
+				started <- job
+				status <- 1
+				return nil
+			}
+			_, err := service.RunJob("test")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect((<-started).ID).To(Equal("test"))
+			Consistently(started).ShouldNot(Receive())
+		})
+	})
+})
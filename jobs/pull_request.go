@@ -0,0 +1,62 @@
+package jobs
+
+import "fmt"
+
+// PullRequest is a proposed change to a job's repository, built before it is
+// merged.
+type PullRequest struct {
+	Number int
+
+	// Owner and name of the base repository, e.g. "octocat/hello-world"
+	Repository string
+
+	// Ref to check out, e.g. refs/pull/12/head
+	Ref string
+
+	// Commit that statuses are reported for
+	HeadCommit string
+}
+
+func (pr PullRequest) String() string {
+	return fmt.Sprintf("pull request #%d", pr.Number)
+}
+
+// Values of BuildStatus.State
+const (
+	StatePending = "pending"
+	StateSuccess = "success"
+	StateFailure = "failure"
+	// The build could not run the job's command
+	StateError = "error"
+)
+
+// BuildStatus is reported for the head commit of a pull request when its build
+// starts and finishes.
+type BuildStatus struct {
+	Job         Job
+	BuildNumber int
+	PullRequest PullRequest
+	State       string
+	Description string
+}
+
+//go:generate counterfeiter -o fake_status_reporter/fake_status_reporter.go . StatusReporter
+type StatusReporter interface {
+	ReportStatus(status BuildStatus) error
+}
+
+func finishedStatus(exitStatus uint32) (string, string) {
+	switch {
+	case exitStatus == 0:
+		return StateSuccess, "The build passed"
+	case exitStatus == StatusAborted:
+		return StateError, "The build was aborted"
+	case exitStatus == StatusSuperseded:
+		return StateError, "A newer build superseded the build"
+	case exitStatus == StatusImageBuildFailed:
+		return StateFailure, "The job's image could not be built"
+	case exitStatus > 255:
+		return StateError, "The build could not run"
+	}
+	return StateFailure, fmt.Sprintf("The build failed with exit status %d", exitStatus)
+}
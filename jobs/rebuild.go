@@ -0,0 +1,79 @@
+package jobs
+
+import (
+	"fmt"
+	"io"
+)
+
+// BuildInputs are what a build used besides the revisions of its sources,
+// kept so that it can be rebuilt with the same ones.
+type BuildInputs struct {
+	DockerImage string           `json:",omitempty"`
+	Parameters  []ParameterValue `json:",omitempty"`
+	RebuildOf   int              `json:",omitempty"`
+}
+
+// InputRecorder is implemented by build outputs that keep the inputs a build
+// used.
+type InputRecorder interface {
+	RecordInputs(inputs BuildInputs) error
+}
+
+// RecordInputs keeps the inputs if the build output is able to.
+func RecordInputs(outputDest io.Writer, inputs BuildInputs) error {
+	if recorder, ok := outputDest.(InputRecorder); ok {
+		return recorder.RecordInputs(inputs)
+	}
+	return nil
+}
+
+// Rebuild starts a build of the revisions, docker image and parameters that
+// an earlier build of the job used. It is a variant of the job, as the job
+// may have changed since.
+func (s *Service) Rebuild(id string, buildNumber int) (int, error) {
+	original, err := s.BuildRepository.Find(id, buildNumber)
+	if err != nil {
+		return 0, fmt.Errorf("rebuilding build %d of job with ID: %s. Cause: %v", buildNumber, id, err)
+	}
+
+	parameters := map[string]string{}
+	for _, value := range original.ParameterValues {
+		parameters[value.Name] = value.Value
+	}
+	return s.startBuild(id, buildRequest{
+		parameters: parameters,
+		rebuild:    &rebuild{buildNumber: buildNumber, original: original},
+	})
+}
+
+type rebuild struct {
+	buildNumber int
+	original    Build
+}
+
+func (r rebuild) String() string {
+	return fmt.Sprintf("rebuild of #%d", r.buildNumber)
+}
+
+// pin checks out the revision of each source that the original build used.
+// Archives cannot be pinned, as they are only ever downloaded as they are.
+func (r rebuild) pin(job *Job) {
+	if r.original.Image != "" {
+		job.DockerImage = r.original.Image
+	}
+
+	revisions := map[string]string{}
+	for _, revision := range builtRevisions(r.original) {
+		revisions[revision.Input] = revision.Revision
+	}
+
+	if revision := revisions[""]; revision != "" && job.SourceType != SourceArchive {
+		job.Checkout.Ref = revision
+	}
+	job.Inputs = append([]Input{}, job.Inputs...)
+	for i, input := range job.Inputs {
+		if revision := revisions[input.Name]; revision != "" && input.SourceType != SourceArchive {
+			job.Inputs[i].Checkout.Ref = revision
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+)
+
+// RetryPolicy decides whether a failed build is tried again. Without exit
+// statuses or infrastructure errors to retry on, any failure is retried.
+type RetryPolicy struct {
+	// Including the first attempt. Builds are not retried unless it is more
+	// than 1.
+	MaxAttempts int
+
+	// Exit statuses of the job's command that are worth retrying, e.g. those
+	// of flaky tests
+	ExitStatuses []uint32 `json:",omitempty"`
+
+	// Retry when Woodhouse or its infrastructure fails the build, e.g. when
+	// the source cannot be fetched or the image cannot be pulled
+	InfrastructureErrors bool `json:",omitempty"`
+}
+
+// Attempts are limited so that a broken job cannot occupy Woodhouse forever
+const maxRetryAttempts = 10
+
+func (p RetryPolicy) Enabled() bool {
+	return p.MaxAttempts > 1
+}
+
+func (p RetryPolicy) Validate() error {
+	if p.MaxAttempts < 0 || p.MaxAttempts > maxRetryAttempts {
+		return fmt.Errorf("builds may be attempted at most %d times, not: %d", maxRetryAttempts, p.MaxAttempts)
+	}
+	for _, exitStatus := range p.ExitStatuses {
+		if exitStatus == 0 || exitStatus > 255 {
+			return fmt.Errorf("exit statuses to retry on must be between 1 and 255, not: %d", exitStatus)
+		}
+	}
+	return nil
+}
+
+// Retries is whether a build that finished with the exit status should be
+// tried again, if it has attempts left.
+func (p RetryPolicy) Retries(exitStatus uint32) bool {
+	switch {
+	case exitStatus == 0 || exitStatus == StatusAborted || exitStatus == StatusSkipped || exitStatus == StatusNotApproved || exitStatus == StatusSuperseded:
+		return false
+	case len(p.ExitStatuses) == 0 && !p.InfrastructureErrors:
+		return true
+	case IsInfrastructureError(exitStatus):
+		return p.InfrastructureErrors
+	}
+	for _, retried := range p.ExitStatuses {
+		if exitStatus == retried {
+			return true
+		}
+	}
+	return false
+}
+
+// IsInfrastructureError is whether the build failed before or without the
+// job's command failing.
+func IsInfrastructureError(exitStatus uint32) bool {
+	switch exitStatus {
+	case StatusFetchFailed, StatusImagePullFailed, StatusContainerFailed, StatusAgentLost:
+		return true
+	}
+	return false
+}
+
+type runFunc func(ctx context.Context, job Job, outputDest io.WriteCloser, status chan<- uint32) error
+
+// retryRunner runs a build again while it fails in a way the job's retry
+// policy allows, up to its number of attempts. Each attempt's output is kept
+// separately, as well as in the output of the build.
+type retryRunner struct {
+	service     *Service
+	buildNumber int
+	run         runFunc
+}
+
+func (s *Service) retryRunner(buildNumber int, run runFunc) retryRunner {
+	return retryRunner{service: s, buildNumber: buildNumber, run: run}
+}
+
+func (r retryRunner) Run(ctx context.Context, job Job, outputDest io.WriteCloser, status chan<- uint32) error {
+	policy := job.Retry
+	var attempt func(attemptNumber int) error
+	attempt = func(attemptNumber int) error {
+		_, output, attemptStatus, err := r.service.BuildRepository.CreateAttempt(job.ID, r.buildNumber)
+		if err != nil {
+			return fmt.Errorf("creating attempt %d. Cause: %v", attemptNumber, err)
+		}
+		fmt.Fprintf(outputDest, "Attempt %d of %d\n", attemptNumber, policy.MaxAttempts)
+
+		runnerStatus := make(chan uint32, 1)
+		attemptOutput := &attemptOutput{WriteCloser: output, build: outputDest, first: attemptNumber == 1}
+		if err := r.run(ctx, job, attemptOutput, runnerStatus); err != nil {
+			output.Close()
+			attemptStatus <- StatusContainerFailed
+			return err
+		}
+
+		go func() {
+			exitStatus := <-runnerStatus
+			attemptStatus <- exitStatus
+
+			if attemptNumber < policy.MaxAttempts && ctx.Err() == nil && policy.Retries(exitStatus) {
+				fmt.Fprintf(outputDest, "Attempt %d failed with exit status %d, retrying\n", attemptNumber, exitStatus)
+				err := attempt(attemptNumber + 1)
+				if err == nil {
+					return
+				}
+				fmt.Fprintf(outputDest, "Error starting attempt %d: %v\n", attemptNumber+1, err)
+			}
+
+			if err := outputDest.Close(); err != nil {
+				log.Printf("error closing output of build %d of job %s: %v\n", r.buildNumber, job.ID, err)
+			}
+			status <- exitStatus
+		}()
+		return nil
+	}
+	return attempt(1)
+}
+
+// attemptOutput writes the output of an attempt to the build's output too,
+// which is closed once the last attempt finishes. The revisions fetched by the
+// first attempt are those of the build, and artifacts and caches are kept for
+// the build. Each attempt keeps the logs of its own service containers.
+type attemptOutput struct {
+	io.WriteCloser
+	build io.Writer
+	first bool
+
+	mutex sync.Mutex
+}
+
+func (o *attemptOutput) Write(p []byte) (int, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if _, err := o.build.Write(p); err != nil {
+		return 0, err
+	}
+	return o.WriteCloser.Write(p)
+}
+
+func (o *attemptOutput) RecordRevision(revision Revision) error {
+	if o.first {
+		if err := RecordRevision(o.build, revision); err != nil {
+			return err
+		}
+	}
+	return RecordRevision(o.WriteCloser, revision)
+}
+
+func (o *attemptOutput) ArtifactsDir() (string, error) {
+	return ArtifactsDir(o.build)
+}
+
+func (o *attemptOutput) CacheDir(cache Cache, key string) (string, error) {
+	return CacheDir(o.build, cache, key)
+}
+
+func (o *attemptOutput) ServiceLog(name string) (io.WriteCloser, error) {
+	return ServiceLogWriter(o.WriteCloser, name)
+}
@@ -0,0 +1,143 @@
+package jobs_test
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+	"github.com/craigfurman/woodhouse-ci/jobs/fake_build_repository"
+	"github.com/craigfurman/woodhouse-ci/jobs/fake_job_repository"
+	"github.com/craigfurman/woodhouse-ci/jobs/fake_job_runner"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Retries", func() {
+	Describe("the retry policy", func() {
+		It("retries any failure by default", func() {
+			policy := jobs.RetryPolicy{MaxAttempts: 2}
+			Expect(policy.Retries(1)).To(BeTrue())
+			Expect(policy.Retries(jobs.StatusImagePullFailed)).To(BeTrue())
+			Expect(policy.Retries(0)).To(BeFalse())
+		})
+
+		It("never retries aborted or skipped builds", func() {
+			policy := jobs.RetryPolicy{MaxAttempts: 2, InfrastructureErrors: true}
+			Expect(policy.Retries(jobs.StatusAborted)).To(BeFalse())
+			Expect(policy.Retries(jobs.StatusSkipped)).To(BeFalse())
+		})
+
+		It("retries only the given exit statuses", func() {
+			policy := jobs.RetryPolicy{MaxAttempts: 2, ExitStatuses: []uint32{3}}
+			Expect(policy.Retries(3)).To(BeTrue())
+			Expect(policy.Retries(1)).To(BeFalse())
+			Expect(policy.Retries(jobs.StatusFetchFailed)).To(BeFalse())
+		})
+
+		It("retries infrastructure errors but not failures of the job's command", func() {
+			policy := jobs.RetryPolicy{MaxAttempts: 2, InfrastructureErrors: true}
+			Expect(policy.Retries(jobs.StatusFetchFailed)).To(BeTrue())
+			Expect(policy.Retries(jobs.StatusAgentLost)).To(BeTrue())
+			Expect(policy.Retries(jobs.StatusTimedOut)).To(BeFalse())
+			Expect(policy.Retries(1)).To(BeFalse())
+		})
+
+		It("rejects too many attempts and exit statuses a command cannot have", func() {
+			Expect(jobs.RetryPolicy{MaxAttempts: 3, ExitStatuses: []uint32{1, 255}}.Validate()).To(Succeed())
+			Expect(jobs.RetryPolicy{MaxAttempts: 11}.Validate()).To(MatchError("builds may be attempted at most 10 times, not: 11"))
+			Expect(jobs.RetryPolicy{MaxAttempts: 2, ExitStatuses: []uint32{0}}.Validate()).To(MatchError(ContainSubstring("not: 0")))
+			Expect(jobs.RetryPolicy{MaxAttempts: 2, ExitStatuses: []uint32{256}}.Validate()).To(MatchError(ContainSubstring("not: 256")))
+		})
+	})
+
+	Describe("running a job that retries failed builds", func() {
+		var (
+			service        *jobs.Service
+			buildRepo      *fake_build_repository.FakeBuildRepository
+			runner         *fake_job_runner.FakeRunner
+			output         *gbytes.Buffer
+			exitStatus     chan uint32
+			attemptOutputs []*gbytes.Buffer
+			attemptStatus  []chan uint32
+			runnerStatuses []uint32
+			mutex          sync.Mutex
+		)
+
+		BeforeEach(func() {
+			jobRepo := new(fake_job_repository.FakeJobRepository)
+			jobRepo.FindByIdReturns(jobs.Job{ID: "flaky", Command: "make test", Retry: jobs.RetryPolicy{MaxAttempts: 3, ExitStatuses: []uint32{1}}}, nil)
+
+			output = gbytes.NewBuffer()
+			exitStatus = make(chan uint32, 1)
+			buildRepo = new(fake_build_repository.FakeBuildRepository)
+			buildRepo.CreateReturns(7, output, exitStatus, nil)
+			attemptOutputs = nil
+			attemptStatus = nil
+			buildRepo.CreateAttemptStub = func(jobID string, buildNumber int) (int, io.WriteCloser, chan uint32, error) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				attemptOutputs = append(attemptOutputs, gbytes.NewBuffer())
+				attemptStatus = append(attemptStatus, make(chan uint32, 1))
+				return len(attemptOutputs), attemptOutputs[len(attemptOutputs)-1], attemptStatus[len(attemptStatus)-1], nil
+			}
+
+			runner = new(fake_job_runner.FakeRunner)
+			runner.RunStub = func(ctx context.Context, job jobs.Job, outputDest io.WriteCloser, status chan<- uint32) error {
+				mutex.Lock()
+				defer mutex.Unlock()
+				attempt := runner.RunCallCount()
+				outputDest.Write([]byte("running attempt\n"))
+				Expect(outputDest.Close()).To(Succeed())
+				status <- runnerStatuses[attempt-1]
+				return nil
+			}
+
+			service = &jobs.Service{JobRepository: jobRepo, BuildRepository: buildRepo, Runner: runner}
+		})
+
+		It("tries again while the build fails with a status it retries on", func() {
+			runnerStatuses = []uint32{1, 1, 0}
+			buildNumber, err := service.RunJob("flaky")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buildNumber).To(Equal(7))
+
+			Eventually(exitStatus).Should(Receive(Equal(uint32(0))))
+			Expect(runner.RunCallCount()).To(Equal(3))
+			jobID, attemptBuild := buildRepo.CreateAttemptArgsForCall(2)
+			Expect(jobID).To(Equal("flaky"))
+			Expect(attemptBuild).To(Equal(7))
+
+			Expect(output).To(gbytes.Say("Attempt 1 of 3"))
+			Expect(output).To(gbytes.Say("running attempt"))
+			Expect(output).To(gbytes.Say("Attempt 1 failed with exit status 1, retrying"))
+			Expect(output).To(gbytes.Say("Attempt 2 of 3"))
+			Expect(output).To(gbytes.Say("Attempt 3 of 3"))
+			Expect(output.Closed()).To(BeTrue())
+
+			for i, status := range []uint32{1, 1, 0} {
+				Expect(attemptOutputs[i].Contents()).To(Equal([]byte("running attempt\n")))
+				Expect(attemptStatus[i]).To(Receive(Equal(status)))
+			}
+		})
+
+		It("stops after the last attempt", func() {
+			runnerStatuses = []uint32{1, 1, 1}
+			_, err := service.RunJob("flaky")
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(exitStatus).Should(Receive(Equal(uint32(1))))
+			Expect(runner.RunCallCount()).To(Equal(3))
+		})
+
+		It("does not retry other failures", func() {
+			runnerStatuses = []uint32{2}
+			_, err := service.RunJob("flaky")
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(exitStatus).Should(Receive(Equal(uint32(2))))
+			Expect(runner.RunCallCount()).To(Equal(1))
+			Expect(output).NotTo(gbytes.Say("retrying"))
+		})
+	})
+})
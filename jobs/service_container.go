@@ -0,0 +1,64 @@
+package jobs
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// ServiceContainer runs alongside each build of a job, e.g. a database that
+// its integration tests use, and is reachable from the build by its name.
+type ServiceContainer struct {
+	Name  string
+	Image string
+
+	// Environment variables, like "NAME=value", set in the service container
+	Env []string `json:",omitempty"`
+
+	// A shell command run in the service container that succeeds once the
+	// service is ready, e.g. "pg_isready -U postgres". Builds start once it
+	// does. Without one, builds start as soon as the service container has.
+	HealthCheck string `json:",omitempty"`
+}
+
+// Names are used as hostnames
+var serviceName = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+func ValidateServices(services []ServiceContainer) error {
+	names := map[string]bool{}
+	for _, service := range services {
+		if !serviceName.MatchString(service.Name) {
+			return fmt.Errorf("service names may only contain lower case letters, numbers and '-', not: %s", service.Name)
+		}
+		if names[service.Name] {
+			return fmt.Errorf("more than one service is named %s", service.Name)
+		}
+		names[service.Name] = true
+
+		if service.Image == "" {
+			return fmt.Errorf("service %s has no image", service.Name)
+		}
+	}
+	return nil
+}
+
+// ServiceLog is what one of a build's service containers logged.
+type ServiceLog struct {
+	Name   string
+	Output []byte
+}
+
+// ServiceLogKeeper is implemented by build outputs that keep the logs of each
+// service container apart from the build's own output.
+type ServiceLogKeeper interface {
+	ServiceLog(name string) (io.WriteCloser, error)
+}
+
+// ServiceLogWriter is where the logs of the named service container should be
+// written, or nil if the build output cannot keep them.
+func ServiceLogWriter(outputDest io.Writer, name string) (io.WriteCloser, error) {
+	if keeper, ok := outputDest.(ServiceLogKeeper); ok {
+		return keeper.ServiceLog(name)
+	}
+	return nil, nil
+}
@@ -0,0 +1,20 @@
+package jobs_test
+
+import (
+	"github.com/craigfurman/woodhouse-ci/jobs"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Service containers", func() {
+	It("validates the services of a job", func() {
+		Expect(jobs.ValidateServices([]jobs.ServiceContainer{
+			{Name: "postgres", Image: "postgres:13", HealthCheck: "pg_isready"},
+			{Name: "redis-cache", Image: "redis"},
+		})).To(Succeed())
+		Expect(jobs.ValidateServices([]jobs.ServiceContainer{{Name: "Postgres_DB", Image: "postgres"}})).To(MatchError(ContainSubstring("not: Postgres_DB")))
+		Expect(jobs.ValidateServices([]jobs.ServiceContainer{{Name: "db", Image: "postgres"}, {Name: "db", Image: "mysql"}})).To(MatchError("more than one service is named db"))
+		Expect(jobs.ValidateServices([]jobs.ServiceContainer{{Name: "db"}})).To(MatchError("service db has no image"))
+	})
+})
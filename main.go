@@ -1,19 +1,27 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/craigfurman/woodhouse-ci/agents"
 	"github.com/craigfurman/woodhouse-ci/builds"
 	"github.com/craigfurman/woodhouse-ci/db"
+	"github.com/craigfurman/woodhouse-ci/forge"
 	"github.com/craigfurman/woodhouse-ci/jobs"
 	"github.com/craigfurman/woodhouse-ci/runner"
+	"github.com/craigfurman/woodhouse-ci/secrets"
 	"github.com/craigfurman/woodhouse-ci/vcs"
 	"github.com/craigfurman/woodhouse-ci/web"
 
@@ -32,8 +40,31 @@ func main() {
 	assetsDir := flag.String("assetsDir", filepath.Join(distBase, "web", "assets"), "path to static web assets")
 	gooseCmd := flag.String("gooseCmd", filepath.Join(distBase, "bin", "goose"), `path to "goose" database migration tool`)
 	debugMode := flag.Bool("debugMode", false, "do not parse templates up front. Only for development use")
+	containerRuntime := flag.String("containerRuntime", jobs.RunnerDocker, `container runtime for jobs that do not choose one: "docker" or "podman"`)
+	dockerHost := flag.String("dockerHost", "unix:///var/run/docker.sock", "address of the Docker Engine API")
+	localTimeout := flag.Duration("localTimeout", time.Hour, "maximum duration of jobs run on the Woodhouse host. 0 means no limit")
+	agentTimeout := flag.Duration("agentTimeout", time.Minute, "time after which build agents that have not sent a heartbeat are considered lost")
+	gitMirrors := flag.Bool("gitMirrors", true, "keep mirrors of git repositories in the store directory, to speed up checkouts")
+	removeStaleMirrors := flag.Duration("removeStaleMirrors", 0, "remove git mirrors that have not been used for this long, then exit")
+	externalURL := flag.String("externalURL", "", "URL that Woodhouse is served from, for links in commit statuses")
+	forgeAPIURL := flag.String("forgeAPIURL", "https://api.github.com", "base URL of the forge API that commit statuses are set with")
+	forgeTokenFile := flag.String("forgeTokenFile", "", "file containing an API token for setting the status of pull request commits. Statuses are not set without one")
+	privilegedImages := flag.String("privilegedImages", "", "comma separated docker images that jobs may run privileged containers of, e.g. docker:dind")
+	volumeDirs := flag.String("volumeDirs", "", "comma separated directories of the host that jobs may mount in their containers, along with anything in them")
+	allowLocalRunner := flag.Bool("allowLocalRunner", false, `allow jobs to run directly on the Woodhouse host with the "local" runner`)
+	shutdownGracePeriod := flag.Duration("shutdownGracePeriod", time.Minute, "time to wait for running builds to finish when shutting down, before stopping them")
 	flag.Parse()
 
+	mirrorDir := filepath.Join(*storeDir, "git-mirrors")
+	if *removeStaleMirrors > 0 {
+		removed, err := vcs.RemoveStaleMirrors(mirrorDir, *removeStaleMirrors)
+		for _, mirror := range removed {
+			log.Printf("removed %s\n", mirror)
+		}
+		must(err)
+		return
+	}
+
 	bootMsg := ` _    _                 _ _                                 _____ _____
 | |  | |               | | |                               /  __ \_   _|
 | |  | | ___   ___   __| | |__   ___  _   _ ___  ___ ______| /  \/ | |
@@ -56,25 +87,111 @@ func main() {
 
 	jobRepo, err := db.NewJobRepository(filepath.Join(dbDir, "store.db"))
 	must(err)
+	credentialsKey := secrets.Key{Path: filepath.Join(*storeDir, "credentials-key")}
+	must(credentialsKey.Ensure())
+	credentialRepo, err := db.NewCredentialRepository(filepath.Join(dbDir, "store.db"), credentialsKey)
+	must(err)
+
+	dockerClient, err := runner.NewDockerClient(*dockerHost)
+	must(err)
+	gitCloner := vcs.GitCloner{}
+	if *gitMirrors {
+		gitCloner.MirrorDir = mirrorDir
+	}
+	sources := vcs.Registry{
+		jobs.SourceGit:       gitCloner,
+		jobs.SourceMercurial: vcs.MercurialCloner{},
+		jobs.SourceArchive:   vcs.ArchiveFetcher{},
+	}
+	dockerRunner := runner.NewDockerAPIRunner(dockerClient, sources)
+	if err := dockerRunner.RemoveContainers(context.Background()); err != nil {
+		log.Printf("error removing containers left over from previous run: %v\n", err)
+	}
+
+	exitChan := make(chan os.Signal, 1)
+	signal.Notify(exitChan, os.Interrupt, syscall.SIGTERM)
 
-	// Only Interrupt handled, as this is available on all major platforms and is the most common way of stopping Woodhouse-CI
-	exitChan := make(chan os.Signal)
-	signal.Notify(exitChan, os.Interrupt)
-	go func(c <-chan os.Signal) {
-		log.Printf("Caught signal %s. Closing database connections. Goodbye!\n", <-c)
-		must(jobRepo.Close())
-		os.Exit(0)
-	}(exitChan)
+	registrationToken := agents.RegistrationToken{Path: filepath.Join(*storeDir, "agent-registration-token")}
+	must(registrationToken.Ensure())
+	agentPool := agents.NewPool(*agentTimeout, registrationToken)
+	jobRunner := runner.Dispatcher{
+		jobs.RunnerAgent:  agentPool,
+		jobs.RunnerDocker: dockerRunner,
+		jobs.RunnerPodman: runner.NewPodmanRunner(sources),
+	}
+	if *allowLocalRunner {
+		jobRunner[jobs.RunnerLocal] = runner.NewLocalRunner(sources, *localTimeout)
+	}
+	switch *containerRuntime {
+	case jobs.RunnerDocker, jobs.RunnerPodman:
+		jobRunner[jobs.RunnerContainer] = jobRunner[*containerRuntime]
+	default:
+		log.Fatalf("unsupported container runtime: %s\n", *containerRuntime)
+	}
 
-	handler := web.New(&jobs.Service{
+	jobService := &jobs.Service{
 		JobRepository:   jobRepo,
-		Runner:          runner.NewDockerRunner(vcs.GitCloner{}),
+		Runner:          jobRunner,
 		BuildRepository: builds.NewRepository(*buildsDir),
-	}, *templateDir, !*debugMode)
+		Credentials:     credentialRepo,
+		ContainerPolicy: jobs.ContainerPolicy{
+			PrivilegedImages: splitList(*privilegedImages),
+			VolumeDirs:       splitList(*volumeDirs),
+			AllowLocalRunner: *allowLocalRunner,
+		},
+	}
+	if *forgeTokenFile != "" {
+		token, err := ioutil.ReadFile(*forgeTokenFile)
+		must(err)
+		forgeClient := forge.NewGitHubClient(*forgeAPIURL, strings.TrimSpace(string(token)))
+		jobService.Reporter = forge.Reporter{Client: forgeClient, ExternalURL: *externalURL}
+	}
+	webhookSecret := forge.WebhookSecret{Path: filepath.Join(*storeDir, "webhook-secret")}
+	must(webhookSecret.Ensure())
+	hooks := forge.NewHandler(jobService, webhookSecret)
+	handler := web.New(jobService, agentPool, credentialRepo, agents.NewHandler(agentPool), hooks, *templateDir, !*debugMode)
+
+	n := negroni.New(negroni.NewRecovery(), negroni.NewLogger(), negroni.NewStatic(http.Dir(*assetsDir)))
+	n.UseHandler(handler)
+	server := &http.Server{Addr: fmt.Sprintf("0.0.0.0:%d", *port), Handler: n}
+	go func() {
+		log.Printf("listening on %s\n", server.Addr)
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	log.Printf("Caught signal %s. Waiting up to %s for running builds to finish\n", <-exitChan, *shutdownGracePeriod)
+	jobService.Shutdown(*shutdownGracePeriod)
+
+	if err := dockerRunner.RemoveContainers(context.Background()); err != nil {
+		log.Printf("error removing containers: %v\n", err)
+	}
+	if err := vcs.RemoveTempDirs(); err != nil {
+		log.Printf("error removing temporary checkouts: %v\n", err)
+	}
+
+	// Streaming responses never end by themselves, so don't wait long for them
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("error shutting down HTTP server: %v. Closing remaining connections\n", err)
+		must(server.Close())
+	}
 
-	server := negroni.New(negroni.NewRecovery(), negroni.NewLogger(), negroni.NewStatic(http.Dir(*assetsDir)))
-	server.UseHandler(handler)
-	server.Run(fmt.Sprintf("0.0.0.0:%d", *port))
+	must(jobRepo.Close())
+	must(credentialRepo.Close())
+	log.Println("Goodbye!")
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 func must(err error) {
@@ -0,0 +1,159 @@
+package runner
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+)
+
+// fetchUpstreamArtifacts copies the artifacts of the builds that triggered the
+// job, so that the job cannot change them. They are put in the workspace like
+// inputs.
+func fetchUpstreamArtifacts(job jobs.Job, fetched *fetchedSources, outputDest io.Writer) error {
+	for _, upstream := range job.UpstreamBuilds {
+		if upstream.ArtifactsDir == "" {
+			continue
+		}
+
+		dir, err := ioutil.TempDir("", "woodhouse-artifacts")
+		if err != nil {
+			return err
+		}
+		name := path.Join(jobs.ArtifactsDirName, upstream.DirName())
+		fetched.inputs = append(fetched.inputs, fetchedInput{name: name, dir: dir})
+
+		fmt.Fprintf(outputDest, "Copying artifacts of build %d of %s to %s\n", upstream.BuildNumber, upstream.JobName, name)
+		if err := copyTree(upstream.ArtifactsDir, dir); err != nil {
+			return fmt.Errorf("copying artifacts of build %d of %s: %v", upstream.BuildNumber, upstream.JobName, err)
+		}
+	}
+	return nil
+}
+
+// keepArtifacts copies the files in the workspace matching the job's artifact
+// patterns to wherever the build output keeps them. Failing to keep them does
+// not fail the build.
+func keepArtifacts(job jobs.Job, workspace string, outputDest io.Writer) {
+	if len(job.Artifacts) == 0 {
+		return
+	}
+
+	dest, err := jobs.ArtifactsDir(outputDest)
+	if err != nil {
+		fmt.Fprintf(outputDest, "Error keeping artifacts: %v\n", err)
+		return
+	}
+	if dest == "" || workspace == "" {
+		fmt.Fprintln(outputDest, "Artifacts cannot be kept for this build")
+		return
+	}
+
+	// Matches are compared with where the workspace really is
+	resolvedWorkspace, err := filepath.EvalSymlinks(workspace)
+	if err != nil {
+		fmt.Fprintf(outputDest, "Error keeping artifacts: %v\n", err)
+		return
+	}
+
+	for _, pattern := range job.Artifacts {
+		// Patterns were checked when the job was saved, unless it was saved
+		// before they were
+		if err := jobs.ValidateArtifacts([]string{pattern}); err != nil {
+			fmt.Fprintf(outputDest, "Error keeping artifacts matching %s: %v\n", pattern, err)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(workspace, pattern))
+		if err != nil {
+			fmt.Fprintf(outputDest, "Error keeping artifacts matching %s: %v\n", pattern, err)
+			continue
+		}
+		if len(matches) == 0 {
+			fmt.Fprintf(outputDest, "No artifacts match %s\n", pattern)
+		}
+
+		for _, match := range matches {
+			rel, err := filepath.Rel(workspace, match)
+			if err == nil {
+				err = keepArtifact(match, resolvedWorkspace, filepath.Join(dest, rel), filepath.ToSlash(rel), outputDest)
+			}
+			if err != nil {
+				fmt.Fprintf(outputDest, "Error keeping artifact %s: %v\n", match, err)
+			}
+		}
+	}
+}
+
+// keepArtifact copies a match unless it is a symlink, or the build made it
+// resolve to somewhere outside the workspace through a symlinked directory.
+func keepArtifact(match, resolvedWorkspace, dest, name string, outputDest io.Writer) error {
+	info, err := os.Lstat(match)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		fmt.Fprintf(outputDest, "Skipping artifact %s, which is a symlink\n", name)
+		return nil
+	}
+
+	resolved, err := filepath.EvalSymlinks(match)
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(resolvedWorkspace, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		fmt.Fprintf(outputDest, "Skipping artifact %s, which is outside the workspace\n", name)
+		return nil
+	}
+
+	fmt.Fprintf(outputDest, "Keeping artifact %s\n", name)
+	return copyTree(match, dest)
+}
+
+// copyTree copies a file, or a directory and everything in it. Symlinks are
+// not followed, so that nothing outside the tree is copied.
+func copyTree(src, dest string) error {
+	return filepath.Walk(src, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, 0755)
+		case info.Mode().IsRegular():
+			return copyFile(file, target, info.Mode())
+		}
+		return nil
+	})
+}
+
+func copyFile(src, dest string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,84 @@
+package runner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+)
+
+// cacheMounts mounts each of the job's caches, kept between its builds by the
+// build output, at its path in the container. A build runs without the caches
+// it cannot use rather than failing.
+func cacheMounts(job jobs.Job, workspace string, outputDest io.Writer) []Mount {
+	mounts := []Mount{}
+	for _, cache := range job.Caches {
+		key, err := cacheKey(cache, workspace)
+		if err != nil {
+			fmt.Fprintf(outputDest, "Error keying cache %s, so building without it: %v\n", cache.Name, err)
+			continue
+		}
+
+		dir, err := jobs.CacheDir(outputDest, cache, key)
+		if err != nil {
+			fmt.Fprintf(outputDest, "Error using cache %s, so building without it: %v\n", cache.Name, err)
+			continue
+		}
+		if dir == "" {
+			fmt.Fprintln(outputDest, "Caches cannot be kept for this build")
+			return nil
+		}
+
+		if key == "" {
+			fmt.Fprintf(outputDest, "Using cache %s\n", cache.Name)
+		} else {
+			fmt.Fprintf(outputDest, "Using cache %s with key %s\n", cache.Name, key)
+		}
+		mounts = append(mounts, Mount{HostDir: dir, ContainerDir: cacheContainerDir(cache)})
+	}
+	return mounts
+}
+
+func cacheContainerDir(cache jobs.Cache) string {
+	if path.IsAbs(cache.Path) {
+		return cache.Path
+	}
+	return path.Join(containerWorkspace, cache.Path)
+}
+
+// cacheKey hashes the contents of the cache's key files in the checkout of the
+// job's repository. Missing files are keyed as such, e.g. so that a lock file
+// being added changes the key.
+func cacheKey(cache jobs.Cache, workspace string) (string, error) {
+	if len(cache.KeyFiles) == 0 {
+		return "", nil
+	}
+	if workspace == "" {
+		return "", fmt.Errorf("the job has no repository to find %v in", cache.KeyFiles)
+	}
+	// Jobs saved before key files were checked may still have any
+	if err := jobs.ValidateCaches([]jobs.Cache{cache}); err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	for _, file := range cache.KeyFiles {
+		contents, err := ioutil.ReadFile(filepath.Join(workspace, filepath.FromSlash(file)))
+		switch {
+		case os.IsNotExist(err):
+			fmt.Fprintf(hash, "%s missing\x00", file)
+		case err != nil:
+			return "", err
+		default:
+			fmt.Fprintf(hash, "%s %d\x00", file, len(contents))
+			hash.Write(contents)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16], nil
+}
@@ -0,0 +1,71 @@
+package runner
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+)
+
+// applyContainerOptions sets the limits and security options of the job's
+// container. They have been checked against the server's policy when the build
+// was started.
+func applyContainerOptions(options jobs.ContainerOptions, config *ContainerConfig) {
+	config.User = options.User
+	config.HostConfig.NanoCPUs = int64(options.CPUs * 1e9)
+	config.HostConfig.Memory = options.Memory
+	config.HostConfig.PidsLimit = options.PidsLimit
+	config.HostConfig.NetworkMode = options.NetworkMode
+	config.HostConfig.ReadonlyRootfs = options.ReadOnlyRootFilesystem
+	config.HostConfig.Privileged = options.Privileged
+	config.HostConfig.Binds = append(config.HostConfig.Binds, volumes(options)...)
+}
+
+// containerOptionArgs are the flags of docker compatible CLIs that apply the
+// job's container options.
+func containerOptionArgs(options jobs.ContainerOptions) []string {
+	var args []string
+	if options.CPUs > 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(options.CPUs, 'f', -1, 64))
+	}
+	if options.Memory > 0 {
+		args = append(args, "--memory", strconv.FormatInt(options.Memory, 10))
+	}
+	if options.PidsLimit > 0 {
+		args = append(args, "--pids-limit", strconv.FormatInt(options.PidsLimit, 10))
+	}
+	if options.NetworkMode != "" {
+		args = append(args, "--network", options.NetworkMode)
+	}
+	if options.ReadOnlyRootFilesystem {
+		args = append(args, "--read-only")
+	}
+	if options.User != "" {
+		args = append(args, "--user", options.User)
+	}
+	if options.Privileged {
+		args = append(args, "--privileged")
+	}
+	for _, volume := range volumes(options) {
+		args = append(args, "-v", volume)
+	}
+	return args
+}
+
+// volumes are the job's volumes with their paths cleaned, as they were when
+// they were checked against the server's policy.
+func volumes(options jobs.ContainerOptions) []string {
+	var binds []string
+	for _, volume := range options.Volumes {
+		hostPath, containerPath, err := jobs.ParseVolume(volume)
+		if err != nil {
+			continue
+		}
+		bind := hostPath + ":" + containerPath
+		if strings.HasSuffix(volume, ":ro") {
+			bind += ":ro"
+		}
+		binds = append(binds, bind)
+	}
+	return binds
+}
@@ -0,0 +1,54 @@
+package runner
+
+import (
+	"fmt"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+)
+
+// ContainerRuntime captures how a docker compatible CLI behaves differently
+// from docker itself.
+type ContainerRuntime interface {
+	// Arguments to `run` that mount the checkouts of a build's sources
+	WorkspaceArgs(mounts []Mount) []string
+
+	// The status to record when `run` exits with the given code
+	ExitStatus(exitCode int) uint32
+}
+
+type DockerRuntime struct{}
+
+func (DockerRuntime) WorkspaceArgs(mounts []Mount) []string {
+	args := []string{}
+	for _, mount := range mounts {
+		args = append(args, "-v", fmt.Sprintf("%s:%s", mount.HostDir, mount.ContainerDir))
+	}
+	return args
+}
+
+func (DockerRuntime) ExitStatus(exitCode int) uint32 {
+	return uint32(exitCode)
+}
+
+// PodmanRuntime supports rootless podman.
+type PodmanRuntime struct{}
+
+// Checkouts are relabelled (:Z) so that SELinux allows the container to use
+// them. Keeping the user ID means files the job writes to the workspace are
+// owned by the Woodhouse user rather than a subordinate ID, so that they can
+// be removed after the build.
+func (PodmanRuntime) WorkspaceArgs(mounts []Mount) []string {
+	args := []string{}
+	for _, mount := range mounts {
+		args = append(args, "-v", fmt.Sprintf("%s:%s:Z", mount.HostDir, mount.ContainerDir))
+	}
+	return append(args, "--userns=keep-id")
+}
+
+// Podman reserves 125 for its own errors, e.g. failing to pull the image.
+func (PodmanRuntime) ExitStatus(exitCode int) uint32 {
+	if exitCode == 125 {
+		return jobs.StatusContainerFailed
+	}
+	return uint32(exitCode)
+}
@@ -0,0 +1,102 @@
+package runner_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+	"github.com/craigfurman/woodhouse-ci/runner"
+	"github.com/craigfurman/woodhouse-ci/runner/fake_vcs_fetcher"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Container runtimes", func() {
+	Describe("podman", func() {
+		var (
+			r           *runner.DockerRunner
+			vcsFetcher  *fake_vcs_fetcher.FakeVcsFetcher
+			fakeCLIDir  string
+			checkoutDir string
+			exitCode    string
+
+			output     *gbytes.Buffer
+			exitStatus chan uint32
+		)
+
+		BeforeEach(func() {
+			var err error
+			fakeCLIDir, err = ioutil.TempDir("", "fake-podman")
+			Expect(err).NotTo(HaveOccurred())
+			checkoutDir, err = ioutil.TempDir("", "podman-runner-unit-tests")
+			Expect(err).NotTo(HaveOccurred())
+
+			vcsFetcher = new(fake_vcs_fetcher.FakeVcsFetcher)
+			vcsFetcher.FetchReturns(checkoutDir, "some-revision", nil)
+			r = runner.NewPodmanRunner(vcsFetcher)
+			r.DockerCmd = filepath.Join(fakeCLIDir, "podman")
+
+			output = gbytes.NewBuffer()
+			exitStatus = make(chan uint32, 1)
+			exitCode = "0"
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(fakeCLIDir)).To(Succeed())
+		})
+
+		JustBeforeEach(func() {
+			fakeCLI := "#!/bin/sh\necho \"$@\"\nexit " + exitCode + "\n"
+			Expect(ioutil.WriteFile(r.DockerCmd, []byte(fakeCLI), 0755)).To(Succeed())
+
+			job := jobs.Job{ID: "some-id", Command: "make test", DockerImage: "golang", Repository: "some-repo"}
+			Expect(r.Run(context.Background(), job, output, exitStatus)).To(Succeed())
+		})
+
+		It("relabels the workspace and keeps the user ID", func() {
+			Eventually(output).Should(gbytes.Say("-v %s:/woodhouse-workspace:Z --userns=keep-id --workdir /woodhouse-workspace golang make test", checkoutDir))
+			Eventually(exitStatus).Should(Receive(Equal(uint32(0))))
+		})
+
+		Context("when podman itself fails", func() {
+			BeforeEach(func() {
+				exitCode = "125"
+			})
+
+			It("reports that the container could not be run", func() {
+				Eventually(exitStatus).Should(Receive(Equal(jobs.StatusContainerFailed)))
+			})
+		})
+
+		Context("when the command fails", func() {
+			BeforeEach(func() {
+				exitCode = "2"
+			})
+
+			It("sends the status code", func() {
+				Eventually(exitStatus).Should(Receive(Equal(uint32(2))))
+			})
+		})
+	})
+
+	Describe("docker", func() {
+		It("mounts the workspace without relabelling", func() {
+			mounts := []runner.Mount{
+				{HostDir: "/tmp/checkout", ContainerDir: "/woodhouse-workspace"},
+				{HostDir: "/tmp/lib", ContainerDir: "/woodhouse-workspace/lib"},
+			}
+			Expect(runner.DockerRuntime{}.WorkspaceArgs(mounts)).To(Equal([]string{
+				"-v", "/tmp/checkout:/woodhouse-workspace",
+				"-v", "/tmp/lib:/woodhouse-workspace/lib",
+			}))
+		})
+
+		It("passes exit codes through", func() {
+			Expect(runner.DockerRuntime{}.ExitStatus(125)).To(Equal(uint32(125)))
+		})
+	})
+})
@@ -0,0 +1,26 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+)
+
+// Dispatcher runs each job with the runner registered for its RunnerType.
+// Jobs without a RunnerType are run in a container.
+type Dispatcher map[string]jobs.Runner
+
+func (d Dispatcher) Run(ctx context.Context, job jobs.Job, outputDest io.WriteCloser, status chan<- uint32) error {
+	runnerType := job.RunnerType
+	if runnerType == "" {
+		runnerType = jobs.RunnerContainer
+	}
+
+	r, ok := d[runnerType]
+	if !ok {
+		return fmt.Errorf("no runner available for runner type: %s", runnerType)
+	}
+	return r.Run(ctx, job, outputDest, status)
+}
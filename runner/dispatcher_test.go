@@ -0,0 +1,51 @@
+package runner_test
+
+import (
+	"context"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+	"github.com/craigfurman/woodhouse-ci/jobs/fake_job_runner"
+	"github.com/craigfurman/woodhouse-ci/runner"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Dispatcher", func() {
+	var (
+		containerRunner *fake_job_runner.FakeRunner
+		localRunner     *fake_job_runner.FakeRunner
+		dispatcher      runner.Dispatcher
+	)
+
+	BeforeEach(func() {
+		containerRunner = new(fake_job_runner.FakeRunner)
+		localRunner = new(fake_job_runner.FakeRunner)
+		dispatcher = runner.Dispatcher{
+			jobs.RunnerContainer: containerRunner,
+			jobs.RunnerLocal:     localRunner,
+		}
+	})
+
+	run := func(job jobs.Job) error {
+		return dispatcher.Run(context.Background(), job, gbytes.NewBuffer(), make(chan uint32, 1))
+	}
+
+	It("runs jobs with the runner for their type", func() {
+		Expect(run(jobs.Job{ID: "lint", RunnerType: jobs.RunnerLocal})).To(Succeed())
+		Expect(localRunner.RunCallCount()).To(Equal(1))
+		_, job, _, _ := localRunner.RunArgsForCall(0)
+		Expect(job.ID).To(Equal("lint"))
+		Expect(containerRunner.RunCallCount()).To(Equal(0))
+	})
+
+	It("runs jobs without a type in a container", func() {
+		Expect(run(jobs.Job{ID: "old"})).To(Succeed())
+		Expect(containerRunner.RunCallCount()).To(Equal(1))
+	})
+
+	It("errors when there is no runner for the type", func() {
+		Expect(run(jobs.Job{RunnerType: "mainframe"})).To(MatchError("no runner available for runner type: mainframe"))
+	})
+})
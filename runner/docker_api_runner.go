@@ -0,0 +1,193 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+
+	"github.com/pborman/uuid"
+)
+
+const (
+	// Every container started by Woodhouse has this label, so that leftovers can be found
+	ManagedLabel = "ci.woodhouse.managed"
+	JobIDLabel   = "ci.woodhouse.job-id"
+)
+
+// DockerAPIRunner runs jobs in containers using the Docker Engine API.
+type DockerAPIRunner struct {
+	Client     *DockerClient
+	VcsFetcher VcsFetcher
+
+	// How often the health checks of service containers are run
+	HealthCheckInterval time.Duration
+}
+
+func NewDockerAPIRunner(client *DockerClient, vcsFetcher VcsFetcher) *DockerAPIRunner {
+	return &DockerAPIRunner{Client: client, VcsFetcher: vcsFetcher, HealthCheckInterval: time.Second}
+}
+
+func (r *DockerAPIRunner) Run(ctx context.Context, job jobs.Job, outputDest io.WriteCloser, status chan<- uint32) error {
+	commandToRun := Chunk(job.Command)
+	if len(commandToRun) == 0 {
+		return fmt.Errorf("No arguments could be parsed from command: %s", job.Command)
+	}
+
+	if job.DockerImage == "" && job.Dockerfile == "" {
+		return errors.New("you need to specify a docker image or Dockerfile when using DockerAPIRunner")
+	}
+
+	go func() {
+		defer func() {
+			if err := outputDest.Close(); err != nil {
+				log.Printf("error closing command output: %v", err)
+			}
+		}()
+
+		status <- r.run(ctx, job, commandToRun, outputDest)
+	}()
+
+	return nil
+}
+
+func (r *DockerAPIRunner) run(ctx context.Context, job jobs.Job, commandToRun []string, outputDest io.Writer) uint32 {
+	config := ContainerConfig{
+		Image:  job.DockerImage,
+		Cmd:    commandToRun,
+		Env:    job.Env,
+		Labels: map[string]string{ManagedLabel: "true", JobIDLabel: job.ID},
+	}
+
+	sources, err := fetchSources(r.VcsFetcher, job, outputDest)
+	defer sources.remove()
+	if skipped(err, job, outputDest) {
+		return jobs.StatusSkipped
+	}
+	if err != nil {
+		fmt.Fprintf(outputDest, "Error %v\n", err)
+		return jobs.StatusFetchFailed
+	}
+
+	for _, mount := range sources.mounts() {
+		config.HostConfig.Binds = append(config.HostConfig.Binds, fmt.Sprintf("%s:%s", mount.HostDir, mount.ContainerDir))
+		config.WorkingDir = containerWorkspace
+	}
+	for _, mount := range cacheMounts(job, sources.dir, outputDest) {
+		config.HostConfig.Binds = append(config.HostConfig.Binds, fmt.Sprintf("%s:%s", mount.HostDir, mount.ContainerDir))
+	}
+
+	if job.Dockerfile != "" {
+		image, exitStatus := r.buildImage(ctx, job, sources.dir, outputDest)
+		if exitStatus != 0 {
+			return exitStatus
+		}
+		config.Image = image
+	} else {
+		fmt.Fprintf(outputDest, "Pulling image %s\n", job.DockerImage)
+		if err := r.Client.PullImage(ctx, job.DockerImage, outputDest); err != nil {
+			if ctx.Err() != nil {
+				return jobs.StatusAborted
+			}
+			fmt.Fprintf(outputDest, "Error pulling image %s: %v\n", job.DockerImage, err)
+			return jobs.StatusImagePullFailed
+		}
+	}
+
+	if ctx.Err() != nil {
+		return jobs.StatusAborted
+	}
+
+	applyContainerOptions(job.Container, &config)
+	services, exitStatus := r.startServices(ctx, job, outputDest)
+	defer services.remove()
+	if exitStatus != 0 {
+		return exitStatus
+	}
+	if services.network != "" {
+		config.HostConfig.NetworkMode = services.network
+	}
+
+	// The build's context is only used to decide when to stop the container.
+	// Cleaning up must happen regardless.
+	apiCtx := context.Background()
+
+	containerID, err := r.Client.CreateContainer(apiCtx, "woodhouse-"+uuid.New(), config)
+	if err != nil {
+		fmt.Fprintf(outputDest, "Error creating container: %v\n", err)
+		return jobs.StatusContainerFailed
+	}
+
+	defer func() {
+		if err := r.Client.RemoveContainer(apiCtx, containerID); err != nil {
+			log.Printf("error removing container %s: %v\n", containerID, err)
+		}
+	}()
+
+	if err := r.Client.StartContainer(apiCtx, containerID); err != nil {
+		fmt.Fprintf(outputDest, "Error starting container: %v\n", err)
+		return jobs.StatusContainerFailed
+	}
+
+	logsCopied := make(chan struct{})
+	go func() {
+		defer close(logsCopied)
+		if err := r.Client.FollowLogs(apiCtx, containerID, outputDest); err != nil {
+			log.Printf("error streaming logs from container %s: %v\n", containerID, err)
+		}
+	}()
+
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			if err := r.Client.StopContainer(apiCtx, containerID); err != nil {
+				log.Printf("error stopping container %s: %v\n", containerID, err)
+			}
+		case <-finished:
+		}
+	}()
+
+	exitCode, err := r.Client.WaitContainer(apiCtx, containerID)
+	<-logsCopied
+	if err != nil {
+		fmt.Fprintf(outputDest, "Error waiting for container: %v\n", err)
+		return jobs.StatusContainerFailed
+	}
+	if exitCode == 0 {
+		keepArtifacts(job, sources.dir, outputDest)
+	}
+	return uint32(exitCode)
+}
+
+// RemoveContainers force removes all containers started by Woodhouse, and the
+// networks of their services. Only call this when no builds are running, e.g.
+// on startup to clean up after a crash.
+func (r *DockerAPIRunner) RemoveContainers(ctx context.Context) error {
+	ids, err := r.Client.ListContainers(ctx, ManagedLabel+"=true")
+	if err != nil {
+		return fmt.Errorf("listing containers: %v", err)
+	}
+
+	for _, id := range ids {
+		if err := r.Client.RemoveContainer(ctx, id); err != nil {
+			return fmt.Errorf("removing container %s: %v", id, err)
+		}
+	}
+
+	networks, err := r.Client.ListNetworks(ctx, ManagedLabel+"=true")
+	if err != nil {
+		return fmt.Errorf("listing networks: %v", err)
+	}
+	for _, id := range networks {
+		if err := r.Client.RemoveNetwork(ctx, id); err != nil {
+			return fmt.Errorf("removing network %s: %v", id, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,702 @@
+package runner_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+	"github.com/craigfurman/woodhouse-ci/runner"
+	"github.com/craigfurman/woodhouse-ci/runner/fake_docker_engine"
+	"github.com/craigfurman/woodhouse-ci/runner/fake_vcs_fetcher"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("DockerAPIRunner", func() {
+	var (
+		engine     *fake_docker_engine.FakeEngine
+		r          *runner.DockerAPIRunner
+		vcsFetcher *fake_vcs_fetcher.FakeVcsFetcher
+
+		job        jobs.Job
+		ctx        context.Context
+		runErr     error
+		output     *gbytes.Buffer
+		outputDest io.WriteCloser
+		exitStatus chan uint32
+	)
+
+	BeforeEach(func() {
+		engine = fake_docker_engine.New()
+		engine.Images = []string{"busybox:latest", "debian:jessie"}
+		client, err := runner.NewDockerClient("tcp://" + engine.Listener.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		vcsFetcher = new(fake_vcs_fetcher.FakeVcsFetcher)
+		r = runner.NewDockerAPIRunner(client, vcsFetcher)
+
+		job = jobs.Job{ID: "some-id", Name: "gob", Command: "echo hello", DockerImage: "busybox"}
+		ctx = context.Background()
+		output = gbytes.NewBuffer()
+		outputDest = output
+		exitStatus = make(chan uint32, 1)
+	})
+
+	AfterEach(func() {
+		engine.Close()
+	})
+
+	JustBeforeEach(func() {
+		runErr = r.Run(ctx, job, outputDest, exitStatus)
+	})
+
+	Context("when the command succeeds", func() {
+		BeforeEach(func() {
+			engine.RunStub = func(c fake_docker_engine.Container, stdout io.Writer, stop <-chan struct{}) int {
+				fmt.Fprintf(stdout, "hello from %v\n", c.Config.Cmd)
+				return 0
+			}
+		})
+
+		It("does not error", func() {
+			Expect(runErr).NotTo(HaveOccurred())
+		})
+
+		It("logs the progress of pulling the image", func() {
+			Eventually(output).Should(gbytes.Say("Pulling image busybox"))
+			Eventually(output).Should(gbytes.Say("8ddc19f16526: Pull complete"))
+			Expect(string(output.Contents())).NotTo(ContainSubstring("Downloading"))
+		})
+
+		It("writes the output of the container", func() {
+			Eventually(output).Should(gbytes.Say(`hello from \[echo hello\]`))
+		})
+
+		It("sends the status code", func() {
+			Eventually(exitStatus).Should(Receive(Equal(uint32(0))))
+		})
+
+		It("closes the output writer", func() {
+			Eventually(output.Closed).Should(BeTrue())
+		})
+
+		It("labels the container so that it can be cleaned up", func() {
+			Eventually(exitStatus).Should(Receive())
+			Expect(engine.Containers()).To(HaveLen(1))
+			Expect(engine.Containers()[0].Config.Labels).To(Equal(map[string]string{
+				runner.ManagedLabel: "true",
+				runner.JobIDLabel:   "some-id",
+			}))
+		})
+
+		It("removes the container", func() {
+			Eventually(output.Closed).Should(BeTrue())
+			Expect(engine.Containers()[0].Removed).To(BeTrue())
+		})
+
+		Context("when the job limits its container", func() {
+			BeforeEach(func() {
+				job.Container = jobs.ContainerOptions{
+					CPUs:                   1.5,
+					Memory:                 512 * 1024 * 1024,
+					PidsLimit:              100,
+					NetworkMode:            jobs.NetworkNone,
+					ReadOnlyRootFilesystem: true,
+					User:                   "1000:1000",
+					Privileged:             true,
+					Volumes:                []string{"/var/cache/woodhouse/../apt/:/var/cache/apt:ro"},
+				}
+			})
+
+			It("creates the container with the limits and security options", func() {
+				Eventually(exitStatus).Should(Receive(Equal(uint32(0))))
+				config := engine.Containers()[0].Config
+				Expect(config.User).To(Equal("1000:1000"))
+				Expect(config.HostConfig).To(Equal(runner.HostConfig{
+					Binds:          []string{"/var/cache/apt:/var/cache/apt:ro"},
+					NetworkMode:    "none",
+					NanoCPUs:       1500000000,
+					Memory:         512 * 1024 * 1024,
+					PidsLimit:      100,
+					ReadonlyRootfs: true,
+					Privileged:     true,
+				}))
+			})
+		})
+
+		Context("when the job sets environment variables", func() {
+			BeforeEach(func() {
+				job.Env = []string{"GOARCH=386"}
+			})
+
+			It("sets them in the container", func() {
+				Eventually(exitStatus).Should(Receive(Equal(uint32(0))))
+				Expect(engine.Containers()[0].Config.Env).To(Equal([]string{"GOARCH=386"}))
+			})
+		})
+
+		Context("and the job has a git repository", func() {
+			var repoDir string
+
+			BeforeEach(func() {
+				var err error
+				repoDir, err = ioutil.TempDir("", "docker-api-runner-unit-tests")
+				Expect(err).NotTo(HaveOccurred())
+				vcsFetcher.FetchReturns(repoDir, "some-revision", nil)
+				job.Repository = "some-repo"
+				job.Checkout = jobs.CheckoutOptions{Depth: 1, Submodules: jobs.SubmodulesNone}
+			})
+
+			It("mounts the checkout in the container as the working directory", func() {
+				Eventually(exitStatus).Should(Receive(Equal(uint32(0))))
+				config := engine.Containers()[0].Config
+				Expect(config.HostConfig.Binds).To(ConsistOf(repoDir + ":/woodhouse-workspace"))
+				Expect(config.WorkingDir).To(Equal("/woodhouse-workspace"))
+				fetched, _ := vcsFetcher.FetchArgsForCall(0)
+				Expect(fetched).To(Equal(jobs.Input{SourceType: job.SourceType, Repository: "some-repo", Checkout: job.Checkout}))
+			})
+
+			Context("when the build was triggered by a change", func() {
+				BeforeEach(func() {
+					job.ChangedSince = "last-revision"
+					job.Paths = jobs.PathFilter{Include: []string{"services/api/"}}
+				})
+
+				Context("and a file the path filters match changed", func() {
+					BeforeEach(func() {
+						vcsFetcher.ChangedFilesReturns([]string{"docs/api.md", "services/api/main.go"}, nil)
+					})
+
+					It("runs the build", func() {
+						Eventually(exitStatus).Should(Receive(Equal(uint32(0))))
+						_, checkoutDir, since, _ := vcsFetcher.ChangedFilesArgsForCall(0)
+						Expect(checkoutDir).To(Equal(repoDir))
+						Expect(since).To(Equal("last-revision"))
+					})
+				})
+
+				Context("and none of the changed files match the path filters", func() {
+					BeforeEach(func() {
+						vcsFetcher.ChangedFilesReturns([]string{"docs/api.md"}, nil)
+					})
+
+					It("skips the build", func() {
+						Eventually(exitStatus).Should(Receive(Equal(jobs.StatusSkipped)))
+						Expect(output).To(gbytes.Say("Skipping build: none of the 1 files changed since last-revision match the job's path filters"))
+						Expect(engine.Containers()).To(BeEmpty())
+					})
+				})
+
+				Context("and the changed files cannot be listed", func() {
+					BeforeEach(func() {
+						vcsFetcher.ChangedFilesReturns(nil, errors.New("shallow"))
+					})
+
+					It("runs the build anyway", func() {
+						Eventually(exitStatus).Should(Receive(Equal(uint32(0))))
+						Expect(output).To(gbytes.Say("Could not list the files changed since last-revision, so building anyway: shallow"))
+					})
+				})
+			})
+
+			Context("and other inputs", func() {
+				var libDir string
+
+				BeforeEach(func() {
+					var err error
+					libDir, err = ioutil.TempDir("", "docker-api-runner-unit-tests")
+					Expect(err).NotTo(HaveOccurred())
+					vcsFetcher.FetchStub = func(source jobs.Input, _ io.Writer) (string, string, error) {
+						if source.Name == "lib" {
+							return libDir, "lib-revision", nil
+						}
+						return repoDir, "some-revision", nil
+					}
+					job.Inputs = []jobs.Input{{Name: "lib", Repository: "lib-repo", Checkout: jobs.CheckoutOptions{Ref: "v1"}}}
+				})
+
+				It("mounts each input in a directory of the workspace", func() {
+					Eventually(exitStatus).Should(Receive(Equal(uint32(0))))
+					config := engine.Containers()[0].Config
+					Expect(config.HostConfig.Binds).To(ConsistOf(repoDir+":/woodhouse-workspace", libDir+":/woodhouse-workspace/lib"))
+					Expect(vcsFetcher.FetchCallCount()).To(Equal(2))
+					fetched, _ := vcsFetcher.FetchArgsForCall(1)
+					Expect(fetched).To(Equal(job.Inputs[0]))
+				})
+
+				It("removes every checkout", func() {
+					Eventually(func() bool {
+						_, err := os.Stat(libDir)
+						return os.IsNotExist(err)
+					}).Should(BeTrue())
+				})
+			})
+
+			Context("and caches", func() {
+				var cachesDir string
+
+				BeforeEach(func() {
+					var err error
+					cachesDir, err = ioutil.TempDir("", "docker-api-runner-caches")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(ioutil.WriteFile(filepath.Join(repoDir, "go.sum"), []byte("sums"), 0644)).To(Succeed())
+					outputDest = cacheOutput{Buffer: output, dir: cachesDir}
+					job.Caches = []jobs.Cache{
+						{Name: "go-modules", Path: "/go/pkg/mod", KeyFiles: []string{"go.sum"}},
+						{Name: "node-modules", Path: "node_modules"},
+					}
+				})
+
+				AfterEach(func() {
+					Expect(os.RemoveAll(cachesDir)).To(Succeed())
+				})
+
+				It("mounts each cache at its path, keyed by the contents of its key files", func() {
+					Eventually(exitStatus).Should(Receive(Equal(uint32(0))))
+					binds := engine.Containers()[0].Config.HostConfig.Binds
+					Expect(binds).To(HaveLen(3))
+					Expect(binds[1]).To(MatchRegexp(`^%s/go-modules/[0-9a-f]{16}:/go/pkg/mod$`, cachesDir))
+					Expect(binds[2]).To(Equal(filepath.Join(cachesDir, "node-modules", "default") + ":/woodhouse-workspace/node_modules"))
+					Expect(output).To(gbytes.Say("Using cache go-modules with key [0-9a-f]{16}"))
+					Expect(output).To(gbytes.Say("Using cache node-modules"))
+				})
+
+				Context("when the build output cannot keep caches", func() {
+					BeforeEach(func() {
+						outputDest = output
+					})
+
+					It("builds without them", func() {
+						Eventually(exitStatus).Should(Receive(Equal(uint32(0))))
+						Expect(engine.Containers()[0].Config.HostConfig.Binds).To(ConsistOf(repoDir + ":/woodhouse-workspace"))
+						Expect(output).To(gbytes.Say("Caches cannot be kept for this build"))
+					})
+				})
+			})
+
+			Context("and the job's image is built from a Dockerfile in it", func() {
+				BeforeEach(func() {
+					job.DockerImage = ""
+					job.Dockerfile = "ci/Dockerfile"
+					Expect(os.MkdirAll(filepath.Join(repoDir, "ci"), 0755)).To(Succeed())
+					Expect(os.MkdirAll(filepath.Join(repoDir, ".git"), 0755)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(repoDir, ".git", "HEAD"), []byte("ref: refs/heads/master"), 0644)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(repoDir, "go.mod"), []byte("module app"), 0644)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(repoDir, "ci", "Dockerfile"), []byte("FROM golang\nCOPY go.mod .\n"), 0644)).To(Succeed())
+				})
+
+				It("builds the image from the checkout, and runs the command in it", func() {
+					Eventually(exitStatus).Should(Receive(Equal(uint32(0))))
+					Expect(output).To(gbytes.Say(`Building image woodhouse/some-id:[0-9a-f]{16} from ci/Dockerfile`))
+					Expect(output).To(gbytes.Say(`Step 2/2 : COPY go.mod .`))
+
+					builds := engine.Builds()
+					Expect(builds).To(HaveLen(1))
+					Expect(builds[0].Dockerfile).To(Equal("ci/Dockerfile"))
+					Expect(builds[0].Files).To(ConsistOf("ci/", "ci/Dockerfile", "go.mod"))
+					Expect(builds[0].Labels).To(HaveKeyWithValue(runner.JobIDLabel, "some-id"))
+					Expect(engine.Containers()[0].Config.Image).To(Equal(builds[0].Tag))
+				})
+
+				It("tags the image after the contents of the Dockerfile", func() {
+					Eventually(exitStatus).Should(Receive(Equal(uint32(0))))
+
+					dockerfile := "FROM golang\nCOPY go.mod .\n"
+					vcsFetcher.FetchStub = func(jobs.Input, io.Writer) (string, string, error) {
+						checkoutDir, err := ioutil.TempDir("", "docker-api-runner-unit-tests")
+						Expect(err).NotTo(HaveOccurred())
+						Expect(os.MkdirAll(filepath.Join(checkoutDir, "ci"), 0755)).To(Succeed())
+						Expect(ioutil.WriteFile(filepath.Join(checkoutDir, "ci", "Dockerfile"), []byte(dockerfile), 0644)).To(Succeed())
+						return checkoutDir, "other-revision", nil
+					}
+					Expect(r.Run(ctx, job, gbytes.NewBuffer(), exitStatus)).To(Succeed())
+					Eventually(exitStatus).Should(Receive(Equal(uint32(0))))
+
+					dockerfile = "FROM golang:1.16\n"
+					Expect(r.Run(ctx, job, gbytes.NewBuffer(), exitStatus)).To(Succeed())
+					Eventually(exitStatus).Should(Receive(Equal(uint32(0))))
+
+					builds := engine.Builds()
+					Expect(builds).To(HaveLen(3))
+					Expect(builds[1].Tag).To(Equal(builds[0].Tag))
+					Expect(builds[2].Tag).NotTo(Equal(builds[0].Tag))
+				})
+
+				Context("when the image cannot be built", func() {
+					BeforeEach(func() {
+						Expect(ioutil.WriteFile(filepath.Join(repoDir, "ci", "Dockerfile"), []byte("FROM golang\nRUN false\n"), 0644)).To(Succeed())
+					})
+
+					It("reports that building failed", func() {
+						Eventually(exitStatus).Should(Receive(Equal(jobs.StatusImageBuildFailed)))
+						Expect(output).To(gbytes.Say("Error building image from ci/Dockerfile: .*returned a non-zero code: 1"))
+						Expect(engine.Containers()).To(BeEmpty())
+					})
+				})
+
+				Context("when the Dockerfile does not exist", func() {
+					BeforeEach(func() {
+						job.Dockerfile = "Dockerfile"
+					})
+
+					It("reports that building failed", func() {
+						Eventually(exitStatus).Should(Receive(Equal(jobs.StatusImageBuildFailed)))
+						Expect(output).To(gbytes.Say("Error reading Dockerfile Dockerfile: .*no such file or directory"))
+					})
+				})
+			})
+
+			It("removes the checkout", func() {
+				Eventually(func() bool {
+					_, err := os.Stat(repoDir)
+					return os.IsNotExist(err)
+				}).Should(BeTrue())
+			})
+
+			Context("when fetching fails", func() {
+				BeforeEach(func() {
+					vcsFetcher.FetchReturns(repoDir, "", errors.New("oops"))
+				})
+
+				It("reports that fetching failed", func() {
+					Eventually(exitStatus).Should(Receive(Equal(jobs.StatusFetchFailed)))
+					Expect(output).To(gbytes.Say("Error fetching some-repo: oops"))
+					Expect(engine.Containers()).To(BeEmpty())
+				})
+			})
+		})
+	})
+
+	Context("when the job has service containers", func() {
+		var healthy chan struct{}
+
+		BeforeEach(func() {
+			engine.Images = append(engine.Images, "postgres:13", "redis:latest")
+			r.HealthCheckInterval = time.Millisecond * 10
+			job.Services = []jobs.ServiceContainer{
+				{Name: "postgres", Image: "postgres:13", Env: []string{"POSTGRES_PASSWORD=woodhouse"}, HealthCheck: "pg_isready"},
+				{Name: "redis", Image: "redis"},
+			}
+
+			healthy = make(chan struct{})
+			engine.HealthStub = func(c fake_docker_engine.Container) string {
+				select {
+				case <-healthy:
+					return "healthy"
+				default:
+					return "starting"
+				}
+			}
+			engine.RunStub = func(c fake_docker_engine.Container, stdout io.Writer, stop <-chan struct{}) int {
+				if service, ok := c.Config.Labels[runner.ServiceLabel]; ok {
+					fmt.Fprintf(stdout, "%s is up\npartial line", service)
+					<-stop
+					return 0
+				}
+				fmt.Fprintln(stdout, "running tests")
+				return 0
+			}
+		})
+
+		containerOf := func(service string) fake_docker_engine.Container {
+			for _, c := range engine.Containers() {
+				if c.Config.Labels[runner.ServiceLabel] == service {
+					return c
+				}
+			}
+			Fail("no container for service " + service)
+			return fake_docker_engine.Container{}
+		}
+
+		It("starts them on a network of the build before the build's container", func() {
+			Eventually(output).Should(gbytes.Say("Waiting for service postgres to be healthy"))
+			Consistently(engine.Containers).Should(HaveLen(2))
+
+			close(healthy)
+			Eventually(exitStatus).Should(Receive(Equal(uint32(0))))
+			Expect(output).To(gbytes.Say("Service postgres is ready"))
+			Expect(output).To(gbytes.Say("Service redis is ready"))
+			Expect(output).To(gbytes.Say("running tests"))
+
+			networks := engine.Networks()
+			Expect(networks).To(HaveLen(1))
+			Expect(networks[0].Labels).To(HaveKeyWithValue(runner.ManagedLabel, "true"))
+
+			postgres := containerOf("postgres").Config
+			Expect(postgres.Image).To(Equal("postgres:13"))
+			Expect(postgres.Env).To(Equal([]string{"POSTGRES_PASSWORD=woodhouse"}))
+			Expect(postgres.Healthcheck.Test).To(Equal([]string{"CMD-SHELL", "pg_isready"}))
+			Expect(postgres.HostConfig.NetworkMode).To(Equal(networks[0].ID))
+			Expect(postgres.NetworkingConfig.EndpointsConfig).To(HaveKeyWithValue(networks[0].ID, runner.EndpointConfig{Aliases: []string{"postgres"}}))
+			Expect(containerOf("redis").Config.Healthcheck).To(BeNil())
+
+			build := engine.Containers()[2].Config
+			Expect(build.Image).To(Equal("busybox"))
+			Expect(build.HostConfig.NetworkMode).To(Equal(networks[0].ID))
+		})
+
+		Context("when the build's output keeps service logs", func() {
+			var logs map[string]*gbytes.Buffer
+
+			BeforeEach(func() {
+				logs = map[string]*gbytes.Buffer{"postgres": gbytes.NewBuffer(), "redis": gbytes.NewBuffer()}
+				outputDest = serviceLogOutput{Buffer: output, logs: logs}
+			})
+
+			It("keeps their logs apart from the build's output", func() {
+				close(healthy)
+				Eventually(output.Closed).Should(BeTrue())
+				Expect(logs["postgres"].Closed()).To(BeTrue())
+				Expect(logs["redis"].Closed()).To(BeTrue())
+				Expect(string(logs["postgres"].Contents())).To(Equal("postgres is up\npartial line"))
+				Expect(string(logs["redis"].Contents())).To(Equal("redis is up\npartial line"))
+				Expect(string(output.Contents())).NotTo(ContainSubstring("is up"))
+			})
+		})
+
+		It("writes their logs prefixed with their names when the build's output cannot keep them", func() {
+			close(healthy)
+			Eventually(output.Closed).Should(BeTrue())
+			Expect(string(output.Contents())).To(ContainSubstring("postgres | postgres is up\n"))
+			Expect(string(output.Contents())).To(ContainSubstring("redis | redis is up\n"))
+			Expect(string(output.Contents())).To(ContainSubstring("redis | partial line\n"))
+		})
+
+		It("removes them and their network after the build", func() {
+			close(healthy)
+			Eventually(output.Closed).Should(BeTrue())
+			for _, c := range engine.Containers() {
+				Expect(c.Removed).To(BeTrue())
+			}
+			Expect(engine.Networks()[0].Removed).To(BeTrue())
+		})
+
+		Context("when a service is unhealthy", func() {
+			BeforeEach(func() {
+				engine.HealthStub = func(c fake_docker_engine.Container) string {
+					return "unhealthy"
+				}
+			})
+
+			It("fails the build without running it, and cleans up", func() {
+				Eventually(exitStatus).Should(Receive(Equal(jobs.StatusContainerFailed)))
+				Expect(output).To(gbytes.Say("Service postgres is unhealthy"))
+				Eventually(output.Closed).Should(BeTrue())
+				Expect(engine.Containers()).To(HaveLen(2))
+				Expect(containerOf("redis").Removed).To(BeTrue())
+				Expect(engine.Networks()[0].Removed).To(BeTrue())
+			})
+		})
+
+		Context("when a service exits before it is ready", func() {
+			BeforeEach(func() {
+				engine.RunStub = func(c fake_docker_engine.Container, stdout io.Writer, stop <-chan struct{}) int {
+					return 3
+				}
+			})
+
+			It("fails the build", func() {
+				Eventually(exitStatus).Should(Receive(Equal(jobs.StatusContainerFailed)))
+				Expect(output).To(gbytes.Say("Service postgres exited with status 3 before it was ready"))
+			})
+		})
+
+		Context("when a service's image does not exist", func() {
+			BeforeEach(func() {
+				job.Services[1].Image = "redis:notarealthing"
+			})
+
+			It("reports that the image could not be pulled", func() {
+				Eventually(exitStatus).Should(Receive(Equal(jobs.StatusImagePullFailed)))
+				Expect(output).To(gbytes.Say("Pulling image redis:notarealthing for service redis"))
+				Expect(output).To(gbytes.Say("Error pulling image redis:notarealthing"))
+				Eventually(output.Closed).Should(BeTrue())
+				Expect(containerOf("postgres").Removed).To(BeTrue())
+			})
+		})
+
+		Context("when the build is cancelled while waiting for services", func() {
+			var cancel context.CancelFunc
+
+			BeforeEach(func() {
+				ctx, cancel = context.WithCancel(context.Background())
+			})
+
+			It("aborts the build and cleans up", func() {
+				Eventually(output).Should(gbytes.Say("Waiting for service postgres to be healthy"))
+				cancel()
+				Eventually(exitStatus).Should(Receive(Equal(jobs.StatusAborted)))
+				Eventually(output.Closed).Should(BeTrue())
+				Expect(engine.Containers()).To(HaveLen(2))
+				Expect(engine.Networks()[0].Removed).To(BeTrue())
+			})
+		})
+	})
+
+	Context("when the command returns non-zero exit status", func() {
+		BeforeEach(func() {
+			engine.RunStub = func(c fake_docker_engine.Container, stdout io.Writer, stop <-chan struct{}) int {
+				return 125
+			}
+		})
+
+		It("sends the status code", func() {
+			Eventually(exitStatus).Should(Receive(Equal(uint32(125))))
+		})
+	})
+
+	Context("when the docker image does not exist", func() {
+		BeforeEach(func() {
+			job.DockerImage = "WoodhouseOS:notarealthing"
+		})
+
+		It("reports that the image could not be pulled", func() {
+			Eventually(exitStatus).Should(Receive(Equal(jobs.StatusImagePullFailed)))
+			Expect(output).To(gbytes.Say("Error pulling image WoodhouseOS:notarealthing: .*manifest for WoodhouseOS:notarealthing not found"))
+			Expect(engine.Containers()).To(BeEmpty())
+		})
+	})
+
+	Context("when the docker engine cannot be reached", func() {
+		BeforeEach(func() {
+			engine.Close()
+		})
+
+		It("reports that the image could not be pulled", func() {
+			Eventually(exitStatus).Should(Receive(Equal(jobs.StatusImagePullFailed)))
+		})
+	})
+
+	Context("when the build is cancelled", func() {
+		var cancel context.CancelFunc
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+			engine.RunStub = func(c fake_docker_engine.Container, stdout io.Writer, stop <-chan struct{}) int {
+				fmt.Fprintln(stdout, "started")
+				<-stop
+				return 143
+			}
+		})
+
+		It("stops the container", func() {
+			Eventually(output).Should(gbytes.Say("started"))
+			cancel()
+			Eventually(exitStatus).Should(Receive(Equal(uint32(143))))
+			Expect(engine.Containers()[0].Stopped).To(BeTrue())
+			Expect(engine.Containers()[0].Removed).To(BeTrue())
+		})
+	})
+
+	Context("when the docker image is not specified", func() {
+		BeforeEach(func() {
+			job.DockerImage = ""
+		})
+
+		It("errors", func() {
+			Expect(runErr).To(MatchError("you need to specify a docker image or Dockerfile when using DockerAPIRunner"))
+		})
+	})
+
+	Context("when no arguments can be parsed", func() {
+		BeforeEach(func() {
+			job.Command = ""
+		})
+
+		It("returns error", func() {
+			Expect(runErr).To(MatchError("No arguments could be parsed from command: "))
+		})
+	})
+
+	Describe("removing leftover containers", func() {
+		It("removes only containers started by Woodhouse", func() {
+			leftover := engine.AddContainer(runner.ContainerConfig{Labels: map[string]string{runner.ManagedLabel: "true"}})
+			unrelated := engine.AddContainer(runner.ContainerConfig{Labels: map[string]string{"something": "else"}})
+
+			Eventually(exitStatus).Should(Receive())
+			Expect(r.RemoveContainers(context.Background())).To(Succeed())
+
+			removed := map[string]bool{}
+			for _, c := range engine.Containers() {
+				removed[c.ID] = c.Removed
+			}
+			Expect(removed).To(HaveKeyWithValue(leftover, true))
+			Expect(removed).To(HaveKeyWithValue(unrelated, false))
+		})
+
+		It("removes the networks of services started by Woodhouse", func() {
+			leftover := engine.AddNetwork("woodhouse-leftover", map[string]string{runner.ManagedLabel: "true"})
+			unrelated := engine.AddNetwork("unrelated", nil)
+
+			Eventually(exitStatus).Should(Receive())
+			Expect(r.RemoveContainers(context.Background())).To(Succeed())
+
+			removed := map[string]bool{}
+			for _, network := range engine.Networks() {
+				removed[network.ID] = network.Removed
+			}
+			Expect(removed).To(Equal(map[string]bool{leftover: true, unrelated: false}))
+		})
+	})
+})
+
+var _ = Describe("DockerClient", func() {
+	Describe("connecting over a unix socket", func() {
+		It("talks to the engine listening on the socket", func() {
+			socketDir, err := ioutil.TempDir("", "docker-client-unit-tests")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(socketDir)
+
+			socketPath := filepath.Join(socketDir, "docker.sock")
+			listener, err := net.Listen("unix", socketPath)
+			Expect(err).NotTo(HaveOccurred())
+			server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`[{"Id": "abc"}]`))
+			})}
+			go server.Serve(listener)
+			defer server.Close()
+
+			client, err := runner.NewDockerClient("unix://" + socketPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(client.ListContainers(context.Background(), "foo")).To(ConsistOf("abc"))
+		})
+	})
+
+	It("rejects unsupported hosts", func() {
+		_, err := runner.NewDockerClient("ftp://example.com")
+		Expect(err).To(MatchError("unsupported docker host ftp://example.com"))
+	})
+})
+
+// serviceLogOutput keeps the log of each service in a buffer of its own.
+type serviceLogOutput struct {
+	*gbytes.Buffer
+	logs map[string]*gbytes.Buffer
+}
+
+func (o serviceLogOutput) ServiceLog(name string) (io.WriteCloser, error) {
+	return o.logs[name], nil
+}
+
+// cacheOutput keeps caches in directories named after them and their key.
+type cacheOutput struct {
+	*gbytes.Buffer
+	dir string
+}
+
+func (o cacheOutput) CacheDir(cache jobs.Cache, key string) (string, error) {
+	if key == "" {
+		key = "default"
+	}
+	dir := filepath.Join(o.dir, cache.Name, key)
+	return dir, os.MkdirAll(dir, 0755)
+}
@@ -0,0 +1,424 @@
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DockerClient talks to the Docker Engine HTTP API. Only the small part of the
+// API that Woodhouse needs is implemented.
+type DockerClient struct {
+	HTTPClient *http.Client
+	BaseURL    string
+}
+
+// NewDockerClient creates a client for a Docker host given in the same format
+// as DOCKER_HOST, e.g. unix:///var/run/docker.sock or tcp://127.0.0.1:2375.
+func NewDockerClient(host string) (*DockerClient, error) {
+	hostURL, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("parsing docker host %s: %v", host, err)
+	}
+
+	switch hostURL.Scheme {
+	case "unix":
+		socketPath := hostURL.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socketPath)
+			},
+		}
+		return &DockerClient{HTTPClient: &http.Client{Transport: transport}, BaseURL: "http://docker"}, nil
+	case "tcp", "http":
+		return &DockerClient{HTTPClient: http.DefaultClient, BaseURL: "http://" + hostURL.Host}, nil
+	default:
+		return nil, fmt.Errorf("unsupported docker host %s", host)
+	}
+}
+
+type ContainerConfig struct {
+	Image            string
+	Cmd              []string          `json:",omitempty"`
+	Env              []string          `json:",omitempty"`
+	WorkingDir       string            `json:",omitempty"`
+	User             string            `json:",omitempty"`
+	Labels           map[string]string `json:",omitempty"`
+	Healthcheck      *HealthConfig     `json:",omitempty"`
+	HostConfig       HostConfig
+	NetworkingConfig *NetworkingConfig `json:",omitempty"`
+}
+
+type HostConfig struct {
+	Binds          []string `json:",omitempty"`
+	NetworkMode    string   `json:",omitempty"`
+	NanoCPUs       int64    `json:"NanoCpus,omitempty"`
+	Memory         int64    `json:",omitempty"`
+	PidsLimit      int64    `json:",omitempty"`
+	ReadonlyRootfs bool     `json:",omitempty"`
+	Privileged     bool     `json:",omitempty"`
+}
+
+// HealthConfig is how the Engine checks whether a container is healthy.
+// Durations are sent in nanoseconds, as the API expects.
+type HealthConfig struct {
+	Test        []string
+	Interval    time.Duration `json:",omitempty"`
+	Timeout     time.Duration `json:",omitempty"`
+	StartPeriod time.Duration `json:",omitempty"`
+	Retries     int           `json:",omitempty"`
+}
+
+type NetworkingConfig struct {
+	EndpointsConfig map[string]EndpointConfig
+}
+
+type EndpointConfig struct {
+	Aliases []string `json:",omitempty"`
+}
+
+// ContainerState is the part of an inspected container's state that Woodhouse
+// uses. Health is empty for containers without a health check.
+type ContainerState struct {
+	Running  bool
+	ExitCode int
+	Health   string
+}
+
+// DockerAPIError is returned when the Engine responds with an error.
+type DockerAPIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e DockerAPIError) Error() string {
+	return fmt.Sprintf("docker engine returned %d: %s", e.StatusCode, e.Message)
+}
+
+// PullImage pulls an image, writing one line of progress to progressSink for
+// every layer status change.
+func (c *DockerClient) PullImage(ctx context.Context, image string, progressSink io.Writer) error {
+	name, tag := splitImageTag(image)
+	query := url.Values{"fromImage": {name}, "tag": {tag}}
+	resp, err := c.do(ctx, "POST", "/images/create?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var msg struct {
+			ID       string `json:"id"`
+			Status   string `json:"status"`
+			Progress string `json:"progress"`
+			Error    string `json:"error"`
+		}
+		if err := decoder.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("reading image pull progress: %v", err)
+		}
+
+		if msg.Error != "" {
+			return DockerAPIError{StatusCode: resp.StatusCode, Message: msg.Error}
+		}
+		if msg.Progress != "" {
+			continue
+		}
+		if msg.ID != "" {
+			fmt.Fprintf(progressSink, "%s: %s\n", msg.ID, msg.Status)
+		} else {
+			fmt.Fprintln(progressSink, msg.Status)
+		}
+	}
+}
+
+// BuildImage builds an image from a Dockerfile in contextDir, which is sent to
+// the Engine as the build context, writing the build's output to progressSink.
+// The Engine reuses the layers of earlier builds where it can.
+func (c *DockerClient) BuildImage(ctx context.Context, contextDir, dockerfile, tag string, labels map[string]string, progressSink io.Writer) error {
+	encodedLabels, err := json.Marshal(labels)
+	if err != nil {
+		return err
+	}
+	query := url.Values{"t": {tag}, "dockerfile": {dockerfile}, "labels": {string(encodedLabels)}, "rm": {"1"}}
+
+	buildContext, contextWriter := io.Pipe()
+	go func() {
+		contextWriter.CloseWithError(writeTar(contextDir, contextWriter))
+	}()
+	defer buildContext.Close()
+
+	resp, err := c.send(ctx, "POST", "/build?"+query.Encode(), "application/x-tar", buildContext)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var msg struct {
+			Stream   string `json:"stream"`
+			ID       string `json:"id"`
+			Status   string `json:"status"`
+			Progress string `json:"progress"`
+			Error    string `json:"error"`
+		}
+		if err := decoder.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("reading image build output: %v", err)
+		}
+
+		switch {
+		case msg.Error != "":
+			return DockerAPIError{StatusCode: resp.StatusCode, Message: msg.Error}
+		case msg.Stream != "":
+			io.WriteString(progressSink, msg.Stream)
+		case msg.Progress != "" || msg.Status == "":
+		case msg.ID != "":
+			fmt.Fprintf(progressSink, "%s: %s\n", msg.ID, msg.Status)
+		default:
+			fmt.Fprintln(progressSink, msg.Status)
+		}
+	}
+}
+
+func (c *DockerClient) CreateContainer(ctx context.Context, name string, config ContainerConfig) (string, error) {
+	body, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.do(ctx, "POST", "/containers/create?"+url.Values{"name": {name}}.Encode(), body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return "", fmt.Errorf("decoding created container: %v", err)
+	}
+	return created.ID, nil
+}
+
+func (c *DockerClient) StartContainer(ctx context.Context, id string) error {
+	return c.discard(c.do(ctx, "POST", "/containers/"+id+"/start", nil))
+}
+
+func (c *DockerClient) StopContainer(ctx context.Context, id string) error {
+	return c.discard(c.do(ctx, "POST", "/containers/"+id+"/stop", nil))
+}
+
+func (c *DockerClient) RemoveContainer(ctx context.Context, id string) error {
+	return c.discard(c.do(ctx, "DELETE", "/containers/"+id+"?force=1&v=1", nil))
+}
+
+// WaitContainer blocks until the container exits, returning its exit code.
+func (c *DockerClient) WaitContainer(ctx context.Context, id string) (int, error) {
+	resp, err := c.do(ctx, "POST", "/containers/"+id+"/wait", nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		StatusCode int
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("decoding container exit status: %v", err)
+	}
+	return result.StatusCode, nil
+}
+
+// FollowLogs copies combined stdout and stderr of a container to outputSink
+// until the container exits.
+func (c *DockerClient) FollowLogs(ctx context.Context, id string, outputSink io.Writer) error {
+	resp, err := c.do(ctx, "GET", "/containers/"+id+"/logs?follow=1&stdout=1&stderr=1", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return demultiplex(resp.Body, outputSink)
+}
+
+func (c *DockerClient) InspectContainer(ctx context.Context, id string) (ContainerState, error) {
+	resp, err := c.do(ctx, "GET", "/containers/"+id+"/json", nil)
+	if err != nil {
+		return ContainerState{}, err
+	}
+	defer resp.Body.Close()
+
+	var inspected struct {
+		State struct {
+			Running  bool
+			ExitCode int
+			Health   *struct {
+				Status string
+			}
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&inspected); err != nil {
+		return ContainerState{}, fmt.Errorf("decoding container state: %v", err)
+	}
+
+	state := ContainerState{Running: inspected.State.Running, ExitCode: inspected.State.ExitCode}
+	if inspected.State.Health != nil {
+		state.Health = inspected.State.Health.Status
+	}
+	return state, nil
+}
+
+func (c *DockerClient) CreateNetwork(ctx context.Context, name string, labels map[string]string) (string, error) {
+	body, err := json.Marshal(map[string]interface{}{"Name": name, "Labels": labels, "CheckDuplicate": true})
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.do(ctx, "POST", "/networks/create", body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return "", fmt.Errorf("decoding created network: %v", err)
+	}
+	return created.ID, nil
+}
+
+func (c *DockerClient) RemoveNetwork(ctx context.Context, id string) error {
+	return c.discard(c.do(ctx, "DELETE", "/networks/"+id, nil))
+}
+
+// ListNetworks returns the IDs of all networks that have the given label.
+func (c *DockerClient) ListNetworks(ctx context.Context, label string) ([]string, error) {
+	return c.list(ctx, "/networks?", label, url.Values{})
+}
+
+// ListContainers returns the IDs of all containers, running or not, that have
+// the given label.
+func (c *DockerClient) ListContainers(ctx context.Context, label string) ([]string, error) {
+	return c.list(ctx, "/containers/json?", label, url.Values{"all": {"1"}})
+}
+
+func (c *DockerClient) list(ctx context.Context, path, label string, query url.Values) ([]string, error) {
+	filters, err := json.Marshal(map[string][]string{"label": {label}})
+	if err != nil {
+		return nil, err
+	}
+	query.Set("filters", string(filters))
+
+	resp, err := c.do(ctx, "GET", path+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var objects []struct {
+		ID string `json:"Id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&objects); err != nil {
+		return nil, fmt.Errorf("decoding list: %v", err)
+	}
+
+	ids := []string{}
+	for _, object := range objects {
+		ids = append(ids, object.ID)
+	}
+	return ids, nil
+}
+
+func (c *DockerClient) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	contentType := ""
+	if body != nil {
+		contentType = "application/json"
+	}
+	return c.send(ctx, method, path, contentType, bytes.NewReader(body))
+}
+
+func (c *DockerClient) send(ctx context.Context, method, path, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %v", method, path, err)
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		if err := json.Unmarshal(respBody, &apiErr); err != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(respBody))
+		}
+		return nil, DockerAPIError{StatusCode: resp.StatusCode, Message: apiErr.Message}
+	}
+
+	return resp, nil
+}
+
+func (c *DockerClient) discard(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Containers without a TTY have stdout and stderr multiplexed into frames, each
+// with an 8 byte header: stream type, 3 bytes padding, and big endian length.
+func demultiplex(stream io.Reader, outputSink io.Writer) error {
+	reader := bufio.NewReader(stream)
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(reader, header); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("reading log frame header: %v", err)
+		}
+
+		frameSize := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(outputSink, reader, frameSize); err != nil {
+			return fmt.Errorf("reading log frame: %v", err)
+		}
+	}
+}
+
+func splitImageTag(image string) (string, string) {
+	if strings.Contains(image, "@") {
+		return image, ""
+	}
+
+	lastColon := strings.LastIndex(image, ":")
+	if lastColon == -1 || strings.Contains(image[lastColon:], "/") {
+		return image, "latest"
+	}
+	return image[:lastColon], image[lastColon+1:]
+}
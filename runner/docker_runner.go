@@ -1,39 +1,53 @@
 package runner
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log"
-	"os"
 	"os/exec"
+	"path/filepath"
 	"syscall"
 
 	"github.com/craigfurman/woodhouse-ci/jobs"
+
+	"github.com/pborman/uuid"
 )
 
 //go:generate counterfeiter -o fake_vcs_fetcher/fake_vcs_fetcher.go . VcsFetcher
 type VcsFetcher interface {
-	Fetch(repository string, outputSink io.Writer) (string, error)
+	Fetch(source jobs.Input, outputSink io.Writer) (checkoutDir string, revision string, err error)
+	ChangedFiles(source jobs.Input, checkoutDir, since string, outputSink io.Writer) ([]string, error)
 }
 
+// DockerRunner runs jobs in containers using a docker compatible CLI.
 type DockerRunner struct {
 	DockerCmd  string
+	Runtime    ContainerRuntime
 	VcsFetcher VcsFetcher
 }
 
 func NewDockerRunner(vcsFetcher VcsFetcher) *DockerRunner {
-	return &DockerRunner{DockerCmd: "docker", VcsFetcher: vcsFetcher}
+	return &DockerRunner{DockerCmd: "docker", Runtime: DockerRuntime{}, VcsFetcher: vcsFetcher}
+}
+
+func NewPodmanRunner(vcsFetcher VcsFetcher) *DockerRunner {
+	return &DockerRunner{DockerCmd: "podman", Runtime: PodmanRuntime{}, VcsFetcher: vcsFetcher}
 }
 
-func (r *DockerRunner) Run(job jobs.Job, outputDest io.WriteCloser, status chan<- uint32) error {
+func (r *DockerRunner) Run(ctx context.Context, job jobs.Job, outputDest io.WriteCloser, status chan<- uint32) error {
 	commandToRun := Chunk(job.Command)
 	if len(commandToRun) == 0 {
 		return fmt.Errorf("No arguments could be parsed from command: %s", job.Command)
 	}
 
-	if job.DockerImage == "" {
-		return errors.New("you need to specify a docker image when using DockerRunner")
+	if job.DockerImage == "" && job.Dockerfile == "" {
+		return errors.New("you need to specify a docker image or Dockerfile when using DockerRunner")
+	}
+
+	if len(job.Services) > 0 {
+		return errors.New("service containers are not supported when using DockerRunner")
 	}
 
 	go func() {
@@ -43,33 +57,70 @@ func (r *DockerRunner) Run(job jobs.Job, outputDest io.WriteCloser, status chan<
 			}
 		}()
 
-		args := []string{"run", "--rm"}
+		containerName := "woodhouse-" + uuid.New()
+		args := []string{"run", "--rm", "--name", containerName}
 
-		if job.GitRepository != "" {
-			checkoutDir, err := r.VcsFetcher.Fetch(job.GitRepository, outputDest)
+		sources, err := fetchSources(r.VcsFetcher, job, outputDest)
+		defer sources.remove()
+		if skipped(err, job, outputDest) {
+			status <- jobs.StatusSkipped
+			return
+		}
+		if err != nil {
+			fmt.Fprintf(outputDest, "Error %v\n", err)
+			status <- jobs.StatusFetchFailed
+			return
+		}
 
-			defer func() {
-				if err := os.RemoveAll(checkoutDir); err != nil {
-					log.Printf("error removing checkout dir: %s, cause %v\n", checkoutDir, err)
-				}
-			}()
+		workspaceMounts := sources.mounts()
+		if mounts := append(workspaceMounts, cacheMounts(job, sources.dir, outputDest)...); len(mounts) > 0 {
+			args = append(args, r.Runtime.WorkspaceArgs(mounts)...)
+		}
+		if len(workspaceMounts) > 0 {
+			args = append(args, "--workdir", containerWorkspace)
+		}
 
-			if err != nil {
-				log.Printf("error fetching repository from vcs: cause: %v\n", err)
-				status <- uint32(1)
+		if ctx.Err() != nil {
+			status <- jobs.StatusAborted
+			return
+		}
+
+		image := job.DockerImage
+		if job.Dockerfile != "" {
+			var exitStatus uint32
+			if image, exitStatus = r.buildImage(ctx, job, sources.dir, outputDest); exitStatus != 0 {
+				status <- exitStatus
 				return
 			}
-
-			args = append(args, "-v", fmt.Sprintf("%s:/woodhouse-workspace", checkoutDir), "--workdir", "/woodhouse-workspace")
 		}
 
-		args = append(args, job.DockerImage)
+		args = append(args, containerOptionArgs(job.Container)...)
+		for _, variable := range job.Env {
+			args = append(args, "-e", variable)
+		}
+		args = append(args, image)
 		args = append(args, commandToRun...)
 		containerCmd := exec.Command(r.DockerCmd, args...)
 		containerCmd.Stdout = outputDest
 		containerCmd.Stderr = outputDest
 
-		if err := containerCmd.Run(); err != nil {
+		if err := containerCmd.Start(); err != nil {
+			log.Printf("error running job: %v", err)
+			status <- uint32(1)
+			return
+		}
+
+		finished := make(chan struct{})
+		defer close(finished)
+		go func() {
+			select {
+			case <-ctx.Done():
+				r.stopContainer(containerName)
+			case <-finished:
+			}
+		}()
+
+		if err := containerCmd.Wait(); err != nil {
 			if _, ok := err.(*exec.ExitError); !ok {
 				log.Printf("error running job: %v", err)
 				status <- uint32(1)
@@ -78,8 +129,45 @@ func (r *DockerRunner) Run(job jobs.Job, outputDest io.WriteCloser, status chan<
 		}
 
 		// yep...
-		status <- uint32(containerCmd.ProcessState.Sys().(syscall.WaitStatus).ExitStatus())
+		exitStatus := r.Runtime.ExitStatus(containerCmd.ProcessState.Sys().(syscall.WaitStatus).ExitStatus())
+		if exitStatus == 0 {
+			keepArtifacts(job, sources.dir, outputDest)
+		}
+		status <- exitStatus
 	}()
 
 	return nil
 }
+
+func (r *DockerRunner) buildImage(ctx context.Context, job jobs.Job, workspace string, outputDest io.Writer) (string, uint32) {
+	tag, err := dockerfileTag(job, workspace)
+	if err != nil {
+		fmt.Fprintf(outputDest, "Error reading Dockerfile %s: %v\n", job.Dockerfile, err)
+		return "", jobs.StatusImageBuildFailed
+	}
+
+	fmt.Fprintf(outputDest, "Building image %s from %s\n", tag, job.Dockerfile)
+	buildCmd := exec.CommandContext(ctx, r.DockerCmd, "build",
+		"--tag", tag,
+		"--label", ManagedLabel+"=true",
+		"--label", JobIDLabel+"="+job.ID,
+		"--file", filepath.Join(workspace, filepath.FromSlash(job.Dockerfile)),
+		workspace,
+	)
+	buildCmd.Stdout = outputDest
+	buildCmd.Stderr = outputDest
+	if err := buildCmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", jobs.StatusAborted
+		}
+		fmt.Fprintf(outputDest, "Error building image from %s: %v\n", job.Dockerfile, err)
+		return "", jobs.StatusImageBuildFailed
+	}
+	return tag, 0
+}
+
+func (r *DockerRunner) stopContainer(name string) {
+	if output, err := exec.Command(r.DockerCmd, "stop", name).CombinedOutput(); err != nil {
+		log.Printf("error stopping container %s: %v. Output: %s\n", name, err, output)
+	}
+}
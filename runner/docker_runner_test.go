@@ -1,6 +1,7 @@
 package runner_test
 
 import (
+	"context"
 	"errors"
 	"io/ioutil"
 	"os"
@@ -21,10 +22,11 @@ var _ = Describe("DockerRunner", func() {
 		r          *runner.DockerRunner
 		vcsFetcher *fake_vcs_fetcher.FakeVcsFetcher
 
-		cmd           string
-		rootFS        string
-		gitRepository string
+		cmd        string
+		rootFS     string
+		repository string
 
+		ctx        context.Context
 		runErr     error
 		output     *gbytes.Buffer
 		exitStatus chan uint32
@@ -35,23 +37,24 @@ var _ = Describe("DockerRunner", func() {
 		r = runner.NewDockerRunner(vcsFetcher)
 		output = gbytes.NewBuffer()
 		exitStatus = make(chan uint32, 1)
+		ctx = context.Background()
 	})
 
 	JustBeforeEach(func() {
 		job := jobs.Job{
-			ID:            "some-id",
-			Name:          "gob",
-			Command:       cmd,
-			DockerImage:   rootFS,
-			GitRepository: gitRepository,
+			ID:          "some-id",
+			Name:        "gob",
+			Command:     cmd,
+			DockerImage: rootFS,
+			Repository:  repository,
 		}
-		runErr = r.Run(job, output, exitStatus)
+		runErr = r.Run(ctx, job, output, exitStatus)
 		time.Sleep(time.Second * 2)
 	})
 
 	BeforeEach(func() {
 		rootFS = "busybox"
-		gitRepository = ""
+		repository = ""
 	})
 
 	Context("when the command succeeds", func() {
@@ -94,8 +97,8 @@ var _ = Describe("DockerRunner", func() {
 				Expect(err).NotTo(HaveOccurred())
 				Expect(f.Close()).To(Succeed())
 
-				vcsFetcher.FetchReturns(repoDir, nil)
-				gitRepository = "some-repo"
+				vcsFetcher.FetchReturns(repoDir, "some-revision", nil)
+				repository = "some-repo"
 				cmd = "cat test.txt"
 			})
 
@@ -112,21 +115,25 @@ var _ = Describe("DockerRunner", func() {
 
 			It("runs the job with the repo mounted in the container as cwd", func() {
 				Eventually(output).Should(gbytes.Say("hello from tests!"))
-				repo, _ := vcsFetcher.FetchArgsForCall(0)
-				Expect(repo).To(Equal("some-repo"))
+				source, _ := vcsFetcher.FetchArgsForCall(0)
+				Expect(source.Repository).To(Equal("some-repo"))
 			})
 
 			Context("when fetching fails", func() {
 				BeforeEach(func() {
-					vcsFetcher.FetchReturns(repoDir, errors.New("oops"))
+					vcsFetcher.FetchReturns(repoDir, "", errors.New("oops"))
 				})
 
 				It("does not error", func() {
 					Expect(runErr).NotTo(HaveOccurred())
 				})
 
-				It("sends exit status 1", func() {
-					Expect(<-exitStatus).To(Equal(uint32(1)))
+				It("writes the error to the output", func() {
+					Eventually(output).Should(gbytes.Say("Error fetching some-repo: oops"))
+				})
+
+				It("sends the fetch failed status", func() {
+					Expect(<-exitStatus).To(Equal(jobs.StatusFetchFailed))
 				})
 
 				itRemovesTheRepo()
@@ -160,6 +167,21 @@ var _ = Describe("DockerRunner", func() {
 		})
 	})
 
+	Context("when the build is cancelled", func() {
+		var cancel context.CancelFunc
+
+		BeforeEach(func() {
+			cmd = `sh -c "echo started && sleep 60"`
+			ctx, cancel = context.WithCancel(context.Background())
+		})
+
+		It("stops the container", func() {
+			Eventually(output).Should(gbytes.Say("started"))
+			cancel()
+			Eventually(exitStatus, "20s").Should(Receive(Not(Equal(uint32(0)))))
+		})
+	})
+
 	Context("when the docker image is not specified", func() {
 		BeforeEach(func() {
 			cmd = "echo hello"
@@ -167,7 +189,7 @@ var _ = Describe("DockerRunner", func() {
 		})
 
 		It("errors", func() {
-			Expect(runErr).To(MatchError("you need to specify a docker image when using DockerRunner"))
+			Expect(runErr).To(MatchError("you need to specify a docker image or Dockerfile when using DockerRunner"))
 		})
 	})
 
@@ -0,0 +1,102 @@
+package runner
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+)
+
+// buildImage builds the image the job runs in from its Dockerfile, with the
+// checkout of its repository as the build context.
+func (r *DockerAPIRunner) buildImage(ctx context.Context, job jobs.Job, workspace string, outputDest io.Writer) (string, uint32) {
+	tag, err := dockerfileTag(job, workspace)
+	if err != nil {
+		fmt.Fprintf(outputDest, "Error reading Dockerfile %s: %v\n", job.Dockerfile, err)
+		return "", jobs.StatusImageBuildFailed
+	}
+
+	fmt.Fprintf(outputDest, "Building image %s from %s\n", tag, job.Dockerfile)
+	labels := map[string]string{ManagedLabel: "true", JobIDLabel: job.ID}
+	if err := r.Client.BuildImage(ctx, workspace, filepath.ToSlash(job.Dockerfile), tag, labels, outputDest); err != nil {
+		if ctx.Err() != nil {
+			return "", jobs.StatusAborted
+		}
+		fmt.Fprintf(outputDest, "Error building image from %s: %v\n", job.Dockerfile, err)
+		return "", jobs.StatusImageBuildFailed
+	}
+	return tag, 0
+}
+
+// dockerfileTag names the image built from the job's Dockerfile after a hash
+// of its contents, so that builds of the same Dockerfile use the same tag.
+func dockerfileTag(job jobs.Job, workspace string) (string, error) {
+	if workspace == "" {
+		return "", fmt.Errorf("the job has no repository to find it in")
+	}
+	contents, err := ioutil.ReadFile(filepath.Join(workspace, filepath.FromSlash(job.Dockerfile)))
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(contents)
+	return fmt.Sprintf("woodhouse/%s:%s", strings.ToLower(job.ID), hex.EncodeToString(hash[:])[:16]), nil
+}
+
+// writeTar archives the contents of dir, other than the .git directory, as a
+// build context.
+func writeTar(dir string, w io.Writer) error {
+	archive := tar.NewWriter(w)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil || name == "." {
+			return err
+		}
+		if info.IsDir() && name == ".git" {
+			return filepath.SkipDir
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(archive, f)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("archiving build context: %v", err)
+	}
+	return archive.Close()
+}
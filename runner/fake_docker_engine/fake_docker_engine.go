@@ -0,0 +1,521 @@
+// Package fake_docker_engine is an in-memory imitation of the Docker Engine
+// HTTP API, for testing code that uses runner.DockerClient.
+package fake_docker_engine
+
+import (
+	"archive/tar"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/craigfurman/woodhouse-ci/runner"
+
+	"github.com/gorilla/mux"
+	"github.com/pborman/uuid"
+)
+
+type Container struct {
+	ID      string
+	Name    string
+	Config  runner.ContainerConfig
+	Started bool
+	Stopped bool
+	Removed bool
+}
+
+type ImageBuild struct {
+	Tag        string
+	Dockerfile string
+	Labels     map[string]string
+
+	// Paths of everything in the build context
+	Files []string
+}
+
+type Network struct {
+	ID      string
+	Name    string
+	Labels  map[string]string
+	Removed bool
+}
+
+type container struct {
+	Container
+
+	exitCode   int
+	exited     chan struct{}
+	stop       chan struct{}
+	stopOnce   sync.Once
+	logsReader *io.PipeReader
+	logsWriter *io.PipeWriter
+}
+
+type FakeEngine struct {
+	*httptest.Server
+
+	// Images that can be pulled, e.g. "busybox:latest"
+	Images []string
+
+	// Called when a container is started, to simulate the container's process.
+	// Anything written to stdout appears in the container's logs. The stop
+	// channel is closed when the container is asked to stop.
+	RunStub func(container Container, stdout io.Writer, stop <-chan struct{}) int
+
+	// Called when a running container with a health check is inspected, to
+	// give its health, e.g. "starting". Without it, such containers are
+	// healthy.
+	HealthStub func(container Container) string
+
+	mutex      sync.Mutex
+	pulled     map[string]bool
+	containers map[string]*container
+	order      []string
+	networks   []*Network
+	builds     []ImageBuild
+}
+
+func New() *FakeEngine {
+	engine := &FakeEngine{
+		pulled:     make(map[string]bool),
+		containers: make(map[string]*container),
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/images/create", engine.pullImage).Methods("POST")
+	router.HandleFunc("/build", engine.buildImage).Methods("POST")
+	router.HandleFunc("/containers/json", engine.listContainers).Methods("GET")
+	router.HandleFunc("/containers/create", engine.createContainer).Methods("POST")
+	router.HandleFunc("/containers/{id}/start", engine.startContainer).Methods("POST")
+	router.HandleFunc("/containers/{id}/stop", engine.stopContainer).Methods("POST")
+	router.HandleFunc("/containers/{id}/wait", engine.waitContainer).Methods("POST")
+	router.HandleFunc("/containers/{id}/logs", engine.containerLogs).Methods("GET")
+	router.HandleFunc("/containers/{id}/json", engine.inspectContainer).Methods("GET")
+	router.HandleFunc("/containers/{id}", engine.removeContainer).Methods("DELETE")
+	router.HandleFunc("/networks", engine.listNetworks).Methods("GET")
+	router.HandleFunc("/networks/create", engine.createNetwork).Methods("POST")
+	router.HandleFunc("/networks/{id}", engine.removeNetwork).Methods("DELETE")
+
+	engine.Server = httptest.NewServer(router)
+	return engine
+}
+
+// Containers returns all containers ever created, in order of creation.
+func (e *FakeEngine) Containers() []Container {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	containers := []Container{}
+	for _, id := range e.order {
+		containers = append(containers, e.containers[id].Container)
+	}
+	return containers
+}
+
+// Builds returns every image build, in order.
+func (e *FakeEngine) Builds() []ImageBuild {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return append([]ImageBuild{}, e.builds...)
+}
+
+// Networks returns all networks ever created, in order of creation.
+func (e *FakeEngine) Networks() []Network {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	networks := []Network{}
+	for _, network := range e.networks {
+		networks = append(networks, *network)
+	}
+	return networks
+}
+
+// AddNetwork simulates a network that already exists.
+func (e *FakeEngine) AddNetwork(name string, labels map[string]string) string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.addNetwork(name, labels).ID
+}
+
+func (e *FakeEngine) addNetwork(name string, labels map[string]string) *Network {
+	network := &Network{ID: strings.Replace(uuid.New(), "-", "", -1), Name: name, Labels: labels}
+	e.networks = append(e.networks, network)
+	return network
+}
+
+// AddContainer simulates a container that already exists, e.g. one left
+// behind by an earlier run of Woodhouse.
+func (e *FakeEngine) AddContainer(config runner.ContainerConfig) string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.addContainer("", config).ID
+}
+
+func (e *FakeEngine) addContainer(name string, config runner.ContainerConfig) *container {
+	logsReader, logsWriter := io.Pipe()
+	c := &container{
+		Container: Container{
+			ID:     strings.Replace(uuid.New(), "-", "", -1),
+			Name:   name,
+			Config: config,
+		},
+		exited:     make(chan struct{}),
+		stop:       make(chan struct{}),
+		logsReader: logsReader,
+		logsWriter: logsWriter,
+	}
+	e.containers[c.ID] = c
+	e.order = append(e.order, c.ID)
+	return c
+}
+
+func (e *FakeEngine) pullImage(w http.ResponseWriter, r *http.Request) {
+	image := r.URL.Query().Get("fromImage")
+	tag := r.URL.Query().Get("tag")
+	reference := image + ":" + tag
+
+	encoder := json.NewEncoder(w)
+	for _, available := range e.Images {
+		if available == reference {
+			e.mutex.Lock()
+			e.pulled[reference] = true
+			e.mutex.Unlock()
+
+			encoder.Encode(map[string]string{"status": "Pulling from " + image, "id": tag})
+			encoder.Encode(map[string]string{"status": "Downloading", "progress": "[==>   ]", "id": "8ddc19f16526"})
+			encoder.Encode(map[string]string{"status": "Pull complete", "id": "8ddc19f16526"})
+			encoder.Encode(map[string]string{"status": "Status: Downloaded newer image for " + reference})
+			return
+		}
+	}
+
+	encoder.Encode(map[string]string{"status": "Pulling from " + image, "id": tag})
+	encoder.Encode(map[string]string{"error": fmt.Sprintf("manifest for %s not found", reference)})
+}
+
+// buildImage pretends to run each instruction of the Dockerfile. Instructions
+// running "false" fail.
+func (e *FakeEngine) buildImage(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	build := ImageBuild{Tag: query.Get("t"), Dockerfile: query.Get("dockerfile")}
+	if err := json.Unmarshal([]byte(query.Get("labels")), &build.Labels); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var dockerfile []byte
+	buildContext := tar.NewReader(r.Body)
+	for {
+		header, err := buildContext.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		build.Files = append(build.Files, header.Name)
+		if header.Name == build.Dockerfile {
+			if dockerfile, err = ioutil.ReadAll(buildContext); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	e.mutex.Lock()
+	e.builds = append(e.builds, build)
+	e.mutex.Unlock()
+
+	encoder := json.NewEncoder(w)
+	if dockerfile == nil {
+		encoder.Encode(map[string]string{"error": "Cannot locate specified Dockerfile: " + build.Dockerfile})
+		return
+	}
+	instructions := strings.Split(strings.TrimSpace(string(dockerfile)), "\n")
+	for i, instruction := range instructions {
+		encoder.Encode(map[string]string{"stream": fmt.Sprintf("Step %d/%d : %s\n", i+1, len(instructions), instruction)})
+		if strings.HasSuffix(instruction, " false") {
+			encoder.Encode(map[string]string{"error": "The command '/bin/sh -c false' returned a non-zero code: 1"})
+			return
+		}
+	}
+	encoder.Encode(map[string]string{"stream": "Successfully tagged " + build.Tag + "\n"})
+
+	e.mutex.Lock()
+	e.pulled[build.Tag] = true
+	e.mutex.Unlock()
+}
+
+func (e *FakeEngine) listContainers(w http.ResponseWriter, r *http.Request) {
+	var filters map[string][]string
+	if err := json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	type summary struct {
+		ID string `json:"Id"`
+	}
+	list := []summary{}
+	for _, id := range e.order {
+		c := e.containers[id]
+		if !c.Removed && hasLabels(c.Config.Labels, filters["label"]) {
+			list = append(list, summary{ID: c.ID})
+		}
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+func (e *FakeEngine) createContainer(w http.ResponseWriter, r *http.Request) {
+	var config runner.ContainerConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	image, tag := config.Image, "latest"
+	if strings.Contains(image, ":") {
+		tag = image[strings.LastIndex(image, ":")+1:]
+		image = image[:strings.LastIndex(image, ":")]
+	}
+	if !e.pulled[image+":"+tag] {
+		writeError(w, http.StatusNotFound, "No such image: "+config.Image)
+		return
+	}
+
+	c := e.addContainer(r.URL.Query().Get("name"), config)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"Id": c.ID})
+}
+
+func (e *FakeEngine) startContainer(w http.ResponseWriter, r *http.Request) {
+	c, ok := e.find(w, r)
+	if !ok {
+		return
+	}
+
+	e.mutex.Lock()
+	c.Started = true
+	snapshot := c.Container
+	e.mutex.Unlock()
+
+	go func() {
+		exitCode := 0
+		if e.RunStub != nil {
+			exitCode = e.RunStub(snapshot, frameWriter{c.logsWriter}, c.stop)
+		}
+		e.mutex.Lock()
+		c.exitCode = exitCode
+		e.mutex.Unlock()
+		c.logsWriter.Close()
+		close(c.exited)
+	}()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (e *FakeEngine) stopContainer(w http.ResponseWriter, r *http.Request) {
+	c, ok := e.find(w, r)
+	if !ok {
+		return
+	}
+
+	e.mutex.Lock()
+	c.Stopped = true
+	e.mutex.Unlock()
+	c.stopOnce.Do(func() { close(c.stop) })
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (e *FakeEngine) waitContainer(w http.ResponseWriter, r *http.Request) {
+	c, ok := e.find(w, r)
+	if !ok {
+		return
+	}
+
+	<-c.exited
+	e.mutex.Lock()
+	exitCode := c.exitCode
+	e.mutex.Unlock()
+	json.NewEncoder(w).Encode(map[string]int{"StatusCode": exitCode})
+}
+
+func (e *FakeEngine) containerLogs(w http.ResponseWriter, r *http.Request) {
+	c, ok := e.find(w, r)
+	if !ok {
+		return
+	}
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := c.logsReader.Read(buf)
+		if n > 0 {
+			w.Write(buf[:n])
+			w.(http.Flusher).Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (e *FakeEngine) inspectContainer(w http.ResponseWriter, r *http.Request) {
+	c, ok := e.find(w, r)
+	if !ok {
+		return
+	}
+
+	e.mutex.Lock()
+	running := c.Started
+	select {
+	case <-c.exited:
+		running = false
+	default:
+	}
+	state := map[string]interface{}{"Running": running, "ExitCode": c.exitCode}
+	snapshot := c.Container
+	e.mutex.Unlock()
+
+	if running && snapshot.Config.Healthcheck != nil {
+		health := "healthy"
+		if e.HealthStub != nil {
+			health = e.HealthStub(snapshot)
+		}
+		state["Health"] = map[string]string{"Status": health}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"Id": snapshot.ID, "State": state})
+}
+
+func (e *FakeEngine) removeContainer(w http.ResponseWriter, r *http.Request) {
+	c, ok := e.find(w, r)
+	if !ok {
+		return
+	}
+
+	e.mutex.Lock()
+	c.Removed = true
+	e.mutex.Unlock()
+	c.stopOnce.Do(func() { close(c.stop) })
+	c.logsReader.Close()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (e *FakeEngine) listNetworks(w http.ResponseWriter, r *http.Request) {
+	var filters map[string][]string
+	if err := json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	type summary struct {
+		ID string `json:"Id"`
+	}
+	list := []summary{}
+	for _, network := range e.networks {
+		if !network.Removed && hasLabels(network.Labels, filters["label"]) {
+			list = append(list, summary{ID: network.ID})
+		}
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+func (e *FakeEngine) createNetwork(w http.ResponseWriter, r *http.Request) {
+	var config struct {
+		Name   string
+		Labels map[string]string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	network := e.addNetwork(config.Name, config.Labels)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"Id": network.ID})
+}
+
+func (e *FakeEngine) removeNetwork(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for _, network := range e.networks {
+		if network.ID != id || network.Removed {
+			continue
+		}
+		for _, c := range e.containers {
+			if !c.Removed && c.Config.HostConfig.NetworkMode == id {
+				writeError(w, http.StatusForbidden, fmt.Sprintf("error while removing network: network %s has active endpoints", network.Name))
+				return
+			}
+		}
+		network.Removed = true
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeError(w, http.StatusNotFound, "network "+id+" not found")
+}
+
+func (e *FakeEngine) find(w http.ResponseWriter, r *http.Request) (*container, bool) {
+	id := mux.Vars(r)["id"]
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	c, ok := e.containers[id]
+	if !ok || c.Removed {
+		writeError(w, http.StatusNotFound, "No such container: "+id)
+		return nil, false
+	}
+	return c, true
+}
+
+func hasLabels(labels map[string]string, filters []string) bool {
+	for _, filter := range filters {
+		parts := strings.SplitN(filter, "=", 2)
+		value, ok := labels[parts[0]]
+		if !ok || (len(parts) == 2 && value != parts[1]) {
+			return false
+		}
+	}
+	return true
+}
+
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// Writes everything as stdout frames of the multiplexed log stream
+type frameWriter struct {
+	w io.Writer
+}
+
+func (f frameWriter) Write(p []byte) (int, error) {
+	header := make([]byte, 8)
+	header[0] = 1
+	binary.BigEndian.PutUint32(header[4:], uint32(len(p)))
+	if _, err := f.w.Write(append(header, p...)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -5,33 +5,47 @@ import (
 	"io"
 	"sync"
 
+	"github.com/craigfurman/woodhouse-ci/jobs"
 	"github.com/craigfurman/woodhouse-ci/runner"
 )
 
 type FakeVcsFetcher struct {
-	FetchStub        func(repository string, outputSink io.Writer) (string, error)
+	FetchStub        func(source jobs.Input, outputSink io.Writer) (string, string, error)
 	fetchMutex       sync.RWMutex
 	fetchArgsForCall []struct {
-		repository string
+		source     jobs.Input
 		outputSink io.Writer
 	}
 	fetchReturns struct {
 		result1 string
+		result2 string
+		result3 error
+	}
+	ChangedFilesStub        func(source jobs.Input, checkoutDir string, since string, outputSink io.Writer) ([]string, error)
+	changedFilesMutex       sync.RWMutex
+	changedFilesArgsForCall []struct {
+		source      jobs.Input
+		checkoutDir string
+		since       string
+		outputSink  io.Writer
+	}
+	changedFilesReturns struct {
+		result1 []string
 		result2 error
 	}
 }
 
-func (fake *FakeVcsFetcher) Fetch(repository string, outputSink io.Writer) (string, error) {
+func (fake *FakeVcsFetcher) Fetch(source jobs.Input, outputSink io.Writer) (string, string, error) {
 	fake.fetchMutex.Lock()
 	fake.fetchArgsForCall = append(fake.fetchArgsForCall, struct {
-		repository string
+		source     jobs.Input
 		outputSink io.Writer
-	}{repository, outputSink})
+	}{source, outputSink})
 	fake.fetchMutex.Unlock()
 	if fake.FetchStub != nil {
-		return fake.FetchStub(repository, outputSink)
+		return fake.FetchStub(source, outputSink)
 	} else {
-		return fake.fetchReturns.result1, fake.fetchReturns.result2
+		return fake.fetchReturns.result1, fake.fetchReturns.result2, fake.fetchReturns.result3
 	}
 }
 
@@ -41,16 +55,53 @@ func (fake *FakeVcsFetcher) FetchCallCount() int {
 	return len(fake.fetchArgsForCall)
 }
 
-func (fake *FakeVcsFetcher) FetchArgsForCall(i int) (string, io.Writer) {
+func (fake *FakeVcsFetcher) FetchArgsForCall(i int) (jobs.Input, io.Writer) {
 	fake.fetchMutex.RLock()
 	defer fake.fetchMutex.RUnlock()
-	return fake.fetchArgsForCall[i].repository, fake.fetchArgsForCall[i].outputSink
+	return fake.fetchArgsForCall[i].source, fake.fetchArgsForCall[i].outputSink
 }
 
-func (fake *FakeVcsFetcher) FetchReturns(result1 string, result2 error) {
+func (fake *FakeVcsFetcher) FetchReturns(result1 string, result2 string, result3 error) {
 	fake.FetchStub = nil
 	fake.fetchReturns = struct {
 		result1 string
+		result2 string
+		result3 error
+	}{result1, result2, result3}
+}
+
+func (fake *FakeVcsFetcher) ChangedFiles(source jobs.Input, checkoutDir string, since string, outputSink io.Writer) ([]string, error) {
+	fake.changedFilesMutex.Lock()
+	fake.changedFilesArgsForCall = append(fake.changedFilesArgsForCall, struct {
+		source      jobs.Input
+		checkoutDir string
+		since       string
+		outputSink  io.Writer
+	}{source, checkoutDir, since, outputSink})
+	fake.changedFilesMutex.Unlock()
+	if fake.ChangedFilesStub != nil {
+		return fake.ChangedFilesStub(source, checkoutDir, since, outputSink)
+	} else {
+		return fake.changedFilesReturns.result1, fake.changedFilesReturns.result2
+	}
+}
+
+func (fake *FakeVcsFetcher) ChangedFilesCallCount() int {
+	fake.changedFilesMutex.RLock()
+	defer fake.changedFilesMutex.RUnlock()
+	return len(fake.changedFilesArgsForCall)
+}
+
+func (fake *FakeVcsFetcher) ChangedFilesArgsForCall(i int) (jobs.Input, string, string, io.Writer) {
+	fake.changedFilesMutex.RLock()
+	defer fake.changedFilesMutex.RUnlock()
+	return fake.changedFilesArgsForCall[i].source, fake.changedFilesArgsForCall[i].checkoutDir, fake.changedFilesArgsForCall[i].since, fake.changedFilesArgsForCall[i].outputSink
+}
+
+func (fake *FakeVcsFetcher) ChangedFilesReturns(result1 []string, result2 error) {
+	fake.ChangedFilesStub = nil
+	fake.changedFilesReturns = struct {
+		result1 []string
 		result2 error
 	}{result1, result2}
 }
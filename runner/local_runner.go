@@ -0,0 +1,176 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+)
+
+// LocalRunner runs jobs as processes on the Woodhouse host, in the checked out
+// workspace. Nothing isolates them from the host, so only use it for trusted
+// jobs.
+type LocalRunner struct {
+	VcsFetcher VcsFetcher
+
+	// Environment variables given to every job. Nothing is inherited from
+	// Woodhouse's own environment. HOME and WOODHOUSE_* are always set.
+	Env []string
+
+	// Jobs running for longer than this are killed. Zero means no limit.
+	Timeout time.Duration
+
+	// How long a job's processes have to exit after being asked to stop,
+	// before they are killed.
+	KillGracePeriod time.Duration
+}
+
+func NewLocalRunner(vcsFetcher VcsFetcher, timeout time.Duration) *LocalRunner {
+	return &LocalRunner{
+		VcsFetcher:      vcsFetcher,
+		Env:             []string{"PATH=" + os.Getenv("PATH")},
+		Timeout:         timeout,
+		KillGracePeriod: time.Second * 10,
+	}
+}
+
+func (r *LocalRunner) Run(ctx context.Context, job jobs.Job, outputDest io.WriteCloser, status chan<- uint32) error {
+	commandToRun := Chunk(job.Command)
+	if len(commandToRun) == 0 {
+		return fmt.Errorf("No arguments could be parsed from command: %s", job.Command)
+	}
+
+	if len(job.Services) > 0 {
+		return errors.New("service containers are not supported when using LocalRunner")
+	}
+
+	go func() {
+		defer func() {
+			if err := outputDest.Close(); err != nil {
+				log.Printf("error closing command output: %v", err)
+			}
+		}()
+
+		status <- r.run(ctx, job, commandToRun, outputDest)
+	}()
+
+	return nil
+}
+
+func (r *LocalRunner) run(ctx context.Context, job jobs.Job, commandToRun []string, outputDest io.Writer) uint32 {
+	sources, err := r.prepareWorkspace(job, outputDest)
+	defer sources.remove()
+	workspace := sources.dir
+
+	if skipped(err, job, outputDest) {
+		return jobs.StatusSkipped
+	}
+	if err != nil {
+		fmt.Fprintf(outputDest, "Error preparing workspace: %v\n", err)
+		return jobs.StatusFetchFailed
+	}
+
+	if ctx.Err() != nil {
+		return jobs.StatusAborted
+	}
+
+	cmd := exec.Command(commandToRun[0], commandToRun[1:]...)
+	cmd.Dir = workspace
+	cmd.Env = append([]string{
+		"HOME=" + workspace,
+		"WOODHOUSE_JOB_ID=" + job.ID,
+		"WOODHOUSE_JOB_NAME=" + job.Name,
+		"WOODHOUSE_REVISION=" + sources.revision,
+	}, r.Env...)
+	cmd.Env = append(cmd.Env, job.Env...)
+	cmd.Stdout = outputDest
+	cmd.Stderr = outputDest
+
+	if err := startInProcessGroup(cmd); err != nil {
+		fmt.Fprintf(outputDest, "Error starting command: %v\n", err)
+		return uint32(1)
+	}
+
+	runCtx := ctx
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-runCtx.Done():
+		case <-finished:
+			return
+		}
+
+		if err := signalProcessGroup(cmd, false); err != nil {
+			log.Printf("error stopping job %s: %v\n", job.ID, err)
+		}
+		select {
+		case <-time.After(r.KillGracePeriod):
+			if err := signalProcessGroup(cmd, true); err != nil {
+				log.Printf("error killing job %s: %v\n", job.ID, err)
+			}
+		case <-finished:
+		}
+	}()
+
+	if err := cmd.Wait(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			log.Printf("error running job: %v", err)
+			return uint32(1)
+		}
+	}
+
+	if runCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		fmt.Fprintf(outputDest, "Timed out after %s\n", r.Timeout)
+		return jobs.StatusTimedOut
+	}
+
+	status := exitStatus(cmd.ProcessState)
+	if status == 0 {
+		keepArtifacts(job, workspace, outputDest)
+	}
+	return status
+}
+
+// prepareWorkspace fetches the job's sources, moving each input into a
+// directory of the workspace named after it.
+func (r *LocalRunner) prepareWorkspace(job jobs.Job, outputDest io.Writer) (fetchedSources, error) {
+	sources, err := fetchSources(r.VcsFetcher, job, outputDest)
+	if err != nil {
+		return sources, err
+	}
+
+	if sources.dir == "" {
+		if sources.dir, err = ioutil.TempDir("", "woodhouse-workspace"); err != nil {
+			return sources, err
+		}
+	}
+
+	for _, input := range sources.inputs {
+		dest := filepath.Join(sources.dir, input.name)
+		if _, err := os.Lstat(dest); err == nil {
+			return sources, fmt.Errorf("input %s would replace %s in the checkout", input.name, dest)
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return sources, err
+		}
+		if err := os.Rename(input.dir, dest); err != nil {
+			return sources, fmt.Errorf("moving input %s into the workspace. Cause: %v", input.name, err)
+		}
+	}
+	return sources, nil
+}
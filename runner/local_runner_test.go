@@ -0,0 +1,353 @@
+package runner_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+	"github.com/craigfurman/woodhouse-ci/runner"
+	"github.com/craigfurman/woodhouse-ci/runner/fake_vcs_fetcher"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("LocalRunner", func() {
+	var (
+		r          *runner.LocalRunner
+		vcsFetcher *fake_vcs_fetcher.FakeVcsFetcher
+
+		job        jobs.Job
+		ctx        context.Context
+		runErr     error
+		output     *gbytes.Buffer
+		outputDest io.WriteCloser
+		exitStatus chan uint32
+	)
+
+	BeforeEach(func() {
+		vcsFetcher = new(fake_vcs_fetcher.FakeVcsFetcher)
+		r = runner.NewLocalRunner(vcsFetcher, 0)
+		job = jobs.Job{ID: "some-id", Name: "lint", RunnerType: jobs.RunnerLocal}
+		ctx = context.Background()
+		output = gbytes.NewBuffer()
+		outputDest = output
+		exitStatus = make(chan uint32, 1)
+	})
+
+	JustBeforeEach(func() {
+		runErr = r.Run(ctx, job, outputDest, exitStatus)
+	})
+
+	Context("when the command succeeds", func() {
+		BeforeEach(func() {
+			job.Command = `sh -c "echo hello && echo world >&2"`
+		})
+
+		It("does not error", func() {
+			Expect(runErr).NotTo(HaveOccurred())
+		})
+
+		It("asynchronously writes combined stdout and stderr", func() {
+			Eventually(output).Should(gbytes.Say("hello\nworld"))
+		})
+
+		It("sends the status code", func() {
+			Eventually(exitStatus).Should(Receive(Equal(uint32(0))))
+		})
+
+		It("closes the output writer", func() {
+			Eventually(output.Closed).Should(BeTrue())
+		})
+
+		Context("and the job has a git repository", func() {
+			var repoDir string
+
+			BeforeEach(func() {
+				var err error
+				repoDir, err = ioutil.TempDir("", "local-runner-unit-tests")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ioutil.WriteFile(filepath.Join(repoDir, "test.txt"), []byte("hello from tests!"), 0644)).To(Succeed())
+
+				vcsFetcher.FetchReturns(repoDir, "some-revision", nil)
+				job.Repository = "some-repo"
+				job.Command = "cat test.txt"
+			})
+
+			It("runs the command in the checkout", func() {
+				Eventually(output).Should(gbytes.Say("hello from tests!"))
+			})
+
+			Context("when the command needs the revision", func() {
+				BeforeEach(func() {
+					job.Command = `sh -c "echo revision $WOODHOUSE_REVISION"`
+				})
+
+				It("is in the environment", func() {
+					Eventually(output).Should(gbytes.Say("revision some-revision"))
+				})
+			})
+
+			It("removes the checkout", func() {
+				Eventually(func() bool {
+					_, err := os.Stat(repoDir)
+					return os.IsNotExist(err)
+				}).Should(BeTrue())
+			})
+
+			Context("and other inputs", func() {
+				var libDir string
+
+				BeforeEach(func() {
+					var err error
+					libDir, err = ioutil.TempDir("", "local-runner-unit-tests")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(ioutil.WriteFile(filepath.Join(libDir, "lib.txt"), []byte("hello from lib!"), 0644)).To(Succeed())
+
+					vcsFetcher.FetchStub = func(source jobs.Input, _ io.Writer) (string, string, error) {
+						if source.Name == "lib" {
+							return libDir, "lib-revision", nil
+						}
+						return repoDir, "some-revision", nil
+					}
+					job.Inputs = []jobs.Input{{Name: "lib", Repository: "lib-repo"}}
+					job.Command = "cat lib/lib.txt"
+				})
+
+				It("moves each input into a directory of the workspace", func() {
+					Eventually(output).Should(gbytes.Say("hello from lib!"))
+					Eventually(exitStatus).Should(Receive(Equal(uint32(0))))
+				})
+
+				Context("when an input has the name of a file in the checkout", func() {
+					BeforeEach(func() {
+						job.Inputs[0].Name = "test.txt"
+					})
+
+					It("reports that fetching failed", func() {
+						Eventually(exitStatus).Should(Receive(Equal(jobs.StatusFetchFailed)))
+						Expect(output).To(gbytes.Say("would replace"))
+					})
+				})
+			})
+
+			Context("when fetching fails", func() {
+				BeforeEach(func() {
+					vcsFetcher.FetchReturns(repoDir, "", errors.New("oops"))
+				})
+
+				It("reports that fetching failed", func() {
+					Eventually(exitStatus).Should(Receive(Equal(jobs.StatusFetchFailed)))
+				})
+			})
+		})
+	})
+
+	Describe("the environment of the command", func() {
+		BeforeEach(func() {
+			os.Setenv("WOODHOUSE_SERVER_SECRET", "shh")
+			r.Env = append(r.Env, "EXTRA=value")
+			job.Command = "env"
+		})
+
+		AfterEach(func() {
+			os.Unsetenv("WOODHOUSE_SERVER_SECRET")
+		})
+
+		It("only contains the configured variables", func() {
+			Eventually(output.Closed).Should(BeTrue())
+			env := string(output.Contents())
+			Expect(env).To(ContainSubstring("EXTRA=value"))
+			Expect(env).To(ContainSubstring("WOODHOUSE_JOB_ID=some-id"))
+			Expect(env).To(ContainSubstring("WOODHOUSE_JOB_NAME=lint"))
+			Expect(env).To(MatchRegexp(`HOME=.*woodhouse-workspace`))
+			Expect(env).NotTo(ContainSubstring("WOODHOUSE_SERVER_SECRET"))
+		})
+
+		Context("when the job sets variables", func() {
+			BeforeEach(func() {
+				job.Env = []string{"GOARCH=386", "EXTRA=overridden"}
+			})
+
+			It("adds them, overriding the configured ones", func() {
+				Eventually(output.Closed).Should(BeTrue())
+				env := string(output.Contents())
+				Expect(env).To(ContainSubstring("GOARCH=386"))
+				Expect(env).To(ContainSubstring("EXTRA=overridden"))
+				Expect(env).NotTo(ContainSubstring("EXTRA=value"))
+			})
+		})
+	})
+
+	Context("when the command returns non-zero exit status", func() {
+		BeforeEach(func() {
+			job.Command = `sh -c "exit 3"`
+		})
+
+		It("sends the status code", func() {
+			Eventually(exitStatus).Should(Receive(Equal(uint32(3))))
+		})
+	})
+
+	Context("when the command does not exist", func() {
+		BeforeEach(func() {
+			job.Command = "ihopethisdoesntexistonpath"
+		})
+
+		It("sends exit status 1 to represent failure to fork", func() {
+			Eventually(exitStatus).Should(Receive(Equal(uint32(1))))
+		})
+	})
+
+	Context("when the build is cancelled", func() {
+		var cancel context.CancelFunc
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+			job.Command = `sh -c "sleep 60 & echo started && wait"`
+		})
+
+		// The output is only closed once every process holding it has exited
+		It("stops every process started by the command", func() {
+			Eventually(output).Should(gbytes.Say("started"))
+			cancel()
+			Eventually(exitStatus, "5s").Should(Receive(Equal(uint32(143))))
+			Eventually(output.Closed).Should(BeTrue())
+		})
+	})
+
+	Context("when the command takes longer than the timeout", func() {
+		BeforeEach(func() {
+			r.Timeout = time.Millisecond * 200
+			r.KillGracePeriod = time.Millisecond * 200
+			job.Command = `sh -c "trap : TERM; echo started; sleep 60; sleep 60"`
+		})
+
+		It("kills it and reports that it timed out", func() {
+			Eventually(exitStatus, "5s").Should(Receive(Equal(jobs.StatusTimedOut)))
+			Expect(output).To(gbytes.Say("started"))
+			Expect(output).To(gbytes.Say("Timed out after 200ms"))
+		})
+	})
+
+	Describe("artifacts", func() {
+		var artifactsDir, upstreamDir string
+
+		BeforeEach(func() {
+			var err error
+			artifactsDir, err = ioutil.TempDir("", "local-runner-artifacts")
+			Expect(err).NotTo(HaveOccurred())
+			upstreamDir, err = ioutil.TempDir("", "local-runner-upstream")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.MkdirAll(filepath.Join(upstreamDir, "dist"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(upstreamDir, "dist", "app"), []byte("binary"), 0755)).To(Succeed())
+
+			outputDest = artifactKeeper{Buffer: output, dir: artifactsDir}
+			job.UpstreamBuilds = []jobs.UpstreamBuild{{JobName: "build", BuildNumber: 3, ArtifactsDir: upstreamDir}}
+			job.Artifacts = []string{"*.tar", "missing/"}
+			job.Command = `sh -c "cat woodhouse-upstream/build/dist/app > app.tar"`
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(artifactsDir)).To(Succeed())
+			Expect(os.RemoveAll(upstreamDir)).To(Succeed())
+		})
+
+		It("copies the artifacts of upstream builds into the workspace, and keeps the job's own", func() {
+			Eventually(exitStatus).Should(Receive(Equal(uint32(0))))
+			Eventually(output.Closed).Should(BeTrue())
+			Expect(output).To(gbytes.Say("Copying artifacts of build 3 of build to woodhouse-upstream/build"))
+			Expect(output).To(gbytes.Say("Keeping artifact app.tar"))
+			Expect(output).To(gbytes.Say("No artifacts match missing/"))
+			Expect(ioutil.ReadFile(filepath.Join(artifactsDir, "app.tar"))).To(Equal([]byte("binary")))
+			Expect(filepath.Join(upstreamDir, "dist", "app")).To(BeAnExistingFile())
+		})
+
+		Context("when a pattern leaves the workspace", func() {
+			BeforeEach(func() {
+				job.Artifacts = []string{"../*"}
+			})
+
+			It("does not keep what it matches", func() {
+				Eventually(exitStatus).Should(Receive(Equal(uint32(0))))
+				Eventually(output.Closed).Should(BeTrue())
+				Expect(output).To(gbytes.Say(`Error keeping artifacts matching \.\./\*: artifact patterns cannot leave the workspace`))
+				Expect(ioutil.ReadDir(artifactsDir)).To(BeEmpty())
+			})
+		})
+
+		Context("when the build symlinks to somewhere outside the workspace", func() {
+			var outsideDir string
+
+			BeforeEach(func() {
+				var err error
+				outsideDir, err = ioutil.TempDir("", "local-runner-outside")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ioutil.WriteFile(filepath.Join(outsideDir, "passwd"), []byte("secret"), 0644)).To(Succeed())
+				job.Artifacts = []string{"leaked/*", "leaked", "passwd"}
+				job.Command = fmt.Sprintf(`sh -c "ln -s %s leaked && ln -s %s passwd"`, outsideDir, filepath.Join(outsideDir, "passwd"))
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(outsideDir)).To(Succeed())
+			})
+
+			It("does not keep anything outside the workspace", func() {
+				Eventually(exitStatus).Should(Receive(Equal(uint32(0))))
+				Eventually(output.Closed).Should(BeTrue())
+				Expect(output).To(gbytes.Say("Skipping artifact leaked/passwd, which is outside the workspace"))
+				Expect(output).To(gbytes.Say("Skipping artifact leaked, which is a symlink"))
+				Expect(output).To(gbytes.Say("Skipping artifact passwd, which is a symlink"))
+				Expect(ioutil.ReadDir(artifactsDir)).To(BeEmpty())
+			})
+		})
+
+		Context("when the command fails", func() {
+			BeforeEach(func() {
+				job.Command = `sh -c "touch app.tar; exit 1"`
+			})
+
+			It("does not keep them", func() {
+				Eventually(exitStatus).Should(Receive(Equal(uint32(1))))
+				Expect(filepath.Join(artifactsDir, "app.tar")).NotTo(BeAnExistingFile())
+			})
+		})
+	})
+
+	Context("when no arguments can be parsed", func() {
+		BeforeEach(func() {
+			job.Command = ""
+		})
+
+		It("returns error", func() {
+			Expect(runErr).To(MatchError("No arguments could be parsed from command: "))
+		})
+	})
+
+	Context("when the job has service containers", func() {
+		BeforeEach(func() {
+			job.Command = "make integration"
+			job.Services = []jobs.ServiceContainer{{Name: "postgres", Image: "postgres"}}
+		})
+
+		It("returns error", func() {
+			Expect(runErr).To(MatchError("service containers are not supported when using LocalRunner"))
+		})
+	})
+})
+
+type artifactKeeper struct {
+	*gbytes.Buffer
+	dir string
+}
+
+func (k artifactKeeper) ArtifactsDir() (string, error) {
+	return k.dir, nil
+}
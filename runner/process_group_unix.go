@@ -0,0 +1,33 @@
+//go:build !windows
+
+package runner
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+func startInProcessGroup(cmd *exec.Cmd) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return cmd.Start()
+}
+
+// Signals every process in the command's process group, so that children of
+// the job's command are stopped too.
+func signalProcessGroup(cmd *exec.Cmd, kill bool) error {
+	sig := syscall.SIGTERM
+	if kill {
+		sig = syscall.SIGKILL
+	}
+	return syscall.Kill(-cmd.Process.Pid, sig)
+}
+
+// Processes killed by a signal are reported the same way as by a shell
+func exitStatus(state *os.ProcessState) uint32 {
+	waitStatus := state.Sys().(syscall.WaitStatus)
+	if waitStatus.Signaled() {
+		return uint32(128 + int(waitStatus.Signal()))
+	}
+	return uint32(waitStatus.ExitStatus())
+}
@@ -0,0 +1,20 @@
+package runner
+
+import (
+	"os"
+	"os/exec"
+)
+
+func startInProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Start()
+}
+
+// Windows has no process groups to signal, so only the job's command itself
+// can be killed.
+func signalProcessGroup(cmd *exec.Cmd, kill bool) error {
+	return cmd.Process.Kill()
+}
+
+func exitStatus(state *os.ProcessState) uint32 {
+	return uint32(state.ExitCode())
+}
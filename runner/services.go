@@ -0,0 +1,219 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+
+	"github.com/pborman/uuid"
+)
+
+// Service containers have this label, set to the name of the service
+const ServiceLabel = "ci.woodhouse.service"
+
+const (
+	// Failing health checks only count once a service has had this long to
+	// start, e.g. for a database to initialise
+	serviceStartPeriod   = 2 * time.Minute
+	serviceCheckTimeout  = 30 * time.Second
+	serviceCheckFailures = 3
+)
+
+// buildServices are the service containers of a build, running on a network
+// of their own that the build's container joins to reach them by name.
+type buildServices struct {
+	client     *DockerClient
+	network    string
+	containers []string
+	logsCopied sync.WaitGroup
+}
+
+// startServices starts each of the job's service containers, and waits until
+// all of them are ready. Their logs are kept apart from the build's output.
+// Whatever was started is left for remove to clean up, even when starting
+// fails.
+func (r *DockerAPIRunner) startServices(ctx context.Context, job jobs.Job, outputDest io.Writer) (*buildServices, uint32) {
+	services := &buildServices{client: r.Client}
+	if len(job.Services) == 0 {
+		return services, 0
+	}
+
+	// As for the build's container, the build's context only decides when to
+	// stop waiting
+	apiCtx := context.Background()
+
+	network, err := r.Client.CreateNetwork(apiCtx, "woodhouse-"+uuid.New(), map[string]string{ManagedLabel: "true", JobIDLabel: job.ID})
+	if err != nil {
+		fmt.Fprintf(outputDest, "Error creating network for services: %v\n", err)
+		return services, jobs.StatusContainerFailed
+	}
+	services.network = network
+
+	for _, service := range job.Services {
+		fmt.Fprintf(outputDest, "Pulling image %s for service %s\n", service.Image, service.Name)
+		if err := r.Client.PullImage(ctx, service.Image, outputDest); err != nil {
+			if ctx.Err() != nil {
+				return services, jobs.StatusAborted
+			}
+			fmt.Fprintf(outputDest, "Error pulling image %s: %v\n", service.Image, err)
+			return services, jobs.StatusImagePullFailed
+		}
+
+		config := ContainerConfig{
+			Image: service.Image,
+			Env:   service.Env,
+			Labels: map[string]string{
+				ManagedLabel: "true",
+				JobIDLabel:   job.ID,
+				ServiceLabel: service.Name,
+			},
+			HostConfig: HostConfig{NetworkMode: network},
+			NetworkingConfig: &NetworkingConfig{
+				EndpointsConfig: map[string]EndpointConfig{network: {Aliases: []string{service.Name}}},
+			},
+		}
+		if service.HealthCheck != "" {
+			config.Healthcheck = &HealthConfig{
+				Test:        []string{"CMD-SHELL", service.HealthCheck},
+				Interval:    r.HealthCheckInterval,
+				Timeout:     serviceCheckTimeout,
+				StartPeriod: serviceStartPeriod,
+				Retries:     serviceCheckFailures,
+			}
+		}
+
+		containerID, err := r.Client.CreateContainer(apiCtx, "woodhouse-"+uuid.New(), config)
+		if err != nil {
+			fmt.Fprintf(outputDest, "Error creating container for service %s: %v\n", service.Name, err)
+			return services, jobs.StatusContainerFailed
+		}
+		services.containers = append(services.containers, containerID)
+
+		if err := r.Client.StartContainer(apiCtx, containerID); err != nil {
+			fmt.Fprintf(outputDest, "Error starting service %s: %v\n", service.Name, err)
+			return services, jobs.StatusContainerFailed
+		}
+
+		logs, closeLogs := serviceLogs(service.Name, outputDest)
+		services.logsCopied.Add(1)
+		go func(containerID string) {
+			defer services.logsCopied.Done()
+			defer closeLogs()
+			if err := r.Client.FollowLogs(apiCtx, containerID, logs); err != nil {
+				log.Printf("error streaming logs from service container %s: %v\n", containerID, err)
+			}
+		}(containerID)
+	}
+
+	for i, service := range job.Services {
+		if exitStatus := r.awaitReady(ctx, service, services.containers[i], outputDest); exitStatus != 0 {
+			return services, exitStatus
+		}
+	}
+	return services, 0
+}
+
+func (r *DockerAPIRunner) awaitReady(ctx context.Context, service jobs.ServiceContainer, containerID string, outputDest io.Writer) uint32 {
+	announced := false
+	for {
+		state, err := r.Client.InspectContainer(context.Background(), containerID)
+		switch {
+		case err != nil:
+			fmt.Fprintf(outputDest, "Error checking service %s: %v\n", service.Name, err)
+			return jobs.StatusContainerFailed
+		case !state.Running:
+			fmt.Fprintf(outputDest, "Service %s exited with status %d before it was ready\n", service.Name, state.ExitCode)
+			return jobs.StatusContainerFailed
+		case state.Health == "unhealthy":
+			fmt.Fprintf(outputDest, "Service %s is unhealthy\n", service.Name)
+			return jobs.StatusContainerFailed
+		case state.Health == "" || state.Health == "healthy":
+			fmt.Fprintf(outputDest, "Service %s is ready\n", service.Name)
+			return 0
+		}
+
+		if !announced {
+			fmt.Fprintf(outputDest, "Waiting for service %s to be healthy\n", service.Name)
+			announced = true
+		}
+		select {
+		case <-ctx.Done():
+			return jobs.StatusAborted
+		case <-time.After(r.HealthCheckInterval):
+		}
+	}
+}
+
+// remove force removes the service containers, then their network once their
+// logs have been written.
+func (s *buildServices) remove() {
+	ctx := context.Background()
+	for _, containerID := range s.containers {
+		if err := s.client.RemoveContainer(ctx, containerID); err != nil {
+			log.Printf("error removing service container %s: %v\n", containerID, err)
+		}
+	}
+	s.logsCopied.Wait()
+
+	if s.network == "" {
+		return
+	}
+	if err := s.client.RemoveNetwork(ctx, s.network); err != nil {
+		log.Printf("error removing network %s: %v\n", s.network, err)
+	}
+}
+
+// serviceLogs is where the logs of a service are written: a log of its own
+// when the build's output keeps them, or else the build's output with each
+// line prefixed with the name of the service.
+func serviceLogs(name string, outputDest io.Writer) (io.Writer, func()) {
+	serviceLog, err := jobs.ServiceLogWriter(outputDest, name)
+	if err != nil {
+		fmt.Fprintf(outputDest, "Error creating log of service %s: %v\n", name, err)
+	}
+	if serviceLog != nil {
+		return serviceLog, func() {
+			if err := serviceLog.Close(); err != nil {
+				log.Printf("error closing log of service %s: %v\n", name, err)
+			}
+		}
+	}
+
+	prefixed := &prefixWriter{prefix: name + " | ", w: outputDest}
+	return prefixed, prefixed.Flush
+}
+
+// prefixWriter writes whole lines, each starting with prefix.
+type prefixWriter struct {
+	prefix  string
+	w       io.Writer
+	partial []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.partial = append(p.partial, b...)
+	for {
+		end := bytes.IndexByte(p.partial, '\n')
+		if end == -1 {
+			return len(b), nil
+		}
+		if _, err := fmt.Fprintf(p.w, "%s%s", p.prefix, p.partial[:end+1]); err != nil {
+			return 0, err
+		}
+		p.partial = p.partial[end+1:]
+	}
+}
+
+// Flush writes what is left of a last line without a newline.
+func (p *prefixWriter) Flush() {
+	if len(p.partial) > 0 {
+		fmt.Fprintf(p.w, "%s%s\n", p.prefix, p.partial)
+		p.partial = nil
+	}
+}
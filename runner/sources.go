@@ -0,0 +1,126 @@
+package runner
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+)
+
+const containerWorkspace = "/woodhouse-workspace"
+
+// Mount is a directory on the host made available in the container.
+type Mount struct {
+	HostDir      string
+	ContainerDir string
+}
+
+type fetchedInput struct {
+	name string
+	dir  string
+}
+
+// fetchedSources are the checkouts of a build's inputs. dir and revision are
+// those of the job's own repository, if it has one.
+type fetchedSources struct {
+	dir      string
+	revision string
+	inputs   []fetchedInput
+}
+
+// fetchSources fetches every input of the job, recording the revisions used,
+// and the artifacts of upstream builds. Whatever was fetched must be removed
+// even if it errors.
+func fetchSources(fetcher VcsFetcher, job jobs.Job, outputDest io.Writer) (fetchedSources, error) {
+	var fetched fetchedSources
+	for _, source := range job.Sources() {
+		dir, revision, err := fetcher.Fetch(source, outputDest)
+		if source.Name == "" {
+			fetched.dir = dir
+			fetched.revision = revision
+		} else {
+			fetched.inputs = append(fetched.inputs, fetchedInput{name: source.Name, dir: dir})
+		}
+		if err != nil {
+			return fetched, fmt.Errorf("fetching %s: %v", source.Repository, err)
+		}
+
+		if err := jobs.RecordRevision(outputDest, jobs.Revision{Input: source.Name, Revision: revision}); err != nil {
+			log.Printf("error recording revision of %s: %v\n", source.Repository, err)
+		}
+
+		if source.Name == "" && job.ChangedSince != "" && !job.Paths.Empty() {
+			if err := checkChanges(fetcher, job, source, dir, outputDest); err != nil {
+				return fetched, err
+			}
+		}
+	}
+	return fetched, fetchUpstreamArtifacts(job, &fetched, outputDest)
+}
+
+// skipBuild is returned by fetchSources when nothing the job's path filters
+// match has changed since the last build.
+type skipBuild struct {
+	reason string
+}
+
+func (s skipBuild) Error() string {
+	return s.reason
+}
+
+// checkChanges builds anyway if the changes cannot be listed, as skipping a
+// build that was needed is worse than running one that was not.
+func checkChanges(fetcher VcsFetcher, job jobs.Job, source jobs.Input, checkoutDir string, outputDest io.Writer) error {
+	files, err := fetcher.ChangedFiles(source, checkoutDir, job.ChangedSince, outputDest)
+	if err != nil {
+		fmt.Fprintf(outputDest, "Could not list the files changed since %s, so building anyway: %v\n", job.ChangedSince, err)
+		return nil
+	}
+
+	if len(files) == 0 {
+		return skipBuild{reason: fmt.Sprintf("nothing changed since %s", job.ChangedSince)}
+	}
+	if !job.Paths.Matches(files) {
+		return skipBuild{reason: fmt.Sprintf("none of the %d files changed since %s match the job's path filters", len(files), job.ChangedSince)}
+	}
+	return nil
+}
+
+// skipped reports whether fetching stopped because the build is not needed.
+func skipped(err error, job jobs.Job, outputDest io.Writer) bool {
+	skip, ok := err.(skipBuild)
+	if ok {
+		fmt.Fprintf(outputDest, "Skipping build: %s\n", skip.reason)
+		log.Printf("skipping build of job %s: %s\n", job.ID, skip.reason)
+	}
+	return ok
+}
+
+// mounts puts the job's repository at /woodhouse-workspace, and each other
+// input in a directory of it named after the input.
+func (s fetchedSources) mounts() []Mount {
+	mounts := []Mount{}
+	if s.dir != "" {
+		mounts = append(mounts, Mount{HostDir: s.dir, ContainerDir: containerWorkspace})
+	}
+	for _, input := range s.inputs {
+		mounts = append(mounts, Mount{HostDir: input.dir, ContainerDir: path.Join(containerWorkspace, input.name)})
+	}
+	return mounts
+}
+
+func (s fetchedSources) remove() {
+	dirs := []string{s.dir}
+	for _, input := range s.inputs {
+		dirs = append(dirs, input.dir)
+	}
+
+	for _, dir := range dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			log.Printf("error removing checkout dir: %s, cause %v\n", dir, err)
+		}
+	}
+}
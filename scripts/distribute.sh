@@ -23,6 +23,7 @@ echo "Compiling binaries"
 export GOPATH=$PWD/Godeps/_workspace:$GOPATH
 go build -o $binDir/goose bitbucket.org/liamstask/goose/cmd/goose
 go build -o $binDir/woodhouse-ci
+go build -o $binDir/woodhouse-agent ./cmd/woodhouse-agent
 
 echo "Compiling stylesheets"
 bundle install
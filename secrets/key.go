@@ -0,0 +1,89 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Key encrypts secrets that Woodhouse stores, such as git credentials. It is
+// kept in its own file, readable only by the Woodhouse user, so that a copy
+// of the database alone does not reveal them.
+type Key struct {
+	Path string
+}
+
+// Ensure creates a key unless one exists already. Replacing the key makes
+// everything encrypted with the old one unreadable.
+func (k Key) Ensure() error {
+	if _, err := os.Stat(k.Path); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("checking for encryption key: %s. Cause: %v", k.Path, err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("generating encryption key. Cause: %v", err)
+	}
+	if err := ioutil.WriteFile(k.Path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		return fmt.Errorf("writing encryption key: %s. Cause: %v", k.Path, err)
+	}
+	return nil
+}
+
+// Encrypt seals plaintext with AES-256-GCM. The random nonce is prepended to
+// the result.
+func (k Key) Encrypt(plaintext []byte) ([]byte, error) {
+	aead, err := k.aead()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("generating nonce. Cause: %v", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (k Key) Decrypt(ciphertext []byte) ([]byte, error) {
+	aead, err := k.aead()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("decrypting secret. Cause: ciphertext too short")
+	}
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting secret. Was it encrypted with a different key? Cause: %v", err)
+	}
+	return plaintext, nil
+}
+
+func (k Key) aead() (cipher.AEAD, error) {
+	encoded, err := ioutil.ReadFile(k.Path)
+	if err != nil {
+		return nil, fmt.Errorf("reading encryption key: %s. Cause: %v", k.Path, err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return nil, fmt.Errorf("decoding encryption key: %s. Cause: %v", k.Path, err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("decoding encryption key: %s. Cause: %v", k.Path, err)
+	}
+	return cipher.NewGCM(block)
+}
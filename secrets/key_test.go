@@ -0,0 +1,69 @@
+package secrets_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/craigfurman/woodhouse-ci/secrets"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Key", func() {
+	var (
+		tmpDir string
+		key    secrets.Key
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "secrets-unit-tests")
+		Expect(err).NotTo(HaveOccurred())
+		key = secrets.Key{Path: filepath.Join(tmpDir, "key")}
+		Expect(key.Ensure()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("creates a key only the owner can read", func() {
+		info, err := os.Stat(key.Path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+	})
+
+	It("does not replace an existing key", func() {
+		before, err := ioutil.ReadFile(key.Path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key.Ensure()).To(Succeed())
+		Expect(ioutil.ReadFile(key.Path)).To(Equal(before))
+	})
+
+	It("decrypts what it encrypted", func() {
+		ciphertext, err := key.Encrypt([]byte("hunter2"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(ciphertext)).NotTo(ContainSubstring("hunter2"))
+		Expect(key.Decrypt(ciphertext)).To(Equal([]byte("hunter2")))
+	})
+
+	It("uses a different nonce every time", func() {
+		first, err := key.Encrypt([]byte("hunter2"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key.Encrypt([]byte("hunter2"))).NotTo(Equal(first))
+	})
+
+	Context("when the ciphertext was encrypted with another key", func() {
+		It("errors", func() {
+			other := secrets.Key{Path: filepath.Join(tmpDir, "other")}
+			Expect(other.Ensure()).To(Succeed())
+			ciphertext, err := other.Encrypt([]byte("hunter2"))
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = key.Decrypt(ciphertext)
+			Expect(err).To(MatchError(ContainSubstring("different key")))
+		})
+	})
+})
@@ -0,0 +1,275 @@
+package vcs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+)
+
+// ArchiveFetcher downloads a tarball or zip file and extracts it. The revision
+// is the SHA-256 of the archive.
+type ArchiveFetcher struct {
+	// Defaults to http.DefaultClient
+	Client *http.Client
+}
+
+func (f ArchiveFetcher) Fetch(url string, options jobs.CheckoutOptions, outputSink io.Writer) (string, string, error) {
+	fmt.Fprintf(outputSink, "Downloading %s\n", url)
+	if options.Ref != "" {
+		return "", "", fmt.Errorf("archives do not have refs, but %s was requested", options.Ref)
+	}
+
+	tmpDir, err := ioutil.TempDir("", tmpDirPrefix)
+	if err != nil {
+		return "", "", err
+	}
+
+	archive, err := ioutil.TempFile("", "woodhouse-archive")
+	if err != nil {
+		return tmpDir, "", err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	revision, err := f.download(url, options.Credential, archive)
+	if err != nil {
+		return tmpDir, "", fmt.Errorf("downloading %s. Cause: %v", url, err)
+	}
+
+	if err := extract(archive, tmpDir); err != nil {
+		return tmpDir, "", fmt.Errorf("extracting %s. Cause: %v", url, err)
+	}
+	return tmpDir, revision, stripTopLevelDir(tmpDir)
+}
+
+func (f ArchiveFetcher) download(url string, credential *jobs.GitCredential, dest io.Writer) (string, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	if credential != nil {
+		if credential.Type != jobs.CredentialHTTPS {
+			return "", fmt.Errorf("archives can only be downloaded with HTTPS credentials, not %s", credential.Type)
+		}
+		req.SetBasicAuth(credential.Username, credential.Secret)
+	}
+
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(dest, hash), resp.Body); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// extract works out the format of the archive from its contents, as URLs do
+// not always end in a useful extension.
+func extract(archive *os.File, dest string) error {
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(archive)
+	magic, _ := reader.Peek(4)
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		info, err := archive.Stat()
+		if err != nil {
+			return err
+		}
+		return extractZip(archive, info.Size(), dest)
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		return extractTar(gz, dest)
+	default:
+		return extractTar(reader, dest)
+	}
+}
+
+func extractTar(archive io.Reader, dest string) error {
+	symlinks := map[string]string{}
+	tr := tar.NewReader(archive)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		path, err := archivePath(dest, header.Name)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0755)
+		case tar.TypeReg:
+			err = writeArchiveFile(path, os.FileMode(header.Mode), tr)
+		case tar.TypeSymlink:
+			symlinks[path] = header.Linkname
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return createSymlinks(dest, symlinks)
+}
+
+func extractZip(archive io.ReaderAt, size int64, dest string) error {
+	zr, err := zip.NewReader(archive, size)
+	if err != nil {
+		return err
+	}
+
+	symlinks := map[string]string{}
+	for _, file := range zr.File {
+		path, err := archivePath(dest, file.Name)
+		if err != nil {
+			return err
+		}
+
+		if err := extractZipEntry(file, path, symlinks); err != nil {
+			return err
+		}
+	}
+	return createSymlinks(dest, symlinks)
+}
+
+func extractZipEntry(file *zip.File, path string, symlinks map[string]string) error {
+	if file.FileInfo().IsDir() {
+		return os.MkdirAll(path, 0755)
+	}
+
+	contents, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer contents.Close()
+
+	if file.Mode()&os.ModeSymlink != 0 {
+		target, err := ioutil.ReadAll(contents)
+		symlinks[path] = string(target)
+		return err
+	}
+	return writeArchiveFile(path, file.Mode(), contents)
+}
+
+// archivePath stops entries from being written outside of the destination
+func archivePath(dest, name string) (string, error) {
+	path := filepath.Join(dest, name)
+	if !within(dest, path) {
+		return "", fmt.Errorf("archive entry outside of destination: %s", name)
+	}
+	return path, nil
+}
+
+func within(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+func writeArchiveFile(path string, mode os.FileMode, contents io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, contents); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Symlinks are created after everything else, so that later entries cannot be
+// written through them to outside of the destination.
+func createSymlinks(dest string, symlinks map[string]string) error {
+	realDest, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		return err
+	}
+
+	for path, target := range symlinks {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+
+		// Nor through each other
+		parent, err := filepath.EvalSymlinks(filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		if !within(realDest, parent) {
+			return fmt.Errorf("archive entry outside of destination: %s", path)
+		}
+
+		if err := os.Symlink(target, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Archives usually contain a single directory named after the project. Its
+// contents are moved up, so that builds start in the project root.
+func stripTopLevelDir(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	if len(entries) != 1 || !entries[0].IsDir() {
+		return nil
+	}
+
+	// Renamed first, in case it contains an entry with the same name
+	topLevel := filepath.Join(dir, ".woodhouse-top-level")
+	if err := os.Rename(filepath.Join(dir, entries[0].Name()), topLevel); err != nil {
+		return err
+	}
+	children, err := ioutil.ReadDir(topLevel)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := os.Rename(filepath.Join(topLevel, child.Name()), filepath.Join(dir, child.Name())); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(topLevel); err != nil {
+		return fmt.Errorf("moving archive contents out of top level directory. Cause: %v", err)
+	}
+	return nil
+}
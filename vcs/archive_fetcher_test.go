@@ -0,0 +1,190 @@
+package vcs_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+	"github.com/craigfurman/woodhouse-ci/vcs"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+type archiveEntry struct {
+	name, contents, linkTarget string
+}
+
+func tarball(entries ...archiveEntry) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.contents)), Typeflag: tar.TypeReg}
+		if entry.linkTarget != "" {
+			header = &tar.Header{Name: entry.name, Mode: 0777, Linkname: entry.linkTarget, Typeflag: tar.TypeSymlink}
+		}
+		Expect(tw.WriteHeader(header)).To(Succeed())
+		_, err := tw.Write([]byte(entry.contents))
+		Expect(err).NotTo(HaveOccurred())
+	}
+	Expect(tw.Close()).To(Succeed())
+	return buf.Bytes()
+}
+
+func gzipped(data []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(data)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(gz.Close()).To(Succeed())
+	return buf.Bytes()
+}
+
+func zipFile(entries ...archiveEntry) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		w, err := zw.Create(entry.name)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = w.Write([]byte(entry.contents))
+		Expect(err).NotTo(HaveOccurred())
+	}
+	Expect(zw.Close()).To(Succeed())
+	return buf.Bytes()
+}
+
+var _ = Describe("ArchiveFetcher", func() {
+	var (
+		archive   []byte
+		server    *httptest.Server
+		fetcher   vcs.ArchiveFetcher
+		options   jobs.CheckoutOptions
+		output    *gbytes.Buffer
+		workspace string
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if username, password, ok := r.BasicAuth(); ok && (username != "woodhouse" || password != "s3cret") {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Path != "/project.tar.gz" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(archive)
+		}))
+		fetcher = vcs.ArchiveFetcher{}
+		options = jobs.CheckoutOptions{}
+		output = gbytes.NewBuffer()
+	})
+
+	AfterEach(func() {
+		server.Close()
+		Expect(os.RemoveAll(workspace)).To(Succeed())
+	})
+
+	fetch := func() (string, error) {
+		var revision string
+		var err error
+		workspace, revision, err = fetcher.Fetch(server.URL+"/project.tar.gz", options, output)
+		return revision, err
+	}
+
+	It("extracts gzipped tarballs, without their top level directory", func() {
+		archive = gzipped(tarball(archiveEntry{name: "project-1.0/src/main.go", contents: "package main"}))
+		_, err := fetch()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.ReadFile(filepath.Join(workspace, "src", "main.go"))).To(Equal([]byte("package main")))
+		Expect(output).To(gbytes.Say("Downloading %s/project.tar.gz", server.URL))
+	})
+
+	It("keeps the top level directory when it contains the project", func() {
+		archive = gzipped(tarball(archiveEntry{name: "project/project/main.go", contents: "package main"}))
+		_, err := fetch()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filepath.Join(workspace, "project", "main.go")).To(BeAnExistingFile())
+	})
+
+	It("extracts plain tarballs", func() {
+		archive = tarball(archiveEntry{name: "README", contents: "hi"}, archiveEntry{name: "LICENSE", contents: "MIT"})
+		_, err := fetch()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filepath.Join(workspace, "README")).To(BeAnExistingFile())
+		Expect(filepath.Join(workspace, "LICENSE")).To(BeAnExistingFile())
+	})
+
+	It("extracts zip files whatever the URL says", func() {
+		archive = zipFile(archiveEntry{name: "project/README", contents: "hi"})
+		_, err := fetch()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.ReadFile(filepath.Join(workspace, "README"))).To(Equal([]byte("hi")))
+	})
+
+	It("extracts symlinks", func() {
+		archive = tarball(archiveEntry{name: "README", contents: "hi"}, archiveEntry{name: "README.md", linkTarget: "README"})
+		_, err := fetch()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.ReadFile(filepath.Join(workspace, "README.md"))).To(Equal([]byte("hi")))
+	})
+
+	It("returns the SHA-256 of the archive as the revision", func() {
+		archive = tarball(archiveEntry{name: "README", contents: "hi"})
+		revision, err := fetch()
+		Expect(err).NotTo(HaveOccurred())
+		sum := sha256.Sum256(archive)
+		Expect(revision).To(Equal("sha256:" + hex.EncodeToString(sum[:])))
+	})
+
+	It("authenticates with HTTPS credentials", func() {
+		archive = tarball(archiveEntry{name: "README", contents: "hi"})
+		options.Credential = &jobs.GitCredential{Type: jobs.CredentialHTTPS, Username: "woodhouse", Secret: "wrong"}
+		_, err := fetch()
+		Expect(err).To(MatchError(ContainSubstring("401")))
+
+		options.Credential.Secret = "s3cret"
+		os.RemoveAll(workspace)
+		_, err = fetch()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Context("when an entry would be written outside of the checkout", func() {
+		It("errors", func() {
+			archive = tarball(archiveEntry{name: "../../escaped", contents: "boo"})
+			_, err := fetch()
+			Expect(err).To(MatchError(ContainSubstring("outside of destination")))
+		})
+	})
+
+	Context("when a symlink would be created through another symlink", func() {
+		It("errors", func() {
+			outside, err := ioutil.TempDir("", "archive-outside")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(outside)
+
+			archive = tarball(archiveEntry{name: "a", linkTarget: outside}, archiveEntry{name: "a/b", linkTarget: "/etc/passwd"})
+			_, err = fetch()
+			Expect(err).To(HaveOccurred())
+			Expect(filepath.Join(outside, "b")).NotTo(BeAnExistingFile())
+		})
+	})
+
+	Context("when the archive cannot be downloaded", func() {
+		It("errors", func() {
+			var err error
+			workspace, _, err = fetcher.Fetch(server.URL+"/missing.tar.gz", options, output)
+			Expect(err).To(MatchError(ContainSubstring("404")))
+		})
+	})
+})
@@ -1,22 +1,194 @@
 package vcs
 
 import (
+	"fmt"
 	"io"
 	"io/ioutil"
-	"os/exec"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
 )
 
-type GitCloner struct{}
+type GitCloner struct {
+	// Bare mirrors of repositories are kept here, so that each build only
+	// fetches what changed since the last one. Empty means always cloning
+	// from scratch.
+	MirrorDir string
+}
+
+func (c GitCloner) Fetch(repository string, options jobs.CheckoutOptions, outputSink io.Writer) (string, string, error) {
+	fmt.Fprintf(outputSink, "Checking out %s (%s)\n", repository, options)
 
-func (GitCloner) Fetch(repository string, outputSink io.Writer) (string, error) {
-	tmpDir, err := ioutil.TempDir("", "woodhouse-git")
+	tmpDir, err := ioutil.TempDir("", tmpDirPrefix)
 	if err != nil {
+		return "", "", err
+	}
+
+	git, cleanup, err := newGitCommand(repository, options.Credential, outputSink)
+	if err != nil {
+		return tmpDir, "", err
+	}
+	defer cleanup()
+
+	cloneArgs := []string{"clone"}
+	if c.MirrorDir != "" {
+		mirror, err := c.updateMirror(git, repository, outputSink)
+		if err != nil {
+			return tmpDir, "", err
+		}
+
+		// Holding a shared lock stops the mirror being updated mid-clone.
+		// Dissociating copies the objects used from the mirror, so that the
+		// checkout does not depend on it afterwards.
+		unlock, err := lockMirror(mirror, false)
+		if err != nil {
+			return tmpDir, "", fmt.Errorf("locking mirror of %s. Cause: %v", repository, err)
+		}
+		defer unlock()
+		cloneArgs = append(cloneArgs, "--reference", mirror, "--dissociate")
+	}
+
+	if options.Depth > 0 {
+		cloneArgs = append(cloneArgs, "--depth", strconv.Itoa(options.Depth))
+		if !options.SingleBranch {
+			// --depth implies a single branch otherwise
+			cloneArgs = append(cloneArgs, "--no-single-branch")
+		}
+	}
+	if options.SingleBranch {
+		cloneArgs = append(cloneArgs, "--single-branch")
+	}
+	if len(options.SparsePaths) > 0 || options.Ref != "" {
+		cloneArgs = append(cloneArgs, "--no-checkout")
+	}
+	if err := git.run(append(cloneArgs, "--", repository, tmpDir)...); err != nil {
+		return tmpDir, "", err
+	}
+
+	if len(options.SparsePaths) > 0 {
+		if err := git.run(append([]string{"-C", tmpDir, "sparse-checkout", "set", "--"}, options.SparsePaths...)...); err != nil {
+			return tmpDir, "", err
+		}
+	}
+	if options.Ref != "" {
+		commit, err := resolveRef(git, tmpDir, options)
+		if err != nil {
+			return tmpDir, "", err
+		}
+		if err := git.run("-C", tmpDir, "checkout", "--quiet", "--detach", commit); err != nil {
+			return tmpDir, "", err
+		}
+	} else if len(options.SparsePaths) > 0 {
+		if err := git.run("-C", tmpDir, "checkout"); err != nil {
+			return tmpDir, "", err
+		}
+	}
+
+	if err := updateSubmodules(git, tmpDir, options); err != nil {
+		return tmpDir, "", err
+	}
+
+	revision, err := git.output("-C", tmpDir, "rev-parse", "HEAD")
+	return tmpDir, revision, err
+}
+
+// resolveRef finds the commit that a branch, tag or commit refers to. Refs
+// that the clone did not include, e.g. because it was shallow, are fetched.
+func resolveRef(git gitCommand, checkout string, options jobs.CheckoutOptions) (string, error) {
+	if strings.HasPrefix(options.Ref, "-") {
+		return "", fmt.Errorf("refs cannot start with '-', not: %s", options.Ref)
+	}
+
+	for _, candidate := range []string{"refs/remotes/origin/" + options.Ref, options.Ref} {
+		if commit, err := git.output("-C", checkout, "rev-parse", "--verify", "--quiet", candidate+"^{commit}"); err == nil {
+			return commit, nil
+		}
+	}
+
+	fetchArgs := []string{"-C", checkout, "fetch"}
+	if options.Depth > 0 {
+		fetchArgs = append(fetchArgs, "--depth", strconv.Itoa(options.Depth))
+	}
+	if err := git.run(append(fetchArgs, "--", "origin", options.Ref)...); err != nil {
+		return "", fmt.Errorf("fetching ref %s. Cause: %v", options.Ref, err)
+	}
+	return git.output("-C", checkout, "rev-parse", "FETCH_HEAD^{commit}")
+}
+
+// ChangedFiles lists the files that differ between a checkout and an earlier
+// commit. Shallow checkouts may not include the commit, so it is fetched.
+func (c GitCloner) ChangedFiles(checkoutDir, since string, options jobs.CheckoutOptions, outputSink io.Writer) ([]string, error) {
+	repository, err := gitCommand{outputSink: outputSink}.output("-C", checkoutDir, "remote", "get-url", "origin")
+	if err != nil {
+		return nil, fmt.Errorf("finding the repository of %s. Cause: %v", checkoutDir, err)
+	}
+	git, cleanup, err := newGitCommand(repository, options.Credential, outputSink)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	if _, err := git.output("-C", checkoutDir, "rev-parse", "--verify", "--quiet", since+"^{commit}"); err != nil {
+		if err := git.run("-C", checkoutDir, "fetch", "--quiet", "--depth", "1", "--", "origin", since); err != nil {
+			return nil, fmt.Errorf("fetching %s. Cause: %v", since, err)
+		}
+	}
+
+	diff, err := git.output("-C", checkoutDir, "diff", "--name-only", "--no-renames", since, "HEAD")
+	if err != nil || diff == "" {
+		return nil, err
+	}
+	return strings.Split(diff, "\n"), nil
+}
+
+func updateSubmodules(git gitCommand, checkout string, options jobs.CheckoutOptions) error {
+	args := []string{"-C", checkout, "submodule", "update", "--init"}
+	switch options.Submodules {
+	case jobs.SubmodulesNone:
+		return nil
+	case jobs.SubmodulesTopLevel:
+	case jobs.SubmodulesRecursive, "":
+		args = append(args, "--recursive")
+	default:
+		return fmt.Errorf("unknown submodule mode: %s", options.Submodules)
+	}
+
+	if options.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(options.Depth))
+	}
+	return git.run(args...)
+}
+
+func (c GitCloner) updateMirror(git gitCommand, repository string, outputSink io.Writer) (string, error) {
+	if err := os.MkdirAll(c.MirrorDir, 0755); err != nil {
 		return "", err
 	}
 
-	cloneCmd := exec.Command("git", "clone", "--recursive", repository, tmpDir)
-	cloneCmd.Stdout = outputSink
-	cloneCmd.Stderr = outputSink
-	err = cloneCmd.Run()
-	return tmpDir, err
+	mirror := filepath.Join(c.MirrorDir, MirrorName(repository))
+	unlock, err := lockMirror(mirror, true)
+	if err != nil {
+		return "", fmt.Errorf("locking mirror of %s. Cause: %v", repository, err)
+	}
+	defer unlock()
+
+	if _, err := os.Stat(mirror); os.IsNotExist(err) {
+		fmt.Fprintf(outputSink, "Creating mirror of %s\n", repository)
+		if err := git.run("clone", "--mirror", "--", repository, mirror); err != nil {
+			os.RemoveAll(mirror)
+			return "", err
+		}
+	} else {
+		fmt.Fprintf(outputSink, "Updating mirror of %s\n", repository)
+		if err := git.run("--git-dir", mirror, "fetch", "--prune", "origin"); err != nil {
+			return "", err
+		}
+	}
+
+	// The modification time of the mirror records when it was last used
+	now := time.Now()
+	return mirror, os.Chtimes(mirror, now, now)
 }
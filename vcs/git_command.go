@@ -0,0 +1,102 @@
+package vcs
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+)
+
+// Credentials reach git through the environment of each command, never its
+// arguments or output, so that they do not appear in the build log or the
+// process list.
+const (
+	usernameEnv = "WOODHOUSE_GIT_USERNAME"
+	passwordEnv = "WOODHOUSE_GIT_PASSWORD"
+
+	credentialHelper = `!f() { test "$1" = get && printf 'username=%s\npassword=%s\n' "$` + usernameEnv + `" "$` + passwordEnv + `"; }; f`
+)
+
+type gitCommand struct {
+	outputSink io.Writer
+	configArgs []string
+	env        []string
+}
+
+// newGitCommand runs git with the credential scoped to the commands of one
+// fetch of the repository. The returned function removes any files the
+// credential needed.
+func newGitCommand(repository string, credential *jobs.GitCredential, outputSink io.Writer) (gitCommand, func(), error) {
+	// Fail rather than wait for someone to type a password
+	git := gitCommand{outputSink: outputSink, env: []string{"GIT_TERMINAL_PROMPT=0"}}
+	noop := func() {}
+	if credential == nil {
+		return git, noop, nil
+	}
+
+	switch credential.Type {
+	case jobs.CredentialHTTPS:
+		// Submodules inherit the configuration, so the helper only answers
+		// for the repository's own host. The empty helper stops any helpers
+		// configured for the Woodhouse user from being asked as well.
+		u, err := url.Parse(repository)
+		if err != nil || u.Host == "" {
+			return git, noop, fmt.Errorf("credential %s can only be used with an HTTP(S) URL, not: %s", credential.Name, repository)
+		}
+		scope := u.Scheme + "://" + u.Host
+		git.configArgs = []string{"-c", "credential.helper=", "-c", "credential." + scope + ".helper=" + credentialHelper}
+		git.env = append(git.env, usernameEnv+"="+credential.Username, passwordEnv+"="+credential.Secret)
+		return git, noop, nil
+	case jobs.CredentialSSH:
+		dir, err := ioutil.TempDir("", sshDirPrefix)
+		if err != nil {
+			return git, noop, err
+		}
+		cleanup := func() { os.RemoveAll(dir) }
+
+		key := filepath.Join(dir, "id")
+		knownHosts := filepath.Join(dir, "known_hosts")
+		if err := ioutil.WriteFile(key, []byte(strings.TrimSpace(credential.Secret)+"\n"), 0600); err != nil {
+			cleanup()
+			return git, noop, fmt.Errorf("writing SSH key of credential %s. Cause: %v", credential.Name, err)
+		}
+		if err := ioutil.WriteFile(knownHosts, []byte(credential.KnownHosts+"\n"), 0600); err != nil {
+			cleanup()
+			return git, noop, fmt.Errorf("writing known hosts of credential %s. Cause: %v", credential.Name, err)
+		}
+
+		// Ignore the Woodhouse user's own SSH configuration, keys and known
+		// hosts, so that only the pinned host keys are trusted
+		sshCommand := fmt.Sprintf("ssh -F /dev/null -i '%s' -o IdentitiesOnly=yes -o UserKnownHostsFile='%s' -o GlobalKnownHostsFile=/dev/null -o StrictHostKeyChecking=yes -o BatchMode=yes", key, knownHosts)
+		git.env = append(git.env, "GIT_SSH_COMMAND="+sshCommand)
+		return git, cleanup, nil
+	default:
+		return git, noop, fmt.Errorf("unknown type of credential %s: %s", credential.Name, credential.Type)
+	}
+}
+
+func (g gitCommand) run(args ...string) error {
+	cmd := g.command(args...)
+	cmd.Stdout = g.outputSink
+	return cmd.Run()
+}
+
+// output returns what the command prints, rather than writing it to the
+// output sink.
+func (g gitCommand) output(args ...string) (string, error) {
+	out, err := g.command(args...).Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+func (g gitCommand) command(args ...string) *exec.Cmd {
+	cmd := exec.Command("git", append(g.configArgs, args...)...)
+	cmd.Env = append(os.Environ(), g.env...)
+	cmd.Stderr = g.outputSink
+	return cmd
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+
+package vcs
+
+import (
+	"os"
+	"syscall"
+)
+
+// Locks are held on a file next to each mirror, so that they also exclude
+// other Woodhouse processes sharing the mirror directory.
+func lockMirror(mirror string, exclusive bool) (func(), error) {
+	f, err := os.OpenFile(mirror+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,27 @@
+package vcs
+
+import "sync"
+
+var (
+	mirrorLocksMutex sync.Mutex
+	mirrorLocks      = make(map[string]*sync.RWMutex)
+)
+
+// Only builds within this process are excluded from each other, so the mirror
+// directory must not be shared.
+func lockMirror(mirror string, exclusive bool) (func(), error) {
+	mirrorLocksMutex.Lock()
+	lock, ok := mirrorLocks[mirror]
+	if !ok {
+		lock = new(sync.RWMutex)
+		mirrorLocks[mirror] = lock
+	}
+	mirrorLocksMutex.Unlock()
+
+	if exclusive {
+		lock.Lock()
+		return lock.Unlock, nil
+	}
+	lock.RLock()
+	return lock.RUnlock, nil
+}
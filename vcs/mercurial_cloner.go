@@ -0,0 +1,57 @@
+package vcs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+)
+
+type MercurialCloner struct{}
+
+func (c MercurialCloner) Fetch(repository string, options jobs.CheckoutOptions, outputSink io.Writer) (string, string, error) {
+	fmt.Fprintf(outputSink, "Checking out %s with Mercurial\n", repository)
+
+	// Subrepositories are always checked out, so the submodule mode is
+	// ignored
+	if options.Depth > 0 || len(options.SparsePaths) > 0 {
+		return "", "", errors.New("shallow and sparse checkouts are only supported for git repositories")
+	}
+	if options.Credential != nil {
+		return "", "", errors.New("credentials are only supported for git repositories and archives")
+	}
+
+	tmpDir, err := ioutil.TempDir("", tmpDirPrefix)
+	if err != nil {
+		return "", "", err
+	}
+
+	args := []string{"clone"}
+	if options.SingleBranch {
+		args = append(args, "--branch", "default")
+	}
+	if options.Ref != "" {
+		args = append(args, "--updaterev", options.Ref)
+	}
+	clone := hg(outputSink, append(args, "--", repository, tmpDir)...)
+	clone.Stdout = outputSink
+	if err := clone.Run(); err != nil {
+		return tmpDir, "", err
+	}
+
+	revision, err := hg(outputSink, "--repository", tmpDir, "log", "--rev", ".", "--template", "{node}").Output()
+	return tmpDir, strings.TrimSpace(string(revision)), err
+}
+
+func hg(outputSink io.Writer, args ...string) *exec.Cmd {
+	cmd := exec.Command("hg", append([]string{"--noninteractive"}, args...)...)
+	// Ignore user configuration that changes output
+	cmd.Env = append(os.Environ(), "HGPLAIN=1")
+	cmd.Stderr = outputSink
+	return cmd
+}
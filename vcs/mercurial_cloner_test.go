@@ -0,0 +1,70 @@
+package vcs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+	"github.com/craigfurman/woodhouse-ci/vcs"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("MercurialCloner", func() {
+	var (
+		tmpDir string
+		repo   string
+		output *gbytes.Buffer
+	)
+
+	hg := func(args ...string) string {
+		cmd := exec.Command("hg", append([]string{"--config", "ui.username=Woodhouse <woodhouse@example.com>"}, args...)...)
+		cmd.Dir = repo
+		cmd.Stderr = GinkgoWriter
+		out, err := cmd.Output()
+		Expect(err).NotTo(HaveOccurred())
+		return strings.TrimSpace(string(out))
+	}
+
+	BeforeEach(func() {
+		if _, err := exec.LookPath("hg"); err != nil {
+			Skip("Mercurial is not installed")
+		}
+
+		var err error
+		tmpDir, err = ioutil.TempDir("", "mercurial-cloner-unit-tests")
+		Expect(err).NotTo(HaveOccurred())
+		repo = filepath.Join(tmpDir, "repo")
+		Expect(os.Mkdir(repo, 0755)).To(Succeed())
+		hg("init")
+		Expect(ioutil.WriteFile(filepath.Join(repo, "first.txt"), []byte("first"), 0644)).To(Succeed())
+		hg("commit", "--addremove", "-m", "first")
+		output = gbytes.NewBuffer()
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("clones the repository and returns the changeset", func() {
+		workspace, revision, err := vcs.MercurialCloner{}.Fetch(repo, jobs.CheckoutOptions{}, output)
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(workspace)
+
+		Expect(filepath.Join(workspace, "first.txt")).To(BeAnExistingFile())
+		Expect(revision).To(Equal(hg("log", "--rev", "tip", "--template", "{node}")))
+	})
+
+	Context("when a shallow checkout is requested", func() {
+		It("errors", func() {
+			workspace, _, err := vcs.MercurialCloner{}.Fetch(repo, jobs.CheckoutOptions{Depth: 1}, output)
+			defer os.RemoveAll(workspace)
+			Expect(err).To(MatchError(ContainSubstring("only supported for git repositories")))
+		})
+	})
+})
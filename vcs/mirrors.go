@@ -0,0 +1,78 @@
+package vcs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var unsafeMirrorChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// MirrorName is the directory name of the mirror of a repository. It is
+// readable, and unique thanks to a hash of the repository URL. Credentials in
+// the URL are left out of the readable part.
+func MirrorName(repository string) string {
+	sum := sha256.Sum256([]byte(repository))
+	readable := repository
+	if u, err := url.Parse(repository); err == nil && u.User != nil {
+		u.User = nil
+		readable = u.String()
+	}
+	readable = strings.Trim(unsafeMirrorChars.ReplaceAllString(readable, "-"), "-.")
+	if len(readable) > 64 {
+		readable = readable[len(readable)-64:]
+	}
+	return readable + "-" + hex.EncodeToString(sum[:])[:12] + ".git"
+}
+
+// RemoveStaleMirrors deletes mirrors that no build has used for maxAge, and
+// returns their paths.
+func RemoveStaleMirrors(mirrorDir string, maxAge time.Duration) ([]string, error) {
+	entries, err := ioutil.ReadDir(mirrorDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	removed := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasSuffix(entry.Name(), ".git") {
+			continue
+		}
+
+		mirror := filepath.Join(mirrorDir, entry.Name())
+		stale, err := removeIfStale(mirror, maxAge)
+		if err != nil {
+			return removed, err
+		}
+		if stale {
+			removed = append(removed, mirror)
+		}
+	}
+	return removed, nil
+}
+
+func removeIfStale(mirror string, maxAge time.Duration) (bool, error) {
+	unlock, err := lockMirror(mirror, true)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	// Check again now that no build can be using it
+	info, err := os.Stat(mirror)
+	if err != nil {
+		return false, err
+	}
+	if time.Since(info.ModTime()) < maxAge {
+		return false, nil
+	}
+	return true, os.RemoveAll(mirror)
+}
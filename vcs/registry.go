@@ -0,0 +1,94 @@
+package vcs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+)
+
+// Every fetcher checks out into a directory with this prefix
+const tmpDirPrefix = "woodhouse-checkout"
+
+// Keys of git credentials are written to a directory with this prefix
+const sshDirPrefix = "woodhouse-ssh"
+
+// Prefixes of every temporary directory that builds make, including the
+// runner's workspaces and copies of upstream artifacts
+var tmpDirPrefixes = []string{tmpDirPrefix, sshDirPrefix, "woodhouse-workspace", "woodhouse-artifacts"}
+
+// Fetcher checks out one type of source into a new temporary directory, and
+// returns it along with the revision that was checked out.
+type Fetcher interface {
+	Fetch(repository string, options jobs.CheckoutOptions, outputSink io.Writer) (string, string, error)
+}
+
+// ChangeLister is implemented by fetchers that can list the files changed in a
+// checkout since an earlier revision.
+type ChangeLister interface {
+	ChangedFiles(checkoutDir, since string, options jobs.CheckoutOptions, outputSink io.Writer) ([]string, error)
+}
+
+// Registry fetches each input with the fetcher registered for its SourceType.
+// Inputs without a SourceType are fetched with git.
+type Registry map[string]Fetcher
+
+func (r Registry) Fetch(source jobs.Input, outputSink io.Writer) (string, string, error) {
+	fetcher, err := r.fetcher(source)
+	if err != nil {
+		return "", "", err
+	}
+
+	checkoutDir, revision, err := fetcher.Fetch(source.Repository, source.Checkout, outputSink)
+	if err == nil {
+		fmt.Fprintf(outputSink, "Checked out revision %s\n", revision)
+	}
+	return checkoutDir, revision, err
+}
+
+func (r Registry) ChangedFiles(source jobs.Input, checkoutDir, since string, outputSink io.Writer) ([]string, error) {
+	fetcher, err := r.fetcher(source)
+	if err != nil {
+		return nil, err
+	}
+
+	lister, ok := fetcher.(ChangeLister)
+	if !ok {
+		return nil, fmt.Errorf("listing changed files is not supported for source type: %s", source.SourceType)
+	}
+	return lister.ChangedFiles(checkoutDir, since, source.Checkout, outputSink)
+}
+
+func (r Registry) fetcher(source jobs.Input) (Fetcher, error) {
+	sourceType := source.SourceType
+	if sourceType == "" {
+		sourceType = jobs.SourceGit
+	}
+
+	fetcher, ok := r[sourceType]
+	if !ok {
+		return nil, fmt.Errorf("no fetcher available for source type: %s", sourceType)
+	}
+	return fetcher, nil
+}
+
+// RemoveTempDirs deletes any checkouts, credentials and workspaces left behind
+// in the system temporary directory, e.g. by builds that were running when
+// Woodhouse stopped.
+func RemoveTempDirs() error {
+	for _, prefix := range tmpDirPrefixes {
+		dirs, err := filepath.Glob(filepath.Join(os.TempDir(), prefix+"*"))
+		if err != nil {
+			return err
+		}
+
+		for _, dir := range dirs {
+			if err := os.RemoveAll(dir); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package vcs_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+	"github.com/craigfurman/woodhouse-ci/vcs"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+type stubFetcher struct {
+	repository string
+}
+
+type stubChangeLister struct {
+	stubFetcher
+	since string
+}
+
+func (f *stubFetcher) Fetch(repository string, options jobs.CheckoutOptions, outputSink io.Writer) (string, string, error) {
+	f.repository = repository
+	return "/some/checkout", "some-revision", nil
+}
+
+func (l *stubChangeLister) ChangedFiles(checkoutDir, since string, options jobs.CheckoutOptions, outputSink io.Writer) ([]string, error) {
+	l.since = since
+	return []string{"README.md"}, nil
+}
+
+var _ = Describe("Registry", func() {
+	var (
+		git      *stubChangeLister
+		archive  *stubFetcher
+		registry vcs.Registry
+		output   *gbytes.Buffer
+	)
+
+	BeforeEach(func() {
+		git, archive = new(stubChangeLister), new(stubFetcher)
+		registry = vcs.Registry{jobs.SourceGit: git, jobs.SourceArchive: archive}
+		output = gbytes.NewBuffer()
+	})
+
+	It("fetches with the fetcher for the input's source type", func() {
+		dir, revision, err := registry.Fetch(jobs.Input{SourceType: jobs.SourceArchive, Repository: "https://example.com/a.tgz"}, output)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dir).To(Equal("/some/checkout"))
+		Expect(revision).To(Equal("some-revision"))
+		Expect(archive.repository).To(Equal("https://example.com/a.tgz"))
+		Expect(output).To(gbytes.Say("Checked out revision some-revision"))
+	})
+
+	It("fetches with git by default", func() {
+		_, _, err := registry.Fetch(jobs.Input{Repository: "some-repo.git"}, output)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(git.repository).To(Equal("some-repo.git"))
+	})
+
+	Context("when no fetcher is registered for the source type", func() {
+		It("errors", func() {
+			_, _, err := registry.Fetch(jobs.Input{SourceType: jobs.SourceMercurial}, output)
+			Expect(err).To(MatchError("no fetcher available for source type: hg"))
+		})
+	})
+
+	Describe("listing changed files", func() {
+		It("asks the fetcher for the input's source type", func() {
+			files, err := registry.ChangedFiles(jobs.Input{Repository: "some-repo.git"}, "/some/checkout", "abc123", output)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(Equal([]string{"README.md"}))
+			Expect(git.since).To(Equal("abc123"))
+		})
+
+		Context("when the fetcher cannot list changed files", func() {
+			It("errors", func() {
+				_, err := registry.ChangedFiles(jobs.Input{SourceType: jobs.SourceArchive}, "/some/checkout", "abc123", output)
+				Expect(err).To(MatchError("listing changed files is not supported for source type: archive"))
+			})
+		})
+	})
+
+	Describe("removing temporary directories", func() {
+		var tmpDir, oldTmpDir string
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "registry-tests")
+			Expect(err).NotTo(HaveOccurred())
+			oldTmpDir = os.Getenv("TMPDIR")
+			Expect(os.Setenv("TMPDIR", tmpDir)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.Setenv("TMPDIR", oldTmpDir)).To(Succeed())
+			Expect(os.RemoveAll(tmpDir)).To(Succeed())
+		})
+
+		It("removes those of every kind that builds leave behind", func() {
+			for _, prefix := range []string{"woodhouse-checkout", "woodhouse-ssh", "woodhouse-workspace", "woodhouse-artifacts"} {
+				dir, err := ioutil.TempDir("", prefix)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ioutil.WriteFile(filepath.Join(dir, "left-behind"), nil, 0644)).To(Succeed())
+			}
+			Expect(os.Mkdir(filepath.Join(tmpDir, "something-else"), 0755)).To(Succeed())
+
+			Expect(vcs.RemoveTempDirs()).To(Succeed())
+			entries, err := ioutil.ReadDir(tmpDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+			Expect(entries[0].Name()).To(Equal("something-else"))
+		})
+	})
+})
@@ -3,7 +3,7 @@ $(document).ready(function() {
         return;
     }
 
-    var outputEvents = new EventSource('/jobs/' + job.jobId + '/builds/' + job.buildNumber + '/output?offset=' + job.bytesAleadyReceived);
+    var outputEvents = new EventSource(job.outputURL + '?offset=' + job.bytesAleadyReceived);
     outputEvents.addEventListener("output", function(e) {
         $('#jobOutput').append(e.data);
     });
@@ -0,0 +1,116 @@
+// This file was generated by counterfeiter
+package fake_agent_service
+
+import (
+	"sync"
+
+	"github.com/craigfurman/woodhouse-ci/agents"
+	"github.com/craigfurman/woodhouse-ci/web"
+)
+
+type FakeAgentService struct {
+	AgentsStub        func() []agents.Agent
+	agentsMutex       sync.RWMutex
+	agentsArgsForCall []struct{}
+	agentsReturns     struct {
+		result1 []agents.Agent
+	}
+	SetDisabledStub        func(agentID string, disabled bool) error
+	setDisabledMutex       sync.RWMutex
+	setDisabledArgsForCall []struct {
+		agentID  string
+		disabled bool
+	}
+	setDisabledReturns struct {
+		result1 error
+	}
+	RotateRegistrationTokenStub        func() error
+	rotateRegistrationTokenMutex       sync.RWMutex
+	rotateRegistrationTokenArgsForCall []struct{}
+	rotateRegistrationTokenReturns     struct {
+		result1 error
+	}
+}
+
+func (fake *FakeAgentService) Agents() []agents.Agent {
+	fake.agentsMutex.Lock()
+	fake.agentsArgsForCall = append(fake.agentsArgsForCall, struct{}{})
+	fake.agentsMutex.Unlock()
+	if fake.AgentsStub != nil {
+		return fake.AgentsStub()
+	} else {
+		return fake.agentsReturns.result1
+	}
+}
+
+func (fake *FakeAgentService) AgentsCallCount() int {
+	fake.agentsMutex.RLock()
+	defer fake.agentsMutex.RUnlock()
+	return len(fake.agentsArgsForCall)
+}
+
+func (fake *FakeAgentService) AgentsReturns(result1 []agents.Agent) {
+	fake.AgentsStub = nil
+	fake.agentsReturns = struct {
+		result1 []agents.Agent
+	}{result1}
+}
+
+func (fake *FakeAgentService) SetDisabled(agentID string, disabled bool) error {
+	fake.setDisabledMutex.Lock()
+	fake.setDisabledArgsForCall = append(fake.setDisabledArgsForCall, struct {
+		agentID  string
+		disabled bool
+	}{agentID, disabled})
+	fake.setDisabledMutex.Unlock()
+	if fake.SetDisabledStub != nil {
+		return fake.SetDisabledStub(agentID, disabled)
+	} else {
+		return fake.setDisabledReturns.result1
+	}
+}
+
+func (fake *FakeAgentService) SetDisabledCallCount() int {
+	fake.setDisabledMutex.RLock()
+	defer fake.setDisabledMutex.RUnlock()
+	return len(fake.setDisabledArgsForCall)
+}
+
+func (fake *FakeAgentService) SetDisabledArgsForCall(i int) (string, bool) {
+	fake.setDisabledMutex.RLock()
+	defer fake.setDisabledMutex.RUnlock()
+	return fake.setDisabledArgsForCall[i].agentID, fake.setDisabledArgsForCall[i].disabled
+}
+
+func (fake *FakeAgentService) SetDisabledReturns(result1 error) {
+	fake.SetDisabledStub = nil
+	fake.setDisabledReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeAgentService) RotateRegistrationToken() error {
+	fake.rotateRegistrationTokenMutex.Lock()
+	fake.rotateRegistrationTokenArgsForCall = append(fake.rotateRegistrationTokenArgsForCall, struct{}{})
+	fake.rotateRegistrationTokenMutex.Unlock()
+	if fake.RotateRegistrationTokenStub != nil {
+		return fake.RotateRegistrationTokenStub()
+	} else {
+		return fake.rotateRegistrationTokenReturns.result1
+	}
+}
+
+func (fake *FakeAgentService) RotateRegistrationTokenCallCount() int {
+	fake.rotateRegistrationTokenMutex.RLock()
+	defer fake.rotateRegistrationTokenMutex.RUnlock()
+	return len(fake.rotateRegistrationTokenArgsForCall)
+}
+
+func (fake *FakeAgentService) RotateRegistrationTokenReturns(result1 error) {
+	fake.RotateRegistrationTokenStub = nil
+	fake.rotateRegistrationTokenReturns = struct {
+		result1 error
+	}{result1}
+}
+
+var _ web.AgentService = new(FakeAgentService)
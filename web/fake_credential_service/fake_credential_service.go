@@ -0,0 +1,126 @@
+// This file was generated by counterfeiter
+package fake_credential_service
+
+import (
+	"sync"
+
+	"github.com/craigfurman/woodhouse-ci/jobs"
+	"github.com/craigfurman/woodhouse-ci/web"
+)
+
+type FakeCredentialService struct {
+	ListStub        func() ([]jobs.GitCredential, error)
+	listMutex       sync.RWMutex
+	listArgsForCall []struct{}
+	listReturns     struct {
+		result1 []jobs.GitCredential
+		result2 error
+	}
+	SaveStub        func(credential *jobs.GitCredential) error
+	saveMutex       sync.RWMutex
+	saveArgsForCall []struct {
+		credential *jobs.GitCredential
+	}
+	saveReturns struct {
+		result1 error
+	}
+	DeleteStub        func(name string) error
+	deleteMutex       sync.RWMutex
+	deleteArgsForCall []struct {
+		name string
+	}
+	deleteReturns struct {
+		result1 error
+	}
+}
+
+func (fake *FakeCredentialService) List() ([]jobs.GitCredential, error) {
+	fake.listMutex.Lock()
+	fake.listArgsForCall = append(fake.listArgsForCall, struct{}{})
+	fake.listMutex.Unlock()
+	if fake.ListStub != nil {
+		return fake.ListStub()
+	} else {
+		return fake.listReturns.result1, fake.listReturns.result2
+	}
+}
+
+func (fake *FakeCredentialService) ListCallCount() int {
+	fake.listMutex.RLock()
+	defer fake.listMutex.RUnlock()
+	return len(fake.listArgsForCall)
+}
+
+func (fake *FakeCredentialService) ListReturns(result1 []jobs.GitCredential, result2 error) {
+	fake.ListStub = nil
+	fake.listReturns = struct {
+		result1 []jobs.GitCredential
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeCredentialService) Save(credential *jobs.GitCredential) error {
+	fake.saveMutex.Lock()
+	fake.saveArgsForCall = append(fake.saveArgsForCall, struct {
+		credential *jobs.GitCredential
+	}{credential})
+	fake.saveMutex.Unlock()
+	if fake.SaveStub != nil {
+		return fake.SaveStub(credential)
+	} else {
+		return fake.saveReturns.result1
+	}
+}
+
+func (fake *FakeCredentialService) SaveCallCount() int {
+	fake.saveMutex.RLock()
+	defer fake.saveMutex.RUnlock()
+	return len(fake.saveArgsForCall)
+}
+
+func (fake *FakeCredentialService) SaveArgsForCall(i int) *jobs.GitCredential {
+	fake.saveMutex.RLock()
+	defer fake.saveMutex.RUnlock()
+	return fake.saveArgsForCall[i].credential
+}
+
+func (fake *FakeCredentialService) SaveReturns(result1 error) {
+	fake.SaveStub = nil
+	fake.saveReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeCredentialService) Delete(name string) error {
+	fake.deleteMutex.Lock()
+	fake.deleteArgsForCall = append(fake.deleteArgsForCall, struct {
+		name string
+	}{name})
+	fake.deleteMutex.Unlock()
+	if fake.DeleteStub != nil {
+		return fake.DeleteStub(name)
+	} else {
+		return fake.deleteReturns.result1
+	}
+}
+
+func (fake *FakeCredentialService) DeleteCallCount() int {
+	fake.deleteMutex.RLock()
+	defer fake.deleteMutex.RUnlock()
+	return len(fake.deleteArgsForCall)
+}
+
+func (fake *FakeCredentialService) DeleteArgsForCall(i int) string {
+	fake.deleteMutex.RLock()
+	defer fake.deleteMutex.RUnlock()
+	return fake.deleteArgsForCall[i].name
+}
+
+func (fake *FakeCredentialService) DeleteReturns(result1 error) {
+	fake.DeleteStub = nil
+	fake.deleteReturns = struct {
+		result1 error
+	}{result1}
+}
+
+var _ web.CredentialService = new(FakeCredentialService)
@@ -34,6 +34,69 @@ type FakeJobService struct {
 		result1 int
 		result2 error
 	}
+	RunJobWithParametersStub        func(id string, parameters map[string]string) (int, error)
+	runJobWithParametersMutex       sync.RWMutex
+	runJobWithParametersArgsForCall []struct {
+		id         string
+		parameters map[string]string
+	}
+	runJobWithParametersReturns struct {
+		result1 int
+		result2 error
+	}
+	RebuildStub        func(id string, buildNumber int) (int, error)
+	rebuildMutex       sync.RWMutex
+	rebuildArgsForCall []struct {
+		id          string
+		buildNumber int
+	}
+	rebuildReturns struct {
+		result1 int
+		result2 error
+	}
+	ApproveStub        func(jobId string, buildNumber int, approval jobs.Approval) error
+	approveMutex       sync.RWMutex
+	approveArgsForCall []struct {
+		jobId       string
+		buildNumber int
+		approval    jobs.Approval
+	}
+	approveReturns struct {
+		result1 error
+	}
+	LocksStub        func() []jobs.LockStatus
+	locksMutex       sync.RWMutex
+	locksArgsForCall []struct{}
+	locksReturns     struct {
+		result1 []jobs.LockStatus
+	}
+	ReleaseLockStub        func(name string, jobId string, buildNumber int) error
+	releaseLockMutex       sync.RWMutex
+	releaseLockArgsForCall []struct {
+		name        string
+		jobId       string
+		buildNumber int
+	}
+	releaseLockReturns struct {
+		result1 error
+	}
+	ClearCachesStub        func(jobId string) error
+	clearCachesMutex       sync.RWMutex
+	clearCachesArgsForCall []struct {
+		jobId string
+	}
+	clearCachesReturns struct {
+		result1 error
+	}
+	TriggerJobStub        func(id string) (int, error)
+	triggerJobMutex       sync.RWMutex
+	triggerJobArgsForCall []struct {
+		id string
+	}
+	triggerJobReturns struct {
+		result1 int
+		result2 error
+	}
 	FindBuildStub        func(jobId string, buildNumber int) (jobs.Build, error)
 	findBuildMutex       sync.RWMutex
 	findBuildArgsForCall []struct {
@@ -64,6 +127,40 @@ type FakeJobService struct {
 		result1 *chunkedio.ChunkedReader
 		result2 error
 	}
+	FindCellStub        func(jobId string, buildNumber int, cellNumber int) (jobs.Build, error)
+	findCellMutex       sync.RWMutex
+	findCellArgsForCall []struct {
+		jobId       string
+		buildNumber int
+		cellNumber  int
+	}
+	findCellReturns struct {
+		result1 jobs.Build
+		result2 error
+	}
+	FindAttemptStub        func(jobId string, buildNumber int, attemptNumber int) (jobs.Build, error)
+	findAttemptMutex       sync.RWMutex
+	findAttemptArgsForCall []struct {
+		jobId         string
+		buildNumber   int
+		attemptNumber int
+	}
+	findAttemptReturns struct {
+		result1 jobs.Build
+		result2 error
+	}
+	StreamCellStub        func(jobId string, buildNumber int, cellNumber int, streamOffset int64) (*chunkedio.ChunkedReader, error)
+	streamCellMutex       sync.RWMutex
+	streamCellArgsForCall []struct {
+		jobId        string
+		buildNumber  int
+		cellNumber   int
+		streamOffset int64
+	}
+	streamCellReturns struct {
+		result1 *chunkedio.ChunkedReader
+		result2 error
+	}
 }
 
 func (fake *FakeJobService) AllLatestBuilds() ([]jobs.Build, error) {
@@ -156,6 +253,231 @@ func (fake *FakeJobService) RunJobReturns(result1 int, result2 error) {
 	}{result1, result2}
 }
 
+func (fake *FakeJobService) RunJobWithParameters(id string, parameters map[string]string) (int, error) {
+	fake.runJobWithParametersMutex.Lock()
+	fake.runJobWithParametersArgsForCall = append(fake.runJobWithParametersArgsForCall, struct {
+		id         string
+		parameters map[string]string
+	}{id, parameters})
+	fake.runJobWithParametersMutex.Unlock()
+	if fake.RunJobWithParametersStub != nil {
+		return fake.RunJobWithParametersStub(id, parameters)
+	} else {
+		return fake.runJobWithParametersReturns.result1, fake.runJobWithParametersReturns.result2
+	}
+}
+
+func (fake *FakeJobService) RunJobWithParametersCallCount() int {
+	fake.runJobWithParametersMutex.RLock()
+	defer fake.runJobWithParametersMutex.RUnlock()
+	return len(fake.runJobWithParametersArgsForCall)
+}
+
+func (fake *FakeJobService) RunJobWithParametersArgsForCall(i int) (string, map[string]string) {
+	fake.runJobWithParametersMutex.RLock()
+	defer fake.runJobWithParametersMutex.RUnlock()
+	return fake.runJobWithParametersArgsForCall[i].id, fake.runJobWithParametersArgsForCall[i].parameters
+}
+
+func (fake *FakeJobService) RunJobWithParametersReturns(result1 int, result2 error) {
+	fake.RunJobWithParametersStub = nil
+	fake.runJobWithParametersReturns = struct {
+		result1 int
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeJobService) Rebuild(id string, buildNumber int) (int, error) {
+	fake.rebuildMutex.Lock()
+	fake.rebuildArgsForCall = append(fake.rebuildArgsForCall, struct {
+		id          string
+		buildNumber int
+	}{id, buildNumber})
+	fake.rebuildMutex.Unlock()
+	if fake.RebuildStub != nil {
+		return fake.RebuildStub(id, buildNumber)
+	} else {
+		return fake.rebuildReturns.result1, fake.rebuildReturns.result2
+	}
+}
+
+func (fake *FakeJobService) RebuildCallCount() int {
+	fake.rebuildMutex.RLock()
+	defer fake.rebuildMutex.RUnlock()
+	return len(fake.rebuildArgsForCall)
+}
+
+func (fake *FakeJobService) RebuildArgsForCall(i int) (string, int) {
+	fake.rebuildMutex.RLock()
+	defer fake.rebuildMutex.RUnlock()
+	return fake.rebuildArgsForCall[i].id, fake.rebuildArgsForCall[i].buildNumber
+}
+
+func (fake *FakeJobService) RebuildReturns(result1 int, result2 error) {
+	fake.RebuildStub = nil
+	fake.rebuildReturns = struct {
+		result1 int
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeJobService) Approve(jobId string, buildNumber int, approval jobs.Approval) error {
+	fake.approveMutex.Lock()
+	fake.approveArgsForCall = append(fake.approveArgsForCall, struct {
+		jobId       string
+		buildNumber int
+		approval    jobs.Approval
+	}{jobId, buildNumber, approval})
+	fake.approveMutex.Unlock()
+	if fake.ApproveStub != nil {
+		return fake.ApproveStub(jobId, buildNumber, approval)
+	} else {
+		return fake.approveReturns.result1
+	}
+}
+
+func (fake *FakeJobService) ApproveCallCount() int {
+	fake.approveMutex.RLock()
+	defer fake.approveMutex.RUnlock()
+	return len(fake.approveArgsForCall)
+}
+
+func (fake *FakeJobService) ApproveArgsForCall(i int) (string, int, jobs.Approval) {
+	fake.approveMutex.RLock()
+	defer fake.approveMutex.RUnlock()
+	return fake.approveArgsForCall[i].jobId, fake.approveArgsForCall[i].buildNumber, fake.approveArgsForCall[i].approval
+}
+
+func (fake *FakeJobService) ApproveReturns(result1 error) {
+	fake.ApproveStub = nil
+	fake.approveReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeJobService) Locks() []jobs.LockStatus {
+	fake.locksMutex.Lock()
+	fake.locksArgsForCall = append(fake.locksArgsForCall, struct{}{})
+	fake.locksMutex.Unlock()
+	if fake.LocksStub != nil {
+		return fake.LocksStub()
+	} else {
+		return fake.locksReturns.result1
+	}
+}
+
+func (fake *FakeJobService) LocksCallCount() int {
+	fake.locksMutex.RLock()
+	defer fake.locksMutex.RUnlock()
+	return len(fake.locksArgsForCall)
+}
+
+func (fake *FakeJobService) LocksReturns(result1 []jobs.LockStatus) {
+	fake.LocksStub = nil
+	fake.locksReturns = struct {
+		result1 []jobs.LockStatus
+	}{result1}
+}
+
+func (fake *FakeJobService) ReleaseLock(name string, jobId string, buildNumber int) error {
+	fake.releaseLockMutex.Lock()
+	fake.releaseLockArgsForCall = append(fake.releaseLockArgsForCall, struct {
+		name        string
+		jobId       string
+		buildNumber int
+	}{name, jobId, buildNumber})
+	fake.releaseLockMutex.Unlock()
+	if fake.ReleaseLockStub != nil {
+		return fake.ReleaseLockStub(name, jobId, buildNumber)
+	} else {
+		return fake.releaseLockReturns.result1
+	}
+}
+
+func (fake *FakeJobService) ReleaseLockCallCount() int {
+	fake.releaseLockMutex.RLock()
+	defer fake.releaseLockMutex.RUnlock()
+	return len(fake.releaseLockArgsForCall)
+}
+
+func (fake *FakeJobService) ReleaseLockArgsForCall(i int) (string, string, int) {
+	fake.releaseLockMutex.RLock()
+	defer fake.releaseLockMutex.RUnlock()
+	return fake.releaseLockArgsForCall[i].name, fake.releaseLockArgsForCall[i].jobId, fake.releaseLockArgsForCall[i].buildNumber
+}
+
+func (fake *FakeJobService) ReleaseLockReturns(result1 error) {
+	fake.ReleaseLockStub = nil
+	fake.releaseLockReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeJobService) ClearCaches(jobId string) error {
+	fake.clearCachesMutex.Lock()
+	fake.clearCachesArgsForCall = append(fake.clearCachesArgsForCall, struct {
+		jobId string
+	}{jobId})
+	fake.clearCachesMutex.Unlock()
+	if fake.ClearCachesStub != nil {
+		return fake.ClearCachesStub(jobId)
+	} else {
+		return fake.clearCachesReturns.result1
+	}
+}
+
+func (fake *FakeJobService) ClearCachesCallCount() int {
+	fake.clearCachesMutex.RLock()
+	defer fake.clearCachesMutex.RUnlock()
+	return len(fake.clearCachesArgsForCall)
+}
+
+func (fake *FakeJobService) ClearCachesArgsForCall(i int) string {
+	fake.clearCachesMutex.RLock()
+	defer fake.clearCachesMutex.RUnlock()
+	return fake.clearCachesArgsForCall[i].jobId
+}
+
+func (fake *FakeJobService) ClearCachesReturns(result1 error) {
+	fake.ClearCachesStub = nil
+	fake.clearCachesReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeJobService) TriggerJob(id string) (int, error) {
+	fake.triggerJobMutex.Lock()
+	fake.triggerJobArgsForCall = append(fake.triggerJobArgsForCall, struct {
+		id string
+	}{id})
+	fake.triggerJobMutex.Unlock()
+	if fake.TriggerJobStub != nil {
+		return fake.TriggerJobStub(id)
+	} else {
+		return fake.triggerJobReturns.result1, fake.triggerJobReturns.result2
+	}
+}
+
+func (fake *FakeJobService) TriggerJobCallCount() int {
+	fake.triggerJobMutex.RLock()
+	defer fake.triggerJobMutex.RUnlock()
+	return len(fake.triggerJobArgsForCall)
+}
+
+func (fake *FakeJobService) TriggerJobArgsForCall(i int) string {
+	fake.triggerJobMutex.RLock()
+	defer fake.triggerJobMutex.RUnlock()
+	return fake.triggerJobArgsForCall[i].id
+}
+
+func (fake *FakeJobService) TriggerJobReturns(result1 int, result2 error) {
+	fake.TriggerJobStub = nil
+	fake.triggerJobReturns = struct {
+		result1 int
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeJobService) FindBuild(jobId string, buildNumber int) (jobs.Build, error) {
 	fake.findBuildMutex.Lock()
 	fake.findBuildArgsForCall = append(fake.findBuildArgsForCall, struct {
@@ -258,4 +580,110 @@ func (fake *FakeJobService) StreamReturns(result1 *chunkedio.ChunkedReader, resu
 	}{result1, result2}
 }
 
+func (fake *FakeJobService) FindCell(jobId string, buildNumber int, cellNumber int) (jobs.Build, error) {
+	fake.findCellMutex.Lock()
+	fake.findCellArgsForCall = append(fake.findCellArgsForCall, struct {
+		jobId       string
+		buildNumber int
+		cellNumber  int
+	}{jobId, buildNumber, cellNumber})
+	fake.findCellMutex.Unlock()
+	if fake.FindCellStub != nil {
+		return fake.FindCellStub(jobId, buildNumber, cellNumber)
+	} else {
+		return fake.findCellReturns.result1, fake.findCellReturns.result2
+	}
+}
+
+func (fake *FakeJobService) FindCellCallCount() int {
+	fake.findCellMutex.RLock()
+	defer fake.findCellMutex.RUnlock()
+	return len(fake.findCellArgsForCall)
+}
+
+func (fake *FakeJobService) FindCellArgsForCall(i int) (string, int, int) {
+	fake.findCellMutex.RLock()
+	defer fake.findCellMutex.RUnlock()
+	return fake.findCellArgsForCall[i].jobId, fake.findCellArgsForCall[i].buildNumber, fake.findCellArgsForCall[i].cellNumber
+}
+
+func (fake *FakeJobService) FindCellReturns(result1 jobs.Build, result2 error) {
+	fake.FindCellStub = nil
+	fake.findCellReturns = struct {
+		result1 jobs.Build
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeJobService) FindAttempt(jobId string, buildNumber int, attemptNumber int) (jobs.Build, error) {
+	fake.findAttemptMutex.Lock()
+	fake.findAttemptArgsForCall = append(fake.findAttemptArgsForCall, struct {
+		jobId         string
+		buildNumber   int
+		attemptNumber int
+	}{jobId, buildNumber, attemptNumber})
+	fake.findAttemptMutex.Unlock()
+	if fake.FindAttemptStub != nil {
+		return fake.FindAttemptStub(jobId, buildNumber, attemptNumber)
+	} else {
+		return fake.findAttemptReturns.result1, fake.findAttemptReturns.result2
+	}
+}
+
+func (fake *FakeJobService) FindAttemptCallCount() int {
+	fake.findAttemptMutex.RLock()
+	defer fake.findAttemptMutex.RUnlock()
+	return len(fake.findAttemptArgsForCall)
+}
+
+func (fake *FakeJobService) FindAttemptArgsForCall(i int) (string, int, int) {
+	fake.findAttemptMutex.RLock()
+	defer fake.findAttemptMutex.RUnlock()
+	return fake.findAttemptArgsForCall[i].jobId, fake.findAttemptArgsForCall[i].buildNumber, fake.findAttemptArgsForCall[i].attemptNumber
+}
+
+func (fake *FakeJobService) FindAttemptReturns(result1 jobs.Build, result2 error) {
+	fake.FindAttemptStub = nil
+	fake.findAttemptReturns = struct {
+		result1 jobs.Build
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeJobService) StreamCell(jobId string, buildNumber int, cellNumber int, streamOffset int64) (*chunkedio.ChunkedReader, error) {
+	fake.streamCellMutex.Lock()
+	fake.streamCellArgsForCall = append(fake.streamCellArgsForCall, struct {
+		jobId        string
+		buildNumber  int
+		cellNumber   int
+		streamOffset int64
+	}{jobId, buildNumber, cellNumber, streamOffset})
+	fake.streamCellMutex.Unlock()
+	if fake.StreamCellStub != nil {
+		return fake.StreamCellStub(jobId, buildNumber, cellNumber, streamOffset)
+	} else {
+		return fake.streamCellReturns.result1, fake.streamCellReturns.result2
+	}
+}
+
+func (fake *FakeJobService) StreamCellCallCount() int {
+	fake.streamCellMutex.RLock()
+	defer fake.streamCellMutex.RUnlock()
+	return len(fake.streamCellArgsForCall)
+}
+
+func (fake *FakeJobService) StreamCellArgsForCall(i int) (string, int, int, int64) {
+	fake.streamCellMutex.RLock()
+	defer fake.streamCellMutex.RUnlock()
+	return fake.streamCellArgsForCall[i].jobId, fake.streamCellArgsForCall[i].buildNumber, fake.streamCellArgsForCall[i].cellNumber, fake.streamCellArgsForCall[i].streamOffset
+}
+
+func (fake *FakeJobService) StreamCellReturns(result1 *chunkedio.ChunkedReader, result2 error) {
+	fake.StreamCellStub = nil
+	fake.streamCellReturns = struct {
+		result1 *chunkedio.ChunkedReader
+		result2 error
+	}{result1, result2}
+}
+
 var _ web.JobService = new(FakeJobService)
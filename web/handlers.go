@@ -8,8 +8,10 @@ import (
 	"net/http"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/craigfurman/woodhouse-ci/agents"
 	"github.com/craigfurman/woodhouse-ci/chunkedio"
 	"github.com/craigfurman/woodhouse-ci/jobs"
 	"github.com/craigfurman/woodhouse-ci/web/helpers"
@@ -22,20 +24,48 @@ type JobService interface {
 	AllLatestBuilds() ([]jobs.Build, error)
 	Save(job *jobs.Job) error
 	RunJob(id string) (int, error)
+	RunJobWithParameters(id string, parameters map[string]string) (int, error)
+	Rebuild(id string, buildNumber int) (int, error)
+	Approve(jobId string, buildNumber int, approval jobs.Approval) error
+	Locks() []jobs.LockStatus
+	ReleaseLock(name, jobId string, buildNumber int) error
+	ClearCaches(jobId string) error
+	TriggerJob(id string) (int, error)
 	FindBuild(jobId string, buildNumber int) (jobs.Build, error)
 	HighestBuild(jobId string) (int, error)
 	Stream(jobId string, buildNumber int, streamOffset int64) (*chunkedio.ChunkedReader, error)
+	FindCell(jobId string, buildNumber, cellNumber int) (jobs.Build, error)
+	FindAttempt(jobId string, buildNumber, attemptNumber int) (jobs.Build, error)
+	StreamCell(jobId string, buildNumber, cellNumber int, streamOffset int64) (*chunkedio.ChunkedReader, error)
+}
+
+//go:generate counterfeiter -o fake_agent_service/fake_agent_service.go . AgentService
+type AgentService interface {
+	Agents() []agents.Agent
+	SetDisabled(agentID string, disabled bool) error
+	RotateRegistrationToken() error
+}
+
+//go:generate counterfeiter -o fake_credential_service/fake_credential_service.go . CredentialService
+type CredentialService interface {
+	List() ([]jobs.GitCredential, error)
+	Save(credential *jobs.GitCredential) error
+	Delete(name string) error
 }
 
 type Handler struct {
 	*mux.Router
 
-	jobService   JobService
-	templates    map[string]*template.Template
-	templateSets map[string][]string
+	jobService        JobService
+	agentService      AgentService
+	credentialService CredentialService
+	templates         map[string]*template.Template
+	templateSets      map[string][]string
 }
 
-func New(jobService JobService, templateDir string, preloadTemplates bool) *Handler {
+// New serves the UI, the API that build agents use under /agent-api/, and
+// webhooks from forges under /hooks/.
+func New(jobService JobService, agentService AgentService, credentialService CredentialService, agentAPI, hooks http.Handler, templateDir string, preloadTemplates bool) *Handler {
 	templateSets := collectTemplates(templateDir)
 	templates := make(map[string]*template.Template)
 	if preloadTemplates {
@@ -47,10 +77,12 @@ func New(jobService JobService, templateDir string, preloadTemplates bool) *Hand
 	router := mux.NewRouter()
 
 	h := &Handler{
-		Router:       router,
-		templates:    templates,
-		templateSets: templateSets,
-		jobService:   jobService,
+		Router:            router,
+		templates:         templates,
+		templateSets:      templateSets,
+		jobService:        jobService,
+		agentService:      agentService,
+		credentialService: credentialService,
 	}
 
 	h.HandleFunc("/", h.rootHandler).Methods("GET")
@@ -59,8 +91,30 @@ func New(jobService JobService, templateDir string, preloadTemplates bool) *Hand
 	h.HandleFunc("/jobs/new", h.newJob).Methods("GET")
 	h.HandleFunc("/jobs", h.createJob).Methods("POST")
 	h.HandleFunc("/jobs/{jobId}/builds", h.createBuild).Methods("POST")
+	h.HandleFunc("/jobs/{jobId}/trigger", h.triggerBuild).Methods("POST")
+	h.HandleFunc("/jobs/{jobId}/caches/clear", h.clearCaches).Methods("POST")
 	h.HandleFunc("/jobs/{jobId}/builds/{buildId}", h.showBuild).Methods("GET")
 	h.HandleFunc("/jobs/{jobId}/builds/{buildId}/output", h.streamBuild).Methods("GET")
+	h.HandleFunc("/jobs/{jobId}/builds/{buildId}/rebuild", h.rebuild).Methods("POST")
+	h.HandleFunc("/jobs/{jobId}/builds/{buildId}/approve", h.decide(true)).Methods("POST")
+	h.HandleFunc("/jobs/{jobId}/builds/{buildId}/reject", h.decide(false)).Methods("POST")
+	h.HandleFunc("/jobs/{jobId}/builds/{buildId}/attempts/{attempt}", h.showAttempt).Methods("GET")
+	h.HandleFunc("/jobs/{jobId}/builds/{buildId}/artifacts/{path:.+}", h.downloadArtifact).Methods("GET")
+	h.HandleFunc("/jobs/{jobId}/builds/{buildId}/cells/{cell}", h.showCell).Methods("GET")
+	h.HandleFunc("/jobs/{jobId}/builds/{buildId}/cells/{cell}/output", h.streamCell).Methods("GET")
+	h.HandleFunc("/pipelines", h.showPipelines).Methods("GET")
+	h.HandleFunc("/locks", h.listLocks).Methods("GET")
+	h.HandleFunc("/locks/{name}/release", h.releaseLock).Methods("POST")
+	h.HandleFunc("/agents", h.listAgents).Methods("GET")
+	h.HandleFunc("/agents/registration-token", h.rotateRegistrationToken).Methods("POST")
+	h.HandleFunc("/agents/{agentId}/disable", h.setAgentDisabled(true)).Methods("POST")
+	h.HandleFunc("/agents/{agentId}/enable", h.setAgentDisabled(false)).Methods("POST")
+	h.HandleFunc("/credentials", h.listCredentials).Methods("GET")
+	h.HandleFunc("/credentials", h.saveCredential).Methods("POST")
+	h.HandleFunc("/credentials/{name}/delete", h.deleteCredential).Methods("POST")
+
+	h.PathPrefix("/agent-api/").Handler(agentAPI)
+	h.PathPrefix("/hooks/").Handler(hooks)
 
 	return h
 }
@@ -125,17 +179,118 @@ func (h *Handler) listJobStatuses(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) newJob(w http.ResponseWriter, r *http.Request) {
-	h.renderTemplate("new_job", nil, w)
+	credentials, err := h.credentialService.List()
+	if err != nil {
+		h.renderErrPage("listing git credentials", err, w, r)
+		return
+	}
+
+	latestBuilds, err := h.jobService.AllLatestBuilds()
+	if err != nil {
+		h.renderErrPage("listing jobs", err, w, r)
+		return
+	}
+	jobList := []jobs.Job{}
+	for _, build := range latestBuilds {
+		jobList = append(jobList, build.Job)
+	}
+
+	p := struct {
+		Credentials []jobs.GitCredential
+		Jobs        []jobs.Job
+	}{
+		Credentials: credentials,
+		Jobs:        jobList,
+	}
+	h.renderTemplate("new_job", p, w)
 }
 
 func (h *Handler) createJob(w http.ResponseWriter, r *http.Request) {
-	job := jobs.Job{
-		Name:          r.FormValue("name"),
-		Command:       r.FormValue("command"),
-		DockerImage:   r.FormValue("dockerImage"),
-		GitRepository: r.FormValue("gitRepo"),
+	checkout, err := parseCheckoutOptions(r)
+	if err != nil {
+		h.renderErrPage("saving job", err, w, r)
+		return
+	}
+
+	inputs, err := parseInputs(r.FormValue("inputs"), checkout.CredentialName)
+	if err != nil {
+		h.renderErrPage("saving job", err, w, r)
+		return
+	}
+
+	parameters, err := parseParameters(r.FormValue("parameters"))
+	if err != nil {
+		h.renderErrPage("saving job", err, w, r)
+		return
+	}
+
+	retry, err := parseRetryPolicy(r)
+	if err != nil {
+		h.renderErrPage("saving job", err, w, r)
+		return
+	}
+
+	approval, err := parseApprovalGate(r)
+	if err != nil {
+		h.renderErrPage("saving job", err, w, r)
+		return
 	}
 
+	locks, err := parseLocks(r.FormValue("locks"))
+	if err != nil {
+		h.renderErrPage("saving job", err, w, r)
+		return
+	}
+
+	caches, err := parseCaches(r.FormValue("caches"))
+	if err != nil {
+		h.renderErrPage("saving job", err, w, r)
+		return
+	}
+
+	services, err := parseServices(r.FormValue("services"))
+	if err != nil {
+		h.renderErrPage("saving job", err, w, r)
+		return
+	}
+
+	container, err := parseContainerOptions(r)
+	if err != nil {
+		h.renderErrPage("saving job", err, w, r)
+		return
+	}
+
+	job := jobs.Job{
+		Name:        r.FormValue("name"),
+		Command:     r.FormValue("command"),
+		DockerImage: r.FormValue("dockerImage"),
+		Dockerfile:  strings.TrimSpace(r.FormValue("dockerfile")),
+		Repository:  r.FormValue("repository"),
+		SourceType:  r.FormValue("sourceType"),
+		RunnerType:  r.FormValue("runnerType"),
+		AgentLabels: parseLabels(r.FormValue("agentLabels")),
+		Checkout:    checkout,
+		Inputs:      inputs,
+		Paths: jobs.PathFilter{
+			Include: parseLines(r.FormValue("includePaths")),
+			Exclude: parseLines(r.FormValue("excludePaths")),
+		},
+		Matrix: jobs.Matrix{
+			DockerImages:    parseLines(r.FormValue("matrixImages")),
+			Env:             parseLines(r.FormValue("matrixEnv")),
+			AllowedFailures: parseLines(r.FormValue("allowedFailures")),
+		},
+		Upstream:    r.Form["upstream"],
+		Artifacts:   parseLines(r.FormValue("artifacts")),
+		Parameters:  parameters,
+		Retry:       retry,
+		Approval:    approval,
+		Concurrency: r.FormValue("concurrency"),
+		Locks:       locks,
+		Caches:      caches,
+		Services:    services,
+		Container:   container,
+	}
 	if err := h.jobService.Save(&job); err != nil {
 		h.renderErrPage("saving job", err, w, r)
 		return
@@ -148,15 +303,325 @@ func (h *Handler) createJob(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func parseLabels(field string) []string {
+	var labels []string
+	for _, label := range strings.Split(field, ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+func parseCheckoutOptions(r *http.Request) (jobs.CheckoutOptions, error) {
+	options := jobs.CheckoutOptions{
+		Ref:            strings.TrimSpace(r.FormValue("ref")),
+		SingleBranch:   r.FormValue("singleBranch") == "true",
+		Submodules:     r.FormValue("submodules"),
+		CredentialName: r.FormValue("gitCredential"),
+	}
+
+	if depth := r.FormValue("checkoutDepth"); depth != "" {
+		var err error
+		if options.Depth, err = strconv.Atoi(depth); err != nil || options.Depth < 0 {
+			return options, fmt.Errorf("clone depth must be a positive number, not: %s", depth)
+		}
+	}
+
+	switch options.Submodules {
+	case "", jobs.SubmodulesNone, jobs.SubmodulesTopLevel, jobs.SubmodulesRecursive:
+	default:
+		return options, fmt.Errorf("unknown submodule mode: %s", options.Submodules)
+	}
+
+	options.SparsePaths = parseLines(r.FormValue("sparsePaths"))
+	return options, nil
+}
+
+func parseLines(field string) []string {
+	var lines []string
+	for _, line := range strings.Split(field, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// Other inputs are git repositories, one per line as "name repository [ref]".
+// They are fetched with the job's git credential.
+func parseInputs(field, credentialName string) ([]jobs.Input, error) {
+	var inputs []jobs.Input
+	for _, line := range strings.Split(field, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 3 {
+			return nil, fmt.Errorf("inputs must be given as name, repository and optionally a ref, not: %s", line)
+		}
+
+		input := jobs.Input{
+			Name:     fields[0],
+			Checkout: jobs.CheckoutOptions{CredentialName: credentialName},
+		}
+		if len(fields) > 1 {
+			input.Repository = fields[1]
+		}
+		if len(fields) > 2 {
+			input.Checkout.Ref = fields[2]
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs, nil
+}
+
+func parseRetryPolicy(r *http.Request) (jobs.RetryPolicy, error) {
+	policy := jobs.RetryPolicy{InfrastructureErrors: r.FormValue("retryInfrastructure") == "true"}
+
+	if attempts := strings.TrimSpace(r.FormValue("retryAttempts")); attempts != "" {
+		var err error
+		if policy.MaxAttempts, err = strconv.Atoi(attempts); err != nil {
+			return policy, fmt.Errorf("attempts must be a number, not: %s", attempts)
+		}
+	}
+
+	for _, field := range parseLabels(r.FormValue("retryExitStatuses")) {
+		exitStatus, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return policy, fmt.Errorf("exit statuses to retry on must be numbers, not: %s", field)
+		}
+		policy.ExitStatuses = append(policy.ExitStatuses, uint32(exitStatus))
+	}
+	return policy, nil
+}
+
+// Locks are given comma separated, each followed by ":" and its number of slots
+// if it is a pool, e.g. "staging, devices:3".
+func parseLocks(field string) ([]jobs.Lock, error) {
+	var locks []jobs.Lock
+	for _, declaration := range parseLabels(field) {
+		lock := jobs.Lock{Name: declaration}
+		if i := strings.LastIndex(declaration, ":"); i >= 0 {
+			slots, err := strconv.Atoi(declaration[i+1:])
+			if err != nil || slots < 1 {
+				return nil, fmt.Errorf("lock slots must be a number of at least 1, not: %s", declaration[i+1:])
+			}
+			lock = jobs.Lock{Name: declaration[:i], Slots: slots}
+		}
+		locks = append(locks, lock)
+	}
+	return locks, nil
+}
+
+// Caches are given one per line as "name path", followed by any files that key
+// the cache.
+func parseCaches(field string) ([]jobs.Cache, error) {
+	var caches []jobs.Cache
+	for _, line := range strings.Split(field, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("caches must be given as name, path and optionally files to key them by, not: %s", line)
+		}
+		cache := jobs.Cache{Name: fields[0], Path: fields[1]}
+		if len(fields) > 2 {
+			cache.KeyFiles = fields[2:]
+		}
+		caches = append(caches, cache)
+	}
+	return caches, nil
+}
+
+// Services are given one per line as "name image", followed by any environment
+// variables like NAME=value, then "--" and the health check command if there is
+// one, e.g. "postgres postgres:13 POSTGRES_PASSWORD=secret -- pg_isready".
+func parseServices(field string) ([]jobs.ServiceContainer, error) {
+	var services []jobs.ServiceContainer
+	for _, line := range strings.Split(field, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 || fields[1] == "--" {
+			return nil, fmt.Errorf("services must be given as name, image, optionally environment variables and -- followed by a health check, not: %s", line)
+		}
+
+		service := jobs.ServiceContainer{Name: fields[0], Image: fields[1]}
+		for i, field := range fields[2:] {
+			if field == "--" {
+				service.HealthCheck = strings.Join(fields[i+3:], " ")
+				break
+			}
+			if !strings.Contains(field, "=") {
+				return nil, fmt.Errorf("environment variables of service %s must be given as NAME=value, not: %s", service.Name, field)
+			}
+			service.Env = append(service.Env, field)
+		}
+		services = append(services, service)
+	}
+	return services, nil
+}
+
+// Whether privileged containers and volumes are allowed is up to the job
+// service's policy
+func parseContainerOptions(r *http.Request) (jobs.ContainerOptions, error) {
+	options := jobs.ContainerOptions{
+		NetworkMode:            r.FormValue("networkMode"),
+		ReadOnlyRootFilesystem: r.FormValue("readOnlyRootFilesystem") == "true",
+		User:                   strings.TrimSpace(r.FormValue("containerUser")),
+		Privileged:             r.FormValue("privileged") == "true",
+		Volumes:                parseLines(r.FormValue("volumes")),
+	}
+
+	var err error
+	if cpus := strings.TrimSpace(r.FormValue("cpus")); cpus != "" {
+		if options.CPUs, err = strconv.ParseFloat(cpus, 64); err != nil || options.CPUs <= 0 {
+			return options, fmt.Errorf("CPUs must be a positive number such as 0.5 or 2, not: %s", cpus)
+		}
+	}
+	if memory := strings.TrimSpace(r.FormValue("memory")); memory != "" {
+		if options.Memory, err = parseBytes(memory); err != nil || options.Memory <= 0 {
+			return options, fmt.Errorf("memory must be an amount such as 512m or 2g, not: %s", memory)
+		}
+	}
+	if pidsLimit := strings.TrimSpace(r.FormValue("pidsLimit")); pidsLimit != "" {
+		if options.PidsLimit, err = strconv.ParseInt(pidsLimit, 10, 64); err != nil || options.PidsLimit <= 0 {
+			return options, fmt.Errorf("the process limit must be a positive number, not: %s", pidsLimit)
+		}
+	}
+	return options, nil
+}
+
+// parseBytes reads amounts like 512m, with an optional k, m or g suffix.
+func parseBytes(amount string) (int64, error) {
+	multiplier := int64(1)
+	switch strings.ToLower(amount[len(amount)-1:]) {
+	case "k":
+		multiplier = 1 << 10
+	case "m":
+		multiplier = 1 << 20
+	case "g":
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		amount = amount[:len(amount)-1]
+	}
+	n, err := strconv.ParseInt(amount, 10, 64)
+	return n * multiplier, err
+}
+
+func parseApprovalGate(r *http.Request) (jobs.ApprovalGate, error) {
+	gate := jobs.ApprovalGate{Required: r.FormValue("requiresApproval") == "true"}
+	if timeout := strings.TrimSpace(r.FormValue("approvalTimeout")); gate.Required && timeout != "" {
+		var err error
+		if gate.Timeout, err = time.ParseDuration(timeout); err != nil || gate.Timeout < 0 {
+			return gate, fmt.Errorf("approval timeout must be a duration such as 30m, not: %s", timeout)
+		}
+	}
+	return gate, nil
+}
+
+// Parameters are given one per line as "name type", followed by the default
+// for strings and booleans, or the choices for choice parameters, the first of
+// which is the default.
+func parseParameters(field string) ([]jobs.Parameter, error) {
+	var parameters []jobs.Parameter
+	for _, line := range strings.Split(field, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("parameters must be given as name, type and optionally a default or choices, not: %s", line)
+		}
+
+		parameter := jobs.Parameter{Name: fields[0], Type: fields[1]}
+		if parameter.Type == jobs.ParameterChoice {
+			parameter.Choices = fields[2:]
+		} else {
+			parameter.Default = strings.Join(fields[2:], " ")
+		}
+		parameters = append(parameters, parameter)
+	}
+	return parameters, nil
+}
+
+// Values of a job's parameters are posted as fields named "parameter-<name>".
 func (h *Handler) createBuild(w http.ResponseWriter, r *http.Request) {
 	jobID := mux.Vars(r)["jobId"]
-	if buildNumber, err := h.jobService.RunJob(jobID); err == nil {
+	if err := r.ParseForm(); err != nil {
+		h.renderErrPage("running job", err, w, r)
+		return
+	}
+	parameters := map[string]string{}
+	for field := range r.PostForm {
+		if strings.HasPrefix(field, "parameter-") {
+			parameters[strings.TrimPrefix(field, "parameter-")] = r.PostForm.Get(field)
+		}
+	}
+
+	if buildNumber, err := h.jobService.RunJobWithParameters(jobID, parameters); err == nil {
 		http.Redirect(w, r, fmt.Sprintf("/jobs/%s/builds/%d", jobID, buildNumber), 302)
 	} else {
 		h.renderErrPage("running job", err, w, r)
 	}
 }
 
+func (h *Handler) rebuild(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["jobId"]
+	buildId, err := strconv.Atoi(mux.Vars(r)["buildId"])
+	must(err)
+
+	if buildNumber, err := h.jobService.Rebuild(jobID, buildId); err == nil {
+		http.Redirect(w, r, fmt.Sprintf("/jobs/%s/builds/%d", jobID, buildNumber), 302)
+	} else {
+		h.renderErrPage("rebuilding build", err, w, r)
+	}
+}
+
+// decide approves or rejects a build awaiting approval on behalf of the
+// approver posted, e.g. from the build's page or by a script.
+func (h *Handler) decide(approved bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobID := mux.Vars(r)["jobId"]
+		buildId, err := strconv.Atoi(mux.Vars(r)["buildId"])
+		must(err)
+
+		approval := jobs.Approval{Approved: approved, Approver: strings.TrimSpace(r.FormValue("approver"))}
+		if err := h.jobService.Approve(jobID, buildId, approval); err == nil {
+			http.Redirect(w, r, fmt.Sprintf("/jobs/%s/builds/%d", jobID, buildId), 302)
+		} else {
+			h.renderErrPage("deciding build", err, w, r)
+		}
+	}
+}
+
+func (h *Handler) clearCaches(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["jobId"]
+	if err := h.jobService.ClearCaches(jobID); err != nil {
+		h.renderErrPage("clearing caches", err, w, r)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/jobs/%s/builds/latest", jobID), 302)
+}
+
+// triggerBuild is for scripts and hooks rather than people, so it responds
+// with the location of the build instead of redirecting to it.
+func (h *Handler) triggerBuild(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["jobId"]
+	buildNumber, err := h.jobService.TriggerJob(jobID)
+	if err != nil {
+		log.Printf("error triggering job %s: %v\n", jobID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/jobs/%s/builds/%d", jobID, buildNumber))
+	w.WriteHeader(http.StatusCreated)
+}
+
 func (h *Handler) showBuild(w http.ResponseWriter, r *http.Request) {
 	jobId := mux.Vars(r)["jobId"]
 	buildIdStr := mux.Vars(r)["buildId"]
@@ -183,20 +648,67 @@ func (h *Handler) showBuild(w http.ResponseWriter, r *http.Request) {
 			buildNumbers = append(buildNumbers, i)
 		}
 
+		type cell struct {
+			Number       int
+			Name         string
+			Message      string
+			Status       string
+			AllowFailure bool
+		}
+		cells := []cell{}
+		for i, c := range build.Cells {
+			cells = append(cells, cell{
+				Number:       i + 1,
+				Name:         c.Variant,
+				Message:      helpers.Message(c),
+				Status:       helpers.Classes(c),
+				AllowFailure: c.AllowFailure,
+			})
+		}
+
+		type attempt struct {
+			Number  int
+			Message string
+			Status  string
+		}
+		attempts := []attempt{}
+		for i, a := range build.Attempts {
+			attempts = append(attempts, attempt{Number: i + 1, Message: helpers.Message(a), Status: helpers.Classes(a)})
+		}
+
+		type serviceLog struct {
+			Name   string
+			Output template.HTML
+		}
+		serviceLogs := []serviceLog{}
+		for _, l := range build.ServiceLogs {
+			serviceLogs = append(serviceLogs, serviceLog{Name: l.Name, Output: helpers.SanitisedHTML(l.Output)})
+		}
+
 		buildView := struct {
 			Build                jobs.Build
+			Attempts             []attempt
+			Parameters           []parameterField
 			BuildNumber          int
+			OutputURL            string
 			Output               template.HTML
 			BytesAlreadyReceived int
 			ExitMessage          string
 			BuildNumbers         []int
+			Cells                []cell
+			ServiceLogs          []serviceLog
 		}{
 			Build:                build,
+			Attempts:             attempts,
+			Parameters:           parameterFields(build),
 			BuildNumber:          buildId,
+			OutputURL:            fmt.Sprintf("/jobs/%s/builds/%d/output", jobId, buildId),
 			Output:               sanitizedOutput,
 			BytesAlreadyReceived: len(sanitizedOutput),
 			ExitMessage:          helpers.Message(build),
 			BuildNumbers:         buildNumbers,
+			Cells:                cells,
+			ServiceLogs:          serviceLogs,
 		}
 		h.renderTemplate("show_build", buildView, w)
 	} else {
@@ -204,6 +716,119 @@ func (h *Handler) showBuild(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type parameterField struct {
+	Name    string
+	Type    string
+	Value   string
+	Options []parameterOption
+}
+
+type parameterOption struct {
+	Value    string
+	Selected bool
+}
+
+// parameterFields fills in the form for starting a new build with the values
+// the build used, so that it can be rerun with them.
+func parameterFields(build jobs.Build) []parameterField {
+	used := map[string]string{}
+	for _, value := range build.ParameterValues {
+		used[value.Name] = value.Value
+	}
+
+	fields := []parameterField{}
+	for _, parameter := range build.Parameters {
+		value, ok := used[parameter.Name]
+		if !ok {
+			value = parameter.Default
+		}
+
+		field := parameterField{Name: parameter.Name, Type: parameter.Type, Value: value}
+		options := parameter.Choices
+		if parameter.Type == jobs.ParameterBoolean {
+			options = []string{"false", "true"}
+		}
+		for _, option := range options {
+			field.Options = append(field.Options, parameterOption{Value: option, Selected: option == value})
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// Attempts are shown as plain text, as the output of the attempt that is
+// running streams to the build page.
+func (h *Handler) showAttempt(w http.ResponseWriter, r *http.Request) {
+	jobId := mux.Vars(r)["jobId"]
+	buildId, err := strconv.Atoi(mux.Vars(r)["buildId"])
+	must(err)
+	attemptNumber, err := strconv.Atoi(mux.Vars(r)["attempt"])
+	must(err)
+
+	attempt, err := h.jobService.FindAttempt(jobId, buildId, attemptNumber)
+	if err != nil {
+		h.renderErrPage("retrieving attempt", err, w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(attempt.Output)
+}
+
+// Only files the build lists as artifacts are served, so that the path
+// cannot escape its artifacts directory.
+func (h *Handler) downloadArtifact(w http.ResponseWriter, r *http.Request) {
+	jobId := mux.Vars(r)["jobId"]
+	buildId, err := strconv.Atoi(mux.Vars(r)["buildId"])
+	must(err)
+
+	build, err := h.jobService.FindBuild(jobId, buildId)
+	if err != nil {
+		h.renderErrPage("retrieving build", err, w, r)
+		return
+	}
+
+	artifact := mux.Vars(r)["path"]
+	for _, kept := range build.Artifacts {
+		if kept == artifact {
+			http.ServeFile(w, r, filepath.Join(build.ArtifactsDir, filepath.FromSlash(artifact)))
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func (h *Handler) showCell(w http.ResponseWriter, r *http.Request) {
+	jobId := mux.Vars(r)["jobId"]
+	buildId, err := strconv.Atoi(mux.Vars(r)["buildId"])
+	must(err)
+	cellNumber, err := strconv.Atoi(mux.Vars(r)["cell"])
+	must(err)
+
+	cell, err := h.jobService.FindCell(jobId, buildId, cellNumber)
+	if err != nil {
+		h.renderErrPage("retrieving cell", err, w, r)
+		return
+	}
+
+	sanitizedOutput := helpers.SanitisedHTML(cell.Output)
+	cellView := struct {
+		Build                jobs.Build
+		BuildNumber          int
+		OutputURL            string
+		Output               template.HTML
+		BytesAlreadyReceived int
+		ExitMessage          string
+	}{
+		Build:                cell,
+		BuildNumber:          buildId,
+		OutputURL:            fmt.Sprintf("/jobs/%s/builds/%d/cells/%d/output", jobId, buildId, cellNumber),
+		Output:               sanitizedOutput,
+		BytesAlreadyReceived: len(sanitizedOutput),
+		ExitMessage:          helpers.Message(cell),
+	}
+	h.renderTemplate("show_cell", cellView, w)
+}
+
 func (h *Handler) streamBuild(w http.ResponseWriter, r *http.Request) {
 	jobId := mux.Vars(r)["jobId"]
 	buildId, err := strconv.Atoi(mux.Vars(r)["buildId"])
@@ -216,11 +841,42 @@ func (h *Handler) streamBuild(w http.ResponseWriter, r *http.Request) {
 	streamer, err := h.jobService.Stream(jobId, buildId, int64(streamOffset))
 	must(err)
 
+	streamOutput(w, streamer)
+
+	build, err := h.jobService.FindBuild(jobId, buildId)
+	must(err)
+
+	w.Write([]byte(eventMessage("end", helpers.Message(build))))
+}
+
+func (h *Handler) streamCell(w http.ResponseWriter, r *http.Request) {
+	jobId := mux.Vars(r)["jobId"]
+	buildId, err := strconv.Atoi(mux.Vars(r)["buildId"])
+	must(err)
+	cellNumber, err := strconv.Atoi(mux.Vars(r)["cell"])
+	must(err)
+
+	must(r.ParseForm())
+	streamOffset, err := strconv.Atoi(r.Form.Get("offset"))
+	must(err)
+
+	streamer, err := h.jobService.StreamCell(jobId, buildId, cellNumber, int64(streamOffset))
+	must(err)
+
+	streamOutput(w, streamer)
+
+	cell, err := h.jobService.FindCell(jobId, buildId, cellNumber)
+	must(err)
+
+	w.Write([]byte(eventMessage("end", helpers.Message(cell))))
+}
+
+func streamOutput(w http.ResponseWriter, streamer *chunkedio.ChunkedReader) {
 	w.Header().Set("Content-Type", "text/event-stream\n\n")
 
 	for {
 		bytes, done := streamer.Next()
-		_, err = w.Write([]byte(eventMessage("output", string(helpers.SanitisedHTML(bytes)))))
+		_, err := w.Write([]byte(eventMessage("output", string(helpers.SanitisedHTML(bytes)))))
 		must(err)
 
 		w.(http.Flusher).Flush()
@@ -231,11 +887,164 @@ func (h *Handler) streamBuild(w http.ResponseWriter, r *http.Request) {
 	}
 
 	must(streamer.Close())
+}
 
-	build, err := h.jobService.FindBuild(jobId, buildId)
-	must(err)
+// showPipelines draws jobs in stages, each job after the jobs it waits for.
+func (h *Handler) showPipelines(w http.ResponseWriter, r *http.Request) {
+	latestBuilds, err := h.jobService.AllLatestBuilds()
+	if err != nil {
+		h.renderErrPage("listing jobs", err, w, r)
+		return
+	}
 
-	w.Write([]byte(eventMessage("end", helpers.Message(build))))
+	type node struct {
+		ID       string
+		Name     string
+		Status   string
+		Upstream []string
+	}
+
+	names := make(map[string]string)
+	statuses := make(map[string]string)
+	jobList := []jobs.Job{}
+	for _, build := range latestBuilds {
+		names[build.ID] = build.Name
+		statuses[build.ID] = helpers.Classes(build)
+		jobList = append(jobList, build.Job)
+	}
+
+	stages := [][]node{}
+	for _, stage := range jobs.PipelineStages(jobList) {
+		nodes := []node{}
+		for _, job := range stage {
+			upstream := []string{}
+			for _, id := range job.Upstream {
+				if name, ok := names[id]; ok {
+					upstream = append(upstream, name)
+				}
+			}
+			nodes = append(nodes, node{ID: job.ID, Name: job.Name, Status: statuses[job.ID], Upstream: upstream})
+		}
+		stages = append(stages, nodes)
+	}
+
+	p := struct {
+		Stages [][]node
+	}{
+		Stages: stages,
+	}
+	h.renderTemplate("show_pipelines", p, w)
+}
+
+func (h *Handler) listLocks(w http.ResponseWriter, r *http.Request) {
+	p := struct {
+		Locks []jobs.LockStatus
+	}{
+		Locks: h.jobService.Locks(),
+	}
+	h.renderTemplate("list_locks", p, w)
+}
+
+// releaseLock frees a lock held by the build posted, e.g. one that is stuck.
+func (h *Handler) releaseLock(w http.ResponseWriter, r *http.Request) {
+	buildNumber, err := strconv.Atoi(r.FormValue("buildNumber"))
+	if err != nil {
+		h.renderErrPage("releasing lock", fmt.Errorf("invalid build number: %s", r.FormValue("buildNumber")), w, r)
+		return
+	}
+	if err := h.jobService.ReleaseLock(mux.Vars(r)["name"], r.FormValue("jobId"), buildNumber); err != nil {
+		h.renderErrPage("releasing lock", err, w, r)
+		return
+	}
+	http.Redirect(w, r, "/locks", 302)
+}
+
+func (h *Handler) listAgents(w http.ResponseWriter, r *http.Request) {
+	type agentRow struct {
+		agents.Agent
+		State    string
+		LastSeen string
+	}
+
+	rows := []agentRow{}
+	for _, agent := range h.agentService.Agents() {
+		rows = append(rows, agentRow{
+			Agent:    agent,
+			State:    helpers.AgentState(agent),
+			LastSeen: agent.LastSeen.Format(time.RFC1123),
+		})
+	}
+
+	p := struct {
+		Agents       []agentRow
+		TokenRotated bool
+	}{
+		Agents:       rows,
+		TokenRotated: r.FormValue("tokenRotated") == "true",
+	}
+	h.renderTemplate("list_agents", p, w)
+}
+
+func (h *Handler) setAgentDisabled(disabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h.agentService.SetDisabled(mux.Vars(r)["agentId"], disabled); err != nil {
+			h.renderErrPage("changing agent", err, w, r)
+			return
+		}
+		http.Redirect(w, r, "/agents", 302)
+	}
+}
+
+func (h *Handler) rotateRegistrationToken(w http.ResponseWriter, r *http.Request) {
+	if err := h.agentService.RotateRegistrationToken(); err != nil {
+		h.renderErrPage("rotating agent registration token", err, w, r)
+		return
+	}
+	http.Redirect(w, r, "/agents?tokenRotated=true", 302)
+}
+
+func (h *Handler) listCredentials(w http.ResponseWriter, r *http.Request) {
+	credentials, err := h.credentialService.List()
+	if err != nil {
+		h.renderErrPage("listing git credentials", err, w, r)
+		return
+	}
+
+	p := struct {
+		Credentials []jobs.GitCredential
+	}{
+		Credentials: credentials,
+	}
+	h.renderTemplate("list_credentials", p, w)
+}
+
+func (h *Handler) saveCredential(w http.ResponseWriter, r *http.Request) {
+	credential := jobs.GitCredential{
+		Name:       strings.TrimSpace(r.FormValue("name")),
+		Type:       r.FormValue("type"),
+		Username:   r.FormValue("username"),
+		Secret:     r.FormValue("secret"),
+		KnownHosts: r.FormValue("knownHosts"),
+	}
+	if credential.Type == jobs.CredentialSSH {
+		credential.Username = ""
+	} else {
+		credential.KnownHosts = ""
+	}
+
+	if err := h.credentialService.Save(&credential); err != nil {
+		h.renderErrPage("saving git credential", err, w, r)
+		return
+	}
+	http.Redirect(w, r, "/credentials", 302)
+}
+
+func (h *Handler) deleteCredential(w http.ResponseWriter, r *http.Request) {
+	if err := h.credentialService.Delete(mux.Vars(r)["name"]); err != nil {
+		h.renderErrPage("deleting git credential", err, w, r)
+		return
+	}
+	http.Redirect(w, r, "/credentials", 302)
 }
 
 func eventMessage(eventName, data string) string {
@@ -278,13 +1087,23 @@ func collectTemplates(templateDir string) map[string][]string {
 	listJobs := "list_jobs"
 	newJob := "new_job"
 	showBuild := "show_build"
+	showCell := "show_cell"
+	showPipelines := "show_pipelines"
+	listLocks := "list_locks"
+	listAgents := "list_agents"
+	listCredentials := "list_credentials"
 	errorPage := "error"
 
 	return map[string][]string{
-		listJobs:  {layoutFor("outer"), viewFor(listJobs)},
-		newJob:    {layoutFor("outer"), layoutFor("single_column"), viewFor(newJob)},
-		showBuild: {layoutFor("outer"), layoutFor("single_column"), viewFor(showBuild)},
-		errorPage: {layoutFor("outer"), layoutFor("single_column"), viewFor(errorPage)},
+		listJobs:        {layoutFor("outer"), viewFor(listJobs)},
+		newJob:          {layoutFor("outer"), layoutFor("single_column"), viewFor(newJob)},
+		showBuild:       {layoutFor("outer"), layoutFor("single_column"), viewFor(showBuild)},
+		showCell:        {layoutFor("outer"), layoutFor("single_column"), viewFor(showCell)},
+		showPipelines:   {layoutFor("outer"), layoutFor("single_column"), viewFor(showPipelines)},
+		listLocks:       {layoutFor("outer"), layoutFor("single_column"), viewFor(listLocks)},
+		listAgents:      {layoutFor("outer"), layoutFor("single_column"), viewFor(listAgents)},
+		listCredentials: {layoutFor("outer"), layoutFor("single_column"), viewFor(listCredentials)},
+		errorPage:       {layoutFor("outer"), layoutFor("single_column"), viewFor(errorPage)},
 	}
 }
 
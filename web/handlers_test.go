@@ -3,12 +3,19 @@ package web_test
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/craigfurman/woodhouse-ci/agents"
 	"github.com/craigfurman/woodhouse-ci/jobs"
 	"github.com/craigfurman/woodhouse-ci/web"
+	"github.com/craigfurman/woodhouse-ci/web/fake_agent_service"
+	"github.com/craigfurman/woodhouse-ci/web/fake_credential_service"
 	"github.com/craigfurman/woodhouse-ci/web/fake_job_service"
 	"github.com/craigfurman/woodhouse-ci/web/pageobjects"
 
@@ -23,7 +30,9 @@ var _ = Describe("Handlers", func() {
 		server *httptest.Server
 		page   *agouti.Page
 
-		jobService *fake_job_service.FakeJobService
+		jobService        *fake_job_service.FakeJobService
+		agentService      *fake_agent_service.FakeAgentService
+		credentialService *fake_credential_service.FakeCredentialService
 	)
 
 	BeforeEach(func() {
@@ -31,7 +40,16 @@ var _ = Describe("Handlers", func() {
 		Expect(err).NotTo(HaveOccurred())
 
 		jobService = new(fake_job_service.FakeJobService)
-		handler := web.New(jobService, filepath.Join(cwd, "templates"), true)
+		agentService = new(fake_agent_service.FakeAgentService)
+		credentialService = new(fake_credential_service.FakeCredentialService)
+		credentialService.ListReturns([]jobs.GitCredential{{Name: "deploy-key", Type: jobs.CredentialSSH}}, nil)
+		agentAPI := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		})
+		hooks := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+		})
+		handler := web.New(jobService, agentService, credentialService, agentAPI, hooks, filepath.Join(cwd, "templates"), true)
 		server = httptest.NewServer(handler)
 
 		page, err = agoutiDriver.NewPage()
@@ -60,7 +78,9 @@ var _ = Describe("Handlers", func() {
 					Expect(job.Name).To(Equal("Alice"))
 					Expect(job.Command).To(Equal("bork bork"))
 					Expect(job.DockerImage).To(Equal("user/image:tag"))
-					Expect(job.GitRepository).To(Equal("some-repo.git"))
+					Expect(job.Repository).To(Equal("some-repo.git"))
+					Expect(job.SourceType).To(Equal(jobs.SourceGit))
+					Expect(job.RunnerType).To(Equal(jobs.RunnerContainer))
 					job.ID = "some-id"
 					return nil
 				}
@@ -92,6 +112,403 @@ var _ = Describe("Handlers", func() {
 			})
 		})
 
+		Context("when the job has checkout options", func() {
+			It("saves them", func() {
+				jobService.SaveStub = func(job *jobs.Job) error {
+					job.ID = "some-id"
+					return nil
+				}
+				jobService.FindBuildReturns(jobs.Build{Job: jobs.Job{Name: "monorepo"}}, nil)
+
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/new", server.URL))).To(Succeed())
+				pageobjects.NewNewJobPage(page).
+					SetCheckoutOptions("1", "Top-level only", "services/api\nlibs").
+					CreateJob("monorepo", "make", "golang", "monorepo.git")
+
+				Expect(jobService.SaveArgsForCall(0).Checkout).To(Equal(jobs.CheckoutOptions{
+					Depth:        1,
+					SingleBranch: true,
+					Submodules:   jobs.SubmodulesTopLevel,
+					SparsePaths:  []string{"services/api", "libs"},
+				}))
+			})
+		})
+
+		Context("when the job has other inputs", func() {
+			It("saves them with the ref to build", func() {
+				jobService.SaveStub = func(job *jobs.Job) error {
+					job.ID = "some-id"
+					return nil
+				}
+				jobService.FindBuildReturns(jobs.Build{Job: jobs.Job{Name: "integration"}}, nil)
+
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/new", server.URL))).To(Succeed())
+				Expect(page.Find("form select#gitCredential").Select("deploy-key")).To(Succeed())
+				pageobjects.NewNewJobPage(page).
+					SetInputs("release", "lib git@example.com:lib.git v1.2\n\nfixtures fixtures.git").
+					CreateJob("integration", "make", "golang", "app.git")
+
+				job := jobService.SaveArgsForCall(0)
+				Expect(job.Checkout.Ref).To(Equal("release"))
+				Expect(job.Inputs).To(Equal([]jobs.Input{
+					{Name: "lib", Repository: "git@example.com:lib.git", Checkout: jobs.CheckoutOptions{Ref: "v1.2", CredentialName: "deploy-key"}},
+					{Name: "fixtures", Repository: "fixtures.git", Checkout: jobs.CheckoutOptions{CredentialName: "deploy-key"}},
+				}))
+			})
+		})
+
+		Context("when the job has path filters", func() {
+			It("saves them", func() {
+				jobService.SaveStub = func(job *jobs.Job) error {
+					job.ID = "some-id"
+					return nil
+				}
+				jobService.FindBuildReturns(jobs.Build{Job: jobs.Job{Name: "api"}}, nil)
+
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/new", server.URL))).To(Succeed())
+				Expect(page.Find("form textarea#includePaths").Fill("services/api/\nlibs/")).To(Succeed())
+				Expect(page.Find("form textarea#excludePaths").Fill("*.md")).To(Succeed())
+				pageobjects.NewNewJobPage(page).CreateJob("api", "make", "golang", "monorepo.git")
+
+				Expect(jobService.SaveArgsForCall(0).Paths).To(Equal(jobs.PathFilter{
+					Include: []string{"services/api/", "libs/"},
+					Exclude: []string{"*.md"},
+				}))
+			})
+		})
+
+		Context("when the job has parameters", func() {
+			It("saves them", func() {
+				jobService.SaveStub = func(job *jobs.Job) error {
+					job.ID = "some-id"
+					return nil
+				}
+				jobService.FindBuildReturns(jobs.Build{Job: jobs.Job{Name: "deploy"}}, nil)
+
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/new", server.URL))).To(Succeed())
+				pageobjects.NewNewJobPage(page).
+					SetParameters("VERSION string release 1\nTARGET choice staging production\nDRY_RUN boolean").
+					CreateJob("deploy", "make deploy", "golang", "app.git")
+
+				Expect(jobService.SaveArgsForCall(0).Parameters).To(Equal([]jobs.Parameter{
+					{Name: "VERSION", Type: jobs.ParameterString, Default: "release 1"},
+					{Name: "TARGET", Type: jobs.ParameterChoice, Choices: []string{"staging", "production"}},
+					{Name: "DRY_RUN", Type: jobs.ParameterBoolean},
+				}))
+			})
+		})
+
+		Context("when the job retries failed builds", func() {
+			It("saves its retry policy", func() {
+				jobService.SaveStub = func(job *jobs.Job) error {
+					job.ID = "some-id"
+					return nil
+				}
+				jobService.FindBuildReturns(jobs.Build{Job: jobs.Job{Name: "flaky"}}, nil)
+
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/new", server.URL))).To(Succeed())
+				pageobjects.NewNewJobPage(page).
+					SetRetryPolicy("3", "1, 2", true).
+					CreateJob("flaky", "make test", "golang", "app.git")
+
+				Expect(jobService.SaveArgsForCall(0).Retry).To(Equal(jobs.RetryPolicy{
+					MaxAttempts:          3,
+					ExitStatuses:         []uint32{1, 2},
+					InfrastructureErrors: true,
+				}))
+			})
+		})
+
+		Context("when the job limits its container", func() {
+			BeforeEach(func() {
+				jobService.SaveStub = func(job *jobs.Job) error {
+					job.ID = "some-id"
+					return nil
+				}
+				jobService.FindBuildReturns(jobs.Build{Job: jobs.Job{Name: "build"}}, nil)
+			})
+
+			It("saves the limits and security options", func() {
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/new", server.URL))).To(Succeed())
+				pageobjects.NewNewJobPage(page).
+					LimitContainer("1.5", "512m", "256").
+					SecureContainer("No network", "1000:1000").
+					AllowHostAccess("/var/cache/apt:/var/cache/apt:ro").
+					CreateJob("build", "make", "golang", "app.git")
+
+				Expect(jobService.SaveArgsForCall(0).Container).To(Equal(jobs.ContainerOptions{
+					CPUs:                   1.5,
+					Memory:                 512 * 1024 * 1024,
+					PidsLimit:              256,
+					NetworkMode:            jobs.NetworkNone,
+					ReadOnlyRootFilesystem: true,
+					User:                   "1000:1000",
+					Privileged:             true,
+					Volumes:                []string{"/var/cache/apt:/var/cache/apt:ro"},
+				}))
+			})
+
+			It("does not save unparseable limits", func() {
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/new", server.URL))).To(Succeed())
+				pageobjects.NewNewJobPage(page).LimitContainer("", "lots", "")
+				Expect(page.Find("form input#name").Fill("build")).To(Succeed())
+				Expect(page.Find("form button[type=submit]").Click()).To(Succeed())
+				Eventually(page.Find(".errorTrace")).Should(HaveText("memory must be an amount such as 512m or 2g, not: lots"))
+				Expect(jobService.SaveCallCount()).To(Equal(0))
+			})
+
+			It("shows why the job service did not allow the options", func() {
+				jobService.SaveReturns(errors.New("saving job build. Cause: mounting /etc is not allowed"))
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/new", server.URL))).To(Succeed())
+				pageobjects.NewNewJobPage(page).AllowHostAccess("/etc:/host-etc")
+				Expect(page.Find("form input#name").Fill("build")).To(Succeed())
+				Expect(page.Find("form button[type=submit]").Click()).To(Succeed())
+				Eventually(page.Find(".errorTrace")).Should(HaveText("saving job build. Cause: mounting /etc is not allowed"))
+			})
+		})
+
+		Context("when the job's image is built from a Dockerfile", func() {
+			It("saves the path of the Dockerfile", func() {
+				jobService.SaveStub = func(job *jobs.Job) error {
+					job.ID = "some-id"
+					return nil
+				}
+				jobService.FindBuildReturns(jobs.Build{Job: jobs.Job{Name: "build"}}, nil)
+
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/new", server.URL))).To(Succeed())
+				pageobjects.NewNewJobPage(page).
+					SetDockerfile("ci/Dockerfile").
+					CreateJob("build", "make", "", "app.git")
+
+				saved := jobService.SaveArgsForCall(0)
+				Expect(saved.Dockerfile).To(Equal("ci/Dockerfile"))
+				Expect(saved.DockerImage).To(BeEmpty())
+			})
+		})
+
+		Context("when the job has service containers", func() {
+			It("saves its services", func() {
+				jobService.SaveStub = func(job *jobs.Job) error {
+					job.ID = "some-id"
+					return nil
+				}
+				jobService.FindBuildReturns(jobs.Build{Job: jobs.Job{Name: "integration"}}, nil)
+
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/new", server.URL))).To(Succeed())
+				pageobjects.NewNewJobPage(page).
+					SetServices("postgres postgres:13 POSTGRES_USER=ci POSTGRES_PASSWORD=secret -- pg_isready -U ci\nredis redis").
+					CreateJob("integration", "make integration", "golang", "app.git")
+
+				Expect(jobService.SaveArgsForCall(0).Services).To(Equal([]jobs.ServiceContainer{
+					{Name: "postgres", Image: "postgres:13", Env: []string{"POSTGRES_USER=ci", "POSTGRES_PASSWORD=secret"}, HealthCheck: "pg_isready -U ci"},
+					{Name: "redis", Image: "redis"},
+				}))
+			})
+
+			It("does not save services without an image", func() {
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/new", server.URL))).To(Succeed())
+				pageobjects.NewNewJobPage(page).SetServices("postgres -- pg_isready")
+				Expect(page.Find("form input#name").Fill("integration")).To(Succeed())
+				Expect(page.Find("form button[type=submit]").Click()).To(Succeed())
+				Eventually(page.Find(".errorTrace")).Should(HaveText("services must be given as name, image, optionally environment variables and -- followed by a health check, not: postgres -- pg_isready"))
+				Expect(jobService.SaveCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the job keeps caches", func() {
+			It("saves its caches", func() {
+				jobService.SaveStub = func(job *jobs.Job) error {
+					job.ID = "some-id"
+					return nil
+				}
+				jobService.FindBuildReturns(jobs.Build{Job: jobs.Job{Name: "build"}}, nil)
+
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/new", server.URL))).To(Succeed())
+				pageobjects.NewNewJobPage(page).
+					SetCaches("go-modules /go/pkg/mod go.sum\nnode-modules node_modules").
+					CreateJob("build", "make", "golang", "app.git")
+
+				Expect(jobService.SaveArgsForCall(0).Caches).To(Equal([]jobs.Cache{
+					{Name: "go-modules", Path: "/go/pkg/mod", KeyFiles: []string{"go.sum"}},
+					{Name: "node-modules", Path: "node_modules"},
+				}))
+			})
+
+			It("does not save caches without a path", func() {
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/new", server.URL))).To(Succeed())
+				pageobjects.NewNewJobPage(page).SetCaches("go-modules")
+				Expect(page.Find("form input#name").Fill("build")).To(Succeed())
+				Expect(page.Find("form button[type=submit]").Click()).To(Succeed())
+				Eventually(page.Find(".errorTrace")).Should(HaveText("caches must be given as name, path and optionally files to key them by, not: go-modules"))
+				Expect(jobService.SaveCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the job holds locks", func() {
+			It("saves its locks", func() {
+				jobService.SaveStub = func(job *jobs.Job) error {
+					job.ID = "some-id"
+					return nil
+				}
+				jobService.FindBuildReturns(jobs.Build{Job: jobs.Job{Name: "deploy"}}, nil)
+
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/new", server.URL))).To(Succeed())
+				pageobjects.NewNewJobPage(page).
+					SetLocks("staging, devices:3").
+					CreateJob("deploy", "make deploy", "golang", "app.git")
+
+				Expect(jobService.SaveArgsForCall(0).Locks).To(Equal([]jobs.Lock{{Name: "staging"}, {Name: "devices", Slots: 3}}))
+			})
+
+			It("does not save pools without slots", func() {
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/new", server.URL))).To(Succeed())
+				pageobjects.NewNewJobPage(page).SetLocks("devices:0")
+				Expect(page.Find("form input#name").Fill("deploy")).To(Succeed())
+				Expect(page.Find("form button[type=submit]").Click()).To(Succeed())
+				Eventually(page.Find(".errorTrace")).Should(HaveText("lock slots must be a number of at least 1, not: 0"))
+				Expect(jobService.SaveCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the job runs one build at a time", func() {
+			It("saves its concurrency policy", func() {
+				jobService.SaveStub = func(job *jobs.Job) error {
+					job.ID = "some-id"
+					return nil
+				}
+				jobService.FindBuildReturns(jobs.Build{Job: jobs.Job{Name: "deploy"}}, nil)
+
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/new", server.URL))).To(Succeed())
+				pageobjects.NewNewJobPage(page).
+					SetConcurrency("Stop the running build and drop queued builds").
+					CreateJob("deploy", "make deploy", "golang", "app.git")
+
+				Expect(jobService.SaveArgsForCall(0).Concurrency).To(Equal(jobs.ConcurrencySupersede))
+			})
+		})
+
+		Context("when the job requires approval", func() {
+			It("saves its approval gate", func() {
+				jobService.SaveStub = func(job *jobs.Job) error {
+					job.ID = "some-id"
+					return nil
+				}
+				jobService.FindBuildReturns(jobs.Build{Job: jobs.Job{Name: "deploy"}}, nil)
+
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/new", server.URL))).To(Succeed())
+				pageobjects.NewNewJobPage(page).
+					RequireApproval("30m").
+					CreateJob("deploy", "make deploy", "golang", "app.git")
+
+				Expect(jobService.SaveArgsForCall(0).Approval).To(Equal(jobs.ApprovalGate{Required: true, Timeout: 30 * time.Minute}))
+			})
+
+			It("does not save jobs with an invalid timeout", func() {
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/new", server.URL))).To(Succeed())
+				pageobjects.NewNewJobPage(page).RequireApproval("soon")
+				Expect(page.Find("form input#name").Fill("deploy")).To(Succeed())
+				Expect(page.Find("form button[type=submit]").Click()).To(Succeed())
+				Eventually(page.Find(".errorTrace")).Should(HaveText("approval timeout must be a duration such as 30m, not: soon"))
+				Expect(jobService.SaveCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the job is part of a pipeline", func() {
+			It("saves the jobs it waits for and its artifacts", func() {
+				jobService.AllLatestBuildsReturns([]jobs.Build{
+					{Job: jobs.Job{ID: "build-id", Name: "build"}},
+					{Job: jobs.Job{ID: "test-id", Name: "test"}},
+					{Job: jobs.Job{ID: "lint-id", Name: "lint"}},
+				}, nil)
+				jobService.SaveStub = func(job *jobs.Job) error {
+					job.ID = "some-id"
+					return nil
+				}
+				jobService.FindBuildReturns(jobs.Build{Job: jobs.Job{Name: "deploy"}}, nil)
+
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/new", server.URL))).To(Succeed())
+				pageobjects.NewNewJobPage(page).
+					SetPipeline([]string{"build", "test"}, "dist/\n*.tar.gz").
+					CreateJob("deploy", "make deploy", "golang", "app.git")
+
+				saved := jobService.SaveArgsForCall(0)
+				Expect(saved.Upstream).To(Equal([]string{"build-id", "test-id"}))
+				Expect(saved.Artifacts).To(Equal([]string{"dist/", "*.tar.gz"}))
+			})
+		})
+
+		Context("when the job has a matrix", func() {
+			It("saves it", func() {
+				jobService.SaveStub = func(job *jobs.Job) error {
+					job.ID = "some-id"
+					return nil
+				}
+				jobService.FindBuildReturns(jobs.Build{Job: jobs.Job{Name: "lib"}}, nil)
+
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/new", server.URL))).To(Succeed())
+				pageobjects.NewNewJobPage(page).
+					SetMatrix("golang:1.21\ngolang:1.22", "GOARCH=amd64\nGOARCH=386 CGO_ENABLED=0", "golang:1.22 GOARCH=386").
+					CreateJob("lib", "go test ./...", "golang", "lib.git")
+
+				Expect(jobService.SaveArgsForCall(0).Matrix).To(Equal(jobs.Matrix{
+					DockerImages:    []string{"golang:1.21", "golang:1.22"},
+					Env:             []string{"GOARCH=amd64", "GOARCH=386 CGO_ENABLED=0"},
+					AllowedFailures: []string{"golang:1.22 GOARCH=386"},
+				}))
+			})
+		})
+
+		Context("when the source is not a git repository", func() {
+			It("saves the source type", func() {
+				jobService.SaveStub = func(job *jobs.Job) error {
+					job.ID = "some-id"
+					return nil
+				}
+				jobService.FindBuildReturns(jobs.Build{Job: jobs.Job{Name: "tarball"}}, nil)
+
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/new", server.URL))).To(Succeed())
+				Expect(page.Find("form select#sourceType").Select("Archive URL (.tar, .tar.gz or .zip)")).To(Succeed())
+				pageobjects.NewNewJobPage(page).CreateJob("tarball", "make", "golang", "https://example.com/project.tar.gz")
+
+				job := jobService.SaveArgsForCall(0)
+				Expect(job.SourceType).To(Equal(jobs.SourceArchive))
+				Expect(job.Repository).To(Equal("https://example.com/project.tar.gz"))
+			})
+		})
+
+		Context("when the job fetches with a git credential", func() {
+			It("saves the credential name", func() {
+				jobService.SaveStub = func(job *jobs.Job) error {
+					job.ID = "some-id"
+					return nil
+				}
+				jobService.FindBuildReturns(jobs.Build{Job: jobs.Job{Name: "private"}}, nil)
+
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/new", server.URL))).To(Succeed())
+				Expect(page.Find("form select#gitCredential").Select("deploy-key")).To(Succeed())
+				pageobjects.NewNewJobPage(page).CreateJob("private", "make", "golang", "git@example.com:private.git")
+
+				Expect(jobService.SaveArgsForCall(0).Checkout.CredentialName).To(Equal("deploy-key"))
+			})
+		})
+
+		Context("when the job runs on a build agent", func() {
+			It("saves the required agent labels", func() {
+				jobService.SaveStub = func(job *jobs.Job) error {
+					job.ID = "some-id"
+					return nil
+				}
+				jobService.FindBuildReturns(jobs.Build{Job: jobs.Job{Name: "Bob"}}, nil)
+
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/new", server.URL))).To(Succeed())
+				pageobjects.NewNewJobPage(page).CreateAgentJob("Bob", "make", "", "some-repo.git", "linux, arm64,")
+
+				job := jobService.SaveArgsForCall(0)
+				Expect(job.RunnerType).To(Equal(jobs.RunnerAgent))
+				Expect(job.AgentLabels).To(Equal([]string{"linux", "arm64"}))
+			})
+		})
+
 		Context("when saving the job fails", func() {
 			BeforeEach(func() {
 				jobService.SaveReturns(errors.New("oh dear!"))
@@ -107,6 +524,160 @@ var _ = Describe("Handlers", func() {
 		})
 	})
 
+	Describe("starting a build of a job with parameters", func() {
+		BeforeEach(func() {
+			jobService.FindBuildReturns(jobs.Build{
+				Job: jobs.Job{ID: "deploy-id", Name: "deploy", Parameters: []jobs.Parameter{
+					{Name: "VERSION", Type: jobs.ParameterString, Default: "latest"},
+					{Name: "TARGET", Type: jobs.ParameterChoice, Choices: []string{"staging", "production"}},
+					{Name: "DRY_RUN", Type: jobs.ParameterBoolean, Default: "true"},
+				}},
+				Finished: true,
+				ParameterValues: []jobs.ParameterValue{
+					{Name: "VERSION", Value: "v1.2"},
+					{Name: "TARGET", Value: "production"},
+					{Name: "DRY_RUN", Value: "true"},
+				},
+			}, nil)
+			jobService.HighestBuildReturns(3, nil)
+			jobService.RunJobWithParametersReturns(4, nil)
+		})
+
+		It("shows the values the build used", func() {
+			Expect(page.Navigate(fmt.Sprintf("%s/jobs/deploy-id/builds/3", server.URL))).To(Succeed())
+			Eventually(page.Find("#buildParameters")).Should(MatchText("TARGET\\s+production"))
+		})
+
+		It("reruns the build with the values it used unless they are changed", func() {
+			Expect(page.Navigate(fmt.Sprintf("%s/jobs/deploy-id/builds/3", server.URL))).To(Succeed())
+			Eventually(page.Find("#parameter-VERSION")).Should(HaveAttribute("value", "v1.2"))
+			Expect(page.Find("#parameter-DRY_RUN").Select("false")).To(Succeed())
+			pageobjects.NewShowBuildPage(page).ScheduleNewBuild()
+
+			Expect(jobService.RunJobWithParametersCallCount()).To(Equal(1))
+			jobID, parameters := jobService.RunJobWithParametersArgsForCall(0)
+			Expect(jobID).To(Equal("deploy-id"))
+			Expect(parameters).To(Equal(map[string]string{"VERSION": "v1.2", "TARGET": "production", "DRY_RUN": "false"}))
+		})
+	})
+
+	Describe("rebuilding a build", func() {
+		It("starts a rebuild of the build and shows it", func() {
+			jobService.FindBuildReturns(jobs.Build{Job: jobs.Job{ID: "some-id", Name: "Woodhouse"}, Finished: true}, nil)
+			jobService.HighestBuildReturns(42, nil)
+			jobService.RebuildReturns(43, nil)
+
+			Expect(page.Navigate(fmt.Sprintf("%s/jobs/some-id/builds/42", server.URL))).To(Succeed())
+			Eventually(page.Find("#rebuildBuild")).Should(HaveText("Rebuild #42"))
+			pageobjects.NewShowBuildPage(page).Rebuild()
+
+			Eventually(page).Should(HaveURL(fmt.Sprintf("%s/jobs/some-id/builds/43", server.URL)))
+			Expect(jobService.RebuildCallCount()).To(Equal(1))
+			jobID, buildNumber := jobService.RebuildArgsForCall(0)
+			Expect(jobID).To(Equal("some-id"))
+			Expect(buildNumber).To(Equal(42))
+		})
+
+		Context("when the build cannot be rebuilt", func() {
+			It("shows the error page", func() {
+				jobService.FindBuildReturns(jobs.Build{Job: jobs.Job{ID: "some-id", Name: "Woodhouse"}, Finished: true}, nil)
+				jobService.RebuildReturns(0, errors.New("unknown parameter: OLD"))
+
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/some-id/builds/1", server.URL))).To(Succeed())
+				Eventually(page.Find("#rebuildBuild")).Should(BeFound())
+				Expect(page.Find("#rebuildBuild").Click()).To(Succeed())
+				Eventually(page.Find(".errorTrace")).Should(HaveText("unknown parameter: OLD"))
+			})
+		})
+	})
+
+	Describe("clearing the caches of a job", func() {
+		It("clears them and shows the job's latest build", func() {
+			jobService.FindBuildReturns(jobs.Build{
+				Job:      jobs.Job{ID: "some-id", Name: "build", Caches: []jobs.Cache{{Name: "go-modules", Path: "/go/pkg/mod"}}},
+				Finished: true,
+			}, nil)
+			jobService.HighestBuildReturns(42, nil)
+
+			Expect(page.Navigate(fmt.Sprintf("%s/jobs/some-id/builds/41", server.URL))).To(Succeed())
+			Eventually(page.Find("#clearCachesButton")).Should(HaveAttribute("title", "go-modules"))
+			pageobjects.NewShowBuildPage(page).ClearCaches()
+
+			Eventually(jobService.ClearCachesCallCount).Should(Equal(1))
+			Expect(jobService.ClearCachesArgsForCall(0)).To(Equal("some-id"))
+			Eventually(page).Should(HaveURL(fmt.Sprintf("%s/jobs/some-id/builds/42", server.URL)))
+		})
+
+		It("is not offered for jobs without caches", func() {
+			jobService.FindBuildReturns(jobs.Build{Job: jobs.Job{ID: "some-id", Name: "build"}, Finished: true}, nil)
+			Expect(page.Navigate(fmt.Sprintf("%s/jobs/some-id/builds/1", server.URL))).To(Succeed())
+			Eventually(page.Find("#jobTitle")).Should(BeFound())
+			Expect(page.Find("#clearCaches")).NotTo(BeFound())
+		})
+	})
+
+	Describe("deciding a build awaiting approval", func() {
+		BeforeEach(func() {
+			jobService.FindBuildReturns(jobs.Build{
+				Job:              jobs.Job{ID: "some-id", Name: "deploy", Approval: jobs.ApprovalGate{Required: true}},
+				AwaitingApproval: true,
+			}, nil)
+			jobService.HighestBuildReturns(42, nil)
+			Expect(page.Navigate(fmt.Sprintf("%s/jobs/some-id/builds/42", server.URL))).To(Succeed())
+			Eventually(page.Find("#approval")).Should(BeFound())
+		})
+
+		It("approves the build on behalf of the approver", func() {
+			pageobjects.NewShowBuildPage(page).Approve("alice")
+
+			Eventually(jobService.ApproveCallCount).Should(Equal(1))
+			jobID, buildNumber, approval := jobService.ApproveArgsForCall(0)
+			Expect(jobID).To(Equal("some-id"))
+			Expect(buildNumber).To(Equal(42))
+			Expect(approval).To(Equal(jobs.Approval{Approved: true, Approver: "alice"}))
+			Eventually(page).Should(HaveURL(fmt.Sprintf("%s/jobs/some-id/builds/42", server.URL)))
+		})
+
+		It("rejects the build on behalf of the approver", func() {
+			pageobjects.NewShowBuildPage(page).Reject("bob")
+
+			Eventually(jobService.ApproveCallCount).Should(Equal(1))
+			_, _, approval := jobService.ApproveArgsForCall(0)
+			Expect(approval).To(Equal(jobs.Approval{Approved: false, Approver: "bob"}))
+		})
+
+		Context("when the build cannot be decided", func() {
+			It("shows the error page", func() {
+				jobService.ApproveReturns(errors.New("build 42 of job some-id is not awaiting approval"))
+				pageobjects.NewShowBuildPage(page).Approve("alice")
+				Eventually(page.Find(".errorTrace")).Should(HaveText("build 42 of job some-id is not awaiting approval"))
+			})
+		})
+	})
+
+	Describe("triggering a build", func() {
+		It("starts a build that is filtered by the job's paths", func() {
+			jobService.TriggerJobReturns(7, nil)
+			resp, err := http.Post(fmt.Sprintf("%s/jobs/some-id/trigger", server.URL), "", nil)
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			Expect(resp.Header.Get("Location")).To(Equal("/jobs/some-id/builds/7"))
+			Expect(jobService.TriggerJobArgsForCall(0)).To(Equal("some-id"))
+			Expect(jobService.RunJobCallCount()).To(Equal(0))
+		})
+
+		Context("when the build cannot be started", func() {
+			It("responds with the error", func() {
+				jobService.TriggerJobReturns(0, errors.New("shutting down"))
+				resp, err := http.Post(fmt.Sprintf("%s/jobs/some-id/trigger", server.URL), "", nil)
+				Expect(err).NotTo(HaveOccurred())
+				defer resp.Body.Close()
+				Expect(resp.StatusCode).To(Equal(http.StatusInternalServerError))
+			})
+		})
+	})
+
 	Describe("job output", func() {
 		Context("when the job is finished", func() {
 			It("displays the output", func() {
@@ -120,6 +691,7 @@ var _ = Describe("Handlers", func() {
 					Eventually(page.Find("#jobTitle")).Should(HaveText("Woodhouse"))
 					Eventually(page.Find("#jobOutput")).Should(HaveText("boom!"))
 					Eventually(page.Find("#jobResult")).Should(HaveText("Success"))
+					Expect(page.Find("#buildRevisions")).NotTo(BeFound())
 
 					Expect(jobService.FindBuildCallCount()).To(Equal(1))
 					jobId, buildNumber := jobService.FindBuildArgsForCall(0)
@@ -129,6 +701,199 @@ var _ = Describe("Handlers", func() {
 			})
 		})
 
+		Context("when the build fetched inputs", func() {
+			It("displays the revision of each", func() {
+				jobService.FindBuildReturns(jobs.Build{
+					Job:       jobs.Job{Name: "Woodhouse", Repository: "app.git"},
+					Finished:  true,
+					Revisions: []jobs.Revision{{Revision: "abc123"}, {Input: "lib", Revision: "def456"}},
+				}, nil)
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/woodhouse-id/builds/1", server.URL))).To(Succeed())
+				Eventually(page.Find("#buildRevisions")).Should(MatchText(`app.git\s+abc123`))
+				Expect(page.Find("#buildRevisions")).To(MatchText(`lib\s+def456`))
+			})
+		})
+
+		Context("when the build is of a pull request", func() {
+			It("says so", func() {
+				jobService.FindBuildReturns(jobs.Build{
+					Job:      jobs.Job{Name: "Woodhouse"},
+					Variant:  "pull request #12",
+					Finished: true,
+				}, nil)
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/woodhouse-id/builds/1", server.URL))).To(Succeed())
+				Eventually(page.Find("#buildVariant")).Should(HaveText("Build of pull request #12"))
+			})
+		})
+
+		Context("when the build was retried", func() {
+			BeforeEach(func() {
+				jobService.FindBuildReturns(jobs.Build{
+					Job:      jobs.Job{ID: "woodhouse-id", Name: "Woodhouse", Retry: jobs.RetryPolicy{MaxAttempts: 3}},
+					Finished: true,
+					Attempts: []jobs.Build{
+						{Finished: true, ExitStatus: 1},
+						{Finished: true},
+					},
+				}, nil)
+				jobService.FindAttemptReturns(jobs.Build{Output: []byte("flaked")}, nil)
+			})
+
+			It("shows each attempt", func() {
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/woodhouse-id/builds/1", server.URL))).To(Succeed())
+				Eventually(page.Find("#buildAttempt")).Should(HaveText("Attempt 2 of 3"))
+				Expect(page.Find("#attempt-1")).To(MatchText("Attempt 1\\s+Failure: exit status 1"))
+				Expect(page.Find("#attempt-2 a")).To(HaveAttribute("href", fmt.Sprintf("%s/jobs/woodhouse-id/builds/1/attempts/2", server.URL)))
+			})
+
+			It("serves the output of each attempt", func() {
+				resp, err := http.Get(fmt.Sprintf("%s/jobs/woodhouse-id/builds/1/attempts/1", server.URL))
+				Expect(err).NotTo(HaveOccurred())
+				defer resp.Body.Close()
+				Expect(ioutil.ReadAll(resp.Body)).To(Equal([]byte("flaked")))
+
+				jobID, buildNumber, attemptNumber := jobService.FindAttemptArgsForCall(0)
+				Expect(jobID).To(Equal("woodhouse-id"))
+				Expect(buildNumber).To(Equal(1))
+				Expect(attemptNumber).To(Equal(1))
+			})
+		})
+
+		Context("when the build was decided", func() {
+			It("shows who approved it", func() {
+				at := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+				jobService.FindBuildReturns(jobs.Build{
+					Job:      jobs.Job{ID: "woodhouse-id", Name: "Woodhouse"},
+					Approval: &jobs.Approval{Approved: true, Approver: "alice", At: at},
+					Finished: true,
+				}, nil)
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/woodhouse-id/builds/1", server.URL))).To(Succeed())
+				Eventually(page.Find("#buildApproval")).Should(HaveText("Approved by alice at Mon, 19 Oct 2026 12:00:00 UTC"))
+				Expect(page.Find("#approval")).NotTo(BeFound())
+			})
+		})
+
+		Context("when the build is a rebuild", func() {
+			It("links to the build it rebuilt", func() {
+				jobService.FindBuildReturns(jobs.Build{
+					Job:       jobs.Job{ID: "woodhouse-id", Name: "Woodhouse"},
+					Variant:   "rebuild of #42",
+					RebuildOf: 42,
+					Finished:  true,
+				}, nil)
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/woodhouse-id/builds/43", server.URL))).To(Succeed())
+				Eventually(page.Find("#buildVariant")).Should(HaveText("Rebuild of #42"))
+				Expect(page.Find("#buildVariant a")).To(HaveAttribute("href", fmt.Sprintf("%s/jobs/woodhouse-id/builds/42", server.URL)))
+			})
+		})
+
+		Context("when the build kept artifacts", func() {
+			var artifactsDir string
+
+			BeforeEach(func() {
+				var err error
+				artifactsDir, err = ioutil.TempDir("", "web-artifacts")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(os.MkdirAll(filepath.Join(artifactsDir, "dist"), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(artifactsDir, "dist", "app"), []byte("binary"), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(artifactsDir, "secret"), []byte("not an artifact"), 0644)).To(Succeed())
+
+				jobService.FindBuildReturns(jobs.Build{
+					Job:          jobs.Job{ID: "woodhouse-id", Name: "Woodhouse"},
+					Finished:     true,
+					ArtifactsDir: artifactsDir,
+					Artifacts:    []string{"dist/app"},
+				}, nil)
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(artifactsDir)).To(Succeed())
+			})
+
+			It("links to them", func() {
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/woodhouse-id/builds/1", server.URL))).To(Succeed())
+				Eventually(page.Find("#buildArtifacts")).Should(HaveText("dist/app"))
+				Expect(page.Find("#buildArtifacts a")).To(HaveAttribute("href", fmt.Sprintf("%s/jobs/woodhouse-id/builds/1/artifacts/dist/app", server.URL)))
+			})
+
+			It("serves them", func() {
+				resp, err := http.Get(fmt.Sprintf("%s/jobs/woodhouse-id/builds/1/artifacts/dist/app", server.URL))
+				Expect(err).NotTo(HaveOccurred())
+				defer resp.Body.Close()
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+				Expect(ioutil.ReadAll(resp.Body)).To(Equal([]byte("binary")))
+			})
+
+			It("does not serve other files", func() {
+				for _, path := range []string{"secret", "dist/../secret", "dist"} {
+					resp, err := http.Get(fmt.Sprintf("%s/jobs/woodhouse-id/builds/1/artifacts/%s", server.URL, path))
+					Expect(err).NotTo(HaveOccurred())
+					resp.Body.Close()
+					Expect(resp.StatusCode).NotTo(Equal(http.StatusOK))
+				}
+			})
+		})
+
+		Context("when the build had service containers", func() {
+			BeforeEach(func() {
+				jobService.FindBuildReturns(jobs.Build{
+					Job:      jobs.Job{ID: "woodhouse-id", Name: "Woodhouse"},
+					Finished: true,
+					Output:   []byte("running tests"),
+					ServiceLogs: []jobs.ServiceLog{
+						{Name: "postgres", Output: []byte("ready to accept <connections>")},
+						{Name: "redis", Output: []byte("Ready to accept connections")},
+					},
+				}, nil)
+			})
+
+			It("shows the log of each service apart from the build's output", func() {
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/woodhouse-id/builds/1", server.URL))).To(Succeed())
+				Eventually(page.Find("#jobOutput")).Should(HaveText("running tests"))
+				Expect(page.Find("#serviceLog-postgres")).To(HaveText("ready to accept <connections>"))
+				Expect(page.Find("#serviceLog-redis")).To(HaveText("Ready to accept connections"))
+			})
+		})
+
+		Context("when the build is of a matrix", func() {
+			BeforeEach(func() {
+				jobService.FindBuildReturns(jobs.Build{
+					Job:        jobs.Job{ID: "woodhouse-id", Name: "Woodhouse"},
+					Finished:   true,
+					ExitStatus: 1,
+					Cells: []jobs.Build{
+						{Variant: "golang:1.21", Finished: true},
+						{Variant: "golang:1.22", Finished: true, ExitStatus: 1, AllowFailure: true},
+					},
+				}, nil)
+			})
+
+			It("shows the status of each cell", func() {
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/woodhouse-id/builds/1", server.URL))).To(Succeed())
+				Eventually(page.Find("#cell-1")).Should(MatchText(`golang:1.21\s+Success`))
+				Expect(page.Find("#cell-2")).To(MatchText(`golang:1.22\s+Failure.*allowed to fail`))
+			})
+
+			It("shows the output of a cell", func() {
+				jobService.FindCellReturns(jobs.Build{
+					Job:      jobs.Job{ID: "woodhouse-id", Name: "Woodhouse"},
+					Variant:  "golang:1.21",
+					Output:   []byte("ok ./..."),
+					Finished: true,
+				}, nil)
+
+				Expect(page.Navigate(fmt.Sprintf("%s/jobs/woodhouse-id/builds/1", server.URL))).To(Succeed())
+				Expect(page.Find("#cell-1 a").Click()).To(Succeed())
+				Eventually(page.Find("#cellName")).Should(MatchText("golang:1.21, in build 1"))
+				Expect(page.Find("#jobOutput")).To(HaveText("ok ./..."))
+
+				jobID, buildNumber, cellNumber := jobService.FindCellArgsForCall(0)
+				Expect(jobID).To(Equal("woodhouse-id"))
+				Expect(buildNumber).To(Equal(1))
+				Expect(cellNumber).To(Equal(1))
+			})
+		})
+
 		Context("when the job is not finished", func() {
 			It("displays the output with pending status", func() {
 				By("retrieving the build output", func() {
@@ -171,4 +936,133 @@ var _ = Describe("Handlers", func() {
 			Expect(jobService.HighestBuildArgsForCall(0)).To(Equal("job-id"))
 		})
 	})
+
+	Describe("locks", func() {
+		BeforeEach(func() {
+			jobService.LocksReturns([]jobs.LockStatus{{
+				Name:    "staging",
+				Slots:   1,
+				Holders: []jobs.LockHolder{{JobID: "deploy-api", BuildNumber: 3, Since: time.Now()}},
+				Waiting: []jobs.LockHolder{{JobID: "deploy-web", BuildNumber: 7}},
+			}})
+		})
+
+		It("lists who holds and waits for each lock", func() {
+			Expect(page.Navigate(fmt.Sprintf("%s/locks", server.URL))).To(Succeed())
+			Eventually(page.Find("#lock-staging")).Should(MatchText("1 of 1"))
+			Expect(page.Find("#lock-staging .lock-holder a")).To(HaveText("deploy-api #3"))
+			Expect(page.Find("#lock-staging .lock-holder a")).To(HaveAttribute("href", fmt.Sprintf("%s/jobs/deploy-api/builds/3", server.URL)))
+			Expect(page.Find("#lock-staging .lock-waiting")).To(HaveText("deploy-web #7"))
+		})
+
+		It("force releases a lock", func() {
+			Expect(page.Navigate(fmt.Sprintf("%s/locks", server.URL))).To(Succeed())
+			Expect(page.Find("#lock-staging .lock-holder button").Click()).To(Succeed())
+			Eventually(jobService.ReleaseLockCallCount).Should(Equal(1))
+			name, jobID, buildNumber := jobService.ReleaseLockArgsForCall(0)
+			Expect(name).To(Equal("staging"))
+			Expect(jobID).To(Equal("deploy-api"))
+			Expect(buildNumber).To(Equal(3))
+			Eventually(page).Should(HaveURL(fmt.Sprintf("%s/locks", server.URL)))
+		})
+	})
+
+	Describe("build agents", func() {
+		BeforeEach(func() {
+			agentService.AgentsReturns([]agents.Agent{
+				{ID: "agent-1", Name: "builder", Labels: []string{"linux"}, LastSeen: time.Now(), Builds: []string{"some-build"}},
+			})
+		})
+
+		It("lists the agents", func() {
+			Expect(page.Navigate(fmt.Sprintf("%s/agents", server.URL))).To(Succeed())
+			Eventually(page.Find("#agent-agent-1")).Should(MatchText("builder"))
+			Expect(page.Find("#agent-agent-1 .agent-state")).To(HaveText("Busy"))
+		})
+
+		It("drains an agent", func() {
+			Expect(page.Navigate(fmt.Sprintf("%s/agents", server.URL))).To(Succeed())
+			Expect(page.Find("#agent-agent-1 button").Click()).To(Succeed())
+			Eventually(agentService.SetDisabledCallCount).Should(Equal(1))
+			agentID, disabled := agentService.SetDisabledArgsForCall(0)
+			Expect(agentID).To(Equal("agent-1"))
+			Expect(disabled).To(BeTrue())
+		})
+
+		It("rotates the registration token", func() {
+			Expect(page.Navigate(fmt.Sprintf("%s/agents", server.URL))).To(Succeed())
+			Expect(page.Find("#rotateToken").Click()).To(Succeed())
+			Eventually(page.Find("#tokenRotated")).Should(BeFound())
+			Expect(agentService.RotateRegistrationTokenCallCount()).To(Equal(1))
+		})
+
+		It("serves the agent API separately from the UI", func() {
+			resp, err := http.Get(fmt.Sprintf("%s/agent-api/agents", server.URL))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusTeapot))
+		})
+	})
+
+	Describe("pipelines", func() {
+		It("shows each job after the jobs it waits for", func() {
+			jobService.AllLatestBuildsReturns([]jobs.Build{
+				{Job: jobs.Job{ID: "deploy-id", Name: "deploy", Upstream: []string{"build-id", "test-id"}}},
+				{Job: jobs.Job{ID: "build-id", Name: "build"}, Finished: true},
+				{Job: jobs.Job{ID: "test-id", Name: "test"}, Finished: true, ExitStatus: 1},
+			}, nil)
+
+			Expect(page.Navigate(fmt.Sprintf("%s/pipelines", server.URL))).To(Succeed())
+			Eventually(page.Find("#pipeline-deploy-id")).Should(MatchText("after build, test"))
+			Expect(page.All(".pipeline-stage").At(0).Find("#pipeline-build-id")).To(HaveAttribute("class", "pipeline-job passing"))
+			Expect(page.All(".pipeline-stage").At(0).Find("#pipeline-test-id")).To(HaveAttribute("class", "pipeline-job failing"))
+			Expect(page.All(".pipeline-stage").At(1).Find("#pipeline-deploy-id")).To(BeFound())
+		})
+	})
+
+	It("serves webhooks separately from the UI", func() {
+		resp, err := http.Post(fmt.Sprintf("%s/hooks/github/jobs/some-id", server.URL), "application/json", strings.NewReader("{}"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusAccepted))
+	})
+
+	Describe("git credentials", func() {
+		It("lists the credentials", func() {
+			Expect(page.Navigate(fmt.Sprintf("%s/credentials", server.URL))).To(Succeed())
+			Eventually(page.Find("#credential-deploy-key")).Should(MatchText("ssh"))
+		})
+
+		It("saves a credential", func() {
+			Expect(page.Navigate(fmt.Sprintf("%s/credentials", server.URL))).To(Succeed())
+			Expect(page.Find("#credentialName").Fill("token")).To(Succeed())
+			Expect(page.Find("#credentialType").Select("HTTPS username and token")).To(Succeed())
+			Expect(page.Find("#username").Fill("woodhouse")).To(Succeed())
+			Expect(page.Find("#secret").Fill("s3cret")).To(Succeed())
+			Expect(page.Find("#saveCredential").Click()).To(Succeed())
+
+			Eventually(credentialService.SaveCallCount).Should(Equal(1))
+			Expect(credentialService.SaveArgsForCall(0)).To(Equal(&jobs.GitCredential{
+				Name:     "token",
+				Type:     jobs.CredentialHTTPS,
+				Username: "woodhouse",
+				Secret:   "s3cret",
+			}))
+		})
+
+		It("deletes a credential", func() {
+			Expect(page.Navigate(fmt.Sprintf("%s/credentials", server.URL))).To(Succeed())
+			Expect(page.Find("#credential-deploy-key button").Click()).To(Succeed())
+			Eventually(credentialService.DeleteCallCount).Should(Equal(1))
+			Expect(credentialService.DeleteArgsForCall(0)).To(Equal("deploy-key"))
+		})
+
+		Context("when saving the credential fails", func() {
+			It("shows the error page", func() {
+				credentialService.SaveReturns(errors.New("needs known_hosts"))
+				Expect(page.Navigate(fmt.Sprintf("%s/credentials", server.URL))).To(Succeed())
+				Expect(page.Find("#credentialName").Fill("deploy-key")).To(Succeed())
+				Expect(page.Find("#saveCredential").Click()).To(Succeed())
+				Eventually(page.Find(".errorTrace")).Should(HaveText("needs known_hosts"))
+			})
+		})
+	})
 })
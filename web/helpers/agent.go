@@ -0,0 +1,15 @@
+package helpers
+
+import "github.com/craigfurman/woodhouse-ci/agents"
+
+func AgentState(agent agents.Agent) string {
+	switch {
+	case agent.Disabled && len(agent.Builds) > 0:
+		return "Draining"
+	case agent.Disabled:
+		return "Disabled"
+	case len(agent.Builds) > 0:
+		return "Busy"
+	}
+	return "Idle"
+}
@@ -0,0 +1,29 @@
+package helpers_test
+
+import (
+	"github.com/craigfurman/woodhouse-ci/agents"
+	"github.com/craigfurman/woodhouse-ci/web/helpers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Agent view helpers", func() {
+	Describe("agent state", func() {
+		It("returns idle when the agent has nothing to do", func() {
+			Expect(helpers.AgentState(agents.Agent{})).To(Equal("Idle"))
+		})
+
+		It("returns busy when the agent is running builds", func() {
+			Expect(helpers.AgentState(agents.Agent{Builds: []string{"a"}})).To(Equal("Busy"))
+		})
+
+		It("returns draining when a disabled agent is still running builds", func() {
+			Expect(helpers.AgentState(agents.Agent{Disabled: true, Builds: []string{"a"}})).To(Equal("Draining"))
+		})
+
+		It("returns disabled when a disabled agent has finished its builds", func() {
+			Expect(helpers.AgentState(agents.Agent{Disabled: true})).To(Equal("Disabled"))
+		})
+	})
+})
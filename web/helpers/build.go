@@ -13,12 +13,40 @@ func SanitisedHTML(raw []byte) template.HTML {
 }
 
 func Message(build jobs.Build) string {
+	if !build.Finished && build.AwaitingApproval {
+		return "Awaiting approval"
+	}
+	if !build.Finished && build.WaitingForLock != "" {
+		return "Waiting for lock " + build.WaitingForLock
+	}
 	if !build.Finished {
 		return "Running"
 	}
 	if build.ExitStatus == 0 {
 		return "Success"
 	}
+	switch build.ExitStatus {
+	case jobs.StatusAborted:
+		return "Aborted"
+	case jobs.StatusFetchFailed:
+		return "Error: could not fetch source"
+	case jobs.StatusImagePullFailed:
+		return "Error: could not pull docker image"
+	case jobs.StatusImageBuildFailed:
+		return "Error: could not build docker image"
+	case jobs.StatusContainerFailed:
+		return "Error: could not run container"
+	case jobs.StatusTimedOut:
+		return "Timed out"
+	case jobs.StatusAgentLost:
+		return "Error: build agent stopped responding"
+	case jobs.StatusSkipped:
+		return "Skipped: no relevant changes"
+	case jobs.StatusNotApproved:
+		return "Not approved"
+	case jobs.StatusSuperseded:
+		return "Superseded by a newer build"
+	}
 	return fmt.Sprintf("Failure: exit status %d", build.ExitStatus)
 }
 
@@ -29,6 +57,8 @@ func Classes(build jobs.Build) string {
 
 	if build.ExitStatus == 0 {
 		return "passing"
+	} else if build.ExitStatus == jobs.StatusSkipped || build.ExitStatus == jobs.StatusSuperseded {
+		return "skipped"
 	} else {
 		return "failing"
 	}
@@ -36,6 +36,60 @@ var _ = Describe("Build view helpers", func() {
 			})).To(Equal("Failure: exit status 42"))
 		})
 
+		It("returns aborted when Woodhouse stopped the build", func() {
+			Expect(helpers.Message(jobs.Build{
+				Finished:   true,
+				ExitStatus: jobs.StatusAborted,
+			})).To(Equal("Aborted"))
+		})
+
+		It("returns an error message when the build failed because of infrastructure", func() {
+			Expect(helpers.Message(jobs.Build{
+				Finished:   true,
+				ExitStatus: jobs.StatusImagePullFailed,
+			})).To(Equal("Error: could not pull docker image"))
+		})
+
+		It("returns an error message when the job's image could not be built", func() {
+			Expect(helpers.Message(jobs.Build{
+				Finished:   true,
+				ExitStatus: jobs.StatusImageBuildFailed,
+			})).To(Equal("Error: could not build docker image"))
+		})
+
+		It("returns skipped when nothing relevant changed", func() {
+			Expect(helpers.Message(jobs.Build{
+				Finished:   true,
+				ExitStatus: jobs.StatusSkipped,
+			})).To(Equal("Skipped: no relevant changes"))
+		})
+
+		It("returns not approved when the build was rejected", func() {
+			Expect(helpers.Message(jobs.Build{
+				Finished:   true,
+				ExitStatus: jobs.StatusNotApproved,
+			})).To(Equal("Not approved"))
+		})
+
+		It("returns superseded when a newer build stopped the build", func() {
+			Expect(helpers.Message(jobs.Build{
+				Finished:   true,
+				ExitStatus: jobs.StatusSuperseded,
+			})).To(Equal("Superseded by a newer build"))
+		})
+
+		It("returns waiting for lock when the build cannot run until it holds a lock", func() {
+			Expect(helpers.Message(jobs.Build{
+				WaitingForLock: "staging",
+			})).To(Equal("Waiting for lock staging"))
+		})
+
+		It("returns awaiting approval when the build is paused until it is approved", func() {
+			Expect(helpers.Message(jobs.Build{
+				AwaitingApproval: true,
+			})).To(Equal("Awaiting approval"))
+		})
+
 		It("returns running when the build is not finished", func() {
 			Expect(helpers.Message(jobs.Build{
 				Finished: false,
@@ -82,5 +136,25 @@ var _ = Describe("Build view helpers", func() {
 				Expect(classes).To(Equal("failing"))
 			})
 		})
+
+		Context("when the build was skipped", func() {
+			BeforeEach(func() {
+				b = jobs.Build{Finished: true, ExitStatus: jobs.StatusSkipped}
+			})
+
+			It("is neither passing nor failing", func() {
+				Expect(classes).To(Equal("skipped"))
+			})
+		})
+
+		Context("when the build was superseded", func() {
+			BeforeEach(func() {
+				b = jobs.Build{Finished: true, ExitStatus: jobs.StatusSuperseded}
+			})
+
+			It("is neither passing nor failing", func() {
+				Expect(classes).To(Equal("skipped"))
+			})
+		})
 	})
 })
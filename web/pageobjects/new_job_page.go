@@ -14,12 +14,117 @@ func NewNewJobPage(page *agouti.Page) *NewJobPage {
 	return &NewJobPage{page: page}
 }
 
-func (p *NewJobPage) CreateJob(name, cmd, dockerImage, gitRepo string) *ShowBuildPage {
+func (p *NewJobPage) CreateJob(name, cmd, dockerImage, repository string) *ShowBuildPage {
 	Expect(p.page.Find("form input#name").Fill(name)).To(Succeed())
 	Expect(p.page.Find("form input#command").Fill(cmd)).To(Succeed())
 	Expect(p.page.Find("form input#dockerImage").Fill(dockerImage)).To(Succeed())
-	Expect(p.page.Find("form input#gitRepo").Fill(gitRepo)).To(Succeed())
+	Expect(p.page.Find("form input#repository").Fill(repository)).To(Succeed())
 	Expect(p.page.Find("form button[type=submit]").Click()).To(Succeed())
 	Eventually(p.page.Find("#jobTitle")).Should(HaveText(name))
 	return NewShowBuildPage(p.page)
 }
+
+func (p *NewJobPage) CreateLocalJob(name, cmd, repository string) *ShowBuildPage {
+	Expect(p.page.Find("form select#runnerType").Select("Woodhouse host (no isolation)")).To(Succeed())
+	return p.CreateJob(name, cmd, "", repository)
+}
+
+func (p *NewJobPage) CreateAgentJob(name, cmd, dockerImage, repository, agentLabels string) *ShowBuildPage {
+	Expect(p.page.Find("form select#runnerType").Select("Build agent")).To(Succeed())
+	Expect(p.page.Find("form input#agentLabels").Fill(agentLabels)).To(Succeed())
+	return p.CreateJob(name, cmd, dockerImage, repository)
+}
+
+func (p *NewJobPage) SetInputs(ref, inputs string) *NewJobPage {
+	Expect(p.page.Find("form input#ref").Fill(ref)).To(Succeed())
+	Expect(p.page.Find("form textarea#inputs").Fill(inputs)).To(Succeed())
+	return p
+}
+
+func (p *NewJobPage) SetMatrix(images, env, allowedFailures string) *NewJobPage {
+	Expect(p.page.Find("form textarea#matrixImages").Fill(images)).To(Succeed())
+	Expect(p.page.Find("form textarea#matrixEnv").Fill(env)).To(Succeed())
+	Expect(p.page.Find("form textarea#allowedFailures").Fill(allowedFailures)).To(Succeed())
+	return p
+}
+
+func (p *NewJobPage) SetPipeline(upstream []string, artifacts string) *NewJobPage {
+	for _, job := range upstream {
+		Expect(p.page.Find("form select#upstream").Select(job)).To(Succeed())
+	}
+	Expect(p.page.Find("form textarea#artifacts").Fill(artifacts)).To(Succeed())
+	return p
+}
+
+func (p *NewJobPage) SetParameters(parameters string) *NewJobPage {
+	Expect(p.page.Find("form textarea#parameters").Fill(parameters)).To(Succeed())
+	return p
+}
+
+func (p *NewJobPage) SetRetryPolicy(attempts, exitStatuses string, infrastructureErrors bool) *NewJobPage {
+	Expect(p.page.Find("form input#retryAttempts").Fill(attempts)).To(Succeed())
+	Expect(p.page.Find("form input#retryExitStatuses").Fill(exitStatuses)).To(Succeed())
+	if infrastructureErrors {
+		Expect(p.page.Find("form input#retryInfrastructure").Check()).To(Succeed())
+	}
+	return p
+}
+
+func (p *NewJobPage) LimitContainer(cpus, memory, pidsLimit string) *NewJobPage {
+	Expect(p.page.Find("form input#cpus").Fill(cpus)).To(Succeed())
+	Expect(p.page.Find("form input#memory").Fill(memory)).To(Succeed())
+	Expect(p.page.Find("form input#pidsLimit").Fill(pidsLimit)).To(Succeed())
+	return p
+}
+
+func (p *NewJobPage) SecureContainer(networkMode, user string) *NewJobPage {
+	Expect(p.page.Find("form select#networkMode").Select(networkMode)).To(Succeed())
+	Expect(p.page.Find("form input#containerUser").Fill(user)).To(Succeed())
+	Expect(p.page.Find("form input#readOnlyRootFilesystem").Check()).To(Succeed())
+	return p
+}
+
+func (p *NewJobPage) AllowHostAccess(volumes string) *NewJobPage {
+	Expect(p.page.Find("form input#privileged").Check()).To(Succeed())
+	Expect(p.page.Find("form textarea#volumes").Fill(volumes)).To(Succeed())
+	return p
+}
+
+func (p *NewJobPage) SetDockerfile(dockerfile string) *NewJobPage {
+	Expect(p.page.Find("form input#dockerfile").Fill(dockerfile)).To(Succeed())
+	return p
+}
+
+func (p *NewJobPage) SetServices(services string) *NewJobPage {
+	Expect(p.page.Find("form textarea#services").Fill(services)).To(Succeed())
+	return p
+}
+
+func (p *NewJobPage) SetCaches(caches string) *NewJobPage {
+	Expect(p.page.Find("form textarea#caches").Fill(caches)).To(Succeed())
+	return p
+}
+
+func (p *NewJobPage) SetLocks(locks string) *NewJobPage {
+	Expect(p.page.Find("form input#locks").Fill(locks)).To(Succeed())
+	return p
+}
+
+func (p *NewJobPage) SetConcurrency(concurrency string) *NewJobPage {
+	Expect(p.page.Find("form select#concurrency").Select(concurrency)).To(Succeed())
+	return p
+}
+
+func (p *NewJobPage) RequireApproval(timeout string) *NewJobPage {
+	Expect(p.page.Find("form input#requiresApproval").Check()).To(Succeed())
+	Expect(p.page.Find("form input#approvalTimeout").Fill(timeout)).To(Succeed())
+	return p
+}
+
+func (p *NewJobPage) SetCheckoutOptions(depth, submodules, sparsePaths string) *NewJobPage {
+	Expect(p.page.Find("form input#checkoutDepth").Fill(depth)).To(Succeed())
+	Expect(p.page.Find("form input#singleBranch").Check()).To(Succeed())
+	Expect(p.page.Find("form select#submodules").Select(submodules)).To(Succeed())
+	Expect(p.page.Find("form textarea#sparsePaths").Fill(sparsePaths)).To(Succeed())
+	return p
+}
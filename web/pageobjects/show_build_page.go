@@ -24,6 +24,31 @@ func (p *ShowBuildPage) ScheduleNewBuild() *ShowBuildPage {
 	return p
 }
 
+func (p *ShowBuildPage) Rebuild() *ShowBuildPage {
+	oldUrl, err := p.page.URL()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(p.page.Find("#rebuildBuild").Click()).To(Succeed())
+	Eventually(p.page).ShouldNot(HaveURL(oldUrl))
+	return p
+}
+
+func (p *ShowBuildPage) ClearCaches() *ShowBuildPage {
+	Expect(p.page.Find("#clearCachesButton").Click()).To(Succeed())
+	return p
+}
+
+func (p *ShowBuildPage) Approve(approver string) *ShowBuildPage {
+	Expect(p.page.Find("form#approval input#approver").Fill(approver)).To(Succeed())
+	Expect(p.page.Find("#approveBuild").Click()).To(Succeed())
+	return p
+}
+
+func (p *ShowBuildPage) Reject(approver string) *ShowBuildPage {
+	Expect(p.page.Find("form#approval input#approver").Fill(approver)).To(Succeed())
+	Expect(p.page.Find("#rejectBuild").Click()).To(Succeed())
+	return p
+}
+
 func (p *ShowBuildPage) GoToBuild(buildNumber int) *ShowBuildPage {
 	Expect(p.page.FindByLink(fmt.Sprintf("%d", buildNumber)).Click()).To(Succeed())
 	return p